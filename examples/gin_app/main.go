@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/appoptics/appoptics-apm-go/v1/contrib/aogin"
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,7 +13,7 @@ func main() {
 	router := gin.Default()
 
 	// add AppOptics middleware
-	router.Use(tracer())
+	router.Use(aogin.Middleware())
 
 	router.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "Hello from Gin")
@@ -4,6 +4,8 @@ package ao
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
 	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
@@ -15,33 +17,116 @@ var (
 	errInvalidLogLevel = errors.New("invalid log level")
 )
 
-// The `const` variable which should not be updated on runtime.
-// These variables are accessed by every request in the critical path, which
-// makes it too expensive to be protected by a mutex.
+// This flag indicates whether the agent is disabled, 1 if it's disabled.
 //
-// Do NOT modify it outside the init() function.
+// It is accessed by every request in the critical path, which makes it too
+// expensive to be protected by a mutex, so it's accessed atomically instead.
+// It is initialized when the package is imported and won't be changed in
+// runtime, except by Init.
+var disabled int32
+
 var (
-	// This flag indicates whether the agent is disabled.
-	//
-	// It is initialized when the package is imported and won't be changed
-	// in runtime.
-	disabled = false
+	// whether the agent has been initialized, either automatically when the
+	// package is imported or by Init, or lazily by the first trace.
+	initialized int32
+	// guards the initialization of the agent
+	initLock sync.Mutex
 )
 
 func init() {
 	initDisabled()
+	if !config.GetNoAutoInit() {
+		atomic.StoreInt32(&initialized, 1)
+	}
 }
 
 func initDisabled() {
-	disabled = config.GetDisabled()
-	if disabled {
+	if config.GetDisabled() {
+		atomic.StoreInt32(&disabled, 1)
 		aolog.Warningf("AppOptics agent is disabled.")
+	} else {
+		atomic.StoreInt32(&disabled, 0)
 	}
 }
 
+// Init initializes the agent with the configuration loaded from the environment
+// variables and customized by the options, e.g., WithServiceKey, and starts
+// reporting to the collector.
+//
+// The agent is initialized automatically when the package is imported, unless
+// the environment variable APPOPTICS_NO_AUTO_INIT is set to true. In that case
+// Init should be called before the agent is used, otherwise the agent is
+// initialized lazily by the first trace with the default configuration.
+//
+// Init can be called again to restart the agent after Shutdown, or to apply a
+// new configuration. It should not be called concurrently with the tracing
+// functions, e.g., it is best called in main() before serving any request.
+func Init(opts ...config.Option) error {
+	initLock.Lock()
+	defer initLock.Unlock()
+
+	level := config.GetDebugLevel()
+	config.Refresh(opts...)
+	if l := config.GetDebugLevel(); l != level {
+		SetLogLevel(l)
+	}
+	initDisabled()
+	loadCompiledConfigs()
+	err := reporter.Start()
+	atomic.StoreInt32(&initialized, 1)
+	return err
+}
+
+// lazyInit initializes the agent with the default configuration if it's not
+// initialized yet.
+func lazyInit() {
+	if atomic.LoadInt32(&initialized) == 1 {
+		return
+	}
+	initLock.Lock()
+	defer initLock.Unlock()
+
+	if atomic.LoadInt32(&initialized) == 1 {
+		return
+	}
+	// the flag is set after the reporter is started, so the callers which
+	// skip the lock don't see the reporter being replaced.
+	if err := reporter.Start(); err != nil {
+		aolog.Warningf("Failed to initialize the agent: %v", err)
+	}
+	atomic.StoreInt32(&initialized, 1)
+}
+
+// WithCollector returns an option of Init for the collector address.
+func WithCollector(collector string) config.Option {
+	return config.WithCollector(collector)
+}
+
+// WithServiceKey returns an option of Init for the service key, which is
+// defined as token:service_name.
+func WithServiceKey(key string) config.Option {
+	return config.WithServiceKey(key)
+}
+
+// WithTrustedPath returns an option of Init for the file path of the cert
+// file of the collector.
+func WithTrustedPath(path string) config.Option {
+	return config.WithTrustedPath(path)
+}
+
+// WithHostAlias returns an option of Init for the alias of the hostname.
+func WithHostAlias(alias string) config.Option {
+	return config.WithHostAlias(alias)
+}
+
+// WithDisabled returns an option of Init for whether the agent is disabled.
+func WithDisabled(disabled bool) config.Option {
+	return config.WithDisabled(disabled)
+}
+
 // Disabled indicates if the agent is disabled
 func Disabled() bool {
-	return disabled
+	return atomic.LoadInt32(&disabled) == 1
 }
 
 // WaitForReady checks if the agent is ready. It returns true is the agent is ready,
@@ -68,9 +153,10 @@ func Shutdown(ctx context.Context) error {
 }
 
 // Closed denotes if the agent is closed (by either calling Shutdown explicitly
-// or being triggered from some internal error).
+// or being triggered from some internal error). The agent is initialized by
+// the call if it's not initialized yet.
 func Closed() bool {
-	return reporter.Closed()
+	return defaultAgent.Closed()
 }
 
 // SetLogLevel changes the logging level of the AppOptics agent
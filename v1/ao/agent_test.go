@@ -4,10 +4,15 @@ package ao
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/appoptics/appoptics-apm-go/v1/ao/collectortest"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSetGetLogLevel(t *testing.T) {
@@ -33,3 +38,74 @@ func TestShutdown(t *testing.T) {
 	defer cancel()
 	assert.False(t, WaitForReady(ctx))
 }
+
+func TestInit(t *testing.T) {
+	server, err := collectortest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	// restore the configuration from the environment variables
+	defer Init()
+
+	opts := []config.Option{
+		WithCollector(server.Addr()),
+		WithTrustedPath(server.CertFile()),
+		WithServiceKey("ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:go"),
+	}
+	require.NoError(t, Init(opts...))
+	assert.False(t, Closed())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.True(t, WaitForReady(ctx))
+	assert.NotEmpty(t, server.WaitForStatus(1, 5*time.Second))
+
+	// restart after shutdown
+	require.NoError(t, Shutdown(ctx))
+	assert.True(t, Closed())
+	require.NoError(t, Init(opts...))
+	assert.False(t, Closed())
+	require.True(t, WaitForReady(ctx))
+	assert.Len(t, server.WaitForStatus(2, 5*time.Second), 2)
+
+	tr := NewTrace("init")
+	assert.True(t, tr.IsSampled())
+	tr.End()
+	assert.Len(t, server.WaitForEvents(2, 5*time.Second), 2)
+
+	require.NoError(t, Init(append(opts, WithDisabled(true))...))
+	assert.True(t, Disabled())
+	assert.False(t, NewTrace("init").IsSampled())
+	require.NoError(t, Init(opts...))
+	assert.False(t, Disabled())
+
+	// the service key is validated by the reporter
+	assert.Error(t, Init(WithServiceKey("invalid")))
+	assert.True(t, Closed())
+}
+
+func TestLazyInit(t *testing.T) {
+	server, err := collectortest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	defer Init()
+
+	require.NoError(t, Init(
+		WithCollector(server.Addr()),
+		WithTrustedPath(server.CertFile()),
+		WithServiceKey("ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:go")))
+	require.NoError(t, Shutdown(context.Background()))
+	atomic.StoreInt32(&initialized, 0)
+
+	// the first traces initialize the agent concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			NewTrace("lazy").End()
+			Closed()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&initialized))
+	assert.False(t, Closed())
+}
@@ -0,0 +1,229 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+	"github.com/pkg/errors"
+)
+
+// DefaultAgentName is the name of the default agent, which uses the service
+// key of the configuration and backs the package-level functions.
+const DefaultAgentName = "default"
+
+var (
+	errAgentExists = errors.New("agent already exists")
+	errNoAgentName = errors.New("agent name is empty")
+)
+
+var contextAgentKey = contextKeyT("github.com/appoptics/appoptics-apm-go/v1/ao.Agent")
+
+// Agent reports the traces and metrics of a logical service with its own
+// service key, connection to the collector, sampling settings and metrics.
+// A process can host multiple services by creating an agent for each of them
+// and selecting the agent of a request via the context, see WithAgent.
+type Agent struct {
+	name string
+	// nil for the default agent
+	agent *reporter.Agent
+}
+
+// the named agents created by NewAgent
+var agents = struct {
+	sync.RWMutex
+	m map[string]*Agent
+}{m: make(map[string]*Agent)}
+
+var defaultAgent = &Agent{name: DefaultAgentName}
+
+// NewAgent creates a named agent with the service key, which is defined as
+// token:service_name. It shares the other configuration, e.g., the collector
+// address, with the default agent.
+func NewAgent(name, serviceKey string) (*Agent, error) {
+	if name == "" {
+		return nil, errNoAgentName
+	}
+	agents.Lock()
+	defer agents.Unlock()
+	if _, ok := agents.m[name]; ok || name == DefaultAgentName {
+		return nil, errors.Wrap(errAgentExists, name)
+	}
+
+	ra, err := reporter.NewAgent(serviceKey)
+	if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+	a := &Agent{name: name, agent: ra}
+	agents.m[name] = a
+	return a, nil
+}
+
+// GetAgent returns the agent with the name, or nil if there is no such agent.
+func GetAgent(name string) *Agent {
+	if name == DefaultAgentName {
+		return defaultAgent
+	}
+	agents.RLock()
+	defer agents.RUnlock()
+	return agents.m[name]
+}
+
+// DefaultAgent returns the default agent.
+func DefaultAgent() *Agent {
+	return defaultAgent
+}
+
+// WithAgent returns a copy of the parent context which selects the agent for
+// the traces started from it, e.g., by HTTPHandler.
+func WithAgent(ctx context.Context, a *Agent) context.Context {
+	return context.WithValue(ctx, contextAgentKey, a)
+}
+
+// AgentFromContext returns the agent selected by the context, or the default
+// agent if there is none.
+func AgentFromContext(ctx context.Context) *Agent {
+	if ctx != nil {
+		if a, ok := ctx.Value(contextAgentKey).(*Agent); ok && a != nil {
+			return a
+		}
+	}
+	return defaultAgent
+}
+
+// Name returns the name of the agent.
+func (a *Agent) Name() string {
+	return a.name
+}
+
+// ServiceKey returns the service key of the agent.
+func (a *Agent) ServiceKey() string {
+	return a.agent.ServiceKey()
+}
+
+// NewTrace creates a new Trace reported by this agent, see the package-level
+// NewTrace.
+func (a *Agent) NewTrace(spanName string) Trace {
+	return a.NewTraceFromID(spanName, "", nil)
+}
+
+// NewTraceWithOptions creates a new trace reported by this agent with the
+// provided options.
+func (a *Agent) NewTraceWithOptions(spanName string, opts SpanOptions) Trace {
+	kvs := addKVsFromOpts(opts)
+	return a.NewTraceFromID(spanName, "", func() KVMap {
+		return fromKVs(kvs...)
+	})
+}
+
+// NewTraceFromID creates a new Trace reported by this agent, provided an
+// incoming trace ID, see the package-level NewTraceFromID.
+func (a *Agent) NewTraceFromID(spanName, mdStr string, cb func() KVMap) Trace {
+	return a.NewTraceFromSource(spanName, mdStr, TraceSource{}, cb)
+}
+
+// NewTraceFromSource creates a new Trace reported by this agent, provided an
+// incoming trace ID and its source, see the package-level NewTraceFromSource.
+func (a *Agent) NewTraceFromSource(spanName, mdStr string, src TraceSource, cb func() KVMap) Trace {
+	if mdStr != "" && !currentTraceTrust().trusts(mdStr, src.Signature, src.Peer, src.ForwardedFor...) {
+		aolog.Debugf("Ignored the untrusted %s from %s", HTTPHeaderName, src.Peer)
+		mdStr = ""
+	}
+	return a.newTraceFromID(spanName, mdStr, reporter.SampleBySettings, localSampleRateOf(spanName, nil), cb)
+}
+
+// newTraceFromID creates a new Trace reported by this agent, the sampling
+// decision is overridden by the override, and the sample rate is merged with
+// the local one of the sampling rules if it's not nil.
+func (a *Agent) newTraceFromID(spanName, mdStr string, override reporter.SamplingOverride,
+	local *reporter.LocalSampleRate, cb func() KVMap) Trace {
+	if Disabled() || a.Closed() {
+		return NewNullTrace()
+	}
+
+	ctx, ok := a.agent.NewContextWithOverride(spanName, mdStr, true, override, local, func() map[string]interface{} {
+		if cb != nil {
+			return cb()
+		}
+		return nil
+	})
+	if !ok {
+		return NewNullTrace()
+	}
+	t := &aoTrace{
+		layerSpan: layerSpan{span: span{aoCtx: ctx, labeler: spanLabeler{spanName}}},
+		agent:     a,
+	}
+	t.SetStartTime(time.Now())
+	return t
+}
+
+// newTriggeredTrace creates a new trigger trace reported by this agent, which
+// is sampled regardless of the sample rate. It returns the decision of the
+// trigger trace as well, e.g., reporter.TriggerTraceOK.
+func (a *Agent) newTriggeredTrace(spanName string, signed bool, cb func() KVMap) (Trace, string) {
+	if Disabled() || a.Closed() {
+		return NewNullTrace(), reporter.TriggerTraceTracingDisabled
+	}
+
+	ctx, ok, decision := a.agent.NewTriggeredContext(spanName, signed, true, func() map[string]interface{} {
+		if cb != nil {
+			return cb()
+		}
+		return nil
+	})
+	if !ok {
+		return NewNullTrace(), decision
+	}
+	t := &aoTrace{
+		layerSpan: layerSpan{span: span{aoCtx: ctx, labeler: spanLabeler{spanName}}},
+		agent:     a,
+	}
+	t.SetStartTime(time.Now())
+	return t, decision
+}
+
+// WaitForReady waits until the agent is ready or the context is canceled, see
+// the package-level WaitForReady.
+func (a *Agent) WaitForReady(ctx context.Context) bool {
+	if a.Closed() {
+		return false
+	}
+	return a.agent.WaitForReady(ctx)
+}
+
+// Shutdown flushes the metrics and stops the agent, see the package-level
+// Shutdown. A named agent is removed once it's shutdown, so its name can be
+// used to create a new one.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	if a.agent != nil {
+		agents.Lock()
+		if agents.m[a.name] == a {
+			delete(agents.m, a.name)
+		}
+		agents.Unlock()
+	}
+	return a.agent.Shutdown(ctx)
+}
+
+// Closed denotes if the agent is closed. The default agent is initialized by
+// the call if it's not initialized yet, see Init.
+func (a *Agent) Closed() bool {
+	if a.agent == nil {
+		lazyInit()
+	}
+	return a.agent.Closed()
+}
+
+// reportSpan aggregates the span message into the metrics of the agent. A
+// nil agent is the default one.
+func (a *Agent) reportSpan(span reporter.SpanMessage) error {
+	if a == nil {
+		return reporter.ReportSpan(span)
+	}
+	return a.agent.ReportSpan(span)
+}
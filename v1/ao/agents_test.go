@@ -0,0 +1,105 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/collectortest"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const otherServiceKey = "ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:other"
+
+func TestNewAgent(t *testing.T) {
+	_, err := ao.NewAgent("", otherServiceKey)
+	assert.Error(t, err)
+	_, err = ao.NewAgent(ao.DefaultAgentName, otherServiceKey)
+	assert.Error(t, err)
+	_, err = ao.NewAgent("invalid", "invalid")
+	assert.Error(t, err)
+	assert.Nil(t, ao.GetAgent("invalid"))
+
+	assert.Equal(t, ao.DefaultAgentName, ao.DefaultAgent().Name())
+	assert.Equal(t, ao.DefaultAgent(), ao.GetAgent(ao.DefaultAgentName))
+	assert.Equal(t, ao.DefaultAgent(), ao.AgentFromContext(context.Background()))
+	assert.Equal(t, ao.DefaultAgent(), ao.AgentFromContext(nil))
+}
+
+func TestAgentWithMockCollector(t *testing.T) {
+	server, err := collectortest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	env := server.Env()
+	env["APPOPTICS_REPORTER"] = "ssl"
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+	config.Refresh()
+	defer config.Refresh()
+
+	a, err := ao.NewAgent("other", otherServiceKey)
+	require.NoError(t, err)
+	assert.Equal(t, a, ao.GetAgent("other"))
+	assert.Equal(t, otherServiceKey, a.ServiceKey())
+	_, err = ao.NewAgent("other", otherServiceKey)
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.True(t, a.WaitForReady(ctx))
+
+	// the agent is selected by the context of the request
+	h := ao.HTTPHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r := httptest.NewRequest("GET", "http://test.com/hello", nil)
+	r = r.WithContext(ao.WithAgent(r.Context(), a))
+	assert.Equal(t, a, ao.AgentFromContext(r.Context()))
+	w := httptest.NewRecorder()
+	h(w, r)
+	assert.NotEmpty(t, w.Header().Get("X-Trace"))
+
+	events := server.WaitForEvents(2, 5*time.Second)
+	require.Len(t, events, 2)
+	assert.Equal(t, "/hello", events[0]["URL"])
+
+	// the diagnostics of the agent are selected by name
+	d := a.Diagnostics()
+	assert.Equal(t, "other", d.Agent)
+	assert.Equal(t, "ssl", d.Reporter)
+	assert.True(t, d.Ready)
+	assert.Equal(t, int64(1), d.RateCounts.Requested)
+	w = httptest.NewRecorder()
+	ao.DiagnosticsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/appoptics?agent=other", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var snapshot ao.DiagnosticsSnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshot))
+	assert.Equal(t, "other", snapshot.Agent)
+	assert.Equal(t, "ssl", snapshot.Reporter)
+	for _, req := range server.Requests() {
+		assert.Equal(t, otherServiceKey, req.APIKey)
+	}
+
+	require.NoError(t, a.Shutdown(ctx))
+	assert.True(t, a.Closed())
+	assert.Nil(t, ao.GetAgent("other"))
+	// no trace is started by a closed agent
+	assert.False(t, a.NewTrace("other").IsSampled())
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aotest
+
+import (
+	"fmt"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/graphtest"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The labels of events
+const (
+	LabelEntry        = "entry"
+	LabelExit         = "exit"
+	LabelInfo         = "info"
+	LabelError        = "error"
+	LabelProfileEntry = "profile_entry"
+	LabelProfileExit  = "profile_exit"
+)
+
+// the length of the hex encoded X-Trace header and its fields
+const (
+	xTraceLen    = 60
+	taskIDOffset = 2
+	opIDOffset   = 42
+	flagsOffset  = 58
+)
+
+// Event is a decoded event.
+type Event struct {
+	Layer string
+	Label string
+	// The X-Trace header of the event and its task and op IDs
+	XTrace string
+	TaskID string
+	OpID   string
+	// The op IDs of the events this event points to. The edge to the
+	// previous event of the same context comes last.
+	Edges []string
+	// The timestamp in microseconds
+	Timestamp int64
+	// All the KVs of the event, including the ones above
+	KVs map[string]interface{}
+}
+
+// DecodeEvent decodes a BSON encoded event.
+func DecodeEvent(buf []byte) (Event, error) {
+	var d bson.D
+	if err := bson.Unmarshal(buf, &d); err != nil {
+		return Event{}, err
+	}
+	e := Event{KVs: make(map[string]interface{})}
+	for _, kv := range d {
+		switch kv.Name {
+		case "Edge":
+			edge, _ := kv.Value.(string)
+			e.Edges = append(e.Edges, edge)
+			continue
+		case "Layer":
+			e.Layer, _ = kv.Value.(string)
+		case "Label":
+			e.Label, _ = kv.Value.(string)
+		case "X-Trace":
+			e.XTrace, _ = kv.Value.(string)
+			if len(e.XTrace) != xTraceLen {
+				return Event{}, fmt.Errorf("invalid X-Trace %q", e.XTrace)
+			}
+			e.TaskID = e.XTrace[taskIDOffset:opIDOffset]
+			e.OpID = e.XTrace[opIDOffset:flagsOffset]
+		case "Timestamp_u":
+			e.Timestamp, _ = kv.Value.(int64)
+		}
+		e.KVs[kv.Name] = kv.Value
+	}
+	if e.XTrace == "" {
+		return Event{}, fmt.Errorf("event %s:%s has no X-Trace", e.Layer, e.Label)
+	}
+	return e, nil
+}
+
+// DecodeEvents decodes a list of BSON encoded events.
+func DecodeEvents(bufs [][]byte) ([]Event, error) {
+	var events []Event
+	for i, buf := range bufs {
+		e, err := DecodeEvent(buf)
+		if err != nil {
+			return nil, fmt.Errorf("event #%d: %v", i, err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// String returns the layer, label and op ID of the event.
+func (e Event) String() string {
+	return fmt.Sprintf("%s:%s(%s)", e.Layer, e.Label, e.OpID)
+}
+
+// isEntry returns whether the event starts a span or a profile.
+func (e Event) isEntry() bool {
+	return e.Label == LabelEntry || e.Label == LabelProfileEntry
+}
+
+// isExit returns whether the event ends a span or a profile.
+func (e Event) isExit() bool {
+	return e.Label == LabelExit || e.Label == LabelProfileExit
+}
+
+// node converts the event for the graphtest package.
+func (e Event) node() graphtest.Node {
+	n := graphtest.Node{
+		Layer: e.Layer,
+		Label: e.Label,
+		OpID:  e.OpID,
+		Edges: e.Edges,
+		Map:   make(map[string]interface{}),
+	}
+	for k, v := range e.KVs {
+		n.Map[k] = v
+	}
+	return n
+}
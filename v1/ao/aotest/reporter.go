@@ -0,0 +1,83 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package aotest provides helpers for application tests to assert the traces
+// reported by the instrumented code. It replaces the agent's reporter with an
+// in-memory one, decodes the reported events and offers a fluent API to
+// assert the tree of spans:
+//
+//	r := aotest.NewReporter()
+//	handler.ServeHTTP(w, req)
+//	r.Close(0)
+//
+//	tr := r.Trace(t)
+//	tr.AssertTree()
+//	tr.Span("my-service").Child("postgres").HasKV("Query", "SELECT 1")
+//
+// Set the AOTEST_DOT_DIR environment variable to save the graphviz dot file of
+// the traces which fail the assertions into that directory.
+package aotest
+
+import (
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+	"github.com/stretchr/testify/assert"
+)
+
+// Option configures the test reporter.
+type Option reporter.TestReporterOption
+
+// WithTimeout sets how long the reporter waits for the expected number of
+// events when it's closed.
+func WithTimeout(timeout time.Duration) Option {
+	return Option(reporter.TestReporterTimeout(timeout))
+}
+
+// WithTracingDisabled makes the agent decide not to trace any request.
+func WithTracingDisabled() Option {
+	return Option(reporter.TestReporterDisableTracing())
+}
+
+// WithoutDefaultSetting leaves the agent without a sampling setting, as if
+// it hasn't got one from the collector yet.
+func WithoutDefaultSetting() Option {
+	return Option(reporter.TestReporterDisableDefaultSetting(true))
+}
+
+// Reporter captures the events reported by the agent in memory. Only one
+// Reporter can be in use at a time.
+type Reporter struct {
+	r *reporter.TestReporter
+}
+
+// NewReporter replaces the agent's reporter with an in-memory one which
+// samples all the requests by default. The agent's reporter is restored when
+// the returned Reporter is closed.
+func NewReporter(opts ...Option) *Reporter {
+	var options []reporter.TestReporterOption
+	for _, o := range opts {
+		options = append(options, reporter.TestReporterOption(o))
+	}
+	return &Reporter{r: reporter.SetTestReporter(options...)}
+}
+
+// Close waits until at least numEvents events are reported or the timeout
+// expires, then stops capturing events. The events reported synchronously
+// before Close are always captured, so 0 can be passed if the instrumented
+// code doesn't report events from other goroutines.
+func (r *Reporter) Close(numEvents int) {
+	r.r.Close(numEvents)
+}
+
+// Events decodes the events captured. It must be called after Close.
+func (r *Reporter) Events() ([]Event, error) {
+	return DecodeEvents(r.r.EventBufs)
+}
+
+// Trace decodes the events captured and returns them as a trace to make
+// assertions about. It must be called after Close.
+func (r *Reporter) Trace(t assert.TestingT) *Trace {
+	events, err := r.Events()
+	assert.NoError(t, err, "failed to decode the events")
+	return NewTrace(t, events)
+}
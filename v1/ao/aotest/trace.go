@@ -0,0 +1,415 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aotest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/graphtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// the environment variable of the directory to save the dot files of the
+// failed traces
+const envDotDir = "AOTEST_DOT_DIR"
+
+// the KVs of the error events
+const (
+	keyErrorClass = "ErrorClass"
+	keyErrorMsg   = "ErrorMsg"
+)
+
+type tHelper interface {
+	Helper()
+}
+
+// Trace is a list of events with the tree of spans rebuilt from their edges.
+// The assertions report failures to the test and return the receiver or the
+// span found, so they can be chained.
+type Trace struct {
+	t      assert.TestingT
+	Events []Event
+	// The spans which have no parent in the trace. A well-formed trace has
+	// only one root.
+	Roots []*Span
+
+	byOpID map[string]*Event
+	spanOf map[string]*Span
+	// the problems found when rebuilding the spans
+	problems []string
+	// the dot file saved for the failures of this trace
+	dotFile string
+}
+
+// Span is a span or a profile rebuilt from its events.
+type Span struct {
+	// The layer of the span, or the profile name of a profile
+	Name  string
+	Entry *Event
+	// The exit event, nil if the span hasn't ended
+	Exit *Event
+	// The info and error events in the order of reporting
+	Events   []*Event
+	Parent   *Span
+	Children []*Span
+
+	trace *Trace
+	// whether it's a placeholder returned when the span isn't found
+	missing bool
+}
+
+// NewTrace rebuilds the spans from the events, the assertions are reported
+// to t.
+func NewTrace(t assert.TestingT, events []Event) *Trace {
+	tr := &Trace{
+		t:      t,
+		Events: events,
+		byOpID: make(map[string]*Event),
+		spanOf: make(map[string]*Span),
+	}
+	for i := range tr.Events {
+		e := &tr.Events[i]
+		if _, ok := tr.byOpID[e.OpID]; ok {
+			tr.problems = append(tr.problems, fmt.Sprintf("duplicate op ID of event %v", e))
+		}
+		tr.byOpID[e.OpID] = e
+	}
+	for i := range tr.Events {
+		tr.resolve(&tr.Events[i], make(map[string]bool))
+	}
+	return tr
+}
+
+// resolve returns the span of the event. An entry event starts a new span,
+// the other events belong to the span of the event their context edge, which
+// is the last one, points to.
+func (tr *Trace) resolve(e *Event, visiting map[string]bool) *Span {
+	if s, ok := tr.spanOf[e.OpID]; ok {
+		return s
+	}
+	if visiting[e.OpID] {
+		tr.problems = append(tr.problems, fmt.Sprintf("edges form a cycle at event %v", e))
+		return nil
+	}
+	visiting[e.OpID] = true
+
+	var prev *Span
+	if n := len(e.Edges); n > 0 {
+		if p, ok := tr.byOpID[e.Edges[n-1]]; ok {
+			prev = tr.resolve(p, visiting)
+		}
+	}
+
+	var s *Span
+	switch {
+	case e.isEntry():
+		s = &Span{Name: e.Layer, Entry: e, Parent: prev, trace: tr}
+		if s.Name == "" {
+			s.Name, _ = e.KVs["ProfileName"].(string)
+		}
+		if prev != nil {
+			prev.Children = append(prev.Children, s)
+		} else {
+			tr.Roots = append(tr.Roots, s)
+		}
+	case prev == nil:
+		tr.problems = append(tr.problems, fmt.Sprintf("event %v is not linked to a span", e))
+	case e.isExit():
+		s = prev
+		if s.Exit != nil {
+			tr.problems = append(tr.problems, fmt.Sprintf("span %s has multiple exits", s.Name))
+		}
+		s.Exit = e
+	default:
+		s = prev
+		s.Events = append(s.Events, e)
+	}
+	tr.spanOf[e.OpID] = s
+	return s
+}
+
+// Spans returns all the spans in depth-first order.
+func (tr *Trace) Spans() []*Span {
+	var spans []*Span
+	var walk func(s *Span)
+	walk = func(s *Span) {
+		spans = append(spans, s)
+		for _, c := range s.Children {
+			walk(c)
+		}
+	}
+	for _, r := range tr.Roots {
+		walk(r)
+	}
+	return spans
+}
+
+// Span returns the first span with the name in depth-first order. The
+// failure is reported if there is no such span.
+func (tr *Trace) Span(name string) *Span {
+	if h, ok := tr.t.(tHelper); ok {
+		h.Helper()
+	}
+	for _, s := range tr.Spans() {
+		if s.Name == name {
+			return s
+		}
+	}
+	tr.fail("span %s not found", name)
+	return &Span{Name: name, trace: tr, missing: true}
+}
+
+// AssertTree asserts the trace is well-formed: all the events belong to the
+// same task, there is only one root span, all the spans have ended, and all
+// the edges point to the events in the trace except the ones of the root
+// entry, which may continue a trace from another process.
+func (tr *Trace) AssertTree() *Trace {
+	if h, ok := tr.t.(tHelper); ok {
+		h.Helper()
+	}
+	problems := append([]string(nil), tr.problems...)
+	if len(tr.Events) == 0 {
+		problems = append(problems, "no events")
+	}
+	for _, e := range tr.Events {
+		if e.TaskID != tr.Events[0].TaskID {
+			problems = append(problems, fmt.Sprintf("event %v has a different task ID", e))
+		}
+		if s := tr.spanOf[e.OpID]; s != nil && s.Parent == nil && s.Entry.OpID == e.OpID {
+			continue
+		}
+		for _, edge := range e.Edges {
+			if _, ok := tr.byOpID[edge]; !ok {
+				problems = append(problems, fmt.Sprintf("edge of event %v points to unknown op %s", e, edge))
+			}
+		}
+	}
+	if len(tr.Roots) > 1 {
+		problems = append(problems, fmt.Sprintf("%d root spans", len(tr.Roots)))
+	}
+	for _, s := range tr.Spans() {
+		if s.Exit == nil {
+			problems = append(problems, fmt.Sprintf("span %s has not ended", s.Name))
+		}
+	}
+	if len(problems) > 0 {
+		tr.fail("the trace is not a tree:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return tr
+}
+
+// HasError asserts that an error is reported in the trace.
+func (tr *Trace) HasError() *Trace {
+	if h, ok := tr.t.(tHelper); ok {
+		h.Helper()
+	}
+	for _, e := range tr.Events {
+		if e.Label == LabelError {
+			return tr
+		}
+	}
+	tr.fail("no error is reported")
+	return tr
+}
+
+// NoError asserts that no error is reported in the trace.
+func (tr *Trace) NoError() *Trace {
+	if h, ok := tr.t.(tHelper); ok {
+		h.Helper()
+	}
+	for _, e := range tr.Events {
+		if e.Label == LabelError {
+			tr.fail("error is reported: %v %v", e.KVs[keyErrorClass], e.KVs[keyErrorMsg])
+		}
+	}
+	return tr
+}
+
+// WriteDOT writes the trace as a graphviz dot file.
+func (tr *Trace) WriteDOT(w io.Writer) {
+	var nodes []graphtest.Node
+	for _, e := range tr.Events {
+		nodes = append(nodes, e.node())
+	}
+	graphtest.WriteDOT(w, nodes...)
+}
+
+// String returns the tree of spans with their events.
+func (tr *Trace) String() string {
+	var buf bytes.Buffer
+	var walk func(s *Span, depth int)
+	walk = func(s *Span, depth int) {
+		fmt.Fprintf(&buf, "%s%s:", strings.Repeat("  ", depth), s.Name)
+		for _, e := range s.events() {
+			fmt.Fprintf(&buf, " %s", e.Label)
+		}
+		buf.WriteString("\n")
+		for _, c := range s.Children {
+			walk(c, depth+1)
+		}
+	}
+	for _, r := range tr.Roots {
+		walk(r, 0)
+	}
+	return buf.String()
+}
+
+// fail reports the failure with the tree of spans. The dot file of the trace
+// is saved if the AOTEST_DOT_DIR environment variable is set.
+func (tr *Trace) fail(format string, args ...interface{}) {
+	if h, ok := tr.t.(tHelper); ok {
+		h.Helper()
+	}
+	msg := fmt.Sprintf(format, args...) + "\ntrace:\n" + tr.String()
+	if dir := os.Getenv(envDotDir); dir != "" && tr.dotFile == "" {
+		if f, err := ioutil.TempFile(dir, "aotest-trace-"); err == nil {
+			tr.WriteDOT(f)
+			f.Close()
+			tr.dotFile = f.Name()
+		}
+	}
+	if tr.dotFile != "" {
+		msg += "dot file: " + tr.dotFile
+	}
+	assert.Fail(tr.t, msg)
+}
+
+// events returns all the events of the span in order.
+func (s *Span) events() []*Event {
+	var events []*Event
+	if s.Entry != nil {
+		events = append(events, s.Entry)
+	}
+	events = append(events, s.Events...)
+	if s.Exit != nil {
+		events = append(events, s.Exit)
+	}
+	return events
+}
+
+// KV returns the value of the key in the events of the span, the value of
+// the later event wins.
+func (s *Span) KV(key string) (interface{}, bool) {
+	var value interface{}
+	var found bool
+	for _, e := range s.events() {
+		if v, ok := e.KVs[key]; ok {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+// Child returns the first child span with the name. The failure is reported
+// if there is no such child.
+func (s *Span) Child(name string) *Span {
+	if h, ok := s.trace.t.(tHelper); ok {
+		h.Helper()
+	}
+	if s.missing {
+		return &Span{Name: name, trace: s.trace, missing: true}
+	}
+	for _, c := range s.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	s.trace.fail("span %s has no child %s", s.Name, name)
+	return &Span{Name: name, trace: s.trace, missing: true}
+}
+
+// HasChild asserts the span has a child span with the name.
+func (s *Span) HasChild(name string) *Span {
+	if h, ok := s.trace.t.(tHelper); ok {
+		h.Helper()
+	}
+	s.Child(name)
+	return s
+}
+
+// HasKV asserts one of the events of the span has the KV. The values are
+// compared after converting to the same type, e.g., 200 equals int64(200).
+func (s *Span) HasKV(key string, value interface{}) *Span {
+	if h, ok := s.trace.t.(tHelper); ok {
+		h.Helper()
+	}
+	if s.missing {
+		return s
+	}
+	var values []interface{}
+	for _, e := range s.events() {
+		if v, ok := e.KVs[key]; ok {
+			if assert.ObjectsAreEqualValues(value, v) {
+				return s
+			}
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		s.trace.fail("span %s has no KV %s", s.Name, key)
+	} else {
+		s.trace.fail("span %s has KV %s=%v, expected %v", s.Name, key, values, value)
+	}
+	return s
+}
+
+// HasKey asserts one of the events of the span has the key.
+func (s *Span) HasKey(key string) *Span {
+	if h, ok := s.trace.t.(tHelper); ok {
+		h.Helper()
+	}
+	if s.missing {
+		return s
+	}
+	if _, ok := s.KV(key); !ok {
+		s.trace.fail("span %s has no KV %s", s.Name, key)
+	}
+	return s
+}
+
+// HasError asserts an error is reported in the span. The error message is
+// checked too if msg is not empty.
+func (s *Span) HasError(msg string) *Span {
+	if h, ok := s.trace.t.(tHelper); ok {
+		h.Helper()
+	}
+	if s.missing {
+		return s
+	}
+	var msgs []interface{}
+	for _, e := range s.Events {
+		if e.Label == LabelError {
+			if msg == "" || e.KVs[keyErrorMsg] == msg {
+				return s
+			}
+			msgs = append(msgs, e.KVs[keyErrorMsg])
+		}
+	}
+	if len(msgs) == 0 {
+		s.trace.fail("span %s has no error", s.Name)
+	} else {
+		s.trace.fail("span %s has errors %v, expected %s", s.Name, msgs, msg)
+	}
+	return s
+}
+
+// NoError asserts no error is reported in the span.
+func (s *Span) NoError() *Span {
+	if h, ok := s.trace.t.(tHelper); ok {
+		h.Helper()
+	}
+	if s.missing {
+		return s
+	}
+	for _, e := range s.Events {
+		if e.Label == LabelError {
+			s.trace.fail("span %s has error %v", s.Name, e.KVs[keyErrorMsg])
+		}
+	}
+	return s
+}
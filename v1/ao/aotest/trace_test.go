@@ -0,0 +1,157 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aotest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockT records the failures instead of failing the test.
+type mockT struct {
+	errors []string
+}
+
+func (t *mockT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func traceSomething() {
+	ctx := ao.NewContext(context.Background(), ao.NewTrace("web"))
+	db, dbCtx := ao.BeginSpan(ctx, "db", "Query", "SELECT 1", "Rows", 5)
+	db.Err(errors.New("oops"))
+	cache, _ := ao.BeginSpan(dbCtx, "cache")
+	cache.End()
+	db.End()
+	p := ao.BeginProfile(ctx, "render")
+	p.End()
+	ao.EndTrace(ctx)
+}
+
+func TestTraceAssertions(t *testing.T) {
+	r := aotest.NewReporter()
+	traceSomething()
+	r.Close(9)
+
+	events, err := r.Events()
+	require.NoError(t, err)
+	require.Len(t, events, 9)
+	assert.Equal(t, "web", events[0].Layer)
+	assert.Equal(t, aotest.LabelEntry, events[0].Label)
+	assert.Empty(t, events[0].Edges)
+	assert.Len(t, events[0].TaskID, 40)
+	assert.Len(t, events[0].OpID, 16)
+	assert.NotZero(t, events[0].Timestamp)
+
+	tr := r.Trace(t)
+	tr.AssertTree().HasError()
+	require.Len(t, tr.Roots, 1)
+	assert.Len(t, tr.Spans(), 4)
+
+	web := tr.Span("web").NoError().HasChild("db").HasChild("render")
+	assert.Nil(t, web.Parent)
+	web.Child("db").
+		HasKV("Query", "SELECT 1").
+		HasKV("Rows", 5).
+		HasKey("Rows").
+		HasError("oops").
+		HasError("").
+		Child("cache").NoError()
+	assert.Equal(t, web, tr.Span("cache").Parent.Parent)
+	v, ok := tr.Span("db").KV("Query")
+	assert.True(t, ok)
+	assert.Equal(t, "SELECT 1", v)
+
+	assert.Equal(t, "web: entry exit\n  db: entry error exit\n    cache: entry exit\n  render: profile_entry profile_exit\n",
+		tr.String())
+
+	var buf bytes.Buffer
+	tr.WriteDOT(&buf)
+	assert.Contains(t, buf.String(), "digraph main{")
+	assert.Contains(t, buf.String(), "db: entry")
+}
+
+func TestTraceAssertionFailures(t *testing.T) {
+	r := aotest.NewReporter()
+	traceSomething()
+	r.Close(9)
+	events, err := r.Events()
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "aotest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Setenv("AOTEST_DOT_DIR", dir)
+	defer os.Unsetenv("AOTEST_DOT_DIR")
+
+	mt := &mockT{}
+	tr := aotest.NewTrace(mt, events)
+	tr.NoError()
+	tr.Span("web").HasError("").HasKV("Query", "x")
+	tr.Span("db").HasKV("Query", "SELECT 2").HasError("other").HasKey("none")
+	// the assertions on a missing span are ignored
+	tr.Span("none").Child("none").HasKV("a", "b")
+	tr.Span("web").Child("cache")
+	require.Len(t, mt.errors, 8)
+	assert.Contains(t, mt.errors[0], "error is reported")
+	assert.Contains(t, mt.errors[1], "span web has no error")
+	assert.Contains(t, mt.errors[2], "span web has no KV Query")
+	assert.Contains(t, mt.errors[3], "span db has KV Query=[SELECT 1], expected SELECT 2")
+	assert.Contains(t, mt.errors[4], "span db has errors [oops], expected other")
+	assert.Contains(t, mt.errors[5], "span db has no KV none")
+	assert.Contains(t, mt.errors[6], "span none not found")
+	assert.Contains(t, mt.errors[7], "span web has no child cache")
+	assert.Contains(t, mt.errors[7], "web: entry exit\n")
+
+	// the dot file is saved once for the trace
+	files, err := filepath.Glob(filepath.Join(dir, "aotest-trace-*"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Contains(t, mt.errors[0], files[0])
+
+	// the trace without the root exit and with an event of another trace
+	other := aotest.NewReporter()
+	traceSomething()
+	other.Close(9)
+	otherEvents, err := other.Events()
+	require.NoError(t, err)
+
+	mt = &mockT{}
+	aotest.NewTrace(mt, append(events[:len(events)-1], otherEvents[0])).AssertTree()
+	require.Len(t, mt.errors, 1)
+	assert.Contains(t, mt.errors[0], "has a different task ID")
+	assert.Contains(t, mt.errors[0], "2 root spans")
+	assert.Contains(t, mt.errors[0], "span web has not ended")
+
+	mt = &mockT{}
+	aotest.NewTrace(mt, nil).AssertTree()
+	require.Len(t, mt.errors, 1)
+	assert.Contains(t, mt.errors[0], "no events")
+}
+
+func TestTracingDisabled(t *testing.T) {
+	r := aotest.NewReporter(aotest.WithTracingDisabled())
+	traceSomething()
+	r.Close(0)
+	events, err := r.Events()
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestDecodeEvent(t *testing.T) {
+	_, err := aotest.DecodeEvent([]byte("invalid"))
+	assert.Error(t, err)
+	_, err = aotest.DecodeEvents([][]byte{{5, 0, 0, 0, 0}})
+	assert.EqualError(t, err, "event #0: event : has no X-Trace")
+}
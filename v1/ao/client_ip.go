@@ -0,0 +1,163 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+)
+
+// clientIPResolver is the compiled client IP resolution of the configuration.
+type clientIPResolver struct {
+	headers    []string
+	proxies    []*net.IPNet
+	proxyCount int
+	metricsTag bool
+}
+
+// the compiled client IP resolution, it's a *clientIPResolver.
+var clientIPConf atomic.Value
+
+func init() {
+	registerCompiledConfig(loadClientIPResolver, "ClientIPHeaders", "TrustedProxies",
+		"TrustedProxyCount", "ClientIPMetricsTag")
+}
+
+// loadClientIPResolver compiles the client IP resolution of the configuration.
+func loadClientIPResolver() {
+	r := &clientIPResolver{
+		proxyCount: config.GetTrustedProxyCount(),
+		metricsTag: config.GetClientIPMetricsTag(),
+	}
+	for _, h := range config.GetClientIPHeaders() {
+		h = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(h))
+		switch h {
+		case config.ClientIPHeaderXForwardedFor, config.ClientIPHeaderXRealIP, config.ClientIPHeaderForwarded:
+			r.headers = append(r.headers, h)
+		default:
+			aolog.Warningf("Ignored the client IP header: %q", h)
+		}
+	}
+	for _, p := range config.GetTrustedProxies() {
+		n, err := config.ParseIPNet(p)
+		if err != nil {
+			aolog.Warningf("Ignored the trusted proxy: %v", err)
+			continue
+		}
+		r.proxies = append(r.proxies, n)
+	}
+	if r.proxyCount < 0 {
+		r.proxyCount = 0
+	}
+	if len(r.headers) > 0 && len(r.proxies) == 0 && r.proxyCount == 0 {
+		aolog.Warning("The client IP headers are ignored as there is no trusted proxy.")
+	}
+	clientIPConf.Store(r)
+}
+
+// currentClientIPResolver returns the compiled client IP resolution.
+func currentClientIPResolver() *clientIPResolver {
+	r, _ := clientIPConf.Load().(*clientIPResolver)
+	if r == nil {
+		return &clientIPResolver{}
+	}
+	return r
+}
+
+// enabled returns whether the client IP is resolved.
+func (c *clientIPResolver) enabled() bool {
+	return len(c.headers) > 0
+}
+
+// resolve returns the client IP of the request. The addresses of the first
+// configured header which is present, followed by the remote address, form
+// the chain of the proxies. The client is the rightmost address which is not a
+// trusted proxy, or the one in front of the trusted proxies by count. The
+// remote address is returned if no header is present, there is no trusted
+// proxy, or the client is not a valid IP address, e.g., "unknown".
+func (c *clientIPResolver) resolve(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	var chain []string
+	for _, h := range c.headers {
+		if chain = headerAddrs(h, r.Header); len(chain) > 0 {
+			break
+		}
+	}
+	if len(chain) == 0 {
+		return remote
+	}
+	chain = append(chain, remote)
+
+	i := len(chain) - 1 - c.proxyCount
+	if len(c.proxies) > 0 {
+		for i = len(chain) - 1; i > 0; i-- {
+			if ip := net.ParseIP(chain[i]); ip == nil || !c.isTrustedProxy(ip) {
+				break
+			}
+		}
+	}
+	if i < 0 {
+		i = 0
+	}
+	// the obfuscated or invalid addresses are not reported
+	if net.ParseIP(chain[i]) == nil {
+		return remote
+	}
+	return chain[i]
+}
+
+func (c *clientIPResolver) isTrustedProxy(ip net.IP) bool {
+	for _, n := range c.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerAddrs returns the addresses of the header from the client to the
+// last proxy. The ports, brackets and quotes are removed.
+func headerAddrs(name string, h http.Header) []string {
+	var addrs []string
+	for _, v := range h[name] {
+		for _, elem := range strings.Split(v, ",") {
+			addr := strings.TrimSpace(elem)
+			if name == config.ClientIPHeaderForwarded {
+				addr = forwardedFor(elem)
+			}
+			if addr != "" {
+				addrs = append(addrs, stripPort(addr))
+			}
+		}
+	}
+	return addrs
+}
+
+// forwardedFor returns the "for" parameter of an element of the Forwarded
+// header (RFC 7239), e.g., `for="[2001:db8::1]:4711";proto=https`.
+func forwardedFor(elem string) string {
+	for _, pair := range strings.Split(elem, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+			return strings.Trim(kv[1], `"`)
+		}
+	}
+	return ""
+}
+
+// stripPort removes the port and the brackets of an IPv6 address.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
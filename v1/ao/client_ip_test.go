@@ -0,0 +1,71 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	defer UpdateConfig(WithClientIPHeaders(), WithTrustedProxies(), WithTrustedProxyCount(0),
+		WithClientIPMetricsTag(false))
+
+	newReq := func(remote string, headers ...string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Add(headers[i], headers[i+1])
+		}
+		return r
+	}
+
+	// not enabled by default
+	assert.False(t, currentClientIPResolver().enabled())
+	assert.Equal(t, "10.0.0.1", currentClientIPResolver().resolve(
+		newReq("10.0.0.1:1234", "X-Forwarded-For", "1.2.3.4")))
+
+	// no trusted proxy: the headers may be spoofed
+	require.NoError(t, UpdateConfig(WithClientIPHeaders(ClientIPHeaderXForwardedFor)))
+	cr := currentClientIPResolver()
+	assert.True(t, cr.enabled())
+	assert.Equal(t, "10.0.0.1", cr.resolve(newReq("10.0.0.1:1234", "X-Forwarded-For", "1.2.3.4")))
+
+	// trusted by count
+	require.NoError(t, UpdateConfig(WithTrustedProxyCount(1)))
+	cr = currentClientIPResolver()
+	assert.Equal(t, "1.2.3.4", cr.resolve(newReq("10.0.0.1:1234", "X-Forwarded-For", "1.2.3.4")))
+	assert.Equal(t, "5.6.7.8", cr.resolve(newReq("10.0.0.1:1234", "X-Forwarded-For", "9.9.9.9, 5.6.7.8")))
+	assert.Equal(t, "5.6.7.8", cr.resolve(newReq("10.0.0.1:1234",
+		"X-Forwarded-For", "9.9.9.9", "X-Forwarded-For", "5.6.7.8")))
+	assert.Equal(t, "10.0.0.1", cr.resolve(newReq("10.0.0.1:1234")))
+	assert.Equal(t, "10.0.0.1", cr.resolve(newReq("10.0.0.1:1234", "X-Forwarded-For", "unknown")))
+	require.NoError(t, UpdateConfig(WithTrustedProxyCount(5)))
+	assert.Equal(t, "9.9.9.9", currentClientIPResolver().resolve(
+		newReq("10.0.0.1:1234", "X-Forwarded-For", "9.9.9.9, 5.6.7.8")))
+
+	// trusted by CIDRs, which take precedence over the count
+	require.NoError(t, UpdateConfig(WithTrustedProxies("10.0.0.0/8", "192.168.1.1")))
+	cr = currentClientIPResolver()
+	assert.Equal(t, "5.6.7.8", cr.resolve(newReq("10.0.0.1:1234",
+		"X-Forwarded-For", "9.9.9.9, 5.6.7.8, 192.168.1.1, 10.1.1.1")))
+	// the spoofed address on the left is not reported
+	assert.Equal(t, "5.6.7.8", cr.resolve(newReq("10.0.0.1:1234", "X-Forwarded-For", "10.2.2.2, 5.6.7.8")))
+	assert.Equal(t, "10.2.2.2", cr.resolve(newReq("10.0.0.1:1234", "X-Forwarded-For", "10.2.2.2")))
+	// the remote address is not a trusted proxy
+	assert.Equal(t, "8.8.8.8", cr.resolve(newReq("8.8.8.8:1234", "X-Forwarded-For", "1.2.3.4")))
+
+	// X-Real-IP and Forwarded in the order of preference
+	require.NoError(t, UpdateConfig(WithClientIPHeaders(ClientIPHeaderForwarded, ClientIPHeaderXRealIP)))
+	cr = currentClientIPResolver()
+	assert.Equal(t, "1.2.3.4", cr.resolve(newReq("10.0.0.1:1234", "X-Real-IP", "1.2.3.4")))
+	assert.Equal(t, "2001:db8::1", cr.resolve(newReq("10.0.0.1:1234",
+		"X-Real-IP", "1.2.3.4", "Forwarded", `for="[2001:db8::1]:4711";proto=https, for=10.3.3.3`)))
+	assert.Equal(t, "1.2.3.4", cr.resolve(newReq("10.0.0.1:1234", "Forwarded", "For=1.2.3.4:80")))
+	assert.Equal(t, "10.0.0.1", cr.resolve(newReq("10.0.0.1:1234", "Forwarded", "for=_hidden")))
+	assert.Equal(t, "10.0.0.1", cr.resolve(newReq("10.0.0.1:1234", "Forwarded", "proto=https")))
+}
@@ -33,9 +33,10 @@ func BeginCacheSpan(ctx context.Context, spanName, op, key, remoteHost string, h
 // latency heatmaps and charts by span name and URL endpoint. For requests using the "net/http"
 // package, BeginHTTPClientSpan also reports this metadata, while also propagating trace context
 // metadata headers via http.Request and http.Response.
+// The URL is redacted by the configuration, see RedactURL.
 // Call or defer the returned Span's End() to time the call's client-side latency.
 func BeginRemoteURLSpan(ctx context.Context, spanName, remoteURL string, args ...interface{}) Span {
-	rsKVs := []interface{}{"Spec", "rsc", "IsService", true, "RemoteURL", remoteURL}
+	rsKVs := []interface{}{"Spec", "rsc", "IsService", true, "RemoteURL", RedactURL(remoteURL)}
 	kvs := mergeKVs(rsKVs, args)
 	l, _ := BeginSpan(ctx, spanName, kvs...)
 	return l
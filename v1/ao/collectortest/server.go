@@ -0,0 +1,441 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package collectortest provides an in-process AppOptics collector for
+// integration tests. It runs a real gRPC server with a generated TLS
+// certificate, returns programmable sampling settings, captures the decoded
+// events, metrics and status messages, and can inject faults to test how the
+// agent behaves when the collector is unhealthy.
+//
+// Point the agent to the server by setting the environment variables returned
+// by Env before the agent is initialized:
+//
+//	s, err := collectortest.NewServer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//	for k, v := range s.Env() {
+//		os.Setenv(k, v)
+//	}
+package collectortest
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter/collector"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Method is the name of an RPC method of the collector service.
+type Method string
+
+// The RPC methods of the collector service
+const (
+	PostEvents  Method = "PostEvents"
+	PostMetrics Method = "PostMetrics"
+	PostStatus  Method = "PostStatus"
+	GetSettings Method = "GetSettings"
+	Ping        Method = "Ping"
+	// AnyMethod matches all the methods when injecting faults.
+	AnyMethod Method = "*"
+)
+
+// ResultCode is the result code returned by the collector.
+type ResultCode int32
+
+// The result codes of the collector
+const (
+	OK            = ResultCode(collector.ResultCode_OK)
+	TryLater      = ResultCode(collector.ResultCode_TRY_LATER)
+	InvalidAPIKey = ResultCode(collector.ResultCode_INVALID_API_KEY)
+	LimitExceeded = ResultCode(collector.ResultCode_LIMIT_EXCEEDED)
+	Redirect      = ResultCode(collector.ResultCode_REDIRECT)
+)
+
+// Fault defines how the server misbehaves for a method.
+type Fault struct {
+	// The result code returned instead of OK
+	Result ResultCode
+	// The address returned with the Redirect result. It defaults to the
+	// address of the server itself.
+	RedirectTo string
+	// The delay before responding
+	Latency time.Duration
+	// The number of calls the fault applies to, 0 means until it's cleared.
+	Times int
+}
+
+// Setting is a sampling setting returned by GetSettings.
+type Setting struct {
+	// The layer of the setting, empty for the default setting
+	Layer string
+	// The comma separated flags, e.g., SAMPLE_START,SAMPLE_THROUGH_ALWAYS
+	Flags string
+	// The sample rate, 1000000 means 100%
+	Value int64
+	// The TTL in seconds
+	TTL            int64
+	BucketCapacity float64
+	BucketRate     float64
+	// The optional metrics flush interval in seconds and the maximum number
+	// of transactions, 0 means not set.
+	MetricsFlushInterval int32
+	MaxTransactions      int32
+}
+
+// DefaultSetting samples all the requests.
+var DefaultSetting = Setting{
+	Flags:          "SAMPLE_START,SAMPLE_THROUGH_ALWAYS",
+	Value:          1000000,
+	TTL:            120,
+	BucketCapacity: 1000000,
+	BucketRate:     1000000,
+}
+
+// Message is a BSON message decoded as a map.
+type Message map[string]interface{}
+
+// Request is an RPC call received by the server.
+type Request struct {
+	Method   Method
+	APIKey   string
+	Messages []Message
+	// The result code returned for this call
+	Result ResultCode
+	Time   time.Time
+}
+
+// Server is an in-process collector.
+type Server struct {
+	addr       string
+	certPEM    []byte
+	certFile   string
+	listener   net.Listener
+	grpcServer *grpc.Server
+
+	lock     sync.Mutex
+	settings []Setting
+	faults   map[Method]*Fault
+	requests []Request
+	events   []Message
+	metrics  []Message
+	status   []Message
+}
+
+// NewServer starts a collector listening on a random port of localhost.
+func NewServer() (*Server, error) {
+	cert, certPEM, err := generateCert()
+	if err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile("", "collectortest")
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(certPEM)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+
+	s := &Server{
+		addr:     net.JoinHostPort("localhost", port),
+		certPEM:  certPEM,
+		certFile: f.Name(),
+		listener: lis,
+		settings: []Setting{DefaultSetting},
+		faults:   make(map[Method]*Fault),
+	}
+	creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})
+	s.grpcServer = grpc.NewServer(grpc.Creds(creds))
+	collector.RegisterTraceCollectorServer(s.grpcServer, s)
+	go s.grpcServer.Serve(lis)
+	return s, nil
+}
+
+// Addr returns the address of the server in the form of host:port.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// CertPEM returns the PEM encoded certificate of the server.
+func (s *Server) CertPEM() []byte {
+	return s.certPEM
+}
+
+// CertFile returns the path of the file which contains the certificate.
+func (s *Server) CertFile() string {
+	return s.certFile
+}
+
+// Env returns the environment variables to point the agent to this server.
+func (s *Server) Env() map[string]string {
+	return map[string]string{
+		"APPOPTICS_COLLECTOR":   s.addr,
+		"APPOPTICS_TRUSTEDPATH": s.certFile,
+	}
+}
+
+// Close stops the server and removes the certificate file.
+func (s *Server) Close() {
+	s.grpcServer.Stop()
+	os.Remove(s.certFile)
+}
+
+// SetSettings replaces the settings returned by GetSettings. No settings are
+// returned if it's called without arguments.
+func (s *Server) SetSettings(settings ...Setting) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.settings = append([]Setting(nil), settings...)
+}
+
+// InjectFault makes the method misbehave, it replaces the fault injected for
+// the same method before. The fault of a method takes precedence over the
+// one of AnyMethod.
+func (s *Server) InjectFault(m Method, f Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults[m] = &f
+}
+
+// ClearFaults removes all the faults injected.
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = make(map[Method]*Fault)
+}
+
+// Reset clears all the captured requests and messages.
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = nil
+	s.events = nil
+	s.metrics = nil
+	s.status = nil
+}
+
+// Requests returns all the RPC calls received, including the failed ones.
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Events returns the events accepted by the server.
+func (s *Server) Events() []Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Message(nil), s.events...)
+}
+
+// Metrics returns the metrics messages accepted by the server.
+func (s *Server) Metrics() []Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Message(nil), s.metrics...)
+}
+
+// Status returns the status messages accepted by the server.
+func (s *Server) Status() []Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Message(nil), s.status...)
+}
+
+// WaitForEvents waits until at least n events are accepted or timeout, and
+// returns the events.
+func (s *Server) WaitForEvents(n int, timeout time.Duration) []Message {
+	return waitFor(n, timeout, s.Events)
+}
+
+// WaitForMetrics waits until at least n metrics messages are accepted or
+// timeout, and returns the messages.
+func (s *Server) WaitForMetrics(n int, timeout time.Duration) []Message {
+	return waitFor(n, timeout, s.Metrics)
+}
+
+// WaitForStatus waits until at least n status messages are accepted or
+// timeout, and returns the messages.
+func (s *Server) WaitForStatus(n int, timeout time.Duration) []Message {
+	return waitFor(n, timeout, s.Status)
+}
+
+func waitFor(n int, timeout time.Duration, get func() []Message) []Message {
+	deadline := time.Now().Add(timeout)
+	for {
+		msgs := get()
+		if len(msgs) >= n || time.Now().After(deadline) {
+			return msgs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// fault returns the fault to apply to the method, or nil if there is none.
+// It must be called with the lock held.
+func (s *Server) fault(m Method) *Fault {
+	f, ok := s.faults[m]
+	if !ok {
+		if f, ok = s.faults[AnyMethod]; !ok {
+			return nil
+		}
+		m = AnyMethod
+	}
+	if f.Times > 0 {
+		f.Times--
+		if f.Times == 0 {
+			delete(s.faults, m)
+		}
+	}
+	fc := *f
+	if fc.Result == Redirect && fc.RedirectTo == "" {
+		fc.RedirectTo = s.addr
+	}
+	return &fc
+}
+
+// handle applies the fault and records the request, then returns the result.
+func (s *Server) handle(m Method, apiKey string, msgs [][]byte) *collector.MessageResult {
+	s.lock.Lock()
+	f := s.fault(m)
+	s.lock.Unlock()
+
+	res := &collector.MessageResult{Result: collector.ResultCode_OK}
+	if f != nil {
+		time.Sleep(f.Latency)
+		res.Result = collector.ResultCode(f.Result)
+		if f.Result == Redirect {
+			res.Arg = f.RedirectTo
+		}
+	}
+
+	decoded := decode(msgs)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = append(s.requests, Request{
+		Method:   m,
+		APIKey:   apiKey,
+		Messages: decoded,
+		Result:   ResultCode(res.Result),
+		Time:     time.Now(),
+	})
+	if res.Result == collector.ResultCode_OK {
+		switch m {
+		case PostEvents:
+			s.events = append(s.events, decoded...)
+		case PostMetrics:
+			s.metrics = append(s.metrics, decoded...)
+		case PostStatus:
+			s.status = append(s.status, decoded...)
+		}
+	}
+	return res
+}
+
+// decode decodes the BSON messages, the invalid ones are decoded as nil.
+func decode(msgs [][]byte) []Message {
+	var decoded []Message
+	for _, b := range msgs {
+		var m bson.M
+		if err := bson.Unmarshal(b, &m); err != nil {
+			decoded = append(decoded, nil)
+			continue
+		}
+		decoded = append(decoded, Message(m))
+	}
+	return decoded
+}
+
+// PostEvents implements the collector service.
+func (s *Server) PostEvents(ctx context.Context, req *collector.MessageRequest) (*collector.MessageResult, error) {
+	return s.handle(PostEvents, req.ApiKey, req.Messages), nil
+}
+
+// PostMetrics implements the collector service.
+func (s *Server) PostMetrics(ctx context.Context, req *collector.MessageRequest) (*collector.MessageResult, error) {
+	return s.handle(PostMetrics, req.ApiKey, req.Messages), nil
+}
+
+// PostStatus implements the collector service.
+func (s *Server) PostStatus(ctx context.Context, req *collector.MessageRequest) (*collector.MessageResult, error) {
+	return s.handle(PostStatus, req.ApiKey, req.Messages), nil
+}
+
+// Ping implements the collector service.
+func (s *Server) Ping(ctx context.Context, req *collector.PingRequest) (*collector.MessageResult, error) {
+	return s.handle(Ping, req.ApiKey, nil), nil
+}
+
+// GetSettings implements the collector service.
+func (s *Server) GetSettings(ctx context.Context, req *collector.SettingsRequest) (*collector.SettingsResult, error) {
+	res := s.handle(GetSettings, req.ApiKey, nil)
+	result := &collector.SettingsResult{Result: res.Result, Arg: res.Arg}
+	if res.Result != collector.ResultCode_OK {
+		return result, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, st := range s.settings {
+		result.Settings = append(result.Settings, st.toProto())
+	}
+	return result, nil
+}
+
+// toProto converts the setting to the protobuf message.
+func (st Setting) toProto() *collector.OboeSetting {
+	s := &collector.OboeSetting{
+		Type:      collector.OboeSettingType_DEFAULT_SAMPLE_RATE,
+		Flags:     []byte(st.Flags),
+		Timestamp: time.Now().Unix(),
+		Value:     st.Value,
+		Ttl:       st.TTL,
+		Arguments: map[string][]byte{
+			"BucketCapacity": float64Bytes(st.BucketCapacity),
+			"BucketRate":     float64Bytes(st.BucketRate),
+		},
+	}
+	if st.Layer != "" {
+		s.Type = collector.OboeSettingType_LAYER_SAMPLE_RATE
+		s.Layer = []byte(st.Layer)
+	}
+	if st.MetricsFlushInterval > 0 {
+		s.Arguments["MetricsFlushInterval"] = int32Bytes(st.MetricsFlushInterval)
+	}
+	if st.MaxTransactions > 0 {
+		s.Arguments["MaxTransactions"] = int32Bytes(st.MaxTransactions)
+	}
+	return s
+}
+
+func float64Bytes(f float64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+	return b
+}
+
+func int32Bytes(i int32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(i))
+	return b
+}
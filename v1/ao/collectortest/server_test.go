@@ -0,0 +1,163 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package collectortest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter/collector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func newTestClient(t *testing.T, s *Server) (collector.TraceCollectorClient, func()) {
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(s.CertPEM()))
+	creds := credentials.NewTLS(&tls.Config{RootCAs: pool})
+	conn, err := grpc.Dial(s.Addr(), grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	return collector.NewTraceCollectorClient(conn), func() { conn.Close() }
+}
+
+func TestServerMessages(t *testing.T) {
+	s, err := NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, s.Addr(), s.Env()["APPOPTICS_COLLECTOR"])
+	assert.Equal(t, s.CertFile(), s.Env()["APPOPTICS_TRUSTEDPATH"])
+
+	c, closeFn := newTestClient(t, s)
+	defer closeFn()
+
+	ev, err := bson.Marshal(bson.M{"Layer": "test", "Label": "entry"})
+	require.NoError(t, err)
+	res, err := c.PostEvents(context.Background(),
+		&collector.MessageRequest{ApiKey: "key", Messages: [][]byte{ev, []byte("invalid")}})
+	require.NoError(t, err)
+	assert.Equal(t, collector.ResultCode_OK, res.Result)
+
+	_, err = c.PostMetrics(context.Background(),
+		&collector.MessageRequest{ApiKey: "key", Messages: [][]byte{ev}})
+	require.NoError(t, err)
+	_, err = c.PostStatus(context.Background(),
+		&collector.MessageRequest{ApiKey: "key", Messages: [][]byte{ev}})
+	require.NoError(t, err)
+	_, err = c.Ping(context.Background(), &collector.PingRequest{ApiKey: "key"})
+	require.NoError(t, err)
+
+	events := s.WaitForEvents(2, time.Second)
+	require.Len(t, events, 2)
+	assert.Equal(t, "test", events[0]["Layer"])
+	assert.Equal(t, "entry", events[0]["Label"])
+	assert.Nil(t, events[1])
+	assert.Len(t, s.WaitForMetrics(1, time.Second), 1)
+	assert.Len(t, s.WaitForStatus(1, time.Second), 1)
+
+	reqs := s.Requests()
+	require.Len(t, reqs, 4)
+	assert.Equal(t, []Method{PostEvents, PostMetrics, PostStatus, Ping},
+		[]Method{reqs[0].Method, reqs[1].Method, reqs[2].Method, reqs[3].Method})
+	assert.Equal(t, "key", reqs[0].APIKey)
+
+	s.Reset()
+	assert.Empty(t, s.Requests())
+	assert.Empty(t, s.Events())
+}
+
+func TestServerSettings(t *testing.T) {
+	s, err := NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	c, closeFn := newTestClient(t, s)
+	defer closeFn()
+
+	res, err := c.GetSettings(context.Background(), &collector.SettingsRequest{ApiKey: "key"})
+	require.NoError(t, err)
+	require.Len(t, res.Settings, 1)
+	assert.Equal(t, collector.OboeSettingType_DEFAULT_SAMPLE_RATE, res.Settings[0].Type)
+	assert.Equal(t, int64(1000000), res.Settings[0].Value)
+	assert.Equal(t, "SAMPLE_START,SAMPLE_THROUGH_ALWAYS", string(res.Settings[0].Flags))
+
+	s.SetSettings(Setting{
+		Layer:                "svc",
+		Flags:                "SAMPLE_START",
+		Value:                500000,
+		TTL:                  10,
+		BucketCapacity:       2,
+		BucketRate:           1,
+		MetricsFlushInterval: 30,
+	})
+	res, err = c.GetSettings(context.Background(), &collector.SettingsRequest{ApiKey: "key"})
+	require.NoError(t, err)
+	require.Len(t, res.Settings, 1)
+	st := res.Settings[0]
+	assert.Equal(t, collector.OboeSettingType_LAYER_SAMPLE_RATE, st.Type)
+	assert.Equal(t, "svc", string(st.Layer))
+	assert.Equal(t, int64(10), st.Ttl)
+	assert.Equal(t, 2.0, math.Float64frombits(binary.LittleEndian.Uint64(st.Arguments["BucketCapacity"])))
+	assert.Equal(t, uint32(30), binary.LittleEndian.Uint32(st.Arguments["MetricsFlushInterval"]))
+	assert.NotContains(t, st.Arguments, "MaxTransactions")
+
+	s.SetSettings()
+	res, err = c.GetSettings(context.Background(), &collector.SettingsRequest{ApiKey: "key"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Settings)
+}
+
+func TestServerFaults(t *testing.T) {
+	s, err := NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	c, closeFn := newTestClient(t, s)
+	defer closeFn()
+	post := func() *collector.MessageResult {
+		res, err := c.PostEvents(context.Background(),
+			&collector.MessageRequest{ApiKey: "key", Messages: [][]byte{{}}})
+		require.NoError(t, err)
+		return res
+	}
+
+	// the fault applies to the given number of calls only
+	s.InjectFault(PostEvents, Fault{Result: TryLater, Times: 2})
+	assert.Equal(t, collector.ResultCode_TRY_LATER, post().Result)
+	assert.Equal(t, collector.ResultCode_TRY_LATER, post().Result)
+	assert.Equal(t, collector.ResultCode_OK, post().Result)
+	assert.Len(t, s.Events(), 1)
+	assert.Len(t, s.Requests(), 3)
+
+	// redirect to the server itself by default
+	s.InjectFault(PostEvents, Fault{Result: Redirect})
+	res := post()
+	assert.Equal(t, collector.ResultCode_REDIRECT, res.Result)
+	assert.Equal(t, s.Addr(), res.Arg)
+	s.InjectFault(PostEvents, Fault{Result: Redirect, RedirectTo: "other:443"})
+	assert.Equal(t, "other:443", post().Arg)
+
+	// the fault of a method takes precedence over the one of any method
+	s.InjectFault(AnyMethod, Fault{Result: InvalidAPIKey})
+	assert.Equal(t, collector.ResultCode_REDIRECT, post().Result)
+	sr, err := c.GetSettings(context.Background(), &collector.SettingsRequest{ApiKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, collector.ResultCode_INVALID_API_KEY, sr.Result)
+	assert.Empty(t, sr.Settings)
+
+	s.ClearFaults()
+	s.InjectFault(Ping, Fault{Latency: 100 * time.Millisecond})
+	start := time.Now()
+	pr, err := c.Ping(context.Background(), &collector.PingRequest{ApiKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, collector.ResultCode_OK, pr.Result)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	assert.Len(t, s.Events(), 1)
+}
@@ -0,0 +1,345 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+)
+
+func init() {
+	config.AddListener(applyLogLevel)
+	config.AddListener(reloadCompiledConfig)
+}
+
+// compiledConfig compiles the options of the configuration into the state
+// read by the tracing functions, e.g., the URL filters. The invalid values,
+// e.g., from the configuration file, are logged and ignored by load.
+type compiledConfig struct {
+	options []string
+	load    func()
+}
+
+// the compiled states of the configuration, they are registered by init() and
+// read-only afterwards.
+var compiledConfigs []compiledConfig
+
+// registerCompiledConfig registers and runs the loader of the options. It's
+// run again by Init and whenever any of the options is updated.
+func registerCompiledConfig(load func(), options ...string) {
+	compiledConfigs = append(compiledConfigs, compiledConfig{options: options, load: load})
+	load()
+}
+
+// loadCompiledConfigs runs all the registered loaders.
+func loadCompiledConfigs() {
+	for _, c := range compiledConfigs {
+		c.load()
+	}
+}
+
+// reloadCompiledConfig runs the loaders of the changed options.
+func reloadCompiledConfig(changed []string) {
+	for _, c := range compiledConfigs {
+		if c.changed(changed) {
+			c.load()
+		}
+	}
+}
+
+// changed returns whether any of the options is changed.
+func (c compiledConfig) changed(changed []string) bool {
+	for _, name := range changed {
+		for _, o := range c.options {
+			if name == o {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UpdateConfig updates the configuration at runtime without restarting the
+// agent. Only the following options can be updated this way: WithTracingMode,
+// WithLogLevel, WithPrependDomain, WithHistogramPrecision, WithURLFilters and
+// the transaction naming options. The changes of the other options and the
+// invalid values are discarded and reported by the returned error, the valid
+// changes are applied anyway.
+//
+// The changes are logged, and lost once the configuration is reloaded, e.g.,
+// by ReloadConfig.
+func UpdateConfig(opts ...config.Option) error {
+	return config.Update(opts...)
+}
+
+// ReloadConfig reloads the configuration file set by APPOPTICS_CONFIG_FILE and
+// the environment variables, and applies the changes of the options which can
+// be updated at runtime, see UpdateConfig. It's called when the process
+// receives SIGHUP if enabled by ReloadOnSIGHUP.
+func ReloadConfig() error {
+	return config.Reload()
+}
+
+// WithTracingMode returns an option for the tracing mode: always or never.
+func WithTracingMode(mode string) config.Option {
+	return config.WithTracingMode(mode)
+}
+
+// WithLogLevel returns an option for the log level: DEBUG, INFO, WARN or
+// ERROR.
+func WithLogLevel(level string) config.Option {
+	return config.WithDebugLevel(level)
+}
+
+// WithPrependDomain returns an option for whether the domain should be
+// prepended to the transaction name.
+func WithPrependDomain(prepend bool) config.Option {
+	return config.WithPrependDomain(prepend)
+}
+
+// WithHistogramPrecision returns an option for the precision of the
+// histograms, which is between 0 and 5.
+func WithHistogramPrecision(precision int) config.Option {
+	return config.WithPrecision(precision)
+}
+
+// URLFilter matches the URL path of the inbound HTTP requests by a regular
+// expression or by the extensions, e.g., "css", and defines how the matching
+// requests are traced. The first matching filter wins.
+type URLFilter = config.URLFilter
+
+// The actions of the URL filters
+const (
+	// The matching requests are not traced, but the metrics are recorded.
+	URLFilterNoTracing = config.URLFilterNoTracing
+	// The matching requests are neither traced nor recorded in the metrics.
+	URLFilterNoMetrics = config.URLFilterNoMetrics
+	// The matching requests are always traced unless the tracing mode is
+	// never, regardless of the sample rate and the token bucket.
+	URLFilterForceSample = config.URLFilterForceSample
+)
+
+// WithURLFilters returns an option for the URL filters of the inbound HTTP
+// requests, which replace the ones of APPOPTICS_URL_FILTERS.
+func WithURLFilters(filters ...URLFilter) config.Option {
+	return config.WithURLFilters(filters...)
+}
+
+// TransactionNameRule names the transactions of the inbound HTTP requests
+// whose URL path matches the regular expression. The name may refer to the
+// submatches of the regex, e.g., {Regex: "^/users/[^/]+/(orders|carts)", Name:
+// "/users/{id}/$1"}. The first matching rule wins. The rules take precedence
+// over the framework specific names, e.g., the handler names of HTTPHandler,
+// but not over the names set by SetTransactionName.
+type TransactionNameRule = config.TransactionNameRule
+
+// WithTransactionNameRules returns an option for the transaction name rules,
+// which replace the ones of APPOPTICS_TRANSACTION_NAME_RULES.
+func WithTransactionNameRules(rules ...TransactionNameRule) config.Option {
+	return config.WithTransactionNameRules(rules...)
+}
+
+// WithTransactionNameDepth returns an option for the number of URL path
+// segments kept in the transaction name, 2 by default. It applies if the
+// transaction is named by neither a rule nor the framework.
+func WithTransactionNameDepth(depth int) config.Option {
+	return config.WithTransactionNameDepth(depth)
+}
+
+// WithNormalizeTransactionIDs returns an option for whether the numeric, UUID
+// and hex IDs in the URL path are replaced by the placeholders {id}, {uuid}
+// and {hex} in the transaction name. It applies if the transaction is named by
+// neither a rule nor the framework.
+func WithNormalizeTransactionIDs(normalize bool) config.Option {
+	return config.WithNormalizeTransactionIDs(normalize)
+}
+
+// WithCaptureRequestHeaders returns an option for the request headers reported
+// by the entry events of the inbound HTTP requests, e.g., "User-Agent", which
+// replace the ones of APPOPTICS_CAPTURE_REQUEST_HEADERS. The KVs are named
+// after the headers, e.g., "Request-Header-User-Agent".
+func WithCaptureRequestHeaders(headers ...string) config.Option {
+	return config.WithCaptureRequestHeaders(headers...)
+}
+
+// WithCaptureResponseHeaders returns an option for the response headers
+// reported by the exit events of the inbound HTTP requests, e.g.,
+// "Content-Type", which replace the ones of APPOPTICS_CAPTURE_RESPONSE_HEADERS.
+// The KVs are named after the headers, e.g., "Response-Header-Content-Type".
+func WithCaptureResponseHeaders(headers ...string) config.Option {
+	return config.WithCaptureResponseHeaders(headers...)
+}
+
+// WithRedactedHeaders returns an option for the captured headers whose values
+// are redacted. The Authorization, Proxy-Authorization, Cookie and Set-Cookie
+// headers are always redacted, but the authorization scheme and the cookie
+// names are kept.
+func WithRedactedHeaders(headers ...string) config.Option {
+	return config.WithRedactedHeaders(headers...)
+}
+
+// WithCaptureBodyContentTypes returns an option for the content types of the
+// request and response bodies reported by the exit events of the inbound HTTP
+// requests, e.g., "application/json" or "text/*". No body is captured by
+// default.
+func WithCaptureBodyContentTypes(types ...string) config.Option {
+	return config.WithCaptureBodyContentTypes(types...)
+}
+
+// WithCaptureBodyMaxBytes returns an option for the maximum number of bytes
+// captured of a request or response body, 1024 by default.
+func WithCaptureBodyMaxBytes(max int) config.Option {
+	return config.WithCaptureBodyMaxBytes(max)
+}
+
+// WithRedactedQueryParams returns an option for the names of the query
+// parameters whose values are replaced by "?" in the reported URLs and query
+// strings, case-insensitive. It replaces the default ones, e.g., "password"
+// and "token", and the ones of APPOPTICS_REDACTED_QUERY_PARAMS.
+func WithRedactedQueryParams(names ...string) config.Option {
+	return config.WithRedactedQueryParams(names...)
+}
+
+// WithDropQueryString returns an option for whether the query strings are
+// dropped from the reported URLs entirely.
+func WithDropQueryString(drop bool) config.Option {
+	return config.WithDropQueryString(drop)
+}
+
+// WithURLPathMasks returns an option for the regular expressions of the URL
+// path segments replaced by "*" in the reported URLs, e.g., "^.+@.+$" for the
+// email addresses, which replace the ones of APPOPTICS_URL_PATH_MASKS. The
+// transaction names are made of the masked paths as well, but the transaction
+// name rules match the paths before they're masked.
+func WithURLPathMasks(masks ...string) config.Option {
+	return config.WithURLPathMasks(masks...)
+}
+
+// WithTrustedTraceSources returns an option for the CIDRs or IP addresses, e.g.,
+// "10.0.0.0/8", whose inbound X-Trace headers are continued, which replace the
+// ones of APPOPTICS_TRUSTED_TRACE_SOURCES. The remote address and all the
+// X-Forwarded-For addresses of the request must be trusted. The untrusted
+// X-Trace headers are ignored and new traces are started instead. All the
+// sources are trusted if neither the sources nor the secret is configured.
+func WithTrustedTraceSources(sources ...string) config.Option {
+	return config.WithTrustedTraceSources(sources...)
+}
+
+// WithTraceContextSecret returns an option for the shared secret which signs
+// the X-Trace headers of the outbound HTTP requests and verifies the inbound
+// ones, see HTTPSignatureHeaderName. A signed X-Trace header is continued
+// regardless of its source.
+func WithTraceContextSecret(secret string) config.Option {
+	return config.WithTraceContextSecret(secret)
+}
+
+// WithTraceContextSignDestinations returns an option for the hosts of the
+// outbound HTTP requests whose X-Trace headers are signed, e.g.,
+// "api.example.com" or "*.example.com" for its subdomains, which replace the
+// ones of APPOPTICS_TRACE_CONTEXT_SIGN_DESTINATIONS. The requests to all the
+// hosts are signed if it's empty.
+func WithTraceContextSignDestinations(hosts ...string) config.Option {
+	return config.WithTraceContextSignDestinations(hosts...)
+}
+
+// The headers which carry the client IP, see WithClientIPHeaders.
+const (
+	ClientIPHeaderXForwardedFor = config.ClientIPHeaderXForwardedFor
+	ClientIPHeaderXRealIP       = config.ClientIPHeaderXRealIP
+	ClientIPHeaderForwarded     = config.ClientIPHeaderForwarded
+)
+
+// WithClientIPHeaders returns an option for the headers which carry the client
+// IP of the inbound HTTP requests, in the order of preference. The client IP is
+// reported as the KV "Client-IP" of the entry event, and it's resolved only if
+// the trusted proxies are configured.
+func WithClientIPHeaders(headers ...string) config.Option {
+	return config.WithClientIPHeaders(headers...)
+}
+
+// WithTrustedProxies returns an option for the IP addresses or CIDR blocks of
+// the trusted proxies. The client IP is the rightmost address of the header
+// which is not a trusted proxy.
+func WithTrustedProxies(proxies ...string) config.Option {
+	return config.WithTrustedProxies(proxies...)
+}
+
+// WithTrustedProxyCount returns an option for the number of the trusted proxies
+// in front of the application. It's ignored if the trusted proxies are configured.
+func WithTrustedProxyCount(count int) config.Option {
+	return config.WithTrustedProxyCount(count)
+}
+
+// WithClientIPMetricsTag returns an option for whether the client IP is a tag
+// of the transaction response time metrics. Up to 100 client IPs are tagged
+// in each metrics flush and the others are tagged as "other".
+func WithClientIPMetricsTag(enabled bool) config.Option {
+	return config.WithClientIPMetricsTag(enabled)
+}
+
+// WithTriggerTrace returns an option for whether the trigger traces requested
+// by the X-Trace-Options header are enabled, see HTTPTraceOptionsHeaderName.
+// They are subject to the trigger trace settings of the collector as well.
+func WithTriggerTrace(enabled bool) config.Option {
+	return config.WithTriggerTrace(enabled)
+}
+
+// SamplingRule defines a local sample rate of the traces matching the span
+// name, the URL path or the HTTP method, see WithSamplingRules.
+type SamplingRule = config.SamplingRule
+
+// WithSamplingRules returns an option for the local sampling rules, the first
+// rule matching a new trace wins. The rules with a URL or method only match
+// the inbound HTTP requests. The sample rate of the rule is merged with the one
+// of the remote settings, where the stricter one wins unless the rule overrides
+// it and the remote settings don't have the OVERRIDE flag. The entry events of
+// the traces sampled by a rule report the SampleSource 4.
+func WithSamplingRules(rules ...SamplingRule) config.Option {
+	return config.WithSamplingRules(rules...)
+}
+
+// applyLogLevel applies the log level updated at runtime.
+func applyLogLevel(changed []string) {
+	for _, name := range changed {
+		if name == "DebugLevel" {
+			SetLogLevel(config.GetDebugLevel())
+		}
+	}
+}
+
+// ReloadOnSIGHUP calls ReloadConfig whenever the process receives SIGHUP, which
+// no longer terminates the process then. It's useful with the configuration
+// file set by APPOPTICS_CONFIG_FILE, as the environment variables can't be
+// changed in a running process anyway. The agent never handles any signal
+// unless it's called, e.g., in main() by an application which doesn't handle
+// SIGHUP itself. It returns the function to stop handling the signal.
+func ReloadOnSIGHUP() (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				aolog.Infof("Reloading the configuration on SIGHUP.")
+				if err := ReloadConfig(); err != nil {
+					aolog.Warningf("Failed to reload the configuration: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
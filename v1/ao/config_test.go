@@ -0,0 +1,74 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateConfig(t *testing.T) {
+	oldLevel := GetLogLevel()
+	defer SetLogLevel(oldLevel)
+	os.Unsetenv("APPOPTICS_PREPEND_DOMAIN")
+
+	require.NoError(t, UpdateConfig(WithLogLevel("debug"), WithPrependDomain(true)))
+	assert.Equal(t, "DEBUG", GetLogLevel())
+	assert.True(t, config.GetPrependDomain())
+
+	err := UpdateConfig(WithServiceKey("ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:new"),
+		WithLogLevel("error"), WithHistogramPrecision(9))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ServiceKey can't be updated at runtime")
+	assert.Equal(t, "ERROR", GetLogLevel())
+
+	// the configuration file and environment variables are reloaded
+	f, err := ioutil.TempFile("", "appoptics-config")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"DebugLevel": "INFO"}`), 0644))
+	os.Setenv("APPOPTICS_CONFIG_FILE", f.Name())
+	defer os.Unsetenv("APPOPTICS_CONFIG_FILE")
+
+	require.NoError(t, ReloadConfig())
+	assert.Equal(t, "INFO", GetLogLevel())
+	assert.False(t, config.GetPrependDomain())
+	os.Unsetenv("APPOPTICS_CONFIG_FILE")
+	require.NoError(t, ReloadConfig())
+}
+
+func TestLoadCompiledConfigs(t *testing.T) {
+	defer func() {
+		config.Refresh()
+		loadCompiledConfigs()
+	}()
+
+	// the listeners are not notified when the configuration is refreshed,
+	// e.g., by Init
+	config.Refresh(WithSamplingRules(SamplingRule{SpanName: "cron", SampleRate: 0}),
+		WithURLFilters(URLFilter{Extensions: []string{"png"}, Action: URLFilterNoTracing}))
+	assert.Nil(t, localSampleRateOf("cron", nil))
+	override, _ := samplingOverrideOfURL("/logo.png")
+	assert.Equal(t, reporter.SampleBySettings, override)
+
+	loadCompiledConfigs()
+	assert.Equal(t, &reporter.LocalSampleRate{Rate: 0}, localSampleRateOf("cron", nil))
+	override, _ = samplingOverrideOfURL("/logo.png")
+	assert.Equal(t, reporter.SampleNever, override)
+
+	// only the loaders of the changed options are run
+	var loaded []string
+	defer func(configs []compiledConfig) { compiledConfigs = configs }(compiledConfigs)
+	compiledConfigs = nil
+	registerCompiledConfig(func() { loaded = append(loaded, "a") }, "A1", "A2")
+	registerCompiledConfig(func() { loaded = append(loaded, "b") }, "B")
+	assert.Equal(t, []string{"a", "b"}, loaded)
+	reloadCompiledConfig([]string{"A2", "A1", "C"})
+	assert.Equal(t, []string{"a", "b", "a"}, loaded)
+}
@@ -0,0 +1,42 @@
+// +build linux darwin
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	oldLevel := GetLogLevel()
+	defer SetLogLevel(oldLevel)
+
+	f, err := ioutil.TempFile("", "appoptics-config")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"DebugLevel": "ERROR"}`), 0644))
+	os.Setenv("APPOPTICS_CONFIG_FILE", f.Name())
+	defer func() {
+		os.Unsetenv("APPOPTICS_CONFIG_FILE")
+		ReloadConfig()
+	}()
+	require.NoError(t, UpdateConfig(WithLogLevel("info")))
+
+	stop := ReloadOnSIGHUP()
+	defer stop()
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	deadline := time.Now().Add(5 * time.Second)
+	for GetLogLevel() != "ERROR" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "ERROR", GetLogLevel())
+	stop()
+}
@@ -0,0 +1,35 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// the prefix of the metrics collector names of the database pools
+const dbPoolCollectorPrefix = "sql.DB:"
+
+var errNilDB = errors.New("nil sql.DB")
+
+// MonitorDBPool reports the connection pool stats of the database on each
+// metrics flush, tagged with the pool name. The open, in-use and idle
+// connections are reported as gauges, and the wait count, wait duration and
+// the connections closed due to SetMaxIdleConns/SetConnMaxLifetime are
+// reported as deltas since the last flush. Only the open connections are
+// reported before Go 1.11, which doesn't provide the other stats.
+//
+// Call UnmonitorDBPool with the same name when the database is closed.
+func MonitorDBPool(name string, db *sql.DB) error {
+	if db == nil {
+		return errNilDB
+	}
+	return RegisterMetricsCollector(dbPoolCollectorPrefix+name, dbPoolCollector(name, db))
+}
+
+// UnmonitorDBPool stops reporting the stats of the database pool registered
+// with MonitorDBPool. It returns false if the pool is not found.
+func UnmonitorDBPool(name string) bool {
+	return UnregisterMetricsCollector(dbPoolCollectorPrefix + name)
+}
@@ -0,0 +1,48 @@
+// +build go1.11
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// dbPoolCollector returns the metrics collector of the database pool. The
+// deltas of the first flush are the ones since the collector is created.
+func dbPoolCollector(name string, db *sql.DB) func(emit MetricEmitter) {
+	last := db.Stats()
+	var lock sync.Mutex
+	tags := map[string]string{"PoolName": name}
+
+	return func(emit MetricEmitter) {
+		s := db.Stats()
+
+		lock.Lock()
+		prev := last
+		last = s
+		lock.Unlock()
+
+		emit.Emit("SQLPool.MaxOpenConnections", s.MaxOpenConnections, tags)
+		emit.Emit("SQLPool.OpenConnections", s.OpenConnections, tags)
+		emit.Emit("SQLPool.InUse", s.InUse, tags)
+		emit.Emit("SQLPool.Idle", s.Idle, tags)
+		emit.Emit("SQLPool.WaitCount", counterDelta(s.WaitCount, prev.WaitCount), tags)
+		emit.Emit("SQLPool.WaitDuration",
+			counterDelta(int64(s.WaitDuration), int64(prev.WaitDuration))/int64(time.Microsecond), tags)
+		emit.Emit("SQLPool.MaxIdleClosed", counterDelta(s.MaxIdleClosed, prev.MaxIdleClosed), tags)
+		emit.Emit("SQLPool.MaxLifetimeClosed",
+			counterDelta(s.MaxLifetimeClosed, prev.MaxLifetimeClosed), tags)
+	}
+}
+
+// counterDelta returns the increase of a counter since the last value, or the
+// current value if the counter is reset, e.g., the stats of a reopened pool.
+func counterDelta(curr, last int64) int64 {
+	if curr < last {
+		return curr
+	}
+	return curr - last
+}
@@ -0,0 +1,18 @@
+// +build !go1.11
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import "database/sql"
+
+// dbPoolCollector returns the metrics collector of the database pool, which
+// reports the open connections only as sql.DBStats doesn't have the other
+// stats before Go 1.11.
+func dbPoolCollector(name string, db *sql.DB) func(emit MetricEmitter) {
+	tags := map[string]string{"PoolName": name}
+
+	return func(emit MetricEmitter) {
+		emit.Emit("SQLPool.OpenConnections", db.Stats().OpenConnections, tags)
+	}
+}
@@ -0,0 +1,119 @@
+// +build go1.11
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a database driver which does nothing but opening connections
+type fakeDriver struct{}
+type fakeConn struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("aofake", fakeDriver{})
+}
+
+// an emitter which records the last value of each measurement
+type testEmitter struct {
+	values map[string]interface{}
+	tags   map[string]string
+}
+
+func (e *testEmitter) Emit(name string, value interface{}, tags map[string]string) {
+	e.values[name] = value
+	e.tags = tags
+}
+
+func collect(c func(emit MetricEmitter)) *testEmitter {
+	e := &testEmitter{values: make(map[string]interface{})}
+	c(e)
+	return e
+}
+
+func TestDBPoolCollector(t *testing.T) {
+	db, err := sql.Open("aofake", "")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(5)
+
+	c := dbPoolCollector("main", db)
+	ctx := context.Background()
+	conn1, err := db.Conn(ctx)
+	require.NoError(t, err)
+	conn2, err := db.Conn(ctx)
+	require.NoError(t, err)
+	conn2.Close()
+
+	e := collect(c)
+	assert.Equal(t, map[string]string{"PoolName": "main"}, e.tags)
+	assert.Equal(t, 5, e.values["SQLPool.MaxOpenConnections"])
+	assert.Equal(t, 2, e.values["SQLPool.OpenConnections"])
+	assert.Equal(t, 1, e.values["SQLPool.InUse"])
+	assert.Equal(t, 1, e.values["SQLPool.Idle"])
+	assert.Equal(t, int64(0), e.values["SQLPool.MaxIdleClosed"])
+
+	// the idle connection is closed
+	db.SetMaxIdleConns(0)
+	conn1.Close()
+	e = collect(c)
+	assert.Equal(t, 0, e.values["SQLPool.OpenConnections"])
+	assert.Equal(t, int64(2), e.values["SQLPool.MaxIdleClosed"])
+
+	// deltas since the last flush
+	e = collect(c)
+	assert.Equal(t, int64(0), e.values["SQLPool.MaxIdleClosed"])
+	assert.Equal(t, int64(0), e.values["SQLPool.WaitCount"])
+	assert.Equal(t, int64(0), e.values["SQLPool.WaitDuration"])
+}
+
+func TestDBPoolCollectorPrimed(t *testing.T) {
+	db, err := sql.Open("aofake", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// the connections closed before the collector is created
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	db.SetMaxIdleConns(0)
+	conn.Close()
+	require.Equal(t, int64(1), db.Stats().MaxIdleClosed)
+
+	e := collect(dbPoolCollector("main", db))
+	assert.Equal(t, int64(0), e.values["SQLPool.MaxIdleClosed"])
+	assert.Equal(t, int64(0), e.values["SQLPool.WaitCount"])
+}
+
+func TestCounterDelta(t *testing.T) {
+	assert.Equal(t, int64(5), counterDelta(15, 10))
+	assert.Equal(t, int64(0), counterDelta(10, 10))
+	// reset
+	assert.Equal(t, int64(3), counterDelta(3, 10))
+}
+
+func TestMonitorDBPool(t *testing.T) {
+	db, err := sql.Open("aofake", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Error(t, MonitorDBPool("nil", nil))
+	assert.NoError(t, MonitorDBPool("main", db))
+	assert.Error(t, MonitorDBPool("main", db))
+	assert.True(t, UnmonitorDBPool("main"))
+	assert.False(t, UnmonitorDBPool("main"))
+}
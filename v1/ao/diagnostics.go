@@ -0,0 +1,59 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+)
+
+// DiagnosticsSnapshot is a snapshot of the internal state of the agent,
+// including the event queue stats, sampling counters, collector connections
+// and sampling settings. The counters are accumulated since the last metrics
+// flush.
+type DiagnosticsSnapshot = reporter.Diagnostics
+
+// Diagnostics returns a snapshot of the internal state of the default agent,
+// which helps to check the agent health in production. The named agents have
+// their own state, see Agent.Diagnostics.
+func Diagnostics() DiagnosticsSnapshot {
+	return defaultAgent.Diagnostics()
+}
+
+// Diagnostics returns a snapshot of the internal state of the agent.
+func (a *Agent) Diagnostics() DiagnosticsSnapshot {
+	d := a.agent.Diagnostics()
+	d.Agent = a.name
+	return d
+}
+
+// DiagnosticsHandler returns an HTTP handler which renders the agent
+// diagnostics as JSON. It's not registered by default, and may be mounted
+// under a debug path which is not exposed publicly:
+//
+//	http.Handle("/debug/appoptics", ao.DiagnosticsHandler())
+//
+// It renders the default agent, or the named agent selected by the "agent"
+// query parameter, e.g., "/debug/appoptics?agent=other".
+func DiagnosticsHandler() http.Handler {
+	return http.HandlerFunc(serveDiagnostics)
+}
+
+func serveDiagnostics(w http.ResponseWriter, r *http.Request) {
+	a := defaultAgent
+	if name := r.URL.Query().Get("agent"); name != "" {
+		if a = GetAgent(name); a == nil {
+			http.Error(w, "agent not found: "+name, http.StatusNotFound)
+			return
+		}
+	}
+	b, err := json.MarshalIndent(a.Diagnostics(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(b)
+}
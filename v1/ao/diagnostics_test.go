@@ -0,0 +1,38 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticsHandler(t *testing.T) {
+	r := reporter.SetTestReporter()
+	defer r.Close(0)
+
+	w := httptest.NewRecorder()
+	DiagnosticsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/appoptics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var d DiagnosticsSnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &d))
+	assert.Equal(t, DefaultAgentName, d.Agent)
+	assert.Equal(t, "test", d.Reporter)
+	assert.True(t, d.Ready)
+	require.Len(t, d.Settings, 1)
+	assert.Equal(t, "default", d.Settings[0].Type)
+	assert.Equal(t, 1000000, d.Settings[0].Value)
+
+	// an unknown agent
+	w = httptest.NewRecorder()
+	DiagnosticsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/appoptics?agent=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,230 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+)
+
+// The prefixes of the KVs of the captured headers, e.g., "Request-Header-User-Agent"
+const (
+	keyRequestHeaderPrefix  = "Request-Header-"
+	keyResponseHeaderPrefix = "Response-Header-"
+)
+
+// The KVs of the captured bodies
+const (
+	keyRequestBody           = "Request-Body"
+	keyRequestBodyTruncated  = "Request-Body-Truncated"
+	keyResponseBody          = "Response-Body"
+	keyResponseBodyTruncated = "Response-Body-Truncated"
+)
+
+// redacted replaces the sensitive values of the captured headers
+const redacted = "[REDACTED]"
+
+// The headers which are always redacted
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// httpCapture is the compiled capturing configuration of the headers and
+// bodies of the inbound HTTP requests.
+type httpCapture struct {
+	requestHeaders  []string
+	responseHeaders []string
+	redacted        map[string]bool
+	bodyTypes       []string
+	maxBytes        int
+}
+
+// the compiled capturing configuration, it's a *httpCapture.
+var httpCaptureConf atomic.Value
+
+func init() {
+	registerCompiledConfig(loadHTTPCapture, "CaptureRequestHeaders", "CaptureResponseHeaders",
+		"RedactedHeaders", "CaptureBodyContentTypes", "CaptureBodyMaxBytes")
+}
+
+// loadHTTPCapture compiles the capturing configuration.
+func loadHTTPCapture() {
+	c := &httpCapture{
+		requestHeaders:  canonicalHeaderNames(config.GetCaptureRequestHeaders()),
+		responseHeaders: canonicalHeaderNames(config.GetCaptureResponseHeaders()),
+		redacted:        make(map[string]bool),
+		maxBytes:        config.GetCaptureBodyMaxBytes(),
+	}
+	for _, name := range append(canonicalHeaderNames(config.GetRedactedHeaders()), defaultRedactedHeaders...) {
+		c.redacted[name] = true
+	}
+	for _, t := range config.GetCaptureBodyContentTypes() {
+		mt, _, err := mime.ParseMediaType(t)
+		if err != nil || !strings.Contains(mt, "/") {
+			aolog.Warningf("Ignored the content type to capture: %q", t)
+			continue
+		}
+		c.bodyTypes = append(c.bodyTypes, mt)
+	}
+	if c.maxBytes < 1 {
+		c.maxBytes = 0
+		c.bodyTypes = nil
+	}
+	httpCaptureConf.Store(c)
+}
+
+// canonicalHeaderNames returns the canonical format of the valid header names.
+// Each of them must be a single header name, e.g., "X-A,X-B" is ignored.
+func canonicalHeaderNames(names []string) []string {
+	var canonical []string
+	for _, name := range names {
+		if !config.IsValidHeaderName(strings.TrimSpace(name)) {
+			aolog.Warningf("Ignored the header to capture: %q", name)
+			continue
+		}
+		canonical = append(canonical, textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name)))
+	}
+	return canonical
+}
+
+// currentHTTPCapture returns the compiled capturing configuration.
+func currentHTTPCapture() *httpCapture {
+	c, _ := httpCaptureConf.Load().(*httpCapture)
+	if c == nil {
+		return &httpCapture{}
+	}
+	return c
+}
+
+// headerKVs returns the KVs of the captured headers whose names are prefixed,
+// the values of a header are joined by commas.
+func (c *httpCapture) headerKVs(prefix string, names []string, h http.Header) []interface{} {
+	var kvs []interface{}
+	for _, name := range names {
+		values, ok := h[name]
+		if !ok {
+			continue
+		}
+		if c.redacted[name] {
+			values = append([]string(nil), values...)
+			for i := range values {
+				values[i] = redactHeader(name, values[i])
+			}
+		}
+		kvs = append(kvs, prefix+name, strings.Join(values, ", "))
+	}
+	return kvs
+}
+
+// redactHeader redacts a value of the header. The scheme of the authorization
+// headers, the names of the cookies and the attributes of Set-Cookie are kept.
+func redactHeader(name, value string) string {
+	switch name {
+	case "Authorization", "Proxy-Authorization":
+		if i := strings.IndexByte(value, ' '); i > 0 {
+			return value[:i+1] + redacted
+		}
+	case "Cookie":
+		cookies := strings.Split(value, ";")
+		for i, cookie := range cookies {
+			cookies[i] = redactCookie(cookie)
+		}
+		return strings.Join(cookies, ";")
+	case "Set-Cookie":
+		attrs := strings.SplitN(value, ";", 2)
+		attrs[0] = redactCookie(attrs[0])
+		return strings.Join(attrs, ";")
+	}
+	return redacted
+}
+
+// redactCookie redacts the value of a name=value pair.
+func redactCookie(pair string) string {
+	if i := strings.IndexByte(pair, '='); i >= 0 {
+		return pair[:i+1] + redacted
+	}
+	return redacted
+}
+
+// capturesBody returns whether the body of the content type is captured.
+func (c *httpCapture) capturesBody(contentType string) bool {
+	if len(c.bodyTypes) == 0 || contentType == "" {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.bodyTypes {
+		if t == mt || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyCapture captures the first bytes of a request or response body and
+// reports them by the exit event of the trace.
+type bodyCapture struct {
+	t         Trace
+	key       string
+	keyTrunc  string
+	max       int
+	buf       []byte
+	body      string
+	truncated bool
+}
+
+func newBodyCapture(t Trace, c *httpCapture, key, keyTrunc string) *bodyCapture {
+	return &bodyCapture{t: t, key: key, keyTrunc: keyTrunc, max: c.maxBytes}
+}
+
+// capture keeps the bytes up to the limit. The end args are added by the
+// first bytes, so nothing is reported for an empty body.
+func (b *bodyCapture) capture(p []byte) {
+	if len(p) == 0 || b.truncated {
+		return
+	}
+	if b.buf == nil {
+		b.t.AddEndArgs(b.key, &b.body, b.keyTrunc, &b.truncated)
+	}
+	if n := b.max - len(b.buf); len(p) > n {
+		p = p[:n]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+	b.body = string(b.buf)
+}
+
+// Write implements io.Writer to capture the response body read by ReadFrom.
+func (b *bodyCapture) Write(p []byte) (int, error) {
+	b.capture(p)
+	return len(p), nil
+}
+
+// capturingBody captures the request body read by the handler.
+type capturingBody struct {
+	io.ReadCloser
+	b *bodyCapture
+}
+
+func (r *capturingBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.b.capture(p[:n])
+	return n, err
+}
+
+// captureRequestBody replaces the body of the request by a capturing one if
+// its content type is captured.
+func captureRequestBody(t Trace, r *http.Request) {
+	c := currentHTTPCapture()
+	if !t.IsReporting() || r.Body == nil || r.Body == http.NoBody || !c.capturesBody(r.Header.Get("Content-Type")) {
+		return
+	}
+	r.Body = &capturingBody{r.Body, newBodyCapture(t, c, keyRequestBody, keyRequestBodyTruncated)}
+}
@@ -0,0 +1,54 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactHeader(t *testing.T) {
+	assert.Equal(t, "Bearer [REDACTED]", redactHeader("Authorization", "Bearer abc.def"))
+	assert.Equal(t, "[REDACTED]", redactHeader("Proxy-Authorization", "secret"))
+	assert.Equal(t, "a=[REDACTED]; b=[REDACTED]", redactHeader("Cookie", "a=1; b=2"))
+	assert.Equal(t, "id=[REDACTED]; Path=/; Expires=Wed, 21 Oct 2015 07:28:00 GMT",
+		redactHeader("Set-Cookie", "id=abc; Path=/; Expires=Wed, 21 Oct 2015 07:28:00 GMT"))
+	assert.Equal(t, "[REDACTED]", redactHeader("X-Api-Key", "key"))
+}
+
+func TestCanonicalHeaderNames(t *testing.T) {
+	assert.Equal(t, []string{"User-Agent", "X-Request-Id"},
+		canonicalHeaderNames([]string{"user-agent", " x-request-id ", "X-A,X-B", "X Id", ""}))
+	assert.Empty(t, canonicalHeaderNames(nil))
+}
+
+func TestHTTPCaptureConfig(t *testing.T) {
+	defer UpdateConfig(WithCaptureRequestHeaders(), WithRedactedHeaders(),
+		WithCaptureBodyContentTypes(), WithCaptureBodyMaxBytes(1024))
+
+	require.NoError(t, UpdateConfig(WithCaptureRequestHeaders("user-agent", "x-api-key", "Cookie"),
+		WithRedactedHeaders("X-API-KEY"), WithCaptureBodyContentTypes("application/json", "text/*")))
+	c := currentHTTPCapture()
+	assert.Equal(t, []string{"User-Agent", "X-Api-Key", "Cookie"}, c.requestHeaders)
+
+	h := http.Header{}
+	h.Set("User-Agent", "test")
+	h.Set("X-Api-Key", "key")
+	h.Add("Cookie", "a=1")
+	h.Add("Cookie", "b=2")
+	assert.Equal(t, []interface{}{
+		"Request-Header-User-Agent", "test",
+		"Request-Header-X-Api-Key", "[REDACTED]",
+		"Request-Header-Cookie", "a=[REDACTED], b=[REDACTED]",
+	}, c.headerKVs(keyRequestHeaderPrefix, c.requestHeaders, h))
+	assert.Equal(t, "key", h.Get("X-Api-Key"))
+
+	assert.True(t, c.capturesBody("application/json; charset=utf-8"))
+	assert.True(t, c.capturesBody("text/plain"))
+	assert.False(t, c.capturesBody("application/octet-stream"))
+	assert.False(t, c.capturesBody(""))
+	assert.False(t, c.capturesBody("textual/plain"))
+}
@@ -20,13 +20,19 @@ import (
 type HTTPClientSpan struct{ Span }
 
 // BeginHTTPClientSpan stores trace metadata in the headers of an HTTP client request, allowing the
-// trace to be continued on the other end. It returns a Span that must have End() called to
+// trace to be continued on the other end. The metadata is signed if the configuration has a shared
+// secret and the host of the request is a destination to be signed, see HTTPSignatureHeaderName
+// and WithTraceContextSignDestinations. It returns a Span that must have End() called to
 // benchmark the client request, and should have AddHTTPResponse(r, err) called to process response
 // metadata.
 func BeginHTTPClientSpan(ctx context.Context, req *http.Request) HTTPClientSpan {
 	if req != nil {
 		l := BeginRemoteURLSpan(ctx, "http.Client", req.URL.String())
-		req.Header.Set(HTTPHeaderName, l.MetadataString())
+		md := l.MetadataString()
+		req.Header.Set(HTTPHeaderName, md)
+		if sig := currentTraceTrust().sign(md, req.URL.Hostname()); sig != "" {
+			req.Header.Set(HTTPSignatureHeaderName, sig)
+		}
 		return HTTPClientSpan{Span: l}
 	}
 	return HTTPClientSpan{Span: nullSpan{}}
@@ -0,0 +1,26 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+)
+
+func ExampleHTTPResponseWriterOf() {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		t, w, r := ao.TraceFromHTTPRequestResponse("myHandler", w, r)
+		defer t.End()
+		fmt.Fprintf(w, "Hello")
+
+		// the returned writer may not be an *ao.HTTPResponseWriter, e.g., it
+		// implements http.Flusher as well if the passed in one does, so the
+		// type assertion w.(*ao.HTTPResponseWriter) is replaced by:
+		if aoWriter := ao.HTTPResponseWriterOf(w); aoWriter != nil {
+			fmt.Printf("status %d, %d bytes\n", aoWriter.StatusCode, aoWriter.BytesWritten)
+		}
+	}
+	http.HandleFunc("/hello", handler)
+}
@@ -13,6 +13,8 @@ import (
 	"runtime/debug"
 	"strings"
 	"time"
+
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
 )
 
 // HTTPHeaderName is a constant for the HTTP header used by AppOptics ("X-Trace") to propagate
@@ -24,7 +26,8 @@ const httpHandlerSpanName = "http.HandlerFunc"
 var httpSpanKey = contextKeyT("github.com/appoptics/appoptics-apm-go/v1/ao.HTTPSpan")
 
 // HTTPHandler wraps an http.HandlerFunc with entry / exit events,
-// returning a new handler that can be used in its place.
+// returning a new handler that can be used in its place. The trace is reported
+// by the agent selected by the request's context, see WithAgent.
 //   http.HandleFunc("/path", ao.HTTPHandler(myHandler))
 func HTTPHandler(handler func(http.ResponseWriter, *http.Request), opts ...SpanOpt) func(http.ResponseWriter, *http.Request) {
 	if Disabled() {
@@ -41,7 +44,7 @@ func HTTPHandler(handler func(http.ResponseWriter, *http.Request), opts ...SpanO
 	}
 	// return wrapped HTTP request handler
 	return func(w http.ResponseWriter, r *http.Request) {
-		if Closed() {
+		if AgentFromContext(r.Context()).Closed() {
 			handler(w, r)
 			return
 		}
@@ -64,7 +67,9 @@ func HTTPHandler(handler func(http.ResponseWriter, *http.Request), opts ...SpanO
 // http.Request, given a http.ResponseWriter and http.Request. If a distributed trace is described
 // in the HTTP request headers, the trace's context will be continued. The returned http.ResponseWriter
 // should be used in place of the one passed into this function in order to observe the response's
-// headers and status code.
+// headers and status code. It implements the same optional interfaces as the passed in one among
+// http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom, so it may not be an *HTTPResponseWriter
+// and must be accessed by HTTPResponseWriterOf instead of a type assertion.
 //   func myHandler(w http.ResponseWriter, r *http.Request) {
 //       tr, w, r := ao.TraceFromHTTPRequestResponse("myHandler", w, r)
 //       defer tr.End()
@@ -81,96 +86,119 @@ func TraceFromHTTPRequestResponse(spanName string, w http.ResponseWriter, r *htt
 		isNewContext = true
 	}
 
-	t := traceFromHTTPRequest(spanName, r, isNewContext, opts...)
+	t, optsResponse := traceFromHTTPRequest(spanName, r, isNewContext, opts...)
+	if optsResponse != "" {
+		w.Header().Set(HTTPTraceOptionsResponseHeaderName, optsResponse)
+	}
 
 	// Associate the trace with http.Request to expose it to the handler
 	r = r.WithContext(NewContext(r.Context(), t))
+	captureRequestBody(t, r)
 
 	wrapper := newResponseWriter(w, t) // wrap writer with response-observing writer
-	return t, wrapper, r
+	return t, wrapper.wrap(), r
 }
 
-// HTTPResponseWriter observes an http.ResponseWriter when WriteHeader() or Write() is called to
-// check the status code and response headers.
-type HTTPResponseWriter struct {
-	Writer      http.ResponseWriter
-	t           Trace
-	StatusCode  int
-	WroteHeader bool
-}
+// traceFromHTTPRequest returns a Trace, given an http.Request. If a distributed trace is described
+// in the "X-Trace" header, this context will be continued. The URL filters of the configuration
+// may disable tracing or force sampling of the request, and the sampling rules may change its
+// sample rate. The request headers of the configuration
+// are reported by the entry event, and the URL path and query string are redacted, see RedactURL.
+// The X-Trace header is ignored unless it comes from a trusted source or it's signed, see
+// HTTPSignatureHeaderName. The client IP is resolved from the proxy headers of the configuration.
+// A new context may be a trigger trace requested by the X-Trace-Options header, see
+// HTTPTraceOptionsHeaderName, and the X-Trace-Options-Response header is returned as well.
+func traceFromHTTPRequest(spanName string, r *http.Request, isNewContext bool, opts ...SpanOpt) (Trace, string) {
+	so := &SpanOptions{}
+	for _, f := range opts {
+		f(so)
+	}
 
-func (w *HTTPResponseWriter) Write(p []byte) (n int, err error) {
-	if !w.WroteHeader {
-		w.WriteHeader(w.StatusCode)
+	override, ignored := samplingOverrideOfURL(r.URL.Path)
+	if ignored {
+		return NewNullTrace(), ""
 	}
-	return w.Writer.Write(p)
-}
 
-// Header implements the http.ResponseWriter interface.
-func (w *HTTPResponseWriter) Header() http.Header { return w.Writer.Header() }
-
-// WriteHeader implements the http.ResponseWriter interface.
-func (w *HTTPResponseWriter) WriteHeader(status int) {
-	w.StatusCode = status                // observe HTTP status code
-	md := w.Header().Get(HTTPHeaderName) // check response for downstream metadata
-	if w.t.IsReporting() {               // set trace exit metadata in X-Trace header
-		// if downstream response headers mention a different span, add edge to it
-		if md != "" && md != w.t.ExitMetadata() {
-			w.t.AddEndArgs(keyEdge, md)
-		}
-		w.Header().Set(HTTPHeaderName, w.t.ExitMetadata()) // replace downstream MD with ours
+	redaction := currentURLRedaction()
+	urlPath := redaction.path(r.URL.EscapedPath())
+
+	// the untrusted trace context is ignored and a new trace is started instead
+	md := r.Header.Get(HTTPHeaderName)
+	if md != "" && !currentTraceTrust().trustsRequest(r, md) {
+		aolog.Debugf("Ignored the untrusted %s header from %s", HTTPHeaderName, r.RemoteAddr)
+		md = ""
 	}
-	w.WroteHeader = true
-	w.Writer.WriteHeader(status)
-}
 
-// newResponseWriter observes the HTTP Status code of an HTTP response, returning a
-// wrapped http.ResponseWriter and a pointer to an int containing the status.
-func newResponseWriter(writer http.ResponseWriter, t Trace) *HTTPResponseWriter {
-	w := &HTTPResponseWriter{Writer: writer, t: t, StatusCode: http.StatusOK}
-	t.AddEndArgs(keyStatus, &w.StatusCode)
-	// add exit event metadata to X-Trace header
-	if t.IsReporting() {
-		// add/replace response header metadata with this trace's
-		w.Header().Set(HTTPHeaderName, t.ExitMetadata())
-	}
-	return w
-}
+	resolver := currentClientIPResolver()
+	var clientIP string
+	if resolver.enabled() || resolver.metricsTag {
+		clientIP = resolver.resolve(r)
+	}
 
-// traceFromHTTPRequest returns a Trace, given an http.Request. If a distributed trace is described
-// in the "X-Trace" header, this context will be continued.
-func traceFromHTTPRequest(spanName string, r *http.Request, isNewContext bool, opts ...SpanOpt) Trace {
-	so := &SpanOptions{}
-	for _, f := range opts {
-		f(so)
+	agent := AgentFromContext(r.Context())
+	var topts *traceOptions
+	if isNewContext {
+		topts = parseTraceOptions(r.Header.Get(HTTPTraceOptionsHeaderName),
+			r.Header.Get(HTTPTraceOptionsSignatureHeaderName), agent.ServiceKey())
 	}
 
-	// start trace, passing in metadata header
-	t := NewTraceFromID(spanName, r.Header.Get(HTTPHeaderName), func() KVMap {
+	cb := func() KVMap {
 		kvs := KVMap{
-			keyMethod:      r.Method,
-			keyHTTPHost:    r.Host,
-			keyURL:         r.URL.EscapedPath(),
-			keyRemoteHost:  r.RemoteAddr,
-			keyQueryString: r.URL.RawQuery,
+			keyMethod:     r.Method,
+			keyHTTPHost:   r.Host,
+			keyURL:        urlPath,
+			keyRemoteHost: r.RemoteAddr,
+		}
+		if !redaction.dropQuery {
+			kvs[keyQueryString] = redaction.query(r.URL.RawQuery)
+		}
+		if resolver.enabled() {
+			kvs[keyClientIP] = clientIP
 		}
 
 		if so.WithBackTrace {
 			kvs[KeyBackTrace] = string(debug.Stack())
 		}
 
+		c := currentHTTPCapture()
+		headers := c.headerKVs(keyRequestHeaderPrefix, c.requestHeaders, r.Header)
+		for i := 0; i+1 < len(headers); i += 2 {
+			kvs[headers[i].(string)] = headers[i+1]
+		}
+
+		if topts != nil && topts.authorized() {
+			for k, v := range topts.kvs {
+				kvs[k] = v
+			}
+		}
 		return kvs
-	})
+	}
+
+	// start trace, passing in metadata header
+	var t Trace
+	var optsResponse string
+	if topts != nil && topts.startsTrigger(md, override) {
+		t, topts.decision = agent.newTriggeredTrace(spanName, topts.auth == traceOptionsAuthOK, cb)
+	} else {
+		t = agent.newTraceFromID(spanName, md, override, localSampleRateOf(spanName, r), cb)
+	}
+	if topts != nil {
+		optsResponse = topts.response()
+	}
 
 	// set the start time and method for metrics collection
 	t.SetMethod(r.Method)
-	t.SetPath(r.URL.EscapedPath())
+	t.SetPath(urlPath)
+	setRawPath(t, r.URL.EscapedPath())
 
 	var host string
 	if host = r.Header.Get("X-Forwarded-Host"); host == "" {
 		host = r.Host
 	}
 	t.SetHost(host)
+	if resolver.metricsTag {
+		setClientIP(t, clientIP)
+	}
 
 	// Clear the start time if it is not a new context
 	if !isNewContext {
@@ -178,5 +206,5 @@ func traceFromHTTPRequest(spanName string, r *http.Request, isNewContext bool, o
 	}
 	// update incoming metadata in request headers for any downstream readers
 	r.Header.Set(HTTPHeaderName, t.MetadataString())
-	return t
+	return t, optsResponse
 }
@@ -3,14 +3,18 @@
 package ao_test
 
 import (
+	"context"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
 	g "github.com/appoptics/appoptics-apm-go/v1/ao/internal/graphtest"
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCustomTransactionNameWithDomain(t *testing.T) {
@@ -56,3 +60,88 @@ func TestCustomTransactionNameWithDomain(t *testing.T) {
 	})
 	os.Unsetenv("APPOPTICS_PREPEND_DOMAIN")
 }
+
+func TestTransactionNameRules(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(ao.WithPrependDomain(false), ao.WithTransactionNameRules(
+		ao.TransactionNameRule{Regex: "^/api/v[0-9]+/(\\w+)", Name: "/api/$1"})))
+	defer ao.UpdateConfig(ao.WithTransactionNameRules())
+
+	// the rule takes precedence over the handler name
+	r := reporter.SetTestReporter()
+	httpTestWithEndpoint(handler404, "http://test.com/api/v2/users/123")
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, "/api/users", n.Map["TransactionName"])
+		}},
+	})
+
+	// but not over the custom transaction name
+	r = reporter.SetTestReporter()
+	httpTestWithEndpoint(handler200, "http://test.com/api/v2/users/123")
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.True(t, strings.HasPrefix(n.Map["TransactionName"].(string),
+				"final-my-custom-transaction-name"), n.Map["TransactionName"])
+		}},
+	})
+}
+
+func TestTransactionNameRulesWithPathMasks(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(ao.WithPrependDomain(false), ao.WithURLPathMasks("^v[0-9]+$"),
+		ao.WithTransactionNameRules(ao.TransactionNameRule{Regex: "^/api/v[0-9]+/(\\w+)", Name: "/api/$1"})))
+	defer ao.UpdateConfig(ao.WithTransactionNameRules(), ao.WithURLPathMasks())
+
+	// the rule matches the path before it's masked
+	r := reporter.SetTestReporter()
+	httpTestWithEndpoint(handler404, "http://test.com/api/v2/users/123")
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.Equal(t, "/api/*/users/123", n.Map["URL"])
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, "/api/users", n.Map["TransactionName"])
+		}},
+	})
+}
+
+func TestFrameworkTransactionName(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(ao.WithPrependDomain(false)))
+	handler := func(name string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ao.SetFrameworkTransactionName(r.Context(), "GET /route")
+			if name != "" {
+				ao.SetTransactionName(r.Context(), name)
+			}
+		}
+	}
+
+	// the framework name takes precedence over the handler name
+	r := reporter.SetTestReporter()
+	httpTestWithEndpoint(handler(""), "http://test.com/route/1")
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, "GET /route", n.Map["TransactionName"])
+		}},
+	})
+
+	// but not over the custom transaction name
+	r = reporter.SetTestReporter()
+	httpTestWithEndpoint(handler("custom"), "http://test.com/route/1")
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, "custom", n.Map["TransactionName"])
+		}},
+	})
+
+	// no-op without a trace
+	ao.SetFrameworkTransactionName(context.Background(), "GET /route")
+}
@@ -4,7 +4,11 @@
 package ao_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net"
@@ -92,6 +96,23 @@ func httpTest(f http.HandlerFunc, opts ...ao.SpanOpt) *httptest.ResponseRecorder
 	return httpTestWithEndpoint(f, "http://test.com/hello?testq", opts...)
 }
 
+// httpTraceFrom serves a request from the remote address, if any, with the
+// headers by handler200 and a new test reporter, which is returned along with
+// the response. The reporter is not closed.
+func httpTraceFrom(remoteAddr string, hd map[string]string, opts ...reporter.TestReporterOption) (*reporter.TestReporter, *httptest.ResponseRecorder) {
+	r := reporter.SetTestReporter(opts...)
+	req := httptest.NewRequest("GET", "http://test.com/hello", nil)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	for k, v := range hd {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	http.HandlerFunc(ao.HTTPHandler(handler200)).ServeHTTP(w, req)
+	return r, w
+}
+
 func TestHTTPHandler404(t *testing.T) {
 	r := reporter.SetTestReporter() // set up test reporter
 	response := httpTest(handler404)
@@ -834,3 +855,439 @@ func TestHTTPHandlerOpts(t *testing.T) {
 		}},
 	})
 }
+
+func TestHTTPHandlerURLFilters(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(ao.WithURLFilters(
+		ao.URLFilter{Regex: "^/healthz$", Action: ao.URLFilterNoMetrics},
+		ao.URLFilter{Extensions: []string{"css", "js"}, Action: ao.URLFilterNoTracing},
+		ao.URLFilter{Regex: "^/checkout", Action: ao.URLFilterForceSample},
+	)))
+	defer ao.UpdateConfig(ao.WithURLFilters())
+
+	// ignored entirely, the X-Trace header is not set
+	r := reporter.SetTestReporter()
+	response := httpTestWithEndpoint(handler404, "http://test.com/healthz")
+	assert.Empty(t, response.HeaderMap.Get(ao.HTTPHeaderName))
+	assert.Len(t, r.EventBufs, 0)
+
+	// not traced, the extension is case-insensitive
+	r = reporter.SetTestReporter()
+	response = httpTestWithEndpoint(handler404, "http://test.com/static/style.CSS")
+	xt := response.HeaderMap.Get(ao.HTTPHeaderName)
+	assert.True(t, reporter.ValidMetadata(xt))
+	assert.True(t, strings.HasSuffix(xt, "00"), xt)
+	assert.Len(t, r.EventBufs, 0)
+
+	// always traced, even if there is no sampling setting
+	r = reporter.SetTestReporter(reporter.TestReporterDisableDefaultSetting(true))
+	response = httpTestWithEndpoint(handler404, "http://test.com/checkout/cart")
+	xt = response.HeaderMap.Get(ao.HTTPHeaderName)
+	assert.True(t, strings.HasSuffix(xt, "01"), xt)
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.Equal(t, "/checkout/cart", n.Map["URL"])
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}},
+	})
+
+	// the other requests are sampled by the settings
+	r = reporter.SetTestReporter(reporter.TestReporterDisableDefaultSetting(true))
+	httpTestWithEndpoint(handler404, "http://test.com/hello")
+	assert.Len(t, r.EventBufs, 0)
+}
+
+// minimalResponseWriter implements none of the optional interfaces
+type minimalResponseWriter struct{ http.ResponseWriter }
+
+func TestHTTPResponseWriterInterfaces(t *testing.T) {
+	r := reporter.SetTestReporter()
+	req := httptest.NewRequest("GET", "http://test.com/hello", nil)
+
+	// httptest.ResponseRecorder only implements http.Flusher
+	rec := httptest.NewRecorder()
+	tr, w, _ := ao.TraceFromHTTPRequestResponse("test", rec, req)
+	_, ok := w.(http.Flusher)
+	assert.True(t, ok)
+	_, ok = w.(http.Hijacker)
+	assert.False(t, ok)
+	_, ok = w.(http.Pusher)
+	assert.False(t, ok)
+	_, ok = w.(io.ReaderFrom)
+	assert.False(t, ok)
+	require.NotNil(t, ao.HTTPResponseWriterOf(w))
+	assert.Equal(t, rec, ao.HTTPResponseWriterOf(w).Writer)
+	u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+	require.True(t, ok)
+	assert.Equal(t, rec, u.Unwrap())
+	w.(http.Flusher).Flush()
+	assert.True(t, rec.Flushed)
+	tr.End()
+
+	tr, w, _ = ao.TraceFromHTTPRequestResponse("test", minimalResponseWriter{httptest.NewRecorder()}, req)
+	_, ok = w.(http.Flusher)
+	assert.False(t, ok)
+	assert.NotNil(t, ao.HTTPResponseWriterOf(w))
+	tr.End()
+
+	assert.Nil(t, ao.HTTPResponseWriterOf(rec))
+	r.Close(4)
+}
+
+func TestHTTPResponseWriterStats(t *testing.T) {
+	r := reporter.SetTestReporter()
+	httpTest(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello "))
+		w.Write([]byte("world"))
+	})
+
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.EqualValues(t, 200, n.Map["Status"])
+			assert.EqualValues(t, 11, n.Map["ResponseBytes"])
+			assert.Contains(t, n.Map, "TimeToFirstByte")
+			assert.NotContains(t, n.Map, "Hijacked")
+		}},
+	})
+}
+
+func TestHTTPResponseWriterHijack(t *testing.T) {
+	r := reporter.SetTestReporter()
+	s := httptest.NewServer(http.HandlerFunc(ao.HTTPHandler(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/copy" {
+			// io.Copy uses the ReadFrom method of the underlying writer
+			_, ok := w.(io.ReaderFrom)
+			assert.True(t, ok)
+			io.Copy(w, strings.NewReader("hello world"))
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		rw.Flush()
+	})))
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/hijack")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, true, n.Map["Hijacked"])
+			assert.EqualValues(t, 0, n.Map["ResponseBytes"])
+		}},
+	})
+
+	r = reporter.SetTestReporter()
+	resp, err = http.Get(s.URL + "/copy")
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello world", string(body))
+
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.EqualValues(t, 11, n.Map["ResponseBytes"])
+		}},
+	})
+}
+
+func TestHTTPCapture(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(
+		ao.WithCaptureRequestHeaders("User-Agent", "Authorization", "X-Request-Id"),
+		ao.WithCaptureResponseHeaders("Content-Type", "Set-Cookie"),
+		ao.WithCaptureBodyContentTypes("application/json"),
+		ao.WithCaptureBodyMaxBytes(16)))
+	defer ao.UpdateConfig(ao.WithCaptureRequestHeaders(), ao.WithCaptureResponseHeaders(),
+		ao.WithCaptureBodyContentTypes(), ao.WithCaptureBodyMaxBytes(1024))
+
+	r := reporter.SetTestReporter()
+	h := http.HandlerFunc(ao.HTTPHandler(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, `{"name":"test"}`, string(body))
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret", Path: "/"})
+		w.Write([]byte(`{"id":123,"name":"test"}`))
+	}))
+	req := httptest.NewRequest("POST", "http://test.com/users", strings.NewReader(`{"name":"test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.Equal(t, "test-agent", n.Map["Request-Header-User-Agent"])
+			assert.Equal(t, "Basic [REDACTED]", n.Map["Request-Header-Authorization"])
+			assert.NotContains(t, n.Map, "Request-Header-X-Request-Id")
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, `{"name":"test"}`, n.Map["Request-Body"])
+			assert.Equal(t, false, n.Map["Request-Body-Truncated"])
+			assert.NotContains(t, n.Map, "Response-Header-Content-Type")
+			assert.Equal(t, "session=[REDACTED]; Path=/", n.Map["Response-Header-Set-Cookie"])
+			// the response has no content type and is sniffed as text/plain
+			assert.NotContains(t, n.Map, "Response-Body")
+		}},
+	})
+
+	// the response body is captured up to the limit
+	r = reporter.SetTestReporter()
+	httpTest(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":123,`))
+		w.Write([]byte(`"name":"test"}`))
+	})
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, `{"id":123,"name"`, n.Map["Response-Body"])
+			assert.Equal(t, true, n.Map["Response-Body-Truncated"])
+			assert.Equal(t, "application/json", n.Map["Response-Header-Content-Type"])
+			assert.NotContains(t, n.Map, "Request-Body")
+		}},
+	})
+}
+
+func TestHTTPURLRedaction(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(ao.WithURLPathMasks("^.+@.+$")))
+	defer ao.UpdateConfig(ao.WithURLPathMasks(), ao.WithDropQueryString(false))
+
+	r := reporter.SetTestReporter()
+	httpTestWithEndpoint(func(w http.ResponseWriter, req *http.Request) {
+		// the outbound URL is redacted as well
+		out, _ := http.NewRequest("GET", "http://example.com/users/me@example.com?q=1&api_key=abc", nil)
+		ao.BeginHTTPClientSpan(req.Context(), out).End()
+	}, "http://test.com/users/me@example.com/orders?q=1&token=abc")
+
+	r.Close(4)
+	g.AssertGraph(t, r.EventBufs, 4, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.Equal(t, "/users/*/orders", n.Map["URL"])
+			assert.Equal(t, "q=1&token=?", n.Map["Query-String"])
+		}},
+		{"http.Client", "entry"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}, Callback: func(n g.Node) {
+			assert.Equal(t, "http://example.com/users/*?q=1&api_key=?", n.Map["RemoteURL"])
+		}},
+		{"http.Client", "exit"}: {Edges: g.Edges{{"http.Client", "entry"}}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.Client", "exit"}, {"http.HandlerFunc", "entry"}}},
+	})
+
+	// the query string is dropped entirely
+	require.NoError(t, ao.UpdateConfig(ao.WithDropQueryString(true)))
+	r = reporter.SetTestReporter()
+	httpTestWithEndpoint(handler404, "http://test.com/hello?q=1")
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.Equal(t, "/hello", n.Map["URL"])
+			assert.NotContains(t, n.Map, "Query-String")
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}},
+	})
+}
+
+func TestHTTPTraceTrust(t *testing.T) {
+	const (
+		opID = "89ABCDEF01234567"
+		md   = "2B0123456789ABCDEF0123456789ABCDEF01234567" + opID + "01"
+	)
+	require.NoError(t, ao.UpdateConfig(ao.WithTrustedTraceSources("10.0.0.0/8", "192.168.1.1")))
+	defer ao.UpdateConfig(ao.WithTrustedTraceSources(), ao.WithTraceContextSecret(""),
+		ao.WithTraceContextSignDestinations())
+
+	// asserts the edges of the entry event of a request from the remote
+	// address with the trace context and the headers
+	assertEntryEdges := func(remoteAddr string, hd map[string]string, edges g.Edges) {
+		headers := map[string]string{ao.HTTPHeaderName: md}
+		for k, v := range hd {
+			headers[k] = v
+		}
+		r, _ := httpTraceFrom(remoteAddr, headers)
+		r.Close(2)
+		g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+			{"http.HandlerFunc", "entry"}: {Edges: edges},
+			{"http.HandlerFunc", "exit"}:  {Edges: g.Edges{{"http.HandlerFunc", "entry"}}},
+		})
+	}
+	continued := g.Edges{{"Edge", opID}}
+
+	// trusted remote addresses
+	assertEntryEdges("10.1.2.3:1234", nil, continued)
+	assertEntryEdges("192.168.1.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.1, 10.0.0.2"}, continued)
+
+	// untrusted, a new trace is started
+	assertEntryEdges("192.168.1.2:1234", nil, g.Edges{})
+	assertEntryEdges("10.1.2.3:1234", map[string]string{"X-Forwarded-For": "203.0.113.1"}, g.Edges{})
+
+	// signed by the shared secret
+	require.NoError(t, ao.UpdateConfig(ao.WithTraceContextSecret("secret")))
+	signAt := func(md string, ts int64) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(fmt.Sprintf("%s;%d", md, ts)))
+		return fmt.Sprintf("ts=%d;sig=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+	}
+	now := time.Now().Unix()
+	assertEntryEdges("203.0.113.1:1234", map[string]string{ao.HTTPSignatureHeaderName: signAt(md, now)}, continued)
+	assertEntryEdges("203.0.113.1:1234", map[string]string{ao.HTTPSignatureHeaderName: "bad"}, g.Edges{})
+	assertEntryEdges("10.1.2.3:1234", nil, continued)
+
+	// the signature of another trace context or timestamp is rejected
+	assertEntryEdges("203.0.113.1:1234", map[string]string{
+		ao.HTTPSignatureHeaderName: strings.Replace(signAt(md, now), fmt.Sprint(now), fmt.Sprint(now-1), 1)}, g.Edges{})
+	assertEntryEdges("203.0.113.1:1234", map[string]string{
+		ao.HTTPSignatureHeaderName: signAt(strings.Replace(md, "01", "00", 1), now)}, g.Edges{})
+
+	// the expired signature is rejected
+	assertEntryEdges("203.0.113.1:1234", map[string]string{
+		ao.HTTPSignatureHeaderName: signAt(md, now-int64(10*time.Minute/time.Second))}, g.Edges{})
+	assertEntryEdges("203.0.113.1:1234", map[string]string{
+		ao.HTTPSignatureHeaderName: signAt(md, now+int64(10*time.Minute/time.Second))}, g.Edges{})
+
+	outbound := func(url string) *http.Request {
+		r := reporter.SetTestReporter()
+		ctx := ao.NewContext(context.Background(), ao.NewTrace("test"))
+		req, _ := http.NewRequest("GET", url, nil)
+		ao.BeginHTTPClientSpan(ctx, req).End()
+		ao.EndTrace(ctx)
+		r.Close(4)
+		return req
+	}
+
+	// the outbound trace context is signed
+	req := outbound("http://example.com")
+	sig := req.Header.Get(ao.HTTPSignatureHeaderName)
+	require.True(t, strings.HasPrefix(sig, "ts="), sig)
+	ts, err := strconv.ParseInt(strings.SplitN(strings.TrimPrefix(sig, "ts="), ";", 2)[0], 10, 64)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(ts, 0), time.Minute)
+	assert.Equal(t, signAt(req.Header.Get(ao.HTTPHeaderName), ts), sig)
+
+	// only the trace context to the destinations is signed
+	require.NoError(t, ao.UpdateConfig(ao.WithTraceContextSignDestinations("api.example.com", "*.internal.example.com")))
+	assert.NotEmpty(t, outbound("http://API.example.com:8080/v1").Header.Get(ao.HTTPSignatureHeaderName))
+	assert.NotEmpty(t, outbound("http://svc.internal.example.com").Header.Get(ao.HTTPSignatureHeaderName))
+	assert.Empty(t, outbound("http://example.com").Header.Get(ao.HTTPSignatureHeaderName))
+	assert.Empty(t, outbound("http://internal.example.com").Header.Get(ao.HTTPSignatureHeaderName))
+	assert.Empty(t, outbound("http://third-party.com").Header.Get(ao.HTTPSignatureHeaderName))
+}
+
+func TestHTTPClientIP(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(ao.WithClientIPHeaders(ao.ClientIPHeaderXForwardedFor),
+		ao.WithTrustedProxies("10.0.0.0/8")))
+	defer ao.UpdateConfig(ao.WithClientIPHeaders(), ao.WithTrustedProxies())
+
+	xff := map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.1, 10.0.0.1"}
+	r, _ := httpTraceFrom("10.1.2.3:1234", xff)
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.Equal(t, "203.0.113.1", n.Map["Client-IP"])
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}},
+	})
+
+	// not reported unless it's configured
+	require.NoError(t, ao.UpdateConfig(ao.WithClientIPHeaders()))
+	r, _ = httpTraceFrom("10.1.2.3:1234", xff)
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.NotContains(t, n.Map, "Client-IP")
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}},
+	})
+}
+
+func TestHTTPTriggerTrace(t *testing.T) {
+	// the requests are not sampled unless they are triggered
+	notSampled := reporter.TestReporterShouldTrace(false)
+
+	r, w := httpTraceFrom("", map[string]string{ao.HTTPTraceOptionsHeaderName: "trigger-trace;custom-ticket=1234;foo"}, notSampled)
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.Equal(t, true, n.Map["TriggeredTrace"])
+			assert.Equal(t, "1234", n.Map["custom-ticket"])
+			assert.NotContains(t, n.Map, "foo")
+			assert.NotContains(t, n.Map, "SampleRate")
+			assert.NotContains(t, n.Map, "SampleSource")
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}},
+	})
+	assert.Equal(t, "trigger-trace=ok;ignored=foo", w.Header().Get(ao.HTTPTraceOptionsResponseHeaderName))
+	assert.NotEmpty(t, w.Header().Get(ao.HTTPHeaderName))
+
+	// not requested
+	r, w = httpTraceFrom("", nil, notSampled)
+	r.Close(0)
+	assert.Empty(t, w.Header().Get(ao.HTTPTraceOptionsResponseHeaderName))
+	r, w = httpTraceFrom("", map[string]string{ao.HTTPTraceOptionsHeaderName: "custom-ticket=1234"}, notSampled)
+	r.Close(0)
+	assert.Equal(t, "trigger-trace=not-requested", w.Header().Get(ao.HTTPTraceOptionsResponseHeaderName))
+
+	// the signature can't be verified without a service key
+	r, w = httpTraceFrom("", map[string]string{
+		ao.HTTPTraceOptionsHeaderName:          fmt.Sprintf("trigger-trace;ts=%d", time.Now().Unix()),
+		ao.HTTPTraceOptionsSignatureHeaderName: "0123456789abcdef",
+	}, notSampled)
+	r.Close(0)
+	assert.Equal(t, "auth=no-signature-key", w.Header().Get(ao.HTTPTraceOptionsResponseHeaderName))
+
+	// disabled by the configuration
+	require.NoError(t, ao.UpdateConfig(ao.WithTriggerTrace(false)))
+	defer ao.UpdateConfig(ao.WithTriggerTrace(true))
+	r, w = httpTraceFrom("", map[string]string{ao.HTTPTraceOptionsHeaderName: "trigger-trace"}, notSampled)
+	r.Close(0)
+	assert.Equal(t, "trigger-trace=trigger-tracing-disabled", w.Header().Get(ao.HTTPTraceOptionsResponseHeaderName))
+}
+
+func TestHTTPSamplingRules(t *testing.T) {
+	require.NoError(t, ao.UpdateConfig(ao.WithSamplingRules(
+		ao.SamplingRule{URL: "^/health", SampleRate: 0},
+		ao.SamplingRule{Method: "POST", SampleRate: 1000000, Override: true},
+	)))
+	defer ao.UpdateConfig(ao.WithSamplingRules())
+
+	// stricter than the remote settings
+	r := reporter.SetTestReporter()
+	http.HandlerFunc(ao.HTTPHandler(handler200)).ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("GET", "http://test.com/health", nil))
+	r.Close(0)
+	assert.Len(t, r.EventBufs, 0)
+
+	// the local rule is applied
+	r = reporter.SetTestReporter()
+	http.HandlerFunc(ao.HTTPHandler(handler200)).ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("POST", "http://test.com/hello", nil))
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"http.HandlerFunc", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.EqualValues(t, 1000000, n.Map["SampleRate"])
+			assert.EqualValues(t, 4, n.Map["SampleSource"])
+		}},
+		{"http.HandlerFunc", "exit"}: {Edges: g.Edges{{"http.HandlerFunc", "entry"}}},
+	})
+
+	// by the span name
+	require.NoError(t, ao.UpdateConfig(ao.WithSamplingRules(ao.SamplingRule{SpanName: "cron", SampleRate: 0})))
+	r = reporter.SetTestReporter()
+	ao.NewTrace("cron").End()
+	ao.NewTrace("job").End()
+	r.Close(2)
+	g.AssertGraph(t, r.EventBufs, 2, g.AssertNodeMap{
+		{"job", "entry"}: {Edges: g.Edges{}, Callback: func(n g.Node) {
+			assert.EqualValues(t, 2, n.Map["SampleSource"])
+		}},
+		{"job", "exit"}: {Edges: g.Edges{{"job", "entry"}}},
+	})
+}
@@ -0,0 +1,288 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPResponseWriter observes an http.ResponseWriter when WriteHeader() or Write() is called to
+// check the status code and response headers. The number of bytes written, the time to the first
+// byte and whether the connection is hijacked are reported by the exit event of the trace and
+// recorded in the metrics.
+type HTTPResponseWriter struct {
+	Writer      http.ResponseWriter
+	t           Trace
+	StatusCode  int
+	WroteHeader bool
+	// The number of bytes of the response body written
+	BytesWritten int64
+	// Whether the connection is hijacked, e.g., by a websocket
+	Hijacked bool
+	start    time.Time
+	ttfbSet  bool
+	// the capturing configuration of the response if the trace is reporting
+	capture     *httpCapture
+	body        *bodyCapture
+	bodyChecked bool
+}
+
+func (w *HTTPResponseWriter) Write(p []byte) (n int, err error) {
+	if !w.WroteHeader {
+		w.WriteHeader(w.StatusCode)
+	}
+	w.checkBodyCapture(p)
+	n, err = w.Writer.Write(p)
+	w.BytesWritten += int64(n)
+	if w.body != nil {
+		w.body.capture(p[:n])
+	}
+	return n, err
+}
+
+// Header implements the http.ResponseWriter interface.
+func (w *HTTPResponseWriter) Header() http.Header { return w.Writer.Header() }
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *HTTPResponseWriter) WriteHeader(status int) {
+	w.StatusCode = status                // observe HTTP status code
+	md := w.Header().Get(HTTPHeaderName) // check response for downstream metadata
+	if w.t.IsReporting() {               // set trace exit metadata in X-Trace header
+		// if downstream response headers mention a different span, add edge to it
+		if md != "" && md != w.t.ExitMetadata() {
+			w.t.AddEndArgs(keyEdge, md)
+		}
+		w.Header().Set(HTTPHeaderName, w.t.ExitMetadata()) // replace downstream MD with ours
+	}
+	if !w.ttfbSet {
+		w.ttfbSet = true
+		w.t.AddEndArgs(keyTTFB, int64(time.Since(w.start)/time.Microsecond))
+		if w.capture != nil {
+			w.t.AddEndArgs(w.capture.headerKVs(keyResponseHeaderPrefix, w.capture.responseHeaders, w.Header())...)
+		}
+	}
+	w.WroteHeader = true
+	w.Writer.WriteHeader(status)
+}
+
+// flush implements the http.Flusher interface if the wrapped writer does.
+func (w *HTTPResponseWriter) flush() {
+	if !w.WroteHeader {
+		w.WriteHeader(w.StatusCode)
+	}
+	w.Writer.(http.Flusher).Flush()
+}
+
+// hijack implements the http.Hijacker interface if the wrapped writer does.
+func (w *HTTPResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.Writer.(http.Hijacker).Hijack()
+	if err == nil && !w.Hijacked {
+		w.Hijacked = true
+		w.t.AddEndArgs(keyHijacked, true)
+	}
+	return conn, rw, err
+}
+
+// push implements the http.Pusher interface if the wrapped writer does.
+func (w *HTTPResponseWriter) push(target string, opts *http.PushOptions) error {
+	return w.Writer.(http.Pusher).Push(target, opts)
+}
+
+// readFrom implements the io.ReaderFrom interface if the wrapped writer does.
+func (w *HTTPResponseWriter) readFrom(src io.Reader) (int64, error) {
+	if !w.WroteHeader {
+		w.WriteHeader(w.StatusCode)
+	}
+	if w.checkBodyCapture(nil); w.body != nil {
+		src = io.TeeReader(src, w.body)
+	}
+	n, err := w.Writer.(io.ReaderFrom).ReadFrom(src)
+	w.BytesWritten += n
+	return n, err
+}
+
+// checkBodyCapture checks if the response body is captured by its content type
+// before the first write. The content type is sniffed from the first bytes if
+// it's not set.
+func (w *HTTPResponseWriter) checkBodyCapture(p []byte) {
+	if w.capture == nil || w.bodyChecked {
+		return
+	}
+	w.bodyChecked = true
+	ct := w.Header().Get("Content-Type")
+	if ct == "" && len(p) > 0 {
+		ct = http.DetectContentType(p)
+	}
+	if w.capture.capturesBody(ct) {
+		w.body = newBodyCapture(w.t, w.capture, keyResponseBody, keyResponseBodyTruncated)
+	}
+}
+
+// newResponseWriter observes the HTTP Status code of an HTTP response, returning a
+// wrapped http.ResponseWriter and a pointer to an int containing the status.
+func newResponseWriter(writer http.ResponseWriter, t Trace) *HTTPResponseWriter {
+	w := &HTTPResponseWriter{Writer: writer, t: t, StatusCode: http.StatusOK, start: time.Now()}
+	t.AddEndArgs(keyStatus, &w.StatusCode, keyResponseBytes, &w.BytesWritten)
+	// add exit event metadata to X-Trace header
+	if t.IsReporting() {
+		// add/replace response header metadata with this trace's
+		w.Header().Set(HTTPHeaderName, t.ExitMetadata())
+		w.capture = currentHTTPCapture()
+	}
+	return w
+}
+
+// Unwrap returns the wrapped writer, e.g., for http.ResponseController.
+func (w *HTTPResponseWriter) Unwrap() http.ResponseWriter { return w.Writer }
+
+// HTTPResponseWriterOf returns the HTTPResponseWriter of a writer returned by
+// TraceFromHTTPRequestResponse, or nil if it's not such a writer. It replaces
+// the type assertion w.(*HTTPResponseWriter), which panics if the writer
+// implements any optional interface, e.g., http.Flusher.
+func HTTPResponseWriterOf(w http.ResponseWriter) *HTTPResponseWriter {
+	if o, ok := w.(interface{ observer() *HTTPResponseWriter }); ok {
+		return o.observer()
+	}
+	return nil
+}
+
+func (w *HTTPResponseWriter) observer() *HTTPResponseWriter { return w }
+
+// The optional interfaces implemented by the methods of HTTPResponseWriter
+type (
+	responseFlusher    struct{ w *HTTPResponseWriter }
+	responseHijacker   struct{ w *HTTPResponseWriter }
+	responsePusher     struct{ w *HTTPResponseWriter }
+	responseReaderFrom struct{ w *HTTPResponseWriter }
+)
+
+func (f responseFlusher) Flush() { f.w.flush() }
+func (h responseHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.w.hijack()
+}
+func (p responsePusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.push(target, opts)
+}
+func (r responseReaderFrom) ReadFrom(src io.Reader) (int64, error) { return r.w.readFrom(src) }
+
+// wrap returns a writer which implements exactly the optional interfaces of
+// the wrapped writer among http.Flusher, http.Hijacker, http.Pusher and
+// io.ReaderFrom.
+func (w *HTTPResponseWriter) wrap() http.ResponseWriter {
+	var mask int
+	if _, ok := w.Writer.(http.Flusher); ok {
+		mask |= 1
+	}
+	if _, ok := w.Writer.(http.Hijacker); ok {
+		mask |= 2
+	}
+	if _, ok := w.Writer.(http.Pusher); ok {
+		mask |= 4
+	}
+	if _, ok := w.Writer.(io.ReaderFrom); ok {
+		mask |= 8
+	}
+
+	f, h, p, r := responseFlusher{w}, responseHijacker{w}, responsePusher{w}, responseReaderFrom{w}
+	switch mask {
+	case 0:
+		return w
+	case 1:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+		}{w, f}
+	case 2:
+		return struct {
+			*HTTPResponseWriter
+			http.Hijacker
+		}{w, h}
+	case 3:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case 4:
+		return struct {
+			*HTTPResponseWriter
+			http.Pusher
+		}{w, p}
+	case 5:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case 6:
+		return struct {
+			*HTTPResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case 7:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	case 8:
+		return struct {
+			*HTTPResponseWriter
+			io.ReaderFrom
+		}{w, r}
+	case 9:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+			io.ReaderFrom
+		}{w, f, r}
+	case 10:
+		return struct {
+			*HTTPResponseWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{w, h, r}
+	case 11:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{w, f, h, r}
+	case 12:
+		return struct {
+			*HTTPResponseWriter
+			http.Pusher
+			io.ReaderFrom
+		}{w, p, r}
+	case 13:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{w, f, p, r}
+	case 14:
+		return struct {
+			*HTTPResponseWriter
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{w, h, p, r}
+	case 15:
+		return struct {
+			*HTTPResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{w, f, h, p, r}
+	}
+	return w
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// WithCaptureRequestHeaders defines a Config option for the request headers
+// reported by the entry events of the inbound HTTP requests.
+func WithCaptureRequestHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.CaptureRequestHeaders = headers
+	}
+}
+
+// WithCaptureResponseHeaders defines a Config option for the response headers
+// reported by the exit events of the inbound HTTP requests.
+func WithCaptureResponseHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.CaptureResponseHeaders = headers
+	}
+}
+
+// WithRedactedHeaders defines a Config option for the headers whose values are
+// redacted, in addition to the authorization and cookie headers.
+func WithRedactedHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.RedactedHeaders = headers
+	}
+}
+
+// WithCaptureBodyContentTypes defines a Config option for the content types of
+// the request and response bodies to capture.
+func WithCaptureBodyContentTypes(types ...string) Option {
+	return func(c *Config) {
+		c.CaptureBodyContentTypes = types
+	}
+}
+
+// WithCaptureBodyMaxBytes defines a Config option for the maximum number of
+// bytes captured of a request or response body.
+func WithCaptureBodyMaxBytes(max int) Option {
+	return func(c *Config) {
+		c.CaptureBodyMaxBytes = max
+	}
+}
+
+// validateHeaderNames checks if the names are valid HTTP header names.
+func validateHeaderNames(names []string) error {
+	for _, name := range names {
+		if !IsValidHeaderName(name) {
+			return fmt.Errorf("invalid header name: %q", name)
+		}
+	}
+	return nil
+}
+
+// IsValidHeaderName checks if the name is a single HTTP header name, i.e., a
+// non-empty HTTP token.
+func IsValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateBodyContentTypes checks if the content types are valid media types,
+// e.g., "application/json", or wildcards of a type, e.g., "text/*".
+func validateBodyContentTypes(types []string) error {
+	for _, t := range types {
+		if _, _, err := mime.ParseMediaType(t); err != nil || !strings.Contains(t, "/") {
+			return fmt.Errorf("invalid content type: %q", t)
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated list and trims the spaces.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// IsValidHeaderNames checks if the string is a comma separated list of HTTP
+// header names
+func IsValidHeaderNames(s string) bool {
+	return validateHeaderNames(splitList(s)) == nil
+}
+
+// IsValidContentTypes checks if the string is a comma separated list of
+// content types
+func IsValidContentTypes(s string) bool {
+	return validateBodyContentTypes(splitList(s)) == nil
+}
+
+// ToStringList converts a comma separated list to a slice of strings
+func ToStringList(s string) interface{} {
+	return splitList(s)
+}
+
+// IsValidPositiveInteger checks if the string is a positive integer
+func IsValidPositiveInteger(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureValidators(t *testing.T) {
+	assert.True(t, IsValidHeaderNames("User-Agent, X-Request-Id"))
+	assert.True(t, IsValidHeaderNames(""))
+	assert.False(t, IsValidHeaderNames("User Agent"))
+	assert.False(t, IsValidHeaderNames("X-Id:"))
+	assert.True(t, IsValidHeaderName("X-Request-Id"))
+	assert.False(t, IsValidHeaderName("X-A,X-B"))
+	assert.False(t, IsValidHeaderName(""))
+
+	assert.True(t, IsValidContentTypes("application/json,text/*"))
+	assert.False(t, IsValidContentTypes("json"))
+	assert.False(t, IsValidContentTypes("text/;"))
+
+	assert.True(t, IsValidPositiveInteger("10"))
+	assert.False(t, IsValidPositiveInteger("0"))
+	assert.False(t, IsValidPositiveInteger("abc"))
+}
+
+func TestLoadCapture(t *testing.T) {
+	unsetDynamicEnvs()
+	c := NewConfig()
+	assert.Empty(t, c.GetCaptureRequestHeaders())
+	assert.Empty(t, c.GetCaptureResponseHeaders())
+	assert.Empty(t, c.GetRedactedHeaders())
+	assert.Empty(t, c.GetCaptureBodyContentTypes())
+	assert.Equal(t, 1024, c.GetCaptureBodyMaxBytes())
+
+	os.Setenv(envAppOpticsCaptureReqHeaders, "User-Agent, X-Request-Id")
+	os.Setenv(envAppOpticsCaptureRespHeaders, "Content-Type")
+	os.Setenv(envAppOpticsRedactedHeaders, "X-Api-Key")
+	os.Setenv(envAppOpticsCaptureBodyTypes, "application/json")
+	os.Setenv(envAppOpticsCaptureBodyMaxBytes, "256")
+	defer unsetDynamicEnvs()
+	c = NewConfig()
+	assert.Equal(t, []string{"User-Agent", "X-Request-Id"}, c.GetCaptureRequestHeaders())
+	assert.Equal(t, []string{"Content-Type"}, c.GetCaptureResponseHeaders())
+	assert.Equal(t, []string{"X-Api-Key"}, c.GetRedactedHeaders())
+	assert.Equal(t, []string{"application/json"}, c.GetCaptureBodyContentTypes())
+	assert.Equal(t, 256, c.GetCaptureBodyMaxBytes())
+
+	// the invalid values are ignored
+	os.Setenv(envAppOpticsCaptureReqHeaders, "User Agent")
+	os.Setenv(envAppOpticsCaptureBodyMaxBytes, "-1")
+	c = NewConfig()
+	assert.Empty(t, c.GetCaptureRequestHeaders())
+	assert.Equal(t, 1024, c.GetCaptureBodyMaxBytes())
+
+	require.NoError(t, c.Update(WithCaptureRequestHeaders("Accept"), WithCaptureBodyMaxBytes(64)))
+	assert.Equal(t, []string{"Accept"}, c.GetCaptureRequestHeaders())
+	assert.Equal(t, 64, c.GetCaptureBodyMaxBytes())
+	assert.Error(t, c.Update(WithCaptureBodyContentTypes("json")))
+	assert.Error(t, c.Update(WithCaptureBodyMaxBytes(0)))
+	assert.Equal(t, []string{"application/json"}, c.GetCaptureBodyContentTypes())
+	assert.Equal(t, 64, c.GetCaptureBodyMaxBytes())
+}
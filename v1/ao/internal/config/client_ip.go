@@ -0,0 +1,72 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"fmt"
+	"net/textproto"
+	"strconv"
+)
+
+// The headers to resolve the client IP of the inbound HTTP requests
+const (
+	ClientIPHeaderXForwardedFor = "X-Forwarded-For"
+	ClientIPHeaderXRealIP       = "X-Real-Ip"
+	ClientIPHeaderForwarded     = "Forwarded"
+)
+
+// WithClientIPHeaders defines a Config option for the headers to resolve the
+// client IP, in the order of preference.
+func WithClientIPHeaders(headers ...string) Option {
+	return func(c *Config) {
+		c.ClientIPHeaders = headers
+	}
+}
+
+// WithTrustedProxies defines a Config option for the CIDRs or IP addresses of
+// the trusted proxies.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(c *Config) {
+		c.TrustedProxies = proxies
+	}
+}
+
+// WithTrustedProxyCount defines a Config option for the number of the trusted
+// proxies in front of the application.
+func WithTrustedProxyCount(count int) Option {
+	return func(c *Config) {
+		c.TrustedProxyCount = count
+	}
+}
+
+// WithClientIPMetricsTag defines a Config option for whether the client IP is
+// a tag of the metrics.
+func WithClientIPMetricsTag(enabled bool) Option {
+	return func(c *Config) {
+		c.ClientIPMetricsTag = enabled
+	}
+}
+
+// validateClientIPHeaders checks if the headers are supported.
+func validateClientIPHeaders(headers []string) error {
+	for _, h := range headers {
+		switch textproto.CanonicalMIMEHeaderKey(h) {
+		case ClientIPHeaderXForwardedFor, ClientIPHeaderXRealIP, ClientIPHeaderForwarded:
+		default:
+			return fmt.Errorf("unsupported client IP header: %q", h)
+		}
+	}
+	return nil
+}
+
+// IsValidClientIPHeaders checks if the string is a comma separated list of the
+// supported client IP headers
+func IsValidClientIPHeaders(s string) bool {
+	return validateClientIPHeaders(splitList(s)) == nil
+}
+
+// IsValidNonNegativeInteger checks if the string is a non-negative integer
+func IsValidNonNegativeInteger(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 0
+}
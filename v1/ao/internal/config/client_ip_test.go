@@ -0,0 +1,59 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsValidClientIPHeaders(t *testing.T) {
+	assert.True(t, IsValidClientIPHeaders("X-Forwarded-For"))
+	assert.True(t, IsValidClientIPHeaders("x-real-ip, Forwarded"))
+	assert.False(t, IsValidClientIPHeaders("X-Forwarded-For, X-Client-IP"))
+	assert.True(t, IsValidNonNegativeInteger("0"))
+	assert.True(t, IsValidNonNegativeInteger("2"))
+	assert.False(t, IsValidNonNegativeInteger("-1"))
+	assert.False(t, IsValidNonNegativeInteger("two"))
+}
+
+func TestLoadClientIP(t *testing.T) {
+	unsetDynamicEnvs()
+	c := NewConfig()
+	assert.Empty(t, c.GetClientIPHeaders())
+	assert.Empty(t, c.GetTrustedProxies())
+	assert.Equal(t, 0, c.GetTrustedProxyCount())
+	assert.False(t, c.GetClientIPMetricsTag())
+
+	os.Setenv(envAppOpticsClientIPHeaders, "X-Real-IP, X-Forwarded-For")
+	os.Setenv(envAppOpticsTrustedProxies, "10.0.0.0/8")
+	os.Setenv(envAppOpticsTrustedProxyCount, "2")
+	os.Setenv(envAppOpticsClientIPMetricsTag, "true")
+	defer unsetDynamicEnvs()
+	c = NewConfig()
+	assert.Equal(t, []string{"X-Real-IP", "X-Forwarded-For"}, c.GetClientIPHeaders())
+	assert.Equal(t, []string{"10.0.0.0/8"}, c.GetTrustedProxies())
+	assert.Equal(t, 2, c.GetTrustedProxyCount())
+	assert.True(t, c.GetClientIPMetricsTag())
+
+	// the invalid values are ignored
+	os.Setenv(envAppOpticsClientIPHeaders, "X-Client-IP")
+	os.Setenv(envAppOpticsTrustedProxies, "proxy")
+	os.Setenv(envAppOpticsTrustedProxyCount, "-1")
+	c = NewConfig()
+	assert.Empty(t, c.GetClientIPHeaders())
+	assert.Empty(t, c.GetTrustedProxies())
+	assert.Equal(t, 0, c.GetTrustedProxyCount())
+
+	require.NoError(t, c.Update(WithClientIPHeaders("Forwarded"), WithTrustedProxyCount(1)))
+	assert.Equal(t, []string{"Forwarded"}, c.GetClientIPHeaders())
+	assert.Equal(t, 1, c.GetTrustedProxyCount())
+	assert.Error(t, c.Update(WithClientIPHeaders("X-Client-IP")))
+	assert.Error(t, c.Update(WithTrustedProxies("proxy")))
+	assert.Error(t, c.Update(WithTrustedProxyCount(-1)))
+	assert.Equal(t, []string{"Forwarded"}, c.GetClientIPHeaders())
+	assert.Equal(t, 1, c.GetTrustedProxyCount())
+}
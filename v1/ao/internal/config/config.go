@@ -6,6 +6,10 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"sync"
 
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
@@ -24,6 +28,22 @@ const (
 	defaultInsecureSkipVerify = false
 	defaultHistogramPrecision = 2
 	defaultDisabled           = false
+	defaultSpoolDir           = ""
+	defaultSpoolMaxSize       = 100
+	defaultCompression        = "none"
+	defaultEventQueueSize     = 10000
+	defaultOverflowPolicy     = "drop-newest"
+	defaultQueueBlockTimeout  = 100
+	defaultNoAutoInit         = false
+	defaultDebugLevel         = "WARN"
+	defaultTxnNameDepth       = 2
+	defaultNormalizeTxnIDs    = false
+	defaultCaptureBodyMaxSize = 1024
+	defaultDropQueryString    = false
+	defaultTraceContextSecret = ""
+	defaultTrustedProxyCount  = 0
+	defaultClientIPMetricsTag = false
+	defaultTriggerTrace       = true
 )
 
 // The environment variables
@@ -41,6 +61,36 @@ const (
 	envAppOpticsEventsFlushInterval = "APPOPTICS_EVENTS_FLUSH_INTERVAL"
 	envAppOpticsEventsBatchSize     = "APPOPTICS_EVENTS_BATCHSIZE"
 	envAppOpticsDisabled            = "APPOPTICS_DISABLED"
+	envAppOpticsSpoolDir            = "APPOPTICS_SPOOL_DIR"
+	envAppOpticsSpoolMaxSize        = "APPOPTICS_SPOOL_MAX_SIZE"
+	envAppOpticsCompression         = "APPOPTICS_COMPRESSION"
+	envAppOpticsEventQueueSize      = "APPOPTICS_EVENT_QUEUE_SIZE"
+	envAppOpticsOverflowPolicy      = "APPOPTICS_QUEUE_OVERFLOW_POLICY"
+	envAppOpticsQueueBlockTimeout   = "APPOPTICS_QUEUE_BLOCK_TIMEOUT"
+	envAppOpticsNoAutoInit          = "APPOPTICS_NO_AUTO_INIT"
+	envAppOpticsDebugLevel          = "APPOPTICS_DEBUG_LEVEL"
+	envAppOpticsConfigFile          = "APPOPTICS_CONFIG_FILE"
+	envAppOpticsURLFilters          = "APPOPTICS_URL_FILTERS"
+	envAppOpticsTxnNameRules        = "APPOPTICS_TRANSACTION_NAME_RULES"
+	envAppOpticsTxnNameDepth        = "APPOPTICS_TRANSACTION_NAME_DEPTH"
+	envAppOpticsNormalizeTxnIDs     = "APPOPTICS_NORMALIZE_TRANSACTION_IDS"
+	envAppOpticsCaptureReqHeaders   = "APPOPTICS_CAPTURE_REQUEST_HEADERS"
+	envAppOpticsCaptureRespHeaders  = "APPOPTICS_CAPTURE_RESPONSE_HEADERS"
+	envAppOpticsRedactedHeaders     = "APPOPTICS_REDACTED_HEADERS"
+	envAppOpticsCaptureBodyTypes    = "APPOPTICS_CAPTURE_BODY_CONTENT_TYPES"
+	envAppOpticsCaptureBodyMaxBytes = "APPOPTICS_CAPTURE_BODY_MAX_BYTES"
+	envAppOpticsRedactedQueryParams = "APPOPTICS_REDACTED_QUERY_PARAMS"
+	envAppOpticsDropQueryString     = "APPOPTICS_DROP_QUERY_STRING"
+	envAppOpticsURLPathMasks        = "APPOPTICS_URL_PATH_MASKS"
+	envAppOpticsTrustedSources      = "APPOPTICS_TRUSTED_TRACE_SOURCES"
+	envAppOpticsTraceContextSecret  = "APPOPTICS_TRACE_CONTEXT_SECRET"
+	envAppOpticsSignDestinations    = "APPOPTICS_TRACE_CONTEXT_SIGN_DESTINATIONS"
+	envAppOpticsClientIPHeaders     = "APPOPTICS_CLIENT_IP_HEADERS"
+	envAppOpticsTrustedProxies      = "APPOPTICS_TRUSTED_PROXIES"
+	envAppOpticsTrustedProxyCount   = "APPOPTICS_TRUSTED_PROXY_COUNT"
+	envAppOpticsClientIPMetricsTag  = "APPOPTICS_CLIENT_IP_METRICS_TAG"
+	envAppOpticsTriggerTrace        = "APPOPTICS_TRIGGER_TRACE"
+	envAppOpticsSamplingRules       = "APPOPTICS_SAMPLING_RULES"
 )
 
 // The environment variables, validators and converters. This map is not
@@ -137,11 +187,215 @@ var envs = map[string]Env{
 		convert:  ToBool,
 		mask:     nil,
 	},
+	"SpoolDir": {
+		name:     envAppOpticsSpoolDir,
+		optional: true,
+		validate: IsValidFileString,
+		convert:  ToFileString,
+		mask:     nil,
+	},
+	"SpoolMaxSize": {
+		name:     envAppOpticsSpoolMaxSize,
+		optional: true,
+		validate: IsValidPositiveInteger,
+		convert:  ToInt64,
+		mask:     nil,
+	},
+	"Compression": {
+		name:     envAppOpticsCompression,
+		optional: true,
+		validate: IsValidCompression,
+		convert:  ToCompression,
+		mask:     nil,
+	},
+	"EventQueueSize": {
+		name:     envAppOpticsEventQueueSize,
+		optional: true,
+		validate: IsValidPositiveInteger,
+		convert:  ToInteger,
+		mask:     nil,
+	},
+	"OverflowPolicy": {
+		name:     envAppOpticsOverflowPolicy,
+		optional: true,
+		validate: IsValidOverflowPolicy,
+		convert:  ToOverflowPolicy,
+		mask:     nil,
+	},
+	"QueueBlockTimeout": {
+		name:     envAppOpticsQueueBlockTimeout,
+		optional: true,
+		validate: IsValidPositiveInteger,
+		convert:  ToInteger,
+		mask:     nil,
+	},
+	"NoAutoInit": {
+		name:     envAppOpticsNoAutoInit,
+		optional: true,
+		validate: IsValidBool,
+		convert:  ToBool,
+		mask:     nil,
+	},
+	"DebugLevel": {
+		name:     envAppOpticsDebugLevel,
+		optional: true,
+		validate: IsValidLogLevel,
+		convert:  ToLogLevel,
+		mask:     nil,
+	},
+	"URLFilters": {
+		name:     envAppOpticsURLFilters,
+		optional: true,
+		validate: IsValidURLFilters,
+		convert:  ToURLFilters,
+		mask:     nil,
+	},
+	"TransactionNameRules": {
+		name:     envAppOpticsTxnNameRules,
+		optional: true,
+		validate: IsValidTransactionNameRules,
+		convert:  ToTransactionNameRules,
+		mask:     nil,
+	},
+	"TransactionNameDepth": {
+		name:     envAppOpticsTxnNameDepth,
+		optional: true,
+		validate: IsValidTransactionNameDepth,
+		convert:  ToInteger,
+		mask:     nil,
+	},
+	"NormalizeTransactionIDs": {
+		name:     envAppOpticsNormalizeTxnIDs,
+		optional: true,
+		validate: IsValidBool,
+		convert:  ToBool,
+		mask:     nil,
+	},
+	"CaptureRequestHeaders": {
+		name:     envAppOpticsCaptureReqHeaders,
+		optional: true,
+		validate: IsValidHeaderNames,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"CaptureResponseHeaders": {
+		name:     envAppOpticsCaptureRespHeaders,
+		optional: true,
+		validate: IsValidHeaderNames,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"RedactedHeaders": {
+		name:     envAppOpticsRedactedHeaders,
+		optional: true,
+		validate: IsValidHeaderNames,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"CaptureBodyContentTypes": {
+		name:     envAppOpticsCaptureBodyTypes,
+		optional: true,
+		validate: IsValidContentTypes,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"CaptureBodyMaxBytes": {
+		name:     envAppOpticsCaptureBodyMaxBytes,
+		optional: true,
+		validate: IsValidPositiveInteger,
+		convert:  ToInteger,
+		mask:     nil,
+	},
+	"RedactedQueryParams": {
+		name:     envAppOpticsRedactedQueryParams,
+		optional: true,
+		validate: nil,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"DropQueryString": {
+		name:     envAppOpticsDropQueryString,
+		optional: true,
+		validate: IsValidBool,
+		convert:  ToBool,
+		mask:     nil,
+	},
+	"URLPathMasks": {
+		name:     envAppOpticsURLPathMasks,
+		optional: true,
+		validate: IsValidURLPathMasks,
+		convert:  ToURLPathMasks,
+		mask:     nil,
+	},
+	"TrustedTraceSources": {
+		name:     envAppOpticsTrustedSources,
+		optional: true,
+		validate: IsValidIPNets,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"TraceContextSecret": {
+		name:     envAppOpticsTraceContextSecret,
+		optional: true,
+		validate: nil,
+		convert:  nil,
+		mask:     MaskSecret,
+	},
+	"TraceContextSignDestinations": {
+		name:     envAppOpticsSignDestinations,
+		optional: true,
+		validate: IsValidHostPatterns,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"ClientIPHeaders": {
+		name:     envAppOpticsClientIPHeaders,
+		optional: true,
+		validate: IsValidClientIPHeaders,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"TrustedProxies": {
+		name:     envAppOpticsTrustedProxies,
+		optional: true,
+		validate: IsValidIPNets,
+		convert:  ToStringList,
+		mask:     nil,
+	},
+	"TrustedProxyCount": {
+		name:     envAppOpticsTrustedProxyCount,
+		optional: true,
+		validate: IsValidNonNegativeInteger,
+		convert:  ToInteger,
+		mask:     nil,
+	},
+	"ClientIPMetricsTag": {
+		name:     envAppOpticsClientIPMetricsTag,
+		optional: true,
+		validate: IsValidBool,
+		convert:  ToBool,
+		mask:     nil,
+	},
+	"TriggerTrace": {
+		name:     envAppOpticsTriggerTrace,
+		optional: true,
+		validate: IsValidBool,
+		convert:  ToBool,
+		mask:     nil,
+	},
+	"SamplingRules": {
+		name:     envAppOpticsSamplingRules,
+		optional: true,
+		validate: IsValidSamplingRules,
+		convert:  ToSamplingRules,
+		mask:     nil,
+	},
 }
 
 // Config is the struct to define the agent configuration. The configuration
 // options in this struct (excluding those from ReporterOptions) are not
-// intended for dynamically updating.
+// intended for dynamically updating, except the ones which can be updated by
+// Update or Reload.
 type Config struct {
 	sync.RWMutex
 
@@ -179,6 +433,122 @@ type Config struct {
 	Reporter *ReporterOptions `yaml:"ReporterOptions" json:"ReporterOptions"`
 
 	Disabled bool `yaml:"Disabled" json:"Disabled"`
+
+	// The directory to spool the events when the collector is unreachable.
+	// Spooling is disabled if it's empty.
+	SpoolDir string `yaml:"SpoolDir" json:"SpoolDir"`
+
+	// The maximum size of the spool directory in MB
+	SpoolMaxSize int64 `yaml:"SpoolMaxSize" json:"SpoolMaxSize"`
+
+	// The compression algorithm of the messages sent to the collector: none,
+	// gzip or snappy
+	Compression string `yaml:"Compression" json:"Compression"`
+
+	// The capacity of the event queue
+	EventQueueSize int `yaml:"EventQueueSize" json:"EventQueueSize"`
+
+	// What to do when the event or status queue is full: drop-newest,
+	// drop-oldest or block-with-timeout
+	OverflowPolicy string `yaml:"OverflowPolicy" json:"OverflowPolicy"`
+
+	// The maximum time in milliseconds to wait for a full queue with the
+	// block-with-timeout policy
+	QueueBlockTimeout int `yaml:"QueueBlockTimeout" json:"QueueBlockTimeout"`
+
+	// Whether to skip starting the agent when the package is imported. The
+	// agent is started by ao.Init or the first trace instead.
+	NoAutoInit bool `yaml:"NoAutoInit" json:"NoAutoInit"`
+
+	// The log level: DEBUG, INFO, WARN or ERROR
+	DebugLevel string `yaml:"DebugLevel" json:"DebugLevel"`
+
+	// The filters of the URLs of the inbound HTTP requests, the first
+	// matching one applies.
+	URLFilters []URLFilter `yaml:"URLFilters" json:"URLFilters"`
+
+	// The rules to name the transactions by the URL path, the first matching
+	// one applies.
+	TransactionNameRules []TransactionNameRule `yaml:"TransactionNameRules" json:"TransactionNameRules"`
+
+	// The number of URL path segments kept in the transaction name if no
+	// rule matches
+	TransactionNameDepth int `yaml:"TransactionNameDepth" json:"TransactionNameDepth"`
+
+	// Whether to replace the numeric, UUID and hex IDs in the URL path by
+	// placeholders in the transaction name
+	NormalizeTransactionIDs bool `yaml:"NormalizeTransactionIDs" json:"NormalizeTransactionIDs"`
+
+	// The request headers reported by the entry events of the inbound HTTP
+	// requests, e.g., "User-Agent"
+	CaptureRequestHeaders []string `yaml:"CaptureRequestHeaders" json:"CaptureRequestHeaders"`
+
+	// The response headers reported by the exit events of the inbound HTTP
+	// requests, e.g., "Content-Type"
+	CaptureResponseHeaders []string `yaml:"CaptureResponseHeaders" json:"CaptureResponseHeaders"`
+
+	// The captured headers whose values are redacted, in addition to the
+	// authorization and cookie headers
+	RedactedHeaders []string `yaml:"RedactedHeaders" json:"RedactedHeaders"`
+
+	// The content types of the request and response bodies to capture, e.g.,
+	// "application/json" or "text/*". No body is captured if it's empty.
+	CaptureBodyContentTypes []string `yaml:"CaptureBodyContentTypes" json:"CaptureBodyContentTypes"`
+
+	// The maximum number of bytes captured of a request or response body
+	CaptureBodyMaxBytes int `yaml:"CaptureBodyMaxBytes" json:"CaptureBodyMaxBytes"`
+
+	// The names of the query parameters whose values are redacted in the
+	// reported URLs and query strings, case-insensitive
+	RedactedQueryParams []string `yaml:"RedactedQueryParams" json:"RedactedQueryParams"`
+
+	// Whether to drop the query strings of the reported URLs entirely
+	DropQueryString bool `yaml:"DropQueryString" json:"DropQueryString"`
+
+	// The regular expressions of the URL path segments masked in the
+	// reported URLs, e.g., "^.+@.+$" for email addresses
+	URLPathMasks []string `yaml:"URLPathMasks" json:"URLPathMasks"`
+
+	// The CIDRs or IP addresses whose inbound trace context is continued. The
+	// X-Forwarded-For addresses must be trusted as well.
+	TrustedTraceSources []string `yaml:"TrustedTraceSources" json:"TrustedTraceSources"`
+
+	// The shared secret to sign the outbound trace context and verify the
+	// inbound one. A signed trace context is continued regardless of its
+	// source.
+	TraceContextSecret string `yaml:"TraceContextSecret" json:"TraceContextSecret"`
+
+	// The hosts of the outbound HTTP requests whose trace context is signed,
+	// e.g., "api.example.com" or "*.example.com". All the destinations are
+	// signed if it's empty.
+	TraceContextSignDestinations []string `yaml:"TraceContextSignDestinations" json:"TraceContextSignDestinations"`
+
+	// The headers to resolve the client IP of the inbound HTTP requests, in
+	// the order of preference: X-Forwarded-For, X-Real-IP or Forwarded
+	ClientIPHeaders []string `yaml:"ClientIPHeaders" json:"ClientIPHeaders"`
+
+	// The CIDRs or IP addresses of the trusted proxies, which take precedence
+	// over TrustedProxyCount
+	TrustedProxies []string `yaml:"TrustedProxies" json:"TrustedProxies"`
+
+	// The number of the trusted proxies in front of the application
+	TrustedProxyCount int `yaml:"TrustedProxyCount" json:"TrustedProxyCount"`
+
+	// Whether the client IP is a tag of the metrics
+	ClientIPMetricsTag bool `yaml:"ClientIPMetricsTag" json:"ClientIPMetricsTag"`
+
+	// Whether the trigger traces requested by the X-Trace-Options header are
+	// enabled
+	TriggerTrace bool `yaml:"TriggerTrace" json:"TriggerTrace"`
+
+	// The local sampling rules, the first matching one wins
+	SamplingRules []SamplingRule `yaml:"SamplingRules" json:"SamplingRules"`
+
+	// the options of the last RefreshConfig, which are applied again by Reload
+	opts []Option
+	// the listeners of the runtime updates
+	listeners    map[int]Listener
+	nextListener int
 }
 
 // Option is a function type that accepts a Config pointer and
@@ -199,6 +569,27 @@ func WithServiceKey(key string) Option {
 	}
 }
 
+// WithTrustedPath defines a Config option for the file path of the cert file.
+func WithTrustedPath(path string) Option {
+	return func(c *Config) {
+		c.TrustedPath = path
+	}
+}
+
+// WithHostAlias defines a Config option for the alias of the hostname.
+func WithHostAlias(alias string) Option {
+	return func(c *Config) {
+		c.HostAlias = alias
+	}
+}
+
+// WithDisabled defines a Config option for whether the agent is disabled.
+func WithDisabled(disabled bool) Option {
+	return func(c *Config) {
+		c.Disabled = disabled
+	}
+}
+
 // NewConfig initializes a ReporterOptions object and override default values
 // with options provided as arguments. It may print errors if there are invalid
 // values in the configuration file or the environment variables.
@@ -212,15 +603,27 @@ func NewConfig(opts ...Option) *Config {
 	return c
 }
 
-// RefreshConfig loads the customized settings and merge with default values
+// RefreshConfig loads the customized settings and merge with default values.
+// The environment variables take precedence over the configuration file, and
+// the options take precedence over both of them.
 func (c *Config) RefreshConfig(opts ...Option) {
 	c.Lock()
 	defer c.Unlock()
 
-	c.loadConfigFile("TODO")
+	c.opts = opts
+	c.load()
+}
+
+// load loads the configuration from all the sources. The caller must hold the
+// lock.
+func (c *Config) load() {
+	c.reset()
+	if err := c.loadConfigFile(GetConfigFile()); err != nil {
+		log.Warningf("Failed to load the config file: %v", err)
+	}
 	c.loadEnvs()
 
-	for _, opt := range opts {
+	for _, opt := range c.opts {
 		opt(c)
 	}
 }
@@ -244,12 +647,40 @@ func (c *Config) reset() {
 	c.Precision = defaultHistogramPrecision
 	c.Reporter = defaultReporterOptions()
 	c.Disabled = defaultDisabled
+	c.SpoolDir = defaultSpoolDir
+	c.SpoolMaxSize = defaultSpoolMaxSize
+	c.Compression = defaultCompression
+	c.EventQueueSize = defaultEventQueueSize
+	c.OverflowPolicy = defaultOverflowPolicy
+	c.QueueBlockTimeout = defaultQueueBlockTimeout
+	c.NoAutoInit = defaultNoAutoInit
+	c.DebugLevel = defaultDebugLevel
+	c.URLFilters = nil
+	c.TransactionNameRules = nil
+	c.TransactionNameDepth = defaultTxnNameDepth
+	c.NormalizeTransactionIDs = defaultNormalizeTxnIDs
+	c.CaptureRequestHeaders = nil
+	c.CaptureResponseHeaders = nil
+	c.RedactedHeaders = nil
+	c.CaptureBodyContentTypes = nil
+	c.CaptureBodyMaxBytes = defaultCaptureBodyMaxSize
+	c.RedactedQueryParams = append([]string(nil), defaultRedactedQueryParams...)
+	c.DropQueryString = defaultDropQueryString
+	c.URLPathMasks = nil
+	c.TrustedTraceSources = nil
+	c.TraceContextSecret = defaultTraceContextSecret
+	c.TraceContextSignDestinations = nil
+	c.ClientIPHeaders = nil
+	c.TrustedProxies = nil
+	c.TrustedProxyCount = defaultTrustedProxyCount
+	c.ClientIPMetricsTag = defaultClientIPMetricsTag
+	c.TriggerTrace = defaultTriggerTrace
+	c.SamplingRules = nil
 }
 
 // loadEnvs loads environment variable values and update the Config object.
 func (c *Config) loadEnvs() {
 	// TODO: reflect?
-	c.reset()
 	c.Collector = envs["Collector"].LoadString(c.Collector)
 	c.ServiceKey = envs["ServiceKey"].LoadString(c.ServiceKey)
 
@@ -264,13 +695,53 @@ func (c *Config) loadEnvs() {
 
 	c.Precision = envs["Precision"].LoadInt(c.Precision)
 	c.Disabled = envs["Disabled"].LoadBool(c.Disabled)
+	c.SpoolDir = envs["SpoolDir"].LoadString(c.SpoolDir)
+	c.SpoolMaxSize = envs["SpoolMaxSize"].LoadInt64(c.SpoolMaxSize)
+	c.Compression = envs["Compression"].LoadString(c.Compression)
+	c.EventQueueSize = envs["EventQueueSize"].LoadInt(c.EventQueueSize)
+	c.OverflowPolicy = envs["OverflowPolicy"].LoadString(c.OverflowPolicy)
+	c.QueueBlockTimeout = envs["QueueBlockTimeout"].LoadInt(c.QueueBlockTimeout)
+	c.NoAutoInit = envs["NoAutoInit"].LoadBool(c.NoAutoInit)
+	c.DebugLevel = envs["DebugLevel"].LoadString(c.DebugLevel)
+	c.URLFilters = envs["URLFilters"].LoadURLFilters(c.URLFilters)
+	c.TransactionNameRules = envs["TransactionNameRules"].LoadTransactionNameRules(c.TransactionNameRules)
+	c.TransactionNameDepth = envs["TransactionNameDepth"].LoadInt(c.TransactionNameDepth)
+	c.NormalizeTransactionIDs = envs["NormalizeTransactionIDs"].LoadBool(c.NormalizeTransactionIDs)
+	c.CaptureRequestHeaders = envs["CaptureRequestHeaders"].LoadStrings(c.CaptureRequestHeaders)
+	c.CaptureResponseHeaders = envs["CaptureResponseHeaders"].LoadStrings(c.CaptureResponseHeaders)
+	c.RedactedHeaders = envs["RedactedHeaders"].LoadStrings(c.RedactedHeaders)
+	c.CaptureBodyContentTypes = envs["CaptureBodyContentTypes"].LoadStrings(c.CaptureBodyContentTypes)
+	c.CaptureBodyMaxBytes = envs["CaptureBodyMaxBytes"].LoadInt(c.CaptureBodyMaxBytes)
+	c.RedactedQueryParams = envs["RedactedQueryParams"].LoadStrings(c.RedactedQueryParams)
+	c.DropQueryString = envs["DropQueryString"].LoadBool(c.DropQueryString)
+	c.URLPathMasks = envs["URLPathMasks"].LoadStrings(c.URLPathMasks)
+	c.TrustedTraceSources = envs["TrustedTraceSources"].LoadStrings(c.TrustedTraceSources)
+	c.TraceContextSecret = envs["TraceContextSecret"].LoadString(c.TraceContextSecret)
+	c.TraceContextSignDestinations = envs["TraceContextSignDestinations"].LoadStrings(c.TraceContextSignDestinations)
+	c.ClientIPHeaders = envs["ClientIPHeaders"].LoadStrings(c.ClientIPHeaders)
+	c.TrustedProxies = envs["TrustedProxies"].LoadStrings(c.TrustedProxies)
+	c.TrustedProxyCount = envs["TrustedProxyCount"].LoadInt(c.TrustedProxyCount)
+	c.ClientIPMetricsTag = envs["ClientIPMetricsTag"].LoadBool(c.ClientIPMetricsTag)
+	c.TriggerTrace = envs["TriggerTrace"].LoadBool(c.TriggerTrace)
+	c.SamplingRules = envs["SamplingRules"].LoadSamplingRules(c.SamplingRules)
 
 	c.Reporter.loadEnvs()
 }
 
-// loadConfigFile loads from the config file
+// loadConfigFile loads from the config file in JSON format. The file is
+// optional, nothing is loaded if the path is empty.
 func (c *Config) loadConfigFile(path string) error {
-	log.Debug("Loading from config file is not implemented.")
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	log.Infof("Loaded the config file: %s", path)
 	return nil
 }
 
@@ -351,6 +822,228 @@ func (c *Config) GetDisabled() bool {
 	return c.Disabled
 }
 
+// GetSpoolDir returns the directory to spool the events
+func (c *Config) GetSpoolDir() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.SpoolDir
+}
+
+// GetSpoolMaxSize returns the maximum size of the spool directory in MB
+func (c *Config) GetSpoolMaxSize() int64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.SpoolMaxSize
+}
+
+// GetCompression returns the compression algorithm of the messages
+func (c *Config) GetCompression() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.Compression
+}
+
+// GetEventQueueSize returns the capacity of the event queue
+func (c *Config) GetEventQueueSize() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.EventQueueSize
+}
+
+// GetOverflowPolicy returns the policy to handle a full queue
+func (c *Config) GetOverflowPolicy() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.OverflowPolicy
+}
+
+// GetQueueBlockTimeout returns the maximum time in milliseconds to wait for a
+// full queue
+func (c *Config) GetQueueBlockTimeout() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.QueueBlockTimeout
+}
+
+// GetNoAutoInit returns if the agent should not be started when the package
+// is imported
+func (c *Config) GetNoAutoInit() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.NoAutoInit
+}
+
+// GetConfigFile returns the path of the configuration file, which is set by
+// the environment variable APPOPTICS_CONFIG_FILE
+func GetConfigFile() string {
+	return os.Getenv(envAppOpticsConfigFile)
+}
+
+// GetDebugLevel returns the log level
+func (c *Config) GetDebugLevel() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.DebugLevel
+}
+
+// GetURLFilters returns the filters of the URLs of the inbound HTTP requests
+func (c *Config) GetURLFilters() []URLFilter {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]URLFilter(nil), c.URLFilters...)
+}
+
+// GetTransactionNameRules returns the rules to name the transactions by the
+// URL path
+func (c *Config) GetTransactionNameRules() []TransactionNameRule {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]TransactionNameRule(nil), c.TransactionNameRules...)
+}
+
+// GetTransactionNameDepth returns the number of URL path segments kept in the
+// transaction name
+func (c *Config) GetTransactionNameDepth() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.TransactionNameDepth
+}
+
+// GetNormalizeTransactionIDs returns whether the IDs in the URL path are
+// replaced by placeholders in the transaction name
+func (c *Config) GetNormalizeTransactionIDs() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.NormalizeTransactionIDs
+}
+
+// GetCaptureRequestHeaders returns the request headers reported by the entry
+// events of the inbound HTTP requests
+func (c *Config) GetCaptureRequestHeaders() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.CaptureRequestHeaders...)
+}
+
+// GetCaptureResponseHeaders returns the response headers reported by the exit
+// events of the inbound HTTP requests
+func (c *Config) GetCaptureResponseHeaders() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.CaptureResponseHeaders...)
+}
+
+// GetRedactedHeaders returns the captured headers whose values are redacted
+func (c *Config) GetRedactedHeaders() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.RedactedHeaders...)
+}
+
+// GetCaptureBodyContentTypes returns the content types of the request and
+// response bodies to capture
+func (c *Config) GetCaptureBodyContentTypes() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.CaptureBodyContentTypes...)
+}
+
+// GetCaptureBodyMaxBytes returns the maximum number of bytes captured of a
+// request or response body
+func (c *Config) GetCaptureBodyMaxBytes() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.CaptureBodyMaxBytes
+}
+
+// GetRedactedQueryParams returns the names of the query parameters whose
+// values are redacted
+func (c *Config) GetRedactedQueryParams() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.RedactedQueryParams...)
+}
+
+// GetDropQueryString returns whether the query strings are dropped entirely
+func (c *Config) GetDropQueryString() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.DropQueryString
+}
+
+// GetURLPathMasks returns the regular expressions of the URL path segments to
+// mask
+func (c *Config) GetURLPathMasks() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.URLPathMasks...)
+}
+
+// GetTrustedTraceSources returns the CIDRs or IP addresses whose inbound trace
+// context is continued
+func (c *Config) GetTrustedTraceSources() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.TrustedTraceSources...)
+}
+
+// GetTraceContextSecret returns the shared secret to sign the trace context
+func (c *Config) GetTraceContextSecret() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.TraceContextSecret
+}
+
+// GetTraceContextSignDestinations returns the host patterns of the outbound
+// requests whose trace context is signed
+func (c *Config) GetTraceContextSignDestinations() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.TraceContextSignDestinations...)
+}
+
+// GetClientIPHeaders returns the headers to resolve the client IP
+func (c *Config) GetClientIPHeaders() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.ClientIPHeaders...)
+}
+
+// GetTrustedProxies returns the CIDRs or IP addresses of the trusted proxies
+func (c *Config) GetTrustedProxies() []string {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]string(nil), c.TrustedProxies...)
+}
+
+// GetTrustedProxyCount returns the number of the trusted proxies
+func (c *Config) GetTrustedProxyCount() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.TrustedProxyCount
+}
+
+// GetClientIPMetricsTag returns whether the client IP is a tag of the metrics
+func (c *Config) GetClientIPMetricsTag() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.ClientIPMetricsTag
+}
+
+// GetTriggerTrace returns whether the trigger traces are enabled
+func (c *Config) GetTriggerTrace() bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.TriggerTrace
+}
+
+// GetSamplingRules returns the local sampling rules
+func (c *Config) GetSamplingRules() []SamplingRule {
+	c.RLock()
+	defer c.RUnlock()
+	return append([]SamplingRule(nil), c.SamplingRules...)
+}
+
 // GetReporter returns the reporter options struct
 func (c *Config) GetReporter() *ReporterOptions {
 	c.RLock()
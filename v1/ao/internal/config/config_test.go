@@ -52,4 +52,64 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, "test.crt", filepath.Base(c.GetTrustedPath()))
 	assert.Equal(t, "hello.udp", c.GetCollectorUDP())
 	assert.Equal(t, false, c.GetDisabled())
+	assert.Equal(t, "", c.GetSpoolDir())
+	assert.Equal(t, int64(100), c.GetSpoolMaxSize())
+
+	os.Setenv(envAppOpticsSpoolDir, "/tmp/spool")
+	os.Setenv(envAppOpticsSpoolMaxSize, "10")
+	c.RefreshConfig()
+	assert.Equal(t, "/tmp/spool", c.GetSpoolDir())
+	assert.Equal(t, int64(10), c.GetSpoolMaxSize())
+	// the spool size must be positive
+	os.Setenv(envAppOpticsSpoolMaxSize, "0")
+	c.RefreshConfig()
+	assert.Equal(t, int64(100), c.GetSpoolMaxSize())
+	os.Unsetenv(envAppOpticsSpoolDir)
+	os.Unsetenv(envAppOpticsSpoolMaxSize)
+
+	assert.Equal(t, "none", c.GetCompression())
+	os.Setenv(envAppOpticsCompression, "GZIP")
+	c.RefreshConfig()
+	assert.Equal(t, "gzip", c.GetCompression())
+	os.Unsetenv(envAppOpticsCompression)
+
+	assert.Equal(t, 10000, c.GetEventQueueSize())
+	assert.Equal(t, "drop-newest", c.GetOverflowPolicy())
+	assert.Equal(t, 100, c.GetQueueBlockTimeout())
+	os.Setenv(envAppOpticsEventQueueSize, "500")
+	os.Setenv(envAppOpticsOverflowPolicy, "block-with-timeout")
+	os.Setenv(envAppOpticsQueueBlockTimeout, "20")
+	c.RefreshConfig()
+	assert.Equal(t, 500, c.GetEventQueueSize())
+	assert.Equal(t, "block-with-timeout", c.GetOverflowPolicy())
+	assert.Equal(t, 20, c.GetQueueBlockTimeout())
+	// the queue size and block timeout must be positive
+	os.Setenv(envAppOpticsEventQueueSize, "-5")
+	os.Setenv(envAppOpticsQueueBlockTimeout, "-20")
+	c.RefreshConfig()
+	assert.Equal(t, 10000, c.GetEventQueueSize())
+	assert.Equal(t, 100, c.GetQueueBlockTimeout())
+	os.Setenv(envAppOpticsEventQueueSize, "0")
+	os.Setenv(envAppOpticsQueueBlockTimeout, "0")
+	c.RefreshConfig()
+	assert.Equal(t, 10000, c.GetEventQueueSize())
+	assert.Equal(t, 100, c.GetQueueBlockTimeout())
+	os.Unsetenv(envAppOpticsEventQueueSize)
+	os.Unsetenv(envAppOpticsOverflowPolicy)
+	os.Unsetenv(envAppOpticsQueueBlockTimeout)
+
+	assert.False(t, c.GetNoAutoInit())
+	os.Setenv(envAppOpticsNoAutoInit, "true")
+	c.RefreshConfig()
+	assert.True(t, c.GetNoAutoInit())
+	os.Unsetenv(envAppOpticsNoAutoInit)
+
+	c.RefreshConfig(WithCollector("localhost:4444"), WithTrustedPath("/tmp/cert.pem"),
+		WithHostAlias("alias"), WithDisabled(true))
+	assert.Equal(t, "localhost:4444", c.GetCollector())
+	assert.Equal(t, "/tmp/cert.pem", c.GetTrustedPath())
+	assert.Equal(t, "alias", c.GetHostAlias())
+	assert.True(t, c.GetDisabled())
+	c.RefreshConfig()
+	assert.False(t, c.GetDisabled())
 }
@@ -0,0 +1,261 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+)
+
+// Listener is notified with the names of the options after they are updated
+// at runtime, e.g., "TracingMode". It reads the new values from the Config.
+type Listener func(changed []string)
+
+// The options which can be updated at runtime by Update or Reload, and their
+// validators. The others require restarting the agent.
+var dynamicOptions = map[string]func(c *Config) error{
+	"TracingMode": func(c *Config) error {
+		if !IsValidTracingMode(c.TracingMode) {
+			return fmt.Errorf("invalid TracingMode: %s", c.TracingMode)
+		}
+		return nil
+	},
+	"DebugLevel": func(c *Config) error {
+		if !IsValidLogLevel(c.DebugLevel) {
+			return fmt.Errorf("invalid DebugLevel: %s", c.DebugLevel)
+		}
+		c.DebugLevel = ToLogLevel(c.DebugLevel).(string)
+		return nil
+	},
+	"PrependDomain": nil,
+	"URLFilters": func(c *Config) error {
+		return validateURLFilters(c.URLFilters)
+	},
+	"TransactionNameRules": func(c *Config) error {
+		return validateTransactionNameRules(c.TransactionNameRules)
+	},
+	"TransactionNameDepth": func(c *Config) error {
+		if c.TransactionNameDepth < 1 {
+			return fmt.Errorf("invalid TransactionNameDepth: %d, must be positive", c.TransactionNameDepth)
+		}
+		return nil
+	},
+	"NormalizeTransactionIDs": nil,
+	"CaptureRequestHeaders": func(c *Config) error {
+		return validateHeaderNames(c.CaptureRequestHeaders)
+	},
+	"CaptureResponseHeaders": func(c *Config) error {
+		return validateHeaderNames(c.CaptureResponseHeaders)
+	},
+	"RedactedHeaders": func(c *Config) error {
+		return validateHeaderNames(c.RedactedHeaders)
+	},
+	"CaptureBodyContentTypes": func(c *Config) error {
+		return validateBodyContentTypes(c.CaptureBodyContentTypes)
+	},
+	"CaptureBodyMaxBytes": func(c *Config) error {
+		if c.CaptureBodyMaxBytes < 1 {
+			return fmt.Errorf("invalid CaptureBodyMaxBytes: %d, must be positive", c.CaptureBodyMaxBytes)
+		}
+		return nil
+	},
+	"RedactedQueryParams": nil,
+	"DropQueryString":     nil,
+	"URLPathMasks": func(c *Config) error {
+		return validateURLPathMasks(c.URLPathMasks)
+	},
+	"TrustedTraceSources": func(c *Config) error {
+		return validateIPNets(c.TrustedTraceSources)
+	},
+	"TraceContextSecret": nil,
+	"TraceContextSignDestinations": func(c *Config) error {
+		return validateHostPatterns(c.TraceContextSignDestinations)
+	},
+	"ClientIPHeaders": func(c *Config) error {
+		return validateClientIPHeaders(c.ClientIPHeaders)
+	},
+	"TrustedProxies": func(c *Config) error {
+		return validateIPNets(c.TrustedProxies)
+	},
+	"TrustedProxyCount": func(c *Config) error {
+		if c.TrustedProxyCount < 0 {
+			return fmt.Errorf("invalid TrustedProxyCount: %d, must not be negative", c.TrustedProxyCount)
+		}
+		return nil
+	},
+	"ClientIPMetricsTag": nil,
+	"TriggerTrace":       nil,
+	"SamplingRules": func(c *Config) error {
+		return validateSamplingRules(c.SamplingRules)
+	},
+	"Precision": func(c *Config) error {
+		if c.Precision < 0 || c.Precision > 5 {
+			return fmt.Errorf("invalid Precision: %d, must be between 0 and 5", c.Precision)
+		}
+		return nil
+	},
+}
+
+// The options whose values are not logged when they are updated
+var secretOptions = map[string]bool{
+	"TraceContextSecret": true,
+}
+
+// WithTracingMode defines a Config option for the tracing mode.
+func WithTracingMode(mode string) Option {
+	return func(c *Config) {
+		c.TracingMode = mode
+	}
+}
+
+// WithDebugLevel defines a Config option for the log level.
+func WithDebugLevel(level string) Option {
+	return func(c *Config) {
+		c.DebugLevel = level
+	}
+}
+
+// WithPrependDomain defines a Config option for whether the domain should be
+// prepended to the transaction name.
+func WithPrependDomain(prepend bool) Option {
+	return func(c *Config) {
+		c.PrependDomain = prepend
+	}
+}
+
+// WithPrecision defines a Config option for the precision of the histograms.
+func WithPrecision(precision int) Option {
+	return func(c *Config) {
+		c.Precision = precision
+	}
+}
+
+// AddListener registers a listener of the runtime updates. It returns the
+// function to remove the listener.
+func (c *Config) AddListener(l Listener) (remove func()) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.listeners == nil {
+		c.listeners = make(map[int]Listener)
+	}
+	id := c.nextListener
+	c.nextListener++
+	c.listeners[id] = l
+	return func() {
+		c.Lock()
+		defer c.Unlock()
+		delete(c.listeners, id)
+	}
+}
+
+// Update applies the options to the configuration at runtime. Only the
+// dynamic options, e.g., the tracing mode, are updated. The changes of the
+// other options and the invalid values are discarded and reported by the
+// returned error.
+func (c *Config) Update(opts ...Option) error {
+	return c.update(func() {
+		for _, opt := range opts {
+			opt(c)
+		}
+	})
+}
+
+// Reload reloads the configuration file and the environment variables at
+// runtime, and applies the options of the last RefreshConfig again. Only the
+// dynamic options are updated, as Update does.
+func (c *Config) Reload() error {
+	return c.update(func() {
+		// the reporter options are updated by the collector instead
+		r := c.Reporter
+		c.load()
+		c.Reporter = r
+	})
+}
+
+// update applies the changes, reverts the ones which are not allowed, logs
+// the diff and notifies the listeners.
+func (c *Config) update(apply func()) error {
+	c.Lock()
+	before := c.values()
+	apply()
+	after := c.values()
+
+	var names []string
+	for name := range after {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changed, diffs, errs []string
+	for _, name := range names {
+		if reflect.DeepEqual(before[name], after[name]) {
+			continue
+		}
+		validate, dynamic := dynamicOptions[name]
+		var err error
+		switch {
+		case !dynamic:
+			err = fmt.Errorf("%s can't be updated at runtime", name)
+		case validate != nil:
+			err = validate(c)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			reflect.ValueOf(c).Elem().FieldByName(name).Set(reflect.ValueOf(before[name]))
+			continue
+		}
+		changed = append(changed, name)
+		if secretOptions[name] {
+			diffs = append(diffs, fmt.Sprintf("%s: updated", name))
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", name, before[name],
+			reflect.ValueOf(c).Elem().FieldByName(name).Interface()))
+	}
+
+	var listeners []Listener
+	if len(changed) > 0 {
+		var ids []int
+		for id := range c.listeners {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			listeners = append(listeners, c.listeners[id])
+		}
+	}
+	c.Unlock()
+
+	if len(diffs) > 0 {
+		log.Warningf("Configuration updated: %s", strings.Join(diffs, ", "))
+	}
+	for _, l := range listeners {
+		l(changed)
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// values returns the values of the exported options except the reporter
+// options, which are updated separately. The caller must hold the lock.
+func (c *Config) values() map[string]interface{} {
+	values := make(map[string]interface{})
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Anonymous || f.Name == "Reporter" {
+			continue
+		}
+		values[f.Name] = v.Field(i).Interface()
+	}
+	return values
+}
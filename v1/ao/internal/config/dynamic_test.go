@@ -0,0 +1,117 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsetDynamicEnvs unsets the environment variables of the dynamic options,
+// which may be set by the other tests.
+func unsetDynamicEnvs() {
+	for _, env := range []string{envAppOpticsTracingMode, envAppOpticsDebugLevel,
+		envAppOpticsPrependDomain, envAppOpticsHistogramPrecision, envAppOpticsURLFilters,
+		envAppOpticsTxnNameRules, envAppOpticsTxnNameDepth, envAppOpticsNormalizeTxnIDs,
+		envAppOpticsCaptureReqHeaders, envAppOpticsCaptureRespHeaders, envAppOpticsRedactedHeaders,
+		envAppOpticsCaptureBodyTypes, envAppOpticsCaptureBodyMaxBytes, envAppOpticsRedactedQueryParams,
+		envAppOpticsDropQueryString, envAppOpticsURLPathMasks, envAppOpticsTrustedSources,
+		envAppOpticsTraceContextSecret, envAppOpticsClientIPHeaders, envAppOpticsTrustedProxies,
+		envAppOpticsTrustedProxyCount, envAppOpticsClientIPMetricsTag, envAppOpticsTriggerTrace,
+		envAppOpticsSamplingRules, envAppOpticsSignDestinations} {
+		os.Unsetenv(env)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	unsetDynamicEnvs()
+	c := NewConfig(WithCollector("localhost:4444"))
+	var updates [][]string
+	remove := c.AddListener(func(changed []string) {
+		updates = append(updates, changed)
+	})
+
+	require.NoError(t, c.Update(WithTracingMode("never"), WithDebugLevel("debug"),
+		WithPrependDomain(true), WithPrecision(3)))
+	assert.Equal(t, "never", c.GetTracingMode())
+	assert.Equal(t, "DEBUG", c.GetDebugLevel())
+	assert.True(t, c.GetPrependDomain())
+	assert.Equal(t, 3, c.GetPrecision())
+	require.Len(t, updates, 1)
+	assert.Equal(t, []string{"DebugLevel", "Precision", "PrependDomain", "TracingMode"}, updates[0])
+
+	// nothing changed, nobody is notified
+	require.NoError(t, c.Update(WithTracingMode("never")))
+	assert.Len(t, updates, 1)
+
+	// the static and invalid options are discarded
+	err := c.Update(WithCollector("localhost:5555"), WithPrecision(6), WithTracingMode("always"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Collector can't be updated at runtime")
+	assert.Contains(t, err.Error(), "invalid Precision: 6")
+	assert.Equal(t, "localhost:4444", c.GetCollector())
+	assert.Equal(t, 3, c.GetPrecision())
+	assert.Equal(t, "always", c.GetTracingMode())
+	require.Len(t, updates, 2)
+	assert.Equal(t, []string{"TracingMode"}, updates[1])
+
+	assert.Error(t, c.Update(WithDebugLevel("invalid")))
+	assert.Equal(t, "DEBUG", c.GetDebugLevel())
+
+	remove()
+	require.NoError(t, c.Update(WithTracingMode("never")))
+	assert.Len(t, updates, 2)
+}
+
+func TestReload(t *testing.T) {
+	unsetDynamicEnvs()
+	f, err := ioutil.TempFile("", "appoptics-config")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"TracingMode": "never"}`), 0644))
+
+	os.Setenv(envAppOpticsConfigFile, f.Name())
+	defer os.Unsetenv(envAppOpticsConfigFile)
+	os.Setenv(envAppOpticsPrependDomain, "true")
+	defer os.Unsetenv(envAppOpticsPrependDomain)
+
+	c := NewConfig(WithCollector("localhost:4444"))
+	assert.Equal(t, "never", c.GetTracingMode())
+	assert.True(t, c.GetPrependDomain())
+	r := c.GetReporter()
+
+	var updates [][]string
+	c.AddListener(func(changed []string) {
+		updates = append(updates, changed)
+	})
+	require.NoError(t, ioutil.WriteFile(f.Name(),
+		[]byte(`{"TracingMode": "always", "HistogramPrecision": 4, "DebugLevel": "info"}`), 0644))
+	// the environment variables take precedence
+	require.NoError(t, c.Reload())
+	assert.Equal(t, "always", c.GetTracingMode())
+	assert.Equal(t, 4, c.GetPrecision())
+	assert.Equal(t, "INFO", c.GetDebugLevel())
+	assert.True(t, c.GetPrependDomain())
+	// the options of RefreshConfig and the reporter options are kept
+	assert.Equal(t, "localhost:4444", c.GetCollector())
+	assert.True(t, r == c.GetReporter())
+	require.Len(t, updates, 1)
+	assert.Equal(t, []string{"DebugLevel", "Precision", "TracingMode"}, updates[0])
+
+	// the static options are not reloaded
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`{"SpoolDir": "/tmp"}`), 0644))
+	err = c.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SpoolDir can't be updated at runtime")
+	assert.Equal(t, "", c.GetSpoolDir())
+
+	// the invalid file is ignored
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte(`invalid`), 0644))
+	err = c.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, "always", c.GetTracingMode())
+}
@@ -66,6 +66,42 @@ func (e Env) LoadInt64(fallback int64) int64 {
 	return fallback
 }
 
+// LoadURLFilters loads the env and returns the URL filters
+func (e Env) LoadURLFilters(fallback []URLFilter) []URLFilter {
+	v := e.load(fallback)
+	if s, ok := v.([]URLFilter); ok {
+		return s
+	}
+	return fallback
+}
+
+// LoadTransactionNameRules loads the env and returns the transaction name rules
+func (e Env) LoadTransactionNameRules(fallback []TransactionNameRule) []TransactionNameRule {
+	v := e.load(fallback)
+	if s, ok := v.([]TransactionNameRule); ok {
+		return s
+	}
+	return fallback
+}
+
+// LoadSamplingRules loads the env and returns the sampling rules
+func (e Env) LoadSamplingRules(fallback []SamplingRule) []SamplingRule {
+	v := e.load(fallback)
+	if s, ok := v.([]SamplingRule); ok {
+		return s
+	}
+	return fallback
+}
+
+// LoadStrings loads the env and returns a slice of strings
+func (e Env) LoadStrings(fallback []string) []string {
+	v := e.load(fallback)
+	if s, ok := v.([]string); ok {
+		return s
+	}
+	return fallback
+}
+
 // load loads the environment variable and returns the value
 func (e Env) load(fallback interface{}) interface{} {
 	validate := e.validate
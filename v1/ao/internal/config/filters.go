@@ -0,0 +1,89 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// The actions of the URL filters
+const (
+	// The matching requests are not traced, but the metrics are recorded.
+	URLFilterNoTracing = "no-tracing"
+	// The matching requests are neither traced nor recorded in the metrics.
+	URLFilterNoMetrics = "no-metrics"
+	// The matching requests are always traced, regardless of the sample
+	// rate and the token bucket.
+	URLFilterForceSample = "force-sample"
+)
+
+// URLFilter matches the URL path of the inbound HTTP requests by a regular
+// expression or by the extensions, and defines how the matching requests are
+// traced.
+type URLFilter struct {
+	// The regular expression matching the URL path
+	Regex string `yaml:"Regex" json:"Regex"`
+
+	// The extensions of the URL path without the dot, e.g., "css"
+	Extensions []string `yaml:"Extensions" json:"Extensions"`
+
+	// The action on the matching requests: no-tracing, no-metrics or
+	// force-sample
+	Action string `yaml:"Action" json:"Action"`
+}
+
+// Validate checks if the filter has a valid regex or extensions, and a valid
+// action.
+func (f URLFilter) Validate() error {
+	if f.Regex == "" && len(f.Extensions) == 0 {
+		return errors.New("URL filter has neither regex nor extensions")
+	}
+	if f.Regex != "" {
+		if _, err := regexp.Compile(f.Regex); err != nil {
+			return fmt.Errorf("invalid regex of URL filter: %v", err)
+		}
+	}
+	switch f.Action {
+	case URLFilterNoTracing, URLFilterNoMetrics, URLFilterForceSample:
+	default:
+		return fmt.Errorf("invalid action of URL filter: %q", f.Action)
+	}
+	return nil
+}
+
+// WithURLFilters defines a Config option for the URL filters.
+func WithURLFilters(filters ...URLFilter) Option {
+	return func(c *Config) {
+		c.URLFilters = filters
+	}
+}
+
+// validateURLFilters checks all the filters.
+func validateURLFilters(filters []URLFilter) error {
+	for _, f := range filters {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsValidURLFilters checks if the string is a JSON array of valid URL filters
+func IsValidURLFilters(s string) bool {
+	var filters []URLFilter
+	if err := json.Unmarshal([]byte(s), &filters); err != nil {
+		return false
+	}
+	return validateURLFilters(filters) == nil
+}
+
+// ToURLFilters converts a JSON array to URL filters, the string must have
+// been validated.
+func ToURLFilters(s string) interface{} {
+	var filters []URLFilter
+	json.Unmarshal([]byte(s), &filters)
+	return filters
+}
@@ -0,0 +1,45 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLFilterValidate(t *testing.T) {
+	assert.NoError(t, URLFilter{Regex: "^/healthz$", Action: URLFilterNoMetrics}.Validate())
+	assert.NoError(t, URLFilter{Extensions: []string{"css"}, Action: URLFilterNoTracing}.Validate())
+	assert.NoError(t, URLFilter{Regex: "^/checkout", Action: URLFilterForceSample}.Validate())
+
+	assert.Error(t, URLFilter{Action: URLFilterNoTracing}.Validate())
+	assert.Error(t, URLFilter{Regex: "(", Action: URLFilterNoTracing}.Validate())
+	assert.Error(t, URLFilter{Regex: "^/healthz$", Action: "ignore"}.Validate())
+	assert.Error(t, URLFilter{Regex: "^/healthz$"}.Validate())
+}
+
+func TestLoadURLFilters(t *testing.T) {
+	os.Setenv(envAppOpticsURLFilters,
+		`[{"Regex": "^/healthz$", "Action": "no-metrics"}, {"Extensions": ["css", "js"], "Action": "no-tracing"}]`)
+	defer os.Unsetenv(envAppOpticsURLFilters)
+
+	c := NewConfig()
+	assert.Equal(t, []URLFilter{
+		{Regex: "^/healthz$", Action: URLFilterNoMetrics},
+		{Extensions: []string{"css", "js"}, Action: URLFilterNoTracing},
+	}, c.GetURLFilters())
+
+	// the invalid filters are ignored
+	os.Setenv(envAppOpticsURLFilters, `[{"Regex": "(", "Action": "no-tracing"}]`)
+	c = NewConfig()
+	assert.Empty(t, c.GetURLFilters())
+
+	// updated at runtime
+	require.NoError(t, c.Update(WithURLFilters(URLFilter{Regex: "^/ping", Action: URLFilterNoMetrics})))
+	assert.Len(t, c.GetURLFilters(), 1)
+	assert.Error(t, c.Update(WithURLFilters(URLFilter{Regex: "^/ping", Action: "invalid"})))
+	assert.Equal(t, URLFilterNoMetrics, c.GetURLFilters()[0].Action)
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// TransactionNameRule names the transactions of the inbound HTTP requests
+// whose URL path matches the regular expression.
+type TransactionNameRule struct {
+	// The regular expression matching the URL path
+	Regex string `yaml:"Regex" json:"Regex"`
+
+	// The transaction name, which may refer to the submatches of the regex,
+	// e.g., "/users/$1/orders"
+	Name string `yaml:"Name" json:"Name"`
+}
+
+// Validate checks if the rule has a valid regex and a name.
+func (r TransactionNameRule) Validate() error {
+	if _, err := regexp.Compile(r.Regex); err != nil || r.Regex == "" {
+		return fmt.Errorf("invalid regex of transaction name rule: %q", r.Regex)
+	}
+	if r.Name == "" {
+		return errors.New("transaction name rule has no name")
+	}
+	return nil
+}
+
+// WithTransactionNameRules defines a Config option for the transaction name
+// rules.
+func WithTransactionNameRules(rules ...TransactionNameRule) Option {
+	return func(c *Config) {
+		c.TransactionNameRules = rules
+	}
+}
+
+// WithTransactionNameDepth defines a Config option for the number of URL path
+// segments kept in the transaction name.
+func WithTransactionNameDepth(depth int) Option {
+	return func(c *Config) {
+		c.TransactionNameDepth = depth
+	}
+}
+
+// WithNormalizeTransactionIDs defines a Config option for whether the IDs in
+// the URL path are replaced by placeholders in the transaction name.
+func WithNormalizeTransactionIDs(normalize bool) Option {
+	return func(c *Config) {
+		c.NormalizeTransactionIDs = normalize
+	}
+}
+
+// validateTransactionNameRules checks all the rules.
+func validateTransactionNameRules(rules []TransactionNameRule) error {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsValidTransactionNameRules checks if the string is a JSON array of valid
+// transaction name rules
+func IsValidTransactionNameRules(s string) bool {
+	var rules []TransactionNameRule
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return false
+	}
+	return validateTransactionNameRules(rules) == nil
+}
+
+// ToTransactionNameRules converts a JSON array to transaction name rules, the
+// string must have been validated.
+func ToTransactionNameRules(s string) interface{} {
+	var rules []TransactionNameRule
+	json.Unmarshal([]byte(s), &rules)
+	return rules
+}
+
+// IsValidTransactionNameDepth checks if the string is a positive integer
+func IsValidTransactionNameDepth(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionNameRuleValidate(t *testing.T) {
+	assert.NoError(t, TransactionNameRule{Regex: "^/users/", Name: "users"}.Validate())
+	assert.Error(t, TransactionNameRule{Regex: "(", Name: "users"}.Validate())
+	assert.Error(t, TransactionNameRule{Name: "users"}.Validate())
+	assert.Error(t, TransactionNameRule{Regex: "^/users/"}.Validate())
+}
+
+func TestLoadTransactionNaming(t *testing.T) {
+	unsetDynamicEnvs()
+	c := NewConfig()
+	assert.Empty(t, c.GetTransactionNameRules())
+	assert.Equal(t, 2, c.GetTransactionNameDepth())
+	assert.False(t, c.GetNormalizeTransactionIDs())
+
+	os.Setenv(envAppOpticsTxnNameRules, `[{"Regex": "^/users/", "Name": "users"}]`)
+	os.Setenv(envAppOpticsTxnNameDepth, "4")
+	os.Setenv(envAppOpticsNormalizeTxnIDs, "true")
+	defer unsetDynamicEnvs()
+	c = NewConfig()
+	assert.Equal(t, []TransactionNameRule{{Regex: "^/users/", Name: "users"}}, c.GetTransactionNameRules())
+	assert.Equal(t, 4, c.GetTransactionNameDepth())
+	assert.True(t, c.GetNormalizeTransactionIDs())
+
+	// the invalid values are ignored
+	os.Setenv(envAppOpticsTxnNameRules, `[{"Regex": "^/users/"}]`)
+	os.Setenv(envAppOpticsTxnNameDepth, "0")
+	c = NewConfig()
+	assert.Empty(t, c.GetTransactionNameRules())
+	assert.Equal(t, 2, c.GetTransactionNameDepth())
+
+	require.NoError(t, c.Update(WithTransactionNameDepth(3)))
+	assert.Equal(t, 3, c.GetTransactionNameDepth())
+	assert.Error(t, c.Update(WithTransactionNameDepth(-1)))
+	assert.Equal(t, 3, c.GetTransactionNameDepth())
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// The query parameters whose values are redacted by default
+var defaultRedactedQueryParams = []string{
+	"password", "passwd", "pwd", "secret", "token", "access_token", "api_key", "apikey",
+}
+
+// WithRedactedQueryParams defines a Config option for the names of the query
+// parameters whose values are redacted.
+func WithRedactedQueryParams(names ...string) Option {
+	return func(c *Config) {
+		c.RedactedQueryParams = names
+	}
+}
+
+// WithDropQueryString defines a Config option for whether the query strings
+// are dropped entirely.
+func WithDropQueryString(drop bool) Option {
+	return func(c *Config) {
+		c.DropQueryString = drop
+	}
+}
+
+// WithURLPathMasks defines a Config option for the regular expressions of the
+// URL path segments to mask.
+func WithURLPathMasks(masks ...string) Option {
+	return func(c *Config) {
+		c.URLPathMasks = masks
+	}
+}
+
+// validateURLPathMasks checks if the masks are valid regular expressions.
+func validateURLPathMasks(masks []string) error {
+	for _, m := range masks {
+		if _, err := regexp.Compile(m); err != nil || m == "" {
+			return fmt.Errorf("invalid URL path mask: %q", m)
+		}
+	}
+	return nil
+}
+
+// IsValidURLPathMasks checks if the string is a JSON array of valid regular
+// expressions
+func IsValidURLPathMasks(s string) bool {
+	var masks []string
+	if err := json.Unmarshal([]byte(s), &masks); err != nil {
+		return false
+	}
+	return validateURLPathMasks(masks) == nil
+}
+
+// ToURLPathMasks converts a JSON array to the URL path masks, the string must
+// have been validated.
+func ToURLPathMasks(s string) interface{} {
+	var masks []string
+	json.Unmarshal([]byte(s), &masks)
+	return masks
+}
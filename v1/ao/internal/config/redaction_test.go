@@ -0,0 +1,41 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRedaction(t *testing.T) {
+	unsetDynamicEnvs()
+	c := NewConfig()
+	assert.Equal(t, defaultRedactedQueryParams, c.GetRedactedQueryParams())
+	assert.False(t, c.GetDropQueryString())
+	assert.Empty(t, c.GetURLPathMasks())
+
+	os.Setenv(envAppOpticsRedactedQueryParams, "session, sig")
+	os.Setenv(envAppOpticsDropQueryString, "true")
+	os.Setenv(envAppOpticsURLPathMasks, `["^.+@.+$"]`)
+	defer unsetDynamicEnvs()
+	c = NewConfig()
+	assert.Equal(t, []string{"session", "sig"}, c.GetRedactedQueryParams())
+	assert.True(t, c.GetDropQueryString())
+	assert.Equal(t, []string{"^.+@.+$"}, c.GetURLPathMasks())
+
+	// the default parameters can be disabled by an empty list
+	os.Setenv(envAppOpticsRedactedQueryParams, "")
+	// the invalid values are ignored
+	os.Setenv(envAppOpticsURLPathMasks, `["("]`)
+	c = NewConfig()
+	assert.Empty(t, c.GetRedactedQueryParams())
+	assert.Empty(t, c.GetURLPathMasks())
+
+	require.NoError(t, c.Update(WithURLPathMasks("^[0-9]+$")))
+	assert.Equal(t, []string{"^[0-9]+$"}, c.GetURLPathMasks())
+	assert.Error(t, c.Update(WithURLPathMasks("")))
+	assert.Equal(t, []string{"^[0-9]+$"}, c.GetURLPathMasks())
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The max sample rate of the sampling rules, which means 100%
+const maxSampleRate = 1000000
+
+// SamplingRule defines a local sample rate of the traces matching the span
+// name, the URL path or the HTTP method. All the specified conditions must
+// match. The rate is merged with the one of the remote settings, where the
+// stricter one wins unless the rule overrides it.
+type SamplingRule struct {
+	// The name of the span starting the trace
+	SpanName string `yaml:"SpanName" json:"SpanName"`
+
+	// The regular expression matching the URL path of the inbound HTTP requests
+	URL string `yaml:"URL" json:"URL"`
+
+	// The HTTP method of the inbound HTTP requests, e.g., "GET"
+	Method string `yaml:"Method" json:"Method"`
+
+	// The sample rate between 0 and 1000000, which means 100%
+	SampleRate int `yaml:"SampleRate" json:"SampleRate"`
+
+	// Whether the sample rate is applied even if it's higher than the one of
+	// the remote settings, unless the remote settings have the OVERRIDE flag.
+	Override bool `yaml:"Override" json:"Override"`
+}
+
+// Validate checks if the rule has at least a condition, a valid URL regex
+// and a valid sample rate.
+func (r SamplingRule) Validate() error {
+	if r.SpanName == "" && r.URL == "" && r.Method == "" {
+		return errors.New("sampling rule has no span name, URL or method")
+	}
+	if r.URL != "" {
+		if _, err := regexp.Compile(r.URL); err != nil {
+			return fmt.Errorf("invalid URL regex of sampling rule: %v", err)
+		}
+	}
+	if strings.ContainsAny(r.Method, " \t") {
+		return fmt.Errorf("invalid method of sampling rule: %q", r.Method)
+	}
+	if r.SampleRate < 0 || r.SampleRate > maxSampleRate {
+		return fmt.Errorf("invalid sample rate of sampling rule: %d, must be between 0 and %d",
+			r.SampleRate, maxSampleRate)
+	}
+	return nil
+}
+
+// WithSamplingRules defines a Config option for the local sampling rules.
+func WithSamplingRules(rules ...SamplingRule) Option {
+	return func(c *Config) {
+		c.SamplingRules = rules
+	}
+}
+
+// validateSamplingRules checks all the rules.
+func validateSamplingRules(rules []SamplingRule) error {
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsValidSamplingRules checks if the string is a JSON array of valid sampling
+// rules
+func IsValidSamplingRules(s string) bool {
+	var rules []SamplingRule
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return false
+	}
+	return validateSamplingRules(rules) == nil
+}
+
+// ToSamplingRules converts a JSON array to sampling rules, the string must
+// have been validated.
+func ToSamplingRules(s string) interface{} {
+	var rules []SamplingRule
+	json.Unmarshal([]byte(s), &rules)
+	return rules
+}
@@ -0,0 +1,46 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingRuleValidate(t *testing.T) {
+	assert.NoError(t, SamplingRule{SpanName: "cron", SampleRate: 0}.Validate())
+	assert.NoError(t, SamplingRule{URL: "^/checkout", Method: "POST", SampleRate: 1000000, Override: true}.Validate())
+	assert.NoError(t, SamplingRule{Method: "get", SampleRate: 500000}.Validate())
+
+	assert.Error(t, SamplingRule{SampleRate: 0}.Validate())
+	assert.Error(t, SamplingRule{URL: "(", SampleRate: 0}.Validate())
+	assert.Error(t, SamplingRule{Method: "GET POST", SampleRate: 0}.Validate())
+	assert.Error(t, SamplingRule{SpanName: "cron", SampleRate: -1}.Validate())
+	assert.Error(t, SamplingRule{SpanName: "cron", SampleRate: 1000001}.Validate())
+}
+
+func TestLoadSamplingRules(t *testing.T) {
+	os.Setenv(envAppOpticsSamplingRules,
+		`[{"URL": "^/checkout", "Method": "POST", "SampleRate": 1000000, "Override": true}, {"SpanName": "cron", "SampleRate": 0}]`)
+	defer os.Unsetenv(envAppOpticsSamplingRules)
+
+	c := NewConfig()
+	assert.Equal(t, []SamplingRule{
+		{URL: "^/checkout", Method: "POST", SampleRate: 1000000, Override: true},
+		{SpanName: "cron", SampleRate: 0},
+	}, c.GetSamplingRules())
+
+	// the invalid rules are ignored
+	os.Setenv(envAppOpticsSamplingRules, `[{"SpanName": "cron", "SampleRate": 2000000}]`)
+	c = NewConfig()
+	assert.Empty(t, c.GetSamplingRules())
+
+	// updated at runtime
+	require.NoError(t, c.Update(WithSamplingRules(SamplingRule{SpanName: "cron", SampleRate: 10000})))
+	assert.Len(t, c.GetSamplingRules(), 1)
+	assert.Error(t, c.Update(WithSamplingRules(SamplingRule{SampleRate: 10000})))
+	assert.Equal(t, 10000, c.GetSamplingRules()[0].SampleRate)
+}
@@ -0,0 +1,11 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+// WithTriggerTrace defines a Config option for whether the trigger traces
+// requested by the X-Trace-Options header are enabled.
+func WithTriggerTrace(enabled bool) Option {
+	return func(c *Config) {
+		c.TriggerTrace = enabled
+	}
+}
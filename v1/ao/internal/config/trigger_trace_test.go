@@ -0,0 +1,30 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTriggerTrace(t *testing.T) {
+	unsetDynamicEnvs()
+	c := NewConfig()
+	assert.True(t, c.GetTriggerTrace())
+
+	os.Setenv(envAppOpticsTriggerTrace, "false")
+	defer unsetDynamicEnvs()
+	c = NewConfig()
+	assert.False(t, c.GetTriggerTrace())
+
+	// the invalid value is ignored
+	os.Setenv(envAppOpticsTriggerTrace, "disabled")
+	c = NewConfig()
+	assert.True(t, c.GetTriggerTrace())
+
+	require.NoError(t, c.Update(WithTriggerTrace(false)))
+	assert.False(t, c.GetTriggerTrace())
+}
@@ -0,0 +1,101 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// WithTrustedTraceSources defines a Config option for the CIDRs or IP addresses
+// whose inbound trace context is continued.
+func WithTrustedTraceSources(sources ...string) Option {
+	return func(c *Config) {
+		c.TrustedTraceSources = sources
+	}
+}
+
+// WithTraceContextSecret defines a Config option for the shared secret to sign
+// the trace context.
+func WithTraceContextSecret(secret string) Option {
+	return func(c *Config) {
+		c.TraceContextSecret = secret
+	}
+}
+
+// WithTraceContextSignDestinations defines a Config option for the host
+// patterns of the outbound requests whose trace context is signed.
+func WithTraceContextSignDestinations(hosts ...string) Option {
+	return func(c *Config) {
+		c.TraceContextSignDestinations = hosts
+	}
+}
+
+// ParseIPNet parses a CIDR or an IP address, which is converted to a single
+// address network.
+func ParseIPNet(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid CIDR or IP address: %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// validateIPNets checks if the networks are valid CIDRs or IP addresses.
+func validateIPNets(nets []string) error {
+	for _, s := range nets {
+		if _, err := ParseIPNet(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsValidIPNets checks if the string is a comma separated list of CIDRs or IP
+// addresses
+func IsValidIPNets(s string) bool {
+	return validateIPNets(splitList(s)) == nil
+}
+
+// validateHostPatterns checks if the patterns are host names, IP addresses or
+// wildcard domains, e.g., "*.example.com".
+func validateHostPatterns(patterns []string) error {
+	for _, p := range patterns {
+		host := strings.TrimPrefix(strings.TrimSpace(p), "*.")
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		if host == "" || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") {
+			return fmt.Errorf("invalid host pattern: %q", p)
+		}
+		for _, ch := range host {
+			if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+				ch == '-' || ch == '.') {
+				return fmt.Errorf("invalid host pattern: %q", p)
+			}
+		}
+	}
+	return nil
+}
+
+// IsValidHostPatterns checks if the string is a comma separated list of host
+// names, IP addresses or wildcard domains
+func IsValidHostPatterns(s string) bool {
+	return validateHostPatterns(splitList(s)) == nil
+}
+
+// MaskSecret masks the secret entirely
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
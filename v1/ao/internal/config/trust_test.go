@@ -0,0 +1,73 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPNet(t *testing.T) {
+	n, err := ParseIPNet("10.0.0.0/8")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8", n.String())
+	n, err = ParseIPNet(" 192.168.1.1 ")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.1/32", n.String())
+	n, err = ParseIPNet("::1")
+	require.NoError(t, err)
+	assert.Equal(t, "::1/128", n.String())
+	_, err = ParseIPNet("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseIPNet("localhost")
+	assert.Error(t, err)
+}
+
+func TestIsValidHostPatterns(t *testing.T) {
+	assert.True(t, IsValidHostPatterns("api.example.com, *.example.org"))
+	assert.True(t, IsValidHostPatterns("localhost,10.0.0.1,::1"))
+	assert.False(t, IsValidHostPatterns("*"))
+	assert.False(t, IsValidHostPatterns("*.*.example.com"))
+	assert.False(t, IsValidHostPatterns("example.com/path"))
+	assert.False(t, IsValidHostPatterns(".example.com"))
+}
+
+func TestLoadTraceTrust(t *testing.T) {
+	unsetDynamicEnvs()
+	c := NewConfig()
+	assert.Empty(t, c.GetTrustedTraceSources())
+	assert.Empty(t, c.GetTraceContextSecret())
+
+	os.Setenv(envAppOpticsTrustedSources, "10.0.0.0/8, 192.168.1.1")
+	os.Setenv(envAppOpticsTraceContextSecret, "secret")
+	defer unsetDynamicEnvs()
+	c = NewConfig()
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.1"}, c.GetTrustedTraceSources())
+	assert.Equal(t, "secret", c.GetTraceContextSecret())
+
+	os.Setenv(envAppOpticsSignDestinations, "api.example.com, *.example.org")
+	c = NewConfig()
+	assert.Equal(t, []string{"api.example.com", "*.example.org"}, c.GetTraceContextSignDestinations())
+
+	// the invalid values are ignored
+	os.Setenv(envAppOpticsTrustedSources, "10.0.0.0/8,internal")
+	c = NewConfig()
+	assert.Empty(t, c.GetTrustedTraceSources())
+
+	require.NoError(t, c.Update(WithTrustedTraceSources("172.16.0.0/12"), WithTraceContextSecret("another")))
+	assert.Equal(t, []string{"172.16.0.0/12"}, c.GetTrustedTraceSources())
+	assert.Equal(t, "another", c.GetTraceContextSecret())
+	assert.Error(t, c.Update(WithTrustedTraceSources("internal")))
+	assert.Equal(t, []string{"172.16.0.0/12"}, c.GetTrustedTraceSources())
+
+	require.NoError(t, c.Update(WithTraceContextSignDestinations("*.example.com")))
+	assert.Equal(t, []string{"*.example.com"}, c.GetTraceContextSignDestinations())
+	assert.Error(t, c.Update(WithTraceContextSignDestinations("*")))
+	assert.Equal(t, []string{"*.example.com"}, c.GetTraceContextSignDestinations())
+
+	assert.Equal(t, "********", MaskSecret("secret"))
+	assert.Equal(t, "", MaskSecret(""))
+}
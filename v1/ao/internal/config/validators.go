@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"strings"
 	"unicode/utf8"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
 )
 
 // InvalidEnv returns a string indicating invalid environment variables
@@ -124,6 +126,41 @@ func ToTracingMode(m string) interface{} {
 	return m
 }
 
+// IsValidLogLevel checks if the log level is valid
+func IsValidLogLevel(l string) bool {
+	_, ok := log.ToLogLevel(l)
+	return ok
+}
+
+// ToLogLevel converts a string to the name of the log level, e.g., "debug"
+// and "0" are converted to "DEBUG"
+func ToLogLevel(l string) interface{} {
+	lvl, _ := log.ToLogLevel(l)
+	return log.LevelStr[lvl]
+}
+
+// IsValidCompression checks if the compression algorithm is supported
+func IsValidCompression(c string) bool {
+	t := strings.ToLower(strings.TrimSpace(c))
+	return t == "none" || t == "gzip" || t == "snappy"
+}
+
+// ToCompression converts a string to a compression algorithm
+func ToCompression(c string) interface{} {
+	return strings.ToLower(strings.TrimSpace(c))
+}
+
+// IsValidOverflowPolicy checks if the queue overflow policy is supported
+func IsValidOverflowPolicy(p string) bool {
+	t := strings.ToLower(strings.TrimSpace(p))
+	return t == "drop-newest" || t == "drop-oldest" || t == "block-with-timeout"
+}
+
+// ToOverflowPolicy converts a string to a queue overflow policy
+func ToOverflowPolicy(p string) interface{} {
+	return strings.ToLower(strings.TrimSpace(p))
+}
+
 // IsValidBool checks if the string represents a valid boolean value
 func IsValidBool(b string) bool {
 	t := strings.ToLower(strings.TrimSpace(b))
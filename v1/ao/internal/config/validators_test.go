@@ -62,6 +62,22 @@ func TestIsValidTracingMode(t *testing.T) {
 	assert.Equal(t, true, IsValidTracingMode("ALWAYS"))
 }
 
+func TestIsValidCompression(t *testing.T) {
+	assert.Equal(t, true, IsValidCompression("none"))
+	assert.Equal(t, true, IsValidCompression("gzip"))
+	assert.Equal(t, true, IsValidCompression(" Snappy"))
+	assert.Equal(t, false, IsValidCompression("zstd"))
+	assert.Equal(t, false, IsValidCompression(""))
+}
+
+func TestIsValidOverflowPolicy(t *testing.T) {
+	assert.Equal(t, true, IsValidOverflowPolicy("drop-newest"))
+	assert.Equal(t, true, IsValidOverflowPolicy("drop-oldest"))
+	assert.Equal(t, true, IsValidOverflowPolicy("Block-With-Timeout"))
+	assert.Equal(t, false, IsValidOverflowPolicy("block"))
+	assert.Equal(t, false, IsValidOverflowPolicy(""))
+}
+
 func TestIsValidReporterType(t *testing.T) {
 	assert.Equal(t, true, IsValidReporterType("udp"))
 	assert.Equal(t, true, IsValidReporterType("ssl"))
@@ -75,6 +91,8 @@ func TestConverters(t *testing.T) {
 	assert.Equal(t, int64(1), ToInt64("1"))
 	assert.Equal(t, "ssl", ToReporterType("ssl").(string))
 	assert.Equal(t, "never", ToTracingMode("never").(string))
+	assert.Equal(t, "snappy", ToCompression(" Snappy").(string))
+	assert.Equal(t, "drop-oldest", ToOverflowPolicy("DROP-OLDEST").(string))
 }
 
 func withDemoKey(sn string) string {
@@ -37,8 +37,104 @@ var GetPrecision = conf.GetPrecision
 // GetDisabled is a wrapper to the method of the global config
 var GetDisabled = conf.GetDisabled
 
+// GetSpoolDir is a wrapper to the method of the global config
+var GetSpoolDir = conf.GetSpoolDir
+
+// GetSpoolMaxSize is a wrapper to the method of the global config
+var GetSpoolMaxSize = conf.GetSpoolMaxSize
+
+// GetCompression is a wrapper to the method of the global config
+var GetCompression = conf.GetCompression
+
+// GetEventQueueSize is a wrapper to the method of the global config
+var GetEventQueueSize = conf.GetEventQueueSize
+
+// GetOverflowPolicy is a wrapper to the method of the global config
+var GetOverflowPolicy = conf.GetOverflowPolicy
+
+// GetQueueBlockTimeout is a wrapper to the method of the global config
+var GetQueueBlockTimeout = conf.GetQueueBlockTimeout
+
+// GetNoAutoInit is a wrapper to the method of the global config
+var GetNoAutoInit = conf.GetNoAutoInit
+
+// GetDebugLevel is a wrapper to the method of the global config
+var GetDebugLevel = conf.GetDebugLevel
+
+// GetURLFilters is a wrapper to the method of the global config
+var GetURLFilters = conf.GetURLFilters
+
+// GetTransactionNameRules is a wrapper to the method of the global config
+var GetTransactionNameRules = conf.GetTransactionNameRules
+
+// GetTransactionNameDepth is a wrapper to the method of the global config
+var GetTransactionNameDepth = conf.GetTransactionNameDepth
+
+// GetNormalizeTransactionIDs is a wrapper to the method of the global config
+var GetNormalizeTransactionIDs = conf.GetNormalizeTransactionIDs
+
+// GetCaptureRequestHeaders is a wrapper to the method of the global config
+var GetCaptureRequestHeaders = conf.GetCaptureRequestHeaders
+
+// GetCaptureResponseHeaders is a wrapper to the method of the global config
+var GetCaptureResponseHeaders = conf.GetCaptureResponseHeaders
+
+// GetRedactedHeaders is a wrapper to the method of the global config
+var GetRedactedHeaders = conf.GetRedactedHeaders
+
+// GetCaptureBodyContentTypes is a wrapper to the method of the global config
+var GetCaptureBodyContentTypes = conf.GetCaptureBodyContentTypes
+
+// GetCaptureBodyMaxBytes is a wrapper to the method of the global config
+var GetCaptureBodyMaxBytes = conf.GetCaptureBodyMaxBytes
+
+// GetRedactedQueryParams is a wrapper to the method of the global config
+var GetRedactedQueryParams = conf.GetRedactedQueryParams
+
+// GetDropQueryString is a wrapper to the method of the global config
+var GetDropQueryString = conf.GetDropQueryString
+
+// GetURLPathMasks is a wrapper to the method of the global config
+var GetURLPathMasks = conf.GetURLPathMasks
+
+// GetTrustedTraceSources is a wrapper to the method of the global config
+var GetTrustedTraceSources = conf.GetTrustedTraceSources
+
+// GetTraceContextSecret is a wrapper to the method of the global config
+var GetTraceContextSecret = conf.GetTraceContextSecret
+
+// GetTraceContextSignDestinations is a wrapper to the method of the global config
+var GetTraceContextSignDestinations = conf.GetTraceContextSignDestinations
+
+// GetClientIPHeaders is a wrapper to the method of the global config
+var GetClientIPHeaders = conf.GetClientIPHeaders
+
+// GetTrustedProxies is a wrapper to the method of the global config
+var GetTrustedProxies = conf.GetTrustedProxies
+
+// GetTrustedProxyCount is a wrapper to the method of the global config
+var GetTrustedProxyCount = conf.GetTrustedProxyCount
+
+// GetClientIPMetricsTag is a wrapper to the method of the global config
+var GetClientIPMetricsTag = conf.GetClientIPMetricsTag
+
+// GetTriggerTrace is a wrapper to the method of the global config
+var GetTriggerTrace = conf.GetTriggerTrace
+
+// GetSamplingRules is a wrapper to the method of the global config
+var GetSamplingRules = conf.GetSamplingRules
+
 // ReporterOpts is a wrapper to the method of the global config
 var ReporterOpts = conf.GetReporter
 
 // Refresh reloads the customized configurations
 var Refresh = conf.RefreshConfig
+
+// Update is a wrapper to the method of the global config
+var Update = conf.Update
+
+// Reload is a wrapper to the method of the global config
+var Reload = conf.Reload
+
+// AddListener is a wrapper to the method of the global config
+var AddListener = conf.AddListener
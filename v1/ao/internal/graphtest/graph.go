@@ -306,6 +306,15 @@ func assertOutEdges(t *testing.T, g eventGraph, n Node, edges ...MatchNode) {
 	}
 }
 
+// WriteDOT writes the nodes as a graphviz dot file to output Writer.
+func WriteDOT(output io.Writer, nodes ...Node) {
+	g := make(eventGraph)
+	for _, n := range nodes {
+		g[n.OpID] = n
+	}
+	dotGraph(g, output)
+}
+
 // dotGraph writes a graphviz dot file to output Writer
 func dotGraph(g eventGraph, output io.Writer) {
 	fmt.Fprintln(output, "digraph main{")
@@ -34,11 +34,13 @@ var (
 	// hostId stores the up-to-date ID info, which is updated periodically
 	hostId = newLockedID()
 
-	// exit indicates the ID observer should exit when it's closed
-	exit = make(chan struct{})
+	// exit indicates the running ID observer should exit when it's closed
+	exit chan struct{}
 
-	// make sure the channel exit is not closed twice, it's effectively immutable.
-	exitClosed sync.Once
+	// the number of the callers of Start which haven't called Stop yet, and
+	// the lock protecting it and exit
+	observers int
+	om        sync.Mutex
 
 	// the cache for initDistro information and its lock
 	distro     string
@@ -73,17 +75,34 @@ func PID() int {
 }
 
 // Start starts the host observer as a standalone goroutine, which will refresh
-// the host metadata periodically
+// the host metadata periodically. The observer is shared by all the callers,
+// e.g., the reporters of multiple agents, and keeps running until all of them
+// have called Stop. It can be started again after being stopped.
 func Start() {
-	go observer()
+	om.Lock()
+	defer om.Unlock()
+
+	observers++
+	if observers == 1 {
+		exit = make(chan struct{})
+		go observer(exit)
+	}
 }
 
-// Stop stops the host metadata refreshing goroutine
+// Stop stops the host metadata refreshing goroutine if it's the last caller
+// of Start.
 func Stop() {
-	exitClosed.Do(func() {
+	om.Lock()
+	defer om.Unlock()
+
+	if observers == 0 {
+		return
+	}
+	observers--
+	if observers == 0 {
 		close(exit)
 		log.Info(stopHostIdObserverByUser)
-	})
+	}
 }
 
 // ConfiguredHostname returns the hostname configured by user
@@ -112,6 +112,28 @@ func TestStopHostIDObserver(t *testing.T) {
 	aolog.SetLevel(aolog.WARNING)
 }
 
+func TestRestartHostIDObserver(t *testing.T) {
+	var buf utils.SafeBuffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	aolog.SetLevel(aolog.INFO)
+	defer aolog.SetLevel(aolog.WARNING)
+
+	// the observer keeps running until all the callers of Start stop it
+	Start()
+	Start()
+	Stop()
+	assert.NotContains(t, buf.String(), stopHostIdObserverByUser)
+	Stop()
+	assert.Contains(t, buf.String(), stopHostIdObserverByUser)
+
+	// and it can be started again
+	buf.Reset()
+	Start()
+	Stop()
+	assert.Contains(t, buf.String(), stopHostIdObserverByUser)
+}
+
 func TestCurrentID(t *testing.T) {
 	assert.Equal(t, os.Getpid(), CurrentID().Pid())
 }
@@ -36,7 +36,7 @@ const (
 
 // observer checks the update of the host metadata periodically. It runs in a
 // standalone goroutine.
-func observer() {
+func observer(exit chan struct{}) {
 	log.Debug(hostObserverStarted)
 	defer log.Info(hostObserverStopped)
 
@@ -0,0 +1,145 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	"github.com/pkg/errors"
+)
+
+// Agent errors
+var (
+	ErrInvalidServiceKey   = errors.New("invalid service key")
+	ErrUnsupportedReporter = errors.New("only the ssl reporter supports multiple service keys")
+	ErrReporterInitFailed  = errors.New("failed to initialize the reporter")
+)
+
+// Agent samples and reports the traces and metrics of a service with its own
+// service key, connection to the collector, sampling settings and HTTP
+// metrics. The other configuration, e.g., the collector address, is shared by
+// all the agents.
+//
+// A nil *Agent is the default agent, which uses the service key of the
+// configuration and backs the package-level functions.
+type Agent struct {
+	serviceKey  string
+	reporter    reporter
+	settings    *oboeSettingsCfg
+	httpMetrics *httpMetrics
+	// removes the listener of the configuration updates
+	removeListener func()
+}
+
+// the default agent, which uses the global reporter, settings and metrics
+var defaultAgent *Agent
+
+// NewAgent creates an agent with the service key and starts its reporter.
+func NewAgent(serviceKey string) (*Agent, error) {
+	if !config.IsValidServiceKey(serviceKey) {
+		return nil, ErrInvalidServiceKey
+	}
+	serviceKey = config.ToServiceKey(serviceKey).(string)
+	parts := strings.SplitN(serviceKey, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, ErrInvalidServiceKey
+	}
+
+	a := &Agent{
+		serviceKey:  serviceKey,
+		settings:    newOboeSettingsCfg(),
+		httpMetrics: newHTTPMetrics(),
+	}
+	switch {
+	case config.GetDisabled(), strings.ToLower(config.GetReporterType()) == "none":
+		a.reporter = newNullReporter()
+	case strings.ToLower(config.GetReporterType()) == "udp":
+		return nil, ErrUnsupportedReporter
+	default:
+		r := newAgentGRPCReporter(serviceKey, agentSpoolSubdir(serviceKey), a.settings, a.httpMetrics)
+		if _, ok := r.(*nullReporter); ok {
+			return nil, ErrReporterInitFailed
+		}
+		a.reporter = r
+	}
+	a.removeListener = config.AddListener(configListener(a.settings, a.httpMetrics))
+	sendAgentInitMessage(a)
+	return a, nil
+}
+
+// agentSpoolSubdir returns the spool subdirectory of the agent. It's named
+// after the hash of the service key, so it's unique to each service key and
+// always a valid directory name.
+func agentSpoolSubdir(serviceKey string) string {
+	sum := sha256.Sum256([]byte(serviceKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServiceKey returns the service key of the agent, or the configured one for
+// the default agent.
+func (a *Agent) ServiceKey() string {
+	if a == nil {
+		return config.GetServiceKey()
+	}
+	return a.serviceKey
+}
+
+// getReporter returns the reporter of the agent.
+func (a *Agent) getReporter() reporter {
+	if a == nil {
+		return getGlobalReporter()
+	}
+	return a.reporter
+}
+
+// shouldTraceRequest makes the sampling decision with the settings of the
+// agent and the local sample rate, unless it's overridden.
+func (a *Agent) shouldTraceRequest(layer string, traced bool, override SamplingOverride,
+	local *LocalSampleRate) (bool, int, sampleSource) {
+	switch override {
+	case SampleNever:
+		return false, 0, SAMPLE_SOURCE_NONE
+	case SampleAlways:
+		return a.getSettingsCfg().forceSample(traced)
+	}
+	if a == nil {
+		return oboeSampleRequest(layer, traced, local)
+	}
+	return a.settings.sampleRequest(layer, traced, local)
+}
+
+// getSettingsCfg returns the settings of the agent.
+func (a *Agent) getSettingsCfg() *oboeSettingsCfg {
+	if a == nil {
+		return globalSettingsCfg
+	}
+	return a.settings
+}
+
+// WaitForReady waits until the agent becomes ready or the context is canceled.
+func (a *Agent) WaitForReady(ctx context.Context) bool {
+	return a.getReporter().WaitForReady(ctx)
+}
+
+// Shutdown flushes the metrics and stops the reporter of the agent. It blocks
+// until the reporter is shutdown or the context is canceled.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	if a != nil {
+		a.removeListener()
+	}
+	return a.getReporter().Shutdown(ctx)
+}
+
+// Closed indicates if the reporter of the agent has been shutdown.
+func (a *Agent) Closed() bool {
+	return a.getReporter().Closed()
+}
+
+// ReportSpan aggregates the span message into the metrics of the agent.
+func (a *Agent) ReportSpan(span SpanMessage) error {
+	return a.getReporter().reportSpan(span)
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/collectortest"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (m *measurements) len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.measurements)
+}
+
+const agentServiceKey = "ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:Other Service"
+
+func TestNewAgent(t *testing.T) {
+	_, err := NewAgent("invalid")
+	assert.Equal(t, ErrInvalidServiceKey, err)
+	_, err = NewAgent("ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:")
+	assert.Equal(t, ErrInvalidServiceKey, err)
+
+	// the null reporter is used if the agent is disabled
+	os.Setenv("APPOPTICS_DISABLED", "true")
+	config.Refresh()
+	a, err := NewAgent(agentServiceKey)
+	os.Unsetenv("APPOPTICS_DISABLED")
+	config.Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, "ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:other-service",
+		a.ServiceKey())
+	assert.IsType(t, &nullReporter{}, a.getReporter())
+	assert.False(t, a.settings.hasDefaultSetting())
+	// no settings, no sampling
+	ctx, ok := a.NewContext("layer", "", true, nil)
+	assert.True(t, ok)
+	assert.False(t, ctx.IsSampled())
+
+	assert.Equal(t, config.GetServiceKey(), defaultAgent.ServiceKey())
+	assert.Equal(t, getGlobalReporter(), defaultAgent.getReporter())
+}
+
+func TestAgentSpoolSubdir(t *testing.T) {
+	token := "ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217"
+	other := "be38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217"
+
+	// the service keys of the same service name have their own subdirectory
+	assert.NotEqual(t, agentSpoolSubdir(token+":svc"), agentSpoolSubdir(other+":svc"))
+	assert.Equal(t, agentSpoolSubdir(token+":svc"), agentSpoolSubdir(token+":svc"))
+	for _, name := range []string{".", ".."} {
+		dir := agentSpoolSubdir(token + ":" + name)
+		assert.Len(t, dir, 64)
+		assert.Equal(t, dir, filepath.Base(dir))
+	}
+}
+
+func TestAgentWithMockCollector(t *testing.T) {
+	server, err := collectortest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	env := server.Env()
+	env["APPOPTICS_REPORTER"] = "ssl"
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+	config.Refresh()
+	defer config.Refresh()
+	resetSettings()
+
+	a, err := NewAgent(agentServiceKey)
+	require.NoError(t, err)
+	r, ok := a.getReporter().(*grpcReporter)
+	require.True(t, ok)
+	defer r.ShutdownNow()
+
+	r.getSettings(make(chan bool, 1))
+	ctxTm, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.True(t, a.WaitForReady(ctxTm))
+	// the settings of the default agent are untouched
+	assert.True(t, a.settings.hasDefaultSetting())
+	assert.False(t, hasDefaultSetting())
+
+	// the diagnostics of the agent are its own
+	d := a.Diagnostics()
+	assert.Equal(t, "ssl", d.Reporter)
+	assert.True(t, d.Ready)
+	assert.Len(t, d.Settings, 1)
+	assert.Len(t, d.Connections, 2)
+	assert.False(t, GetDiagnostics().Ready)
+	assert.Empty(t, GetDiagnostics().Settings)
+
+	ctx, ok := a.NewContext("svc", "", true, nil)
+	require.True(t, ok)
+	require.True(t, ctx.IsSampled())
+	require.NoError(t, ctx.ReportEvent(LabelExit, "svc"))
+
+	events := server.WaitForEvents(2, 5*time.Second)
+	require.Len(t, events, 2)
+	assert.Equal(t, "svc", events[0]["Layer"])
+	assert.Equal(t, LabelEntry, events[0]["Label"])
+	assert.Equal(t, LabelExit, events[1]["Label"])
+	require.NotEmpty(t, server.WaitForStatus(1, 5*time.Second))
+
+	// the HTTP metrics are aggregated by the agent
+	require.NoError(t, a.ReportSpan(&HTTPSpanMessage{
+		BaseSpanMessage: BaseSpanMessage{Duration: time.Millisecond},
+		Transaction:     "txn",
+		Status:          200,
+		Method:          "GET",
+	}))
+	for i := 0; i < 100 && a.httpMetrics.measurements.len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NotZero(t, a.httpMetrics.measurements.len())
+	r.collectMetrics(make(chan bool, 1))
+	metrics := server.WaitForMetrics(1, 5*time.Second)
+	require.NotEmpty(t, metrics)
+	assert.Zero(t, a.httpMetrics.measurements.len())
+
+	// the process-wide metrics are left to the default agent
+	names := make(map[string]bool)
+	for _, mt := range metrics[0]["measurements"].([]interface{}) {
+		names[mt.(bson.M)["name"].(string)] = true
+	}
+	assert.True(t, names["RequestCount"])
+	assert.True(t, names["NumSent"])
+	assert.False(t, names["JMX.type=threadcount,name=NumGoroutine"])
+
+	methods := make(map[collectortest.Method]bool)
+	for _, req := range server.Requests() {
+		assert.Equal(t, a.ServiceKey(), req.APIKey)
+		methods[req.Method] = true
+	}
+	assert.True(t, methods[collectortest.GetSettings])
+	assert.True(t, methods[collectortest.PostEvents])
+	assert.True(t, methods[collectortest.PostStatus])
+	assert.True(t, methods[collectortest.PostMetrics])
+}
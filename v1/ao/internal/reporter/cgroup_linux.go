@@ -0,0 +1,265 @@
+// +build linux
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the default locations of the cgroup information
+const (
+	cgroupProcSelf  = "/proc/self/cgroup"
+	cgroupMountRoot = "/sys/fs/cgroup"
+)
+
+// the memory limit reported by cgroup v1 when no limit is set is the maximum
+// int64 value rounded down to the page size. Anything above this threshold is
+// considered unlimited.
+const cgroupMemUnlimited = int64(1) << 62
+
+// cgroupCounters holds the cumulative counters read from the cgroup
+// filesystem, which are reported as deltas between two metrics cycles.
+type cgroupCounters struct {
+	throttledPeriods int64 // number of throttled periods
+	throttledTimeNs  int64 // total throttled time in nanoseconds
+	oomKills         int64 // number of processes killed by the OOM killer
+}
+
+// cgroup reads the resource limits and usage of the control group the process
+// belongs to. Both cgroup v1 and v2 (unified hierarchy) are supported.
+type cgroup struct {
+	// the mount point of the cgroup filesystem, e.g., /sys/fs/cgroup
+	root string
+	// whether it's the unified hierarchy (cgroup v2)
+	v2 bool
+	// the hierarchy of each controller, the key is an empty string for
+	// cgroup v2.
+	hierarchies map[string]cgroupHierarchy
+
+	// the counters of the last metrics cycle, protected by the lock.
+	last cgroupCounters
+	lock sync.Mutex
+}
+
+// cgroupHierarchy is where a controller is mounted and the cgroup path of the
+// process in this hierarchy.
+type cgroupHierarchy struct {
+	mount string // the directory name under the root, e.g., cpu,cpuacct
+	path  string // the cgroup path relative to the mount point
+}
+
+// the cgroup of the current process, nil if the process is not in a cgroup
+// or the cgroup filesystem is not accessible.
+var processCgroup = newCgroup(cgroupProcSelf, cgroupMountRoot)
+
+// newCgroup parses the proc file (in the format of /proc/self/cgroup) and
+// returns a cgroup reader of the filesystem mounted at root. It returns nil
+// if the cgroup information is not available.
+func newCgroup(procFile string, root string) *cgroup {
+	f, err := os.Open(procFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	if _, err := os.Stat(root); err != nil {
+		return nil
+	}
+
+	cg := &cgroup{root: root, hierarchies: make(map[string]cgroupHierarchy)}
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		cg.v2 = true
+	}
+
+	// each line is in the format of hierarchy-ID:controller-list:cgroup-path
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if cg.v2 {
+			if fields[0] == "0" && fields[1] == "" {
+				cg.hierarchies[""] = cgroupHierarchy{path: fields[2]}
+			}
+			continue
+		}
+		for _, ctrl := range strings.Split(fields[1], ",") {
+			cg.hierarchies[ctrl] = cgroupHierarchy{mount: fields[1], path: fields[2]}
+		}
+	}
+
+	if len(cg.hierarchies) == 0 {
+		return nil
+	}
+	// the first metrics cycle reports the deltas since the process started,
+	// rather than the lifetime counters of the cgroup.
+	cg.last = cg.counters()
+	return cg
+}
+
+// dir returns the directory of the controller. The cgroup path in the proc
+// file is relative to the root of the hierarchy, which may not be visible
+// inside a container. It falls back to the root of the hierarchy in this case.
+func (cg *cgroup) dir(controller string) string {
+	if cg.v2 {
+		controller = ""
+	}
+	h := cg.hierarchies[controller]
+
+	// co-mounted controllers (e.g., cpu,cpuacct) usually have symlinks of
+	// each controller name, but it's not guaranteed.
+	base := filepath.Join(cg.root, controller)
+	if _, err := os.Stat(base); err != nil && h.mount != "" {
+		base = filepath.Join(cg.root, h.mount)
+	}
+
+	d := filepath.Join(base, h.path)
+	if _, err := os.Stat(d); err == nil {
+		return d
+	}
+	return base
+}
+
+// readInt reads a file containing a single integer value. The value "max"
+// is returned as -1.
+func (cg *cgroup) readInt(controller, file string) (int64, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(cg.dir(controller), file))
+	if err != nil {
+		return 0, false
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return -1, true
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// readKVs reads a flat keyed file, e.g., cpu.stat, memory.stat, where each
+// line is in the format of "key value"
+func (cg *cgroup) readKVs(controller, file string) map[string]int64 {
+	f, err := os.Open(filepath.Join(cg.dir(controller), file))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	kvs := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			kvs[fields[0]] = v
+		}
+	}
+	return kvs
+}
+
+// cpuQuota returns the CPU quota in number of cores, or false if the quota
+// is not set.
+func (cg *cgroup) cpuQuota() (float64, bool) {
+	var quota, period int64
+	if cg.v2 {
+		b, err := ioutil.ReadFile(filepath.Join(cg.dir(""), "cpu.max"))
+		if err != nil {
+			return 0, false
+		}
+		// cpu.max: $MAX $PERIOD
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		quota, _ = strconv.ParseInt(fields[0], 10, 64)
+		period, _ = strconv.ParseInt(fields[1], 10, 64)
+	} else {
+		var ok bool
+		if quota, ok = cg.readInt("cpu", "cpu.cfs_quota_us"); !ok {
+			return 0, false
+		}
+		if period, ok = cg.readInt("cpu", "cpu.cfs_period_us"); !ok {
+			return 0, false
+		}
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, false
+	}
+	return float64(quota) / float64(period), true
+}
+
+// counters reads the current values of the cumulative counters
+func (cg *cgroup) counters() cgroupCounters {
+	var c cgroupCounters
+
+	cpuStat := cg.readKVs("cpu", "cpu.stat")
+	c.throttledPeriods = cpuStat["nr_throttled"]
+	if cg.v2 {
+		c.throttledTimeNs = cpuStat["throttled_usec"] * 1000
+		c.oomKills = cg.readKVs("", "memory.events")["oom_kill"]
+	} else {
+		c.throttledTimeNs = cpuStat["throttled_time"]
+		c.oomKills = cg.readKVs("memory", "memory.oom_control")["oom_kill"]
+	}
+	return c
+}
+
+// addMetrics reports the cgroup metrics
+// e		the emitter to report the metrics to
+func (cg *cgroup) addMetrics(e *metricsEmitter) {
+	if quota, ok := cg.cpuQuota(); ok {
+		e.addValue("CgroupCPUQuota", quota)
+	}
+
+	cg.lock.Lock()
+	curr := cg.counters()
+	last := cg.last
+	cg.last = curr
+	cg.lock.Unlock()
+
+	// the counters may be reset when the cgroup is recreated
+	e.addValue("CgroupCPUThrottledPeriods", counterDelta(curr.throttledPeriods, last.throttledPeriods))
+	e.addValue("CgroupCPUThrottledTime", counterDelta(curr.throttledTimeNs, last.throttledTimeNs))
+	e.addValue("CgroupOOMKillCount", counterDelta(curr.oomKills, last.oomKills))
+
+	var limit, usage, rss int64
+	var limitOK, usageOK, rssOK bool
+	if cg.v2 {
+		limit, limitOK = cg.readInt("", "memory.max")
+		usage, usageOK = cg.readInt("", "memory.current")
+		rss, rssOK = cg.readKVs("", "memory.stat")["anon"]
+	} else {
+		limit, limitOK = cg.readInt("memory", "memory.limit_in_bytes")
+		usage, usageOK = cg.readInt("memory", "memory.usage_in_bytes")
+		rss, rssOK = cg.readKVs("memory", "memory.stat")["total_rss"]
+	}
+	if limitOK && limit > 0 && limit < cgroupMemUnlimited {
+		e.addValue("CgroupMemoryLimit", limit)
+	}
+	if usageOK {
+		e.addValue("CgroupMemoryUsage", usage)
+	}
+	if rssOK {
+		e.addValue("CgroupMemoryRSS", rss)
+	}
+}
+
+// addCgroupMetrics reports the metrics of the process's cgroup, if any.
+func addCgroupMetrics(e *metricsEmitter) {
+	if processCgroup != nil {
+		processCgroup.addMetrics(e)
+	}
+}
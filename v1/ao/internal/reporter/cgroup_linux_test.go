@@ -0,0 +1,85 @@
+// +build linux
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupV1(t *testing.T) {
+	cg := newCgroup("testdata/cgroup/v1/cgroup", "testdata/cgroup/v1/fs")
+	require.NotNil(t, cg)
+	assert.False(t, cg.v2)
+
+	quota, ok := cg.cpuQuota()
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, quota)
+
+	// the lifetime counters are not reported by the first cycle
+	assert.Equal(t, cgroupCounters{throttledPeriods: 120, throttledTimeNs: 3500000000, oomKills: 2}, cg.last)
+	m := emittedValues(cg.addMetrics)
+	assert.Equal(t, 1.5, m["CgroupCPUQuota"])
+	assert.Equal(t, int64(0), m["CgroupCPUThrottledPeriods"])
+	assert.Equal(t, int64(0), m["CgroupCPUThrottledTime"])
+	assert.Equal(t, int64(0), m["CgroupOOMKillCount"])
+	assert.Equal(t, int64(536870912), m["CgroupMemoryLimit"])
+	assert.Equal(t, int64(268435456), m["CgroupMemoryUsage"])
+	assert.Equal(t, int64(201326592), m["CgroupMemoryRSS"])
+
+	// the counters are reported as deltas
+	cg.last = cgroupCounters{throttledPeriods: 100, throttledTimeNs: 3000000000, oomKills: 1}
+	m = emittedValues(cg.addMetrics)
+	assert.Equal(t, int64(20), m["CgroupCPUThrottledPeriods"])
+	assert.Equal(t, int64(500000000), m["CgroupCPUThrottledTime"])
+	assert.Equal(t, int64(1), m["CgroupOOMKillCount"])
+	m = emittedValues(cg.addMetrics)
+	assert.Equal(t, int64(0), m["CgroupCPUThrottledPeriods"])
+	assert.Equal(t, int64(0), m["CgroupCPUThrottledTime"])
+	assert.Equal(t, int64(0), m["CgroupOOMKillCount"])
+	assert.Equal(t, int64(268435456), m["CgroupMemoryUsage"])
+}
+
+func TestCgroupV2(t *testing.T) {
+	cg := newCgroup("testdata/cgroup/v2/cgroup", "testdata/cgroup/v2/fs")
+	require.NotNil(t, cg)
+	assert.True(t, cg.v2)
+
+	quota, ok := cg.cpuQuota()
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, quota)
+
+	assert.Equal(t, cgroupCounters{throttledPeriods: 30, throttledTimeNs: 1500000000, oomKills: 1}, cg.last)
+	m := emittedValues(cg.addMetrics)
+	assert.Equal(t, 0.5, m["CgroupCPUQuota"])
+	assert.Equal(t, int64(0), m["CgroupCPUThrottledPeriods"])
+	assert.Equal(t, int64(0), m["CgroupCPUThrottledTime"])
+	assert.Equal(t, int64(0), m["CgroupOOMKillCount"])
+	assert.Equal(t, int64(104857600), m["CgroupMemoryUsage"])
+	assert.Equal(t, int64(73400320), m["CgroupMemoryRSS"])
+
+	// memory.max is "max"
+	_, ok = m["CgroupMemoryLimit"]
+	assert.False(t, ok)
+}
+
+func TestCgroupMemoryStatNotAvailable(t *testing.T) {
+	cg := newCgroup("testdata/cgroup/v2/cgroup", "testdata/cgroup/v2/fs")
+	require.NotNil(t, cg)
+	cg.hierarchies[""] = cgroupHierarchy{path: "/nonexistent"}
+	cg.root = "testdata/cgroup/nonexistent"
+	m := emittedValues(cg.addMetrics)
+	_, ok := m["CgroupMemoryRSS"]
+	assert.False(t, ok)
+	_, ok = m["CgroupMemoryUsage"]
+	assert.False(t, ok)
+}
+
+func TestCgroupNotAvailable(t *testing.T) {
+	assert.Nil(t, newCgroup("testdata/cgroup/nonexistent", "testdata/cgroup/v1/fs"))
+	assert.Nil(t, newCgroup("testdata/cgroup/v1/cgroup", "testdata/cgroup/nonexistent"))
+}
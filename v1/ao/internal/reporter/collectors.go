@@ -0,0 +1,295 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+	"github.com/pkg/errors"
+)
+
+// the maximum time a metrics collector is allowed to run in a metrics cycle.
+// The measurements of a collector are discarded if it doesn't return in time.
+const metricsCollectorTimeout = time.Second
+
+var (
+	errInvalidCollectorName = errors.New("invalid metrics collector name")
+	errNilCollector         = errors.New("nil metrics collector")
+	errCollectorExists      = errors.New("metrics collector already registered")
+)
+
+// MetricEmitter is used by a metrics collector to report measurements. It's
+// only valid during the call of the collector.
+type MetricEmitter interface {
+	// Emit reports a measurement with its name, value and optional tags. The
+	// value must be an int, int64, float32 or float64, otherwise the
+	// measurement is discarded.
+	Emit(name string, value interface{}, tags map[string]string)
+}
+
+// metricRecord is a single measurement reported by a collector
+type metricRecord struct {
+	name        string
+	value       interface{}
+	tags        map[string]string
+	measurement *Measurement // the count/sum measurement, if not nil
+	histogram   *histogram   // the histogram, if not nil
+}
+
+// metricsEmitter buffers the measurements reported by a collector. The
+// measurements are dropped once it's closed, e.g., the collector has timed out.
+type metricsEmitter struct {
+	records []metricRecord
+	closed  bool
+	lock    sync.Mutex
+}
+
+// Emit implements the MetricEmitter interface.
+func (e *metricsEmitter) Emit(name string, value interface{}, tags map[string]string) {
+	switch value.(type) {
+	case int, int64, float32, float64:
+	default:
+		log.Warningf("Discarded measurement %s of unsupported type %T", name, value)
+		return
+	}
+	var t map[string]string
+	if len(tags) > 0 {
+		t = make(map[string]string, len(tags))
+		for k, v := range tags {
+			t[k] = v
+		}
+	}
+	e.add(metricRecord{name: name, value: value, tags: t})
+}
+
+// addValue reports a measurement without tags.
+func (e *metricsEmitter) addValue(name string, value interface{}) {
+	e.add(metricRecord{name: name, value: value})
+}
+
+// addMeasurement reports a count/sum measurement.
+func (e *metricsEmitter) addMeasurement(m *Measurement) {
+	e.add(metricRecord{measurement: m})
+}
+
+// addHistogram reports a histogram.
+func (e *metricsEmitter) addHistogram(h *histogram) {
+	e.add(metricRecord{histogram: h})
+}
+
+func (e *metricsEmitter) add(r metricRecord) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !e.closed {
+		e.records = append(e.records, r)
+	}
+}
+
+// close closes the emitter and returns the measurements reported.
+func (e *metricsEmitter) close() []metricRecord {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.closed = true
+	return e.records
+}
+
+// metricsCollector is a source of measurements which is called in each
+// metrics cycle.
+type metricsCollector struct {
+	name    string
+	collect func(e *metricsEmitter)
+	timeout time.Duration
+	// whether the collector is still running, which is the case if it timed
+	// out in the last cycle and hasn't returned yet.
+	running int32
+}
+
+// newMetricsCollector creates a collector with the default timeout.
+func newMetricsCollector(name string, collect func(e *metricsEmitter)) *metricsCollector {
+	return &metricsCollector{
+		name:    name,
+		collect: collect,
+		timeout: metricsCollectorTimeout,
+	}
+}
+
+// newUntimedMetricsCollector creates a collector without the timeout, which
+// is for the built-in collectors resetting their sources, e.g., the rate
+// counts, as their measurements can't be discarded.
+func newUntimedMetricsCollector(name string, collect func(e *metricsEmitter)) *metricsCollector {
+	return &metricsCollector{
+		name:    name,
+		collect: collect,
+	}
+}
+
+// the collectors registered through RegisterMetricsCollector
+var metricsCollectors = struct {
+	collectors []*metricsCollector
+	lock       sync.RWMutex
+}{}
+
+// RegisterMetricsCollector registers a collector which is called in each
+// metrics cycle to report its measurements. The collector must return in
+// time (1 second), otherwise its measurements are discarded. A panic in the
+// collector is recovered and logged.
+func RegisterMetricsCollector(name string, collect func(emit MetricEmitter)) error {
+	if name == "" {
+		return errInvalidCollectorName
+	}
+	if collect == nil {
+		return errNilCollector
+	}
+
+	metricsCollectors.lock.Lock()
+	defer metricsCollectors.lock.Unlock()
+
+	for _, c := range metricsCollectors.collectors {
+		if c.name == name {
+			return errors.Wrap(errCollectorExists, name)
+		}
+	}
+	metricsCollectors.collectors = append(metricsCollectors.collectors,
+		newMetricsCollector(name, func(e *metricsEmitter) { collect(e) }))
+	return nil
+}
+
+// UnregisterMetricsCollector removes the collector by its name. It returns
+// false if the collector is not found.
+func UnregisterMetricsCollector(name string) bool {
+	metricsCollectors.lock.Lock()
+	defer metricsCollectors.lock.Unlock()
+
+	cs := metricsCollectors.collectors
+	for i, c := range cs {
+		if c.name == name {
+			metricsCollectors.collectors = append(cs[:i:i], cs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// registeredMetricsCollectors returns a copy of the registered collectors.
+func registeredMetricsCollectors() []*metricsCollector {
+	metricsCollectors.lock.RLock()
+	defer metricsCollectors.lock.RUnlock()
+
+	return append([]*metricsCollector(nil), metricsCollectors.collectors...)
+}
+
+// run calls the collector and waits for it to return or time out. It returns
+// the measurements reported, or nil if the collector timed out or panicked.
+// The collector without a timeout is waited for until it returns.
+func (c *metricsCollector) run() []metricRecord {
+	if c.timeout <= 0 {
+		return c.runUntimed()
+	}
+	if !atomic.CompareAndSwapInt32(&c.running, 0, 1) {
+		log.Warningf("Metrics collector %s is still running, skipped.", c.name)
+		return nil
+	}
+
+	e := &metricsEmitter{}
+	done := make(chan bool, 1)
+	go func() {
+		ok := false
+		defer func() {
+			if err := recover(); err != nil {
+				log.Errorf("Metrics collector %s panicked: %v", c.name, err)
+			}
+			atomic.StoreInt32(&c.running, 0)
+			done <- ok
+		}()
+		c.collect(e)
+		ok = true
+	}()
+
+	timeout := time.NewTimer(c.timeout)
+	defer timeout.Stop()
+
+	select {
+	case ok := <-done:
+		records := e.close()
+		if !ok {
+			return nil
+		}
+		return records
+	case <-timeout.C:
+		e.close()
+		log.Warningf("Metrics collector %s timed out after %v.", c.name, c.timeout)
+		return nil
+	}
+}
+
+// runUntimed calls the collector and returns the measurements reported, or nil
+// if the collector panicked.
+func (c *metricsCollector) runUntimed() (records []metricRecord) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("Metrics collector %s panicked: %v", c.name, err)
+			records = nil
+		}
+	}()
+	return collectMetrics(c.collect)
+}
+
+// collectMetrics calls the collector synchronously and returns the
+// measurements reported.
+func collectMetrics(collect func(e *metricsEmitter)) []metricRecord {
+	e := &metricsEmitter{}
+	collect(e)
+	return e.close()
+}
+
+// runMetricsCollectors runs the collectors concurrently and returns their
+// measurements in the same order as the collectors.
+func runMetricsCollectors(collectors []*metricsCollector) [][]metricRecord {
+	results := make([][]metricRecord, len(collectors))
+	var wg sync.WaitGroup
+	for i, c := range collectors {
+		wg.Add(1)
+		go func(i int, c *metricsCollector) {
+			defer wg.Done()
+			results[i] = c.run()
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// addMetricRecordToBSON adds a measurement reported by a collector to a BSON
+// buffer.
+// bbuf		the BSON buffer to append the metric to
+// index	a running integer (0,1,2,...) which is needed for BSON arrays
+// r		measurement to be added
+func addMetricRecordToBSON(bbuf *bsonBuffer, index *int, r metricRecord) {
+	if r.measurement != nil {
+		addMeasurementToBSON(bbuf, index, r.measurement)
+		return
+	}
+	if len(r.tags) == 0 {
+		addMetricsValue(bbuf, index, r.name, r.value)
+		return
+	}
+
+	start := bsonAppendStartObject(bbuf, strconv.Itoa(*index))
+	bsonAppendString(bbuf, "name", r.name)
+	switch v := r.value.(type) {
+	case int:
+		bsonAppendInt(bbuf, "value", v)
+	case int64:
+		bsonAppendInt64(bbuf, "value", v)
+	case float32:
+		bsonAppendFloat64(bbuf, "value", float64(v))
+	case float64:
+		bsonAppendFloat64(bbuf, "value", v)
+	}
+	appendTags(bbuf, r.tags)
+	bsonAppendFinishObject(bbuf, start)
+	*index += 1
+}
@@ -0,0 +1,216 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emittedValues returns the values reported by a collector as a map of name
+// to value
+func emittedValues(collect func(e *metricsEmitter)) map[string]interface{} {
+	e := &metricsEmitter{}
+	collect(e)
+
+	values := make(map[string]interface{})
+	for _, r := range e.close() {
+		values[r.name] = r.value
+	}
+	return values
+}
+
+// emittedHistograms returns the histograms reported by a collector as a map
+// of name to histogram
+func emittedHistograms(collect func(e *metricsEmitter)) map[string]*histogram {
+	hists := make(map[string]*histogram)
+	for _, r := range collectMetrics(collect) {
+		if r.histogram != nil {
+			hists[r.histogram.name] = r.histogram
+		}
+	}
+	return hists
+}
+
+func TestRegisterMetricsCollector(t *testing.T) {
+	assert.Equal(t, errInvalidCollectorName, RegisterMetricsCollector("", func(MetricEmitter) {}))
+	assert.Equal(t, errNilCollector, RegisterMetricsCollector("nil", nil))
+
+	require.NoError(t, RegisterMetricsCollector("pool", func(emit MetricEmitter) {
+		emit.Emit("PoolSize", 10, map[string]string{"pool": "db"})
+		emit.Emit("PoolWait", 1.5, nil)
+		emit.Emit("Invalid", "string", nil)
+	}))
+	assert.Error(t, RegisterMetricsCollector("pool", func(MetricEmitter) {}))
+	defer UnregisterMetricsCollector("pool")
+
+	m := bsonToMap(&bsonBuffer{buf: generateMetricsMessage(15, &eventQueueStats{})})
+	mts := m["measurements"].([]interface{})
+
+	values := make(map[string]map[string]interface{})
+	for _, mt := range mts {
+		values[mt.(map[string]interface{})["name"].(string)] = mt.(map[string]interface{})
+	}
+	require.Contains(t, values, "PoolSize")
+	assert.Equal(t, 10, values["PoolSize"]["value"])
+	assert.Equal(t, map[string]interface{}{"pool": "db"}, values["PoolSize"]["tags"])
+	assert.Equal(t, 1.5, values["PoolWait"]["value"])
+	assert.NotContains(t, values, "Invalid")
+	// the built-in ones are still there
+	assert.Contains(t, values, "RequestCount")
+
+	assert.True(t, UnregisterMetricsCollector("pool"))
+	assert.False(t, UnregisterMetricsCollector("pool"))
+	assert.Empty(t, registeredMetricsCollectors())
+}
+
+func TestMetricsCollectorIsolation(t *testing.T) {
+	block := make(chan struct{})
+	collectors := []*metricsCollector{
+		newMetricsCollector("panic", func(e *metricsEmitter) {
+			e.addValue("BeforePanic", 1)
+			panic("oops")
+		}),
+		{name: "slow", timeout: 10 * time.Millisecond, collect: func(e *metricsEmitter) {
+			e.addValue("Slow", 1)
+			<-block
+			e.addValue("TooLate", 1)
+		}},
+		newMetricsCollector("good", func(e *metricsEmitter) {
+			e.addValue("Good", 1)
+		}),
+	}
+
+	results := runMetricsCollectors(collectors)
+	require.Len(t, results, 3)
+	assert.Nil(t, results[0])
+	assert.Nil(t, results[1])
+	require.Len(t, results[2], 1)
+	assert.Equal(t, "Good", results[2][0].name)
+
+	// the slow collector is skipped while it's still running
+	assert.Nil(t, collectors[1].run())
+	close(block)
+	for i := 0; i < 100 && atomic.LoadInt32(&collectors[1].running) == 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	collectors[1].timeout = time.Second
+	assert.Len(t, collectors[1].run(), 2)
+}
+
+func TestAgentMetricsMessage(t *testing.T) {
+	require.NoError(t, RegisterMetricsCollector("pool", func(emit MetricEmitter) {
+		emit.Emit("PoolSize", 10, nil)
+	}))
+	defer UnregisterMetricsCollector("pool")
+
+	names := func(buf []byte) map[string]bool {
+		m := bsonToMap(&bsonBuffer{buf: buf})
+		names := make(map[string]bool)
+		for _, mt := range m["measurements"].([]interface{}) {
+			names[mt.(map[string]interface{})["name"].(string)] = true
+		}
+		return names
+	}
+
+	// the process-wide metrics are reported by the default agent only
+	n := names(generateAgentMetricsMessage(15, &eventQueueStats{}, newOboeSettingsCfg(),
+		newHTTPMetrics(), false))
+	assert.True(t, n["RequestCount"])
+	assert.True(t, n["NumSent"])
+	assert.False(t, n["JMX.type=threadcount,name=NumGoroutine"])
+	assert.False(t, n["PoolSize"])
+
+	n = names(generateMetricsMessage(15, &eventQueueStats{}))
+	assert.True(t, n["RequestCount"])
+	assert.True(t, n["JMX.type=threadcount,name=NumGoroutine"])
+	assert.True(t, n["PoolSize"])
+}
+
+func TestBuiltinCollectorIsolation(t *testing.T) {
+	// a panicking or hung built-in collector doesn't break the metrics message
+	saved := processMetricsCollectors
+	defer func() { processMetricsCollectors = saved }()
+	block := make(chan struct{})
+	defer close(block)
+	processMetricsCollectors = []*metricsCollector{
+		newMetricsCollector("host", func(e *metricsEmitter) {
+			e.addValue("Load1", 1.0)
+			panic("oops")
+		}),
+		{name: "process", timeout: 10 * time.Millisecond, collect: func(e *metricsEmitter) {
+			<-block
+		}},
+		saved[2],
+	}
+
+	m := bsonToMap(&bsonBuffer{buf: generateMetricsMessage(15, &eventQueueStats{})})
+	names := make(map[string]bool)
+	for _, mt := range m["measurements"].([]interface{}) {
+		names[mt.(map[string]interface{})["name"].(string)] = true
+	}
+	assert.True(t, names["RequestCount"])
+	assert.True(t, names["JMX.type=threadcount,name=NumGoroutine"])
+	assert.False(t, names["Load1"])
+
+	// the untimed collectors are isolated from the panics as well
+	c := newUntimedMetricsCollector("panic", func(e *metricsEmitter) {
+		e.addValue("BeforePanic", 1)
+		panic("oops")
+	})
+	assert.Nil(t, c.run())
+	c = newUntimedMetricsCollector("good", func(e *metricsEmitter) {
+		e.addValue("Good", 1)
+	})
+	assert.Len(t, c.run(), 1)
+}
+
+func TestBuiltinHistograms(t *testing.T) {
+	recordHistogram(globalHTTPMetrics.histograms, "", 1500*time.Microsecond)
+	recordHistogram(globalHTTPMetrics.histograms, "my-svc", 2500*time.Microsecond)
+
+	m := bsonToMap(&bsonBuffer{buf: generateMetricsMessage(15, &eventQueueStats{})})
+	names := make(map[string]bool)
+	for _, h := range m["histograms"].([]interface{}) {
+		names[h.(map[string]interface{})["name"].(string)] = true
+	}
+	assert.True(t, names["TransactionResponseTime"])
+	for _, mt := range m["measurements"].([]interface{}) {
+		assert.NotEmpty(t, mt.(map[string]interface{})["name"])
+	}
+
+	// the HTTP histograms are cleared in each cycle
+	assert.Empty(t, emittedHistograms(func(e *metricsEmitter) {
+		addHTTPHistograms(e, globalHTTPMetrics)
+	}))
+}
+
+func TestAddMetricRecordToBSON(t *testing.T) {
+	index := 0
+	bbuf := NewBsonBuffer()
+	addMetricRecordToBSON(bbuf, &index, metricRecord{name: "a", value: int64(1)})
+	addMetricRecordToBSON(bbuf, &index, metricRecord{name: "b", value: float32(2),
+		tags: map[string]string{"k": "v"}})
+	addMetricRecordToBSON(bbuf, &index, metricRecord{measurement: &Measurement{
+		Name: "c", Count: 3, Sum: 4, ReportSum: true}})
+	bsonBufferFinish(bbuf)
+	m := bsonToMap(bbuf)
+
+	require.Equal(t, 3, index)
+	elems := make(map[string]map[string]interface{})
+	for i := 0; i < index; i++ {
+		e := m[strconv.Itoa(i)].(map[string]interface{})
+		elems[e["name"].(string)] = e
+	}
+	assert.Equal(t, int64(1), elems["a"]["value"])
+	assert.Nil(t, elems["a"]["tags"])
+	assert.Equal(t, float64(2), elems["b"]["value"])
+	assert.Equal(t, map[string]interface{}{"k": "v"}, elems["b"]["tags"])
+	assert.Equal(t, 3, elems["c"]["count"])
+	assert.Equal(t, float64(4), elems["c"]["sum"])
+}
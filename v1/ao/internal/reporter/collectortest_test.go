@@ -0,0 +1,77 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/collectortest"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestGRPCReporterWithMockCollector(t *testing.T) {
+	server, err := collectortest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	for k, v := range server.Env() {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+	config.Refresh()
+	defer config.Refresh()
+
+	r, ok := newGRPCReporter().(*grpcReporter)
+	require.True(t, ok)
+	defer r.ShutdownNow()
+	assert.True(t, r.eventMessages.stats == r.eventConnection.queueStats)
+	assert.False(t, r.statusMessages.stats == r.eventConnection.queueStats)
+
+	r.getSettings(make(chan bool, 1))
+	ctxTm, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.True(t, r.WaitForReady(ctxTm))
+
+	// the event is delivered after being redirected and asked to try later
+	server.InjectFault(collectortest.PostEvents, collectortest.Fault{
+		Result: collectortest.Redirect, Times: 1})
+	ctx := newTestContext(t)
+	ev, err := ctx.newEvent(LabelInfo, "layer1")
+	require.NoError(t, err)
+	require.NoError(t, r.reportEvent(ctx, ev))
+
+	events := server.WaitForEvents(1, 5*time.Second)
+	require.Len(t, events, 1)
+	assert.Equal(t, "layer1", events[0]["Layer"])
+	assert.Equal(t, LabelInfo, events[0]["Label"])
+
+	server.InjectFault(collectortest.PostEvents, collectortest.Fault{
+		Result: collectortest.TryLater, Times: 1})
+	ev, err = ctx.newEvent(LabelInfo, "layer2")
+	require.NoError(t, err)
+	require.NoError(t, r.reportEvent(ctx, ev))
+
+	events = server.WaitForEvents(2, 5*time.Second)
+	require.Len(t, events, 2)
+	assert.Equal(t, "layer2", events[1]["Layer"])
+
+	var results []collectortest.ResultCode
+	for _, req := range server.Requests() {
+		if req.Method == collectortest.PostEvents {
+			results = append(results, req.Result)
+			assert.Equal(t, serviceKey, req.APIKey)
+		}
+	}
+	assert.Equal(t, []collectortest.ResultCode{collectortest.Redirect, collectortest.OK,
+		collectortest.TryLater, collectortest.OK}, results)
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // register the gzip compressor
+	"google.golang.org/grpc/stats"
+)
+
+const (
+	// no compression is applied to the gRPC messages
+	compressionNone = "none"
+	// the length of the gRPC message header (compressed flag and length)
+	grpcMsgHeaderLen = 5
+)
+
+func init() {
+	encoding.RegisterCompressor(&snappyCompressor{})
+}
+
+// snappyCompressor implements the gRPC compressor with the snappy framing
+// format.
+type snappyCompressor struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// Name returns the name of the compressor, which is sent in the grpc-encoding
+// header.
+func (c *snappyCompressor) Name() string {
+	return "snappy"
+}
+
+// Compress returns a writer which compresses the data to w.
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	sw, ok := c.writers.Get().(*snappyWriter)
+	if !ok {
+		sw = &snappyWriter{Writer: snappy.NewBufferedWriter(w), pool: &c.writers}
+	} else {
+		sw.Reset(w)
+	}
+	return sw, nil
+}
+
+// Decompress returns a reader which decompresses the data from r.
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	sr, ok := c.readers.Get().(*snappyReader)
+	if !ok {
+		sr = &snappyReader{Reader: snappy.NewReader(r), pool: &c.readers}
+	} else {
+		sr.Reset(r)
+	}
+	return sr, nil
+}
+
+// snappyWriter puts itself back to the pool once it's closed.
+type snappyWriter struct {
+	*snappy.Writer
+	pool *sync.Pool
+}
+
+func (w *snappyWriter) Close() error {
+	defer w.pool.Put(w)
+	return w.Writer.Close()
+}
+
+// snappyReader puts itself back to the pool after reading all the data.
+type snappyReader struct {
+	*snappy.Reader
+	pool *sync.Pool
+}
+
+func (r *snappyReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r)
+	}
+	return n, err
+}
+
+// compressionStats is a gRPC stats handler which counts the outgoing bytes
+// before and after compression.
+type compressionStats struct {
+	queueStats *eventQueueStats
+}
+
+func (s *compressionStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *compressionStats) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	p, ok := rs.(*stats.OutPayload)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&s.queueStats.bytesUncompressed, int64(p.Length))
+	atomic.AddInt64(&s.queueStats.bytesCompressed, int64(p.WireLength-grpcMsgHeaderLen))
+}
+
+func (s *compressionStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *compressionStats) HandleConn(context.Context, stats.ConnStats) {}
@@ -45,6 +45,8 @@ type oboeMetadata struct {
 type oboeContext struct {
 	metadata oboeMetadata
 	txCtx    *transactionContext
+	// the agent which samples and reports the trace, nil for the default one
+	agent *Agent
 }
 
 type transactionContext struct {
@@ -317,28 +319,108 @@ func newContextFromMetadataString(mdstr string) (*oboeContext, error) {
 // NewContext starts a trace, possibly continuing one, if mdStr is provided. Setting reportEntry will
 // report an entry event before this function returns, calling cb if provided for additional KV pairs.
 func NewContext(layer, mdStr string, reportEntry bool, cb func() map[string]interface{}) (ctx Context, ok bool) {
+	return defaultAgent.NewContext(layer, mdStr, reportEntry, cb)
+}
+
+// SamplingOverride overrides the sampling decision made by the settings.
+type SamplingOverride int
+
+// The sampling overrides
+const (
+	// The request is sampled according to the settings
+	SampleBySettings SamplingOverride = iota
+	// The request is neither sampled nor counted, e.g., a health check
+	SampleNever
+	// The request is sampled regardless of the sample rate and the token
+	// bucket, unless the tracing mode is never.
+	SampleAlways
+)
+
+// LocalSampleRate is the sample rate of the local sampling rule matching a
+// request, which is merged with the remote settings.
+type LocalSampleRate struct {
+	// The sample rate between 0 and 1000000
+	Rate int
+	// Whether the rate is applied even if it's higher than the remote one,
+	// unless the remote settings have the OVERRIDE flag.
+	Override bool
+}
+
+// NewContext starts a trace sampled and reported by the agent, see the
+// package-level NewContext.
+func (a *Agent) NewContext(layer, mdStr string, reportEntry bool,
+	cb func() map[string]interface{}) (ctx Context, ok bool) {
+	return a.NewContextWithOverride(layer, mdStr, reportEntry, SampleBySettings, nil, cb)
+}
+
+// NewContextWithOverride starts a trace reported by the agent, the sampling
+// decision is overridden by the override, and the sample rate of the settings
+// is merged with the local one if it's not nil.
+func (a *Agent) NewContextWithOverride(layer, mdStr string, reportEntry bool,
+	override SamplingOverride, local *LocalSampleRate, cb func() map[string]interface{}) (ctx Context, ok bool) {
+	return a.startContext(layer, mdStr, reportEntry, func(traced bool) (bool, int, sampleSource) {
+		return a.shouldTraceRequest(layer, traced, override, local)
+	}, cb)
+}
+
+// NewTriggeredContext starts a new trace requested by a trigger trace, which is
+// sampled regardless of the sample rate, subject to the trigger trace token
+// bucket of the signed or unsigned requests. It returns the decision as well,
+// e.g., TriggerTraceOK, and the entry event reports the KV "TriggeredTrace".
+func (a *Agent) NewTriggeredContext(layer string, signed, reportEntry bool,
+	cb func() map[string]interface{}) (ctx Context, ok bool, decision string) {
+	ctx, ok = a.startContext(layer, "", reportEntry, func(traced bool) (bool, int, sampleSource) {
+		var sampled bool
+		var rate int
+		var source sampleSource
+		sampled, rate, source, decision = a.getSettingsCfg().triggerSample(signed)
+		return sampled, rate, source
+	}, func() map[string]interface{} {
+		var kvs map[string]interface{}
+		if cb != nil {
+			kvs = cb()
+		}
+		if kvs == nil {
+			kvs = make(map[string]interface{})
+		}
+		kvs["TriggeredTrace"] = true
+		return kvs
+	})
+	return ctx, ok, decision
+}
+
+// startContext starts a trace reported by the agent, possibly continuing the one
+// of mdStr, the sampling decision is made by sample.
+func (a *Agent) startContext(layer, mdStr string, reportEntry bool, sample func(traced bool) (bool, int, sampleSource),
+	cb func() map[string]interface{}) (ctx Context, ok bool) {
 	traced := false
 	addCtxEdge := false
 
 	if mdStr != "" {
 		var err error
-		if ctx, err = newContextFromMetadataString(mdStr); err != nil {
+		var octx *oboeContext
+		if octx, err = newContextFromMetadataString(mdStr); err != nil {
 			log.Debug("passed in x-trace seems invalid, ignoring")
-		} else if ctx.GetVersion() != xtrCurrentVersion {
+		} else if octx.GetVersion() != xtrCurrentVersion {
 			log.Debug("passed in x-trace has wrong version, ignoring")
-		} else if ctx.IsSampled() {
+		} else if octx.IsSampled() {
 			traced = true
 			addCtxEdge = true
 		} else {
-			return ctx, true
+			octx.agent = a
+			return octx, true
 		}
+		ctx = octx
 	}
 
 	if !traced {
 		ctx = newContext(true)
 	}
+	if octx, isOboe := ctx.(*oboeContext); isOboe {
+		octx.agent = a
+	}
 
-	if ok, rate, source := shouldTraceRequest(layer, traced); ok {
+	if ok, rate, source := sample(traced); ok {
 		if reportEntry {
 			var kvs map[string]interface{}
 			if cb != nil {
@@ -347,8 +429,11 @@ func NewContext(layer, mdStr string, reportEntry bool, cb func() map[string]inte
 			if len(kvs) == 0 {
 				kvs = make(map[string]interface{})
 			}
-			kvs["SampleRate"] = rate
-			kvs["SampleSource"] = source
+			// the sample rate and source are not applicable to a trigger trace
+			if source != SAMPLE_SOURCE_UNSET {
+				kvs["SampleRate"] = rate
+				kvs["SampleSource"] = source
+			}
 			if _, ok = ctx.(*oboeContext); !ok {
 				return &nullContext{}, false
 			}
@@ -363,13 +448,21 @@ func NewContext(layer, mdStr string, reportEntry bool, cb func() map[string]inte
 	return ctx, true
 }
 
+// getReporter returns the reporter of the agent of the context.
+func (ctx *oboeContext) getReporter() reporter {
+	if ctx == nil {
+		return getGlobalReporter()
+	}
+	return ctx.agent.getReporter()
+}
+
 func (ctx *oboeContext) Copy() Context {
 	md := oboeMetadata{}
 	md.Init()
 	copy(md.ids.taskID, ctx.metadata.ids.taskID)
 	copy(md.ids.opID, ctx.metadata.ids.opID)
 	md.flags = ctx.metadata.flags
-	return &oboeContext{metadata: md, txCtx: ctx.txCtx}
+	return &oboeContext{metadata: md, txCtx: ctx.txCtx, agent: ctx.agent}
 }
 func (ctx *oboeContext) IsSampled() bool { return ctx.metadata.isSampled() }
 
@@ -273,6 +273,101 @@ func TestNewContextTracingDisabled(t *testing.T) {
 	r.Close(0)
 }
 
+func TestNewContextWithOverride(t *testing.T) {
+	// no settings, nothing is sampled by default
+	r := SetTestReporter(TestReporterDisableDefaultSetting(true))
+
+	var a *Agent
+	ctx, ok := a.NewContextWithOverride("testAlways", "", true, SampleAlways, nil, nil)
+	assert.True(t, ok)
+	assert.True(t, ctx.IsSampled())
+	ctx, ok = a.NewContextWithOverride("testBySettings", "", true, SampleBySettings, nil, nil)
+	assert.True(t, ok)
+	assert.False(t, ctx.IsSampled())
+	r.Close(1)
+	g.AssertGraph(t, r.EventBufs, 1, g.AssertNodeMap{
+		{"testAlways", "entry"}: {Callback: func(n g.Node) {
+			assert.EqualValues(t, maxSamplingRate, n.Map["SampleRate"])
+			assert.EqualValues(t, SAMPLE_SOURCE_LOCAL, n.Map["SampleSource"])
+		}},
+	})
+
+	r = SetTestReporter()
+	ctx, ok = a.NewContextWithOverride("testNever", "", true, SampleNever, nil, nil)
+	assert.True(t, ok)
+	assert.False(t, ctx.IsSampled())
+
+	// the tracing mode never takes precedence
+	oldMode := globalSettingsCfg.tracingMode
+	globalSettingsCfg.tracingMode = TRACE_NEVER
+	defer func() { globalSettingsCfg.tracingMode = oldMode }()
+	ctx, ok = a.NewContextWithOverride("testAlways", "", true, SampleAlways, nil, nil)
+	assert.True(t, ok)
+	assert.False(t, ctx.IsSampled())
+	r.Close(0)
+}
+
+func TestNewTriggeredContext(t *testing.T) {
+	var a *Agent
+	r := SetTestReporter(TestReporterDisableDefaultSetting(true))
+	ctx, ok, decision := a.NewTriggeredContext("test", false, true, nil)
+	assert.True(t, ok)
+	assert.False(t, ctx.IsSampled())
+	assert.Equal(t, TriggerTraceSettingsNotAvailable, decision)
+
+	// the trigger traces are not enabled by the settings
+	updateSetting(int32(TYPE_DEFAULT), "", []byte("SAMPLE_START,SAMPLE_THROUGH_ALWAYS"),
+		1000000, 120, argsToMap(1000000, 1000000, -1, -1))
+	ctx, _, decision = a.NewTriggeredContext("test", false, true, nil)
+	assert.False(t, ctx.IsSampled())
+	assert.Equal(t, TriggerTraceDisabled, decision)
+
+	// one token for the unsigned requests, none for the signed ones
+	args := argsToMap(1000000, 1000000, -1, -1)
+	args[kvTriggerStrictBucketCapacity] = args[kvBucketCapacity]
+	updateSetting(int32(TYPE_DEFAULT), "", []byte("SAMPLE_START,SAMPLE_THROUGH_ALWAYS,TRIGGER_TRACE"),
+		0, 120, args)
+	globalSettingsCfg.triggerStrict.setRateCap(0, 1)
+	globalSettingsCfg.triggerStrict.available = 1
+	flushRateCounts()
+	ctx, _, decision = a.NewTriggeredContext("test", true, true, nil)
+	assert.False(t, ctx.IsSampled())
+	assert.Equal(t, TriggerTraceRateExceeded, decision)
+	ctx, _, decision = a.NewTriggeredContext("test", false, true, func() map[string]interface{} {
+		return map[string]interface{}{"custom-key": "value"}
+	})
+	assert.True(t, ctx.IsSampled())
+	assert.Equal(t, TriggerTraceOK, decision)
+	ctx, _, decision = a.NewTriggeredContext("test", false, true, nil)
+	assert.False(t, ctx.IsSampled())
+	assert.Equal(t, TriggerTraceRateExceeded, decision)
+	rc := flushRateCounts()
+	assert.EqualValues(t, 3, rc.requested)
+	assert.EqualValues(t, 2, rc.limited)
+	assert.EqualValues(t, 1, rc.traced)
+	assert.EqualValues(t, 1, rc.triggered)
+
+	r.Close(1)
+	g.AssertGraph(t, r.EventBufs, 1, g.AssertNodeMap{
+		{"test", "entry"}: {Callback: func(n g.Node) {
+			assert.Equal(t, true, n.Map["TriggeredTrace"])
+			assert.Equal(t, "value", n.Map["custom-key"])
+			assert.NotContains(t, n.Map, "SampleRate")
+			assert.NotContains(t, n.Map, "SampleSource")
+		}},
+	})
+
+	// the tracing mode never takes precedence
+	r = SetTestReporter()
+	oldMode := globalSettingsCfg.tracingMode
+	globalSettingsCfg.tracingMode = TRACE_NEVER
+	defer func() { globalSettingsCfg.tracingMode = oldMode }()
+	ctx, _, decision = a.NewTriggeredContext("test", true, true, nil)
+	assert.False(t, ctx.IsSampled())
+	assert.Equal(t, TriggerTraceTracingDisabled, decision)
+	r.Close(0)
+}
+
 // TestNullContext asserts properties of nullContext structs.
 func TestNullContext(t *testing.T) {
 	r := SetTestReporter()
@@ -0,0 +1,232 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Diagnostics is a snapshot of the internal state of the agent. The counters
+// are accumulated since the last metrics flush.
+type Diagnostics struct {
+	// The name of the agent, see ao.NewAgent
+	Agent string
+	// The time when the snapshot is taken
+	Timestamp time.Time
+	// The reporter in use: ssl, udp, test or none
+	Reporter string
+	// Whether the reporter is closed
+	Closed bool
+	// Whether there is a valid default sampling setting
+	Ready bool
+	// The tracing mode: always or never
+	TracingMode string
+
+	Queue       QueueDiagnostics
+	RateCounts  RateCountsDiagnostics
+	Connections []ConnectionDiagnostics
+	Settings    []SettingDiagnostics
+}
+
+// QueueDiagnostics contains the stats of the event queue.
+type QueueDiagnostics struct {
+	// The number of events in the queue and its capacity
+	Length   int
+	Capacity int
+	// The size in bytes of the events spooled on disk
+	SpoolSize int64
+
+	NumSent          int64
+	NumOverflowed    int64
+	NumFailed        int64
+	TotalEvents      int64
+	QueueLargest     int64
+	NumDroppedOldest int64
+	NumBlocked       int64
+	NumBlockTimeout  int64
+}
+
+// RateCountsDiagnostics contains the counters of the sampling decisions.
+type RateCountsDiagnostics struct {
+	Requested int64
+	Sampled   int64
+	Limited   int64
+	Traced    int64
+	Through   int64
+	Triggered int64
+}
+
+// ConnectionDiagnostics contains the state of a connection to the collector.
+type ConnectionDiagnostics struct {
+	Name    string
+	Address string
+	Active  bool
+	// The last error of the RPC calls, empty if there is no error.
+	LastError     string `json:",omitempty"`
+	LastErrorTime time.Time
+	// The time of the last successful RPC call.
+	LastSuccessTime time.Time
+}
+
+// SettingDiagnostics contains a sampling setting got from the collector.
+type SettingDiagnostics struct {
+	Type      string
+	Layer     string `json:",omitempty"`
+	Flags     string
+	Value     int
+	TTL       int64
+	Timestamp time.Time
+	// The token bucket of the setting
+	BucketRate      float64
+	BucketCapacity  float64
+	BucketAvailable float64
+}
+
+// GetDiagnostics returns a snapshot of the internal state of the default agent.
+func GetDiagnostics() Diagnostics {
+	return defaultAgent.Diagnostics()
+}
+
+// Diagnostics returns a snapshot of the internal state of the agent, i.e., its
+// reporter, sampling settings and counters.
+func (a *Agent) Diagnostics() Diagnostics {
+	sc := a.getSettingsCfg()
+	d := Diagnostics{
+		Timestamp:   time.Now(),
+		Closed:      a.getReporter().Closed(),
+		Ready:       sc.hasDefaultSetting(),
+		TracingMode: "always",
+		RateCounts:  sc.getRateCounts(),
+		Settings:    sc.getSettingsDiagnostics(),
+	}
+	if sc.getTracingMode() == TRACE_NEVER {
+		d.TracingMode = "never"
+	}
+
+	switch r := a.getReporter().(type) {
+	case *grpcReporter:
+		d.Reporter = "ssl"
+		r.diagnostics(&d)
+	case *udpReporter:
+		d.Reporter = "udp"
+	case *TestReporter:
+		d.Reporter = "test"
+	default:
+		d.Reporter = "none"
+	}
+	return d
+}
+
+// diagnostics fills in the state of the connections and the queue.
+func (r *grpcReporter) diagnostics(d *Diagnostics) {
+	d.Ready = r.isReady()
+	d.Connections = []ConnectionDiagnostics{
+		r.eventConnection.diagnostics(),
+		r.metricConnection.diagnostics(),
+	}
+
+	s := r.eventConnection.queueStats
+	d.Queue = QueueDiagnostics{
+		Length:           len(r.eventMessages.c),
+		Capacity:         cap(r.eventMessages.c),
+		SpoolSize:        r.spool.size(),
+		NumSent:          atomic.LoadInt64(&s.numSent),
+		NumOverflowed:    atomic.LoadInt64(&s.numOverflowed),
+		NumFailed:        atomic.LoadInt64(&s.numFailed),
+		TotalEvents:      atomic.LoadInt64(&s.totalEvents),
+		QueueLargest:     atomic.LoadInt64(&s.queueLargest),
+		NumDroppedOldest: atomic.LoadInt64(&s.numDroppedOldest),
+		NumBlocked:       atomic.LoadInt64(&s.numBlocked),
+		NumBlockTimeout:  atomic.LoadInt64(&s.numBlockTimeout),
+	}
+}
+
+// diagnostics returns the state of the connection.
+func (c *grpcConnection) diagnostics() ConnectionDiagnostics {
+	c.lock.RLock()
+	d := ConnectionDiagnostics{
+		Name:    c.name,
+		Address: c.address,
+		Active:  c.isActive(),
+	}
+	c.lock.RUnlock()
+
+	c.rpcStatusLock.Lock()
+	defer c.rpcStatusLock.Unlock()
+	if c.lastErr != nil {
+		d.LastError = c.lastErr.Error()
+		d.LastErrorTime = c.lastErrTime
+	}
+	d.LastSuccessTime = c.lastSuccess
+	return d
+}
+
+// getRateCounts reads the sampling counters without resetting them.
+func (sc *oboeSettingsCfg) getRateCounts() RateCountsDiagnostics {
+	return RateCountsDiagnostics{
+		Requested: atomic.LoadInt64(&sc.requested),
+		Sampled:   atomic.LoadInt64(&sc.sampled),
+		Limited:   atomic.LoadInt64(&sc.limited),
+		Traced:    atomic.LoadInt64(&sc.traced),
+		Through:   atomic.LoadInt64(&sc.through),
+		Triggered: atomic.LoadInt64(&sc.triggered),
+	}
+}
+
+// getSettingsDiagnostics returns the current sampling settings sorted by
+// type and layer.
+func (sc *oboeSettingsCfg) getSettingsDiagnostics() []SettingDiagnostics {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	var settings []SettingDiagnostics
+	for _, s := range sc.settings {
+		d := SettingDiagnostics{
+			Type:      "default",
+			Layer:     s.layer,
+			Flags:     flagBinToString(s.flags),
+			Value:     s.value,
+			TTL:       s.ttl,
+			Timestamp: s.timestamp,
+		}
+		if s.sType == TYPE_LAYER {
+			d.Type = "layer"
+		}
+		s.bucket.lock.Lock()
+		d.BucketRate = s.bucket.ratePerSec
+		d.BucketCapacity = s.bucket.capacity
+		d.BucketAvailable = s.bucket.available
+		s.bucket.lock.Unlock()
+		settings = append(settings, d)
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		if settings[i].Type != settings[j].Type {
+			return settings[i].Type < settings[j].Type
+		}
+		return settings[i].Layer < settings[j].Layer
+	})
+	return settings
+}
+
+// flagBinToString is the reverse of flagStringToBin.
+func flagBinToString(flags settingFlag) string {
+	var s []string
+	for _, f := range []struct {
+		flag settingFlag
+		name string
+	}{
+		{FLAG_OVERRIDE, "OVERRIDE"},
+		{FLAG_SAMPLE_START, "SAMPLE_START"},
+		{FLAG_SAMPLE_THROUGH, "SAMPLE_THROUGH"},
+		{FLAG_SAMPLE_THROUGH_ALWAYS, "SAMPLE_THROUGH_ALWAYS"},
+		{FLAG_TRIGGER_TRACE, "TRIGGER_TRACE"},
+	} {
+		if flags&f.flag != 0 {
+			s = append(s, f.name)
+		}
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter/collector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGRPCReporterDiagnostics(t *testing.T) {
+	fc := &fakeCollector{result: collector.ResultCode_TRY_LATER}
+	c := &grpcConnection{
+		name:        "events channel",
+		address:     "test-addr",
+		certificate: []byte(grpcCertDefault),
+		queueStats:  &eventQueueStats{},
+		backoff: func(retries int, wait func(d time.Duration)) error {
+			return errGiveUpAfterRetries
+		},
+		Dialer:  &NoopDialer{},
+		flushed: make(chan struct{}),
+	}
+	require.NoError(t, c.connect())
+	c.client = fc
+
+	r := &grpcReporter{
+		eventConnection:  c,
+		metricConnection: c,
+		eventMessages:    newMessageQueue(10, overflowDropNewest, 0, c.queueStats),
+		done:             make(chan struct{}),
+	}
+	r.eventMessages.push([]byte("a"), nil)
+
+	assert.Equal(t, errGiveUpAfterRetries, c.InvokeRPC(r.done, newPostEventsMethod("key", batchOf("a"))))
+	fc.setResult(collector.ResultCode_OK)
+	assert.NoError(t, c.InvokeRPC(r.done, newPostEventsMethod("key", batchOf("b"))))
+
+	var d Diagnostics
+	r.diagnostics(&d)
+	assert.Equal(t, 1, d.Queue.Length)
+	assert.Equal(t, 10, d.Queue.Capacity)
+	assert.Equal(t, int64(1), d.Queue.NumSent)
+	assert.Equal(t, int64(1), d.Queue.NumFailed)
+	require.Len(t, d.Connections, 2)
+	conn := d.Connections[0]
+	assert.Equal(t, "events channel", conn.Name)
+	assert.Equal(t, "test-addr", conn.Address)
+	assert.True(t, conn.Active)
+	assert.Equal(t, "PostEvents: TRY_LATER", conn.LastError)
+	assert.False(t, conn.LastErrorTime.IsZero())
+	assert.True(t, conn.LastSuccessTime.After(conn.LastErrorTime))
+
+	// the counters are not reset
+	r.diagnostics(&d)
+	assert.Equal(t, int64(1), d.Queue.NumSent)
+}
+
+func TestGetDiagnostics(t *testing.T) {
+	r := SetTestReporter()
+	defer r.Close(0)
+	flushRateCounts()
+	globalTokenBucket.count(true, false, true)
+
+	d := GetDiagnostics()
+	assert.Equal(t, "test", d.Reporter)
+	assert.False(t, d.Closed)
+	assert.True(t, d.Ready)
+	assert.Equal(t, "always", d.TracingMode)
+	assert.Equal(t, RateCountsDiagnostics{Requested: 1, Sampled: 1, Traced: 1}, d.RateCounts)
+	require.Len(t, d.Settings, 1)
+	assert.Equal(t, "default", d.Settings[0].Type)
+	assert.Equal(t, "SAMPLE_START,SAMPLE_THROUGH_ALWAYS,TRIGGER_TRACE", d.Settings[0].Flags)
+	assert.Equal(t, 1000000, d.Settings[0].Value)
+	assert.Empty(t, d.Connections)
+}
+
+func TestFlagBinToString(t *testing.T) {
+	for _, s := range []string{"", "OVERRIDE", "SAMPLE_START,SAMPLE_THROUGH", "OVERRIDE,SAMPLE_START,SAMPLE_THROUGH,SAMPLE_THROUGH_ALWAYS", "SAMPLE_START,TRIGGER_TRACE"} {
+		assert.Equal(t, s, flagBinToString(flagStringToBin(s)))
+	}
+}
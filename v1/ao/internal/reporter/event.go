@@ -62,14 +62,19 @@ const (
 	FLAG_SAMPLE_START          settingFlag = 0x4
 	FLAG_SAMPLE_THROUGH        settingFlag = 0x8
 	FLAG_SAMPLE_THROUGH_ALWAYS settingFlag = 0x10
+	FLAG_TRIGGER_TRACE         settingFlag = 0x20
 )
 
 // source of the sample value
 const (
+	SAMPLE_SOURCE_UNSET   sampleSource = -1
 	SAMPLE_SOURCE_NONE    sampleSource = 0
 	SAMPLE_SOURCE_FILE    sampleSource = 1
 	SAMPLE_SOURCE_DEFAULT sampleSource = 2
 	SAMPLE_SOURCE_LAYER   sampleSource = 3
+	// the sample rate of a local sampling rule, or forced by the local
+	// configuration, is applied
+	SAMPLE_SOURCE_LOCAL sampleSource = 4
 )
 
 const (
@@ -280,8 +285,8 @@ func (e *event) ReportUsing(c *oboeContext, r reporter, channel reporterChannel)
 }
 
 // Reports event using default Reporter
-func (e *event) Report(c *oboeContext) error       { return e.ReportUsing(c, globalReporter, EVENTS) }
-func (e *event) ReportStatus(c *oboeContext) error { return e.ReportUsing(c, globalReporter, METRICS) }
+func (e *event) Report(c *oboeContext) error       { return e.ReportUsing(c, c.getReporter(), EVENTS) }
+func (e *event) ReportStatus(c *oboeContext) error { return e.ReportUsing(c, c.getReporter(), METRICS) }
 
 // Report event using Context interface
 func (e *event) ReportContext(c Context, addCtxEdge bool, args ...interface{}) error {
@@ -3,9 +3,6 @@
 package reporter
 
 import (
-	"os"
-	"runtime"
-	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/hdrhist"
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/host"
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
@@ -22,6 +20,7 @@ import (
 // Linux distributions and their identifying files
 const (
 	metricsTransactionsMaxDefault = 200 // default max amount of transaction names we allow per cycle
+	metricsClientIPsMax           = 100 // max amount of client IP tag values we allow per cycle
 	metricsHistPrecisionDefault   = 2   // default histogram precision
 
 	metricsTagNameLengthMax  = 64  // max number of characters for tag names
@@ -35,10 +34,13 @@ const (
 	maxPathLenForTransactionName = 3
 )
 
+// the client IP tag value of the client IPs beyond the limit
+const otherClientIP = "other"
+
 // SpanMessage defines a span message
 type SpanMessage interface {
 	// called for message processing
-	process()
+	process(hm *httpMetrics)
 }
 
 // BaseSpanMessage is the base span message with properties found in all types of span messages
@@ -55,6 +57,11 @@ type HTTPSpanMessage struct {
 	Status      int    // HTTP status code (e.g. 200, 500, ...)
 	Host        string // HTTP-Host
 	Method      string // HTTP method (e.g. GET, POST, ...)
+
+	ResponseBytes   int64         // the number of bytes of the response body
+	TimeToFirstByte time.Duration // the time until the response header is written
+	Hijacked        bool          // the connection is hijacked, e.g., by a websocket
+	ClientIP        string        // the client IP, which is a metrics tag if set
 }
 
 // Measurement is a single measurement for reporting
@@ -74,6 +81,7 @@ type measurements struct {
 
 // a single histogram
 type histogram struct {
+	name string            // the name of the histogram, TransactionResponseTime if empty
 	hist *hdrhist.Hist     // internal representation of a histogram (see hdrhist package)
 	tags map[string]string // map of KVs
 }
@@ -93,10 +101,17 @@ type eventQueueStats struct {
 	numFailed     int64 // number of messages that failed to send
 	totalEvents   int64 // number of messages queued to send
 	queueLargest  int64 // maximum number of messages that were in the queue at one time
+
+	numDroppedOldest int64 // number of the oldest messages dropped to make room for new ones
+	numBlocked       int64 // number of times blocked waiting for a full queue
+	numBlockTimeout  int64 // number of messages dropped after blocking for a full queue
+
+	bytesUncompressed int64 // number of bytes sent before compression
+	bytesCompressed   int64 // number of bytes sent after compression
 }
 
 // rate counts reported by trace sampler
-type rateCounts struct{ requested, sampled, limited, traced, through int64 }
+type rateCounts struct{ requested, sampled, limited, traced, through, triggered int64 }
 
 // TransMap records the received transaction names in a metrics report cycle. It will refuse
 // new transaction names if reaching the capacity.
@@ -200,23 +215,76 @@ var metricsHTTPHistograms = &histograms{
 	precision:  metricsHistPrecisionDefault,
 }
 
-// TODO: use config package, and add validator (0-5)
-// initialize values according to env variables
+// httpMetrics holds the HTTP measurements and histograms aggregated from the
+// span messages, and the transaction names and the client IPs seen in a
+// metrics report cycle.
+type httpMetrics struct {
+	measurements *measurements
+	histograms   *histograms
+	transMap     *TransMap
+	clientIPs    *TransMap
+}
+
+// the HTTP metrics of the default agent
+var globalHTTPMetrics = &httpMetrics{
+	measurements: metricsHTTPMeasurements,
+	histograms:   metricsHTTPHistograms,
+	transMap:     mTransMap,
+	clientIPs:    NewTransMap(metricsClientIPsMax),
+}
+
+// newHTTPMetrics creates an empty set of HTTP metrics.
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{
+		measurements: &measurements{
+			measurements: make(map[string]*Measurement),
+		},
+		histograms: &histograms{
+			histograms: make(map[string]*histogram),
+			precision:  configuredPrecision(),
+		},
+		transMap:  NewTransMap(metricsTransactionsMaxDefault),
+		clientIPs: NewTransMap(metricsClientIPsMax),
+	}
+}
+
+// initialize values according to the configuration
 func init() {
-	pEnv := "APPOPTICS_HISTOGRAM_PRECISION"
-	precision := os.Getenv(pEnv)
-	if precision != "" {
-		log.Infof("Non-default APPOPTICS_HISTOGRAM_PRECISION: %s", precision)
-		if p, err := strconv.Atoi(precision); err == nil {
-			if p >= 0 && p <= 5 {
-				metricsHTTPHistograms.precision = p
-			} else {
-				log.Errorf("value of %v must be between 0 and 5: %v", pEnv, precision)
-			}
-		} else {
-			log.Errorf("value of %v is not an int: %v", pEnv, precision)
-		}
+	metricsHTTPHistograms.precision = configuredPrecision()
+}
+
+// configuredPrecision returns the histogram precision of the configuration, or
+// the default one if it's out of range.
+func configuredPrecision() int {
+	p := config.GetPrecision()
+	if p < 0 || p > 5 {
+		log.Errorf("value of APPOPTICS_HISTOGRAM_PRECISION must be between 0 and 5: %v", p)
+		return metricsHistPrecisionDefault
 	}
+	return p
+}
+
+// setPrecision sets the precision of the histograms created afterwards.
+func (hi *histograms) setPrecision(precision int) {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	hi.precision = precision
+}
+
+// getPrecision returns the precision of the histograms.
+func (hi *histograms) getPrecision() int {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	return hi.precision
+}
+
+// the built-in collectors of the host, process and runtime metrics, which are
+// shared by all the agents. They read the system files, e.g., /proc and the
+// cgroup filesystem, so they are subject to the timeout in case a read hangs.
+var processMetricsCollectors = []*metricsCollector{
+	newMetricsCollector("host", addHostMetrics),
+	newMetricsCollector("process", addProcessMetrics),
+	newMetricsCollector("runtime", addRuntimeMetrics),
 }
 
 // generates a metrics message in BSON format with all the currently available values
@@ -224,6 +292,15 @@ func init() {
 //
 // return				metrics message in BSON format
 func generateMetricsMessage(metricsFlushInterval int, queueStats *eventQueueStats) []byte {
+	return generateAgentMetricsMessage(metricsFlushInterval, queueStats, globalSettingsCfg, globalHTTPMetrics, true)
+}
+
+// generateAgentMetricsMessage generates a metrics message with the rate counts
+// and HTTP metrics of an agent. The host, process and runtime metrics and the
+// registered collectors are shared by all the agents of the process, so they
+// are only reported if processMetrics is true, i.e., by the default agent.
+func generateAgentMetricsMessage(metricsFlushInterval int, queueStats *eventQueueStats,
+	sc *oboeSettingsCfg, hm *httpMetrics, processMetrics bool) []byte {
 	bbuf := NewBsonBuffer()
 
 	appendHostId(bbuf)
@@ -235,50 +312,33 @@ func generateMetricsMessage(metricsFlushInterval int, queueStats *eventQueueStat
 	start := bsonAppendStartArray(bbuf, "measurements")
 	index := 0
 
-	// request counters
-	rc := flushRateCounts()
-	addMetricsValue(bbuf, &index, "RequestCount", rc.requested)
-	addMetricsValue(bbuf, &index, "TraceCount", rc.traced)
-	addMetricsValue(bbuf, &index, "TokenBucketExhaustionCount", rc.limited)
-	addMetricsValue(bbuf, &index, "SampleCount", rc.sampled)
-	addMetricsValue(bbuf, &index, "ThroughTraceCount", rc.through)
-
-	// Queue states
-	q := queueStats.copyAndReset()
-	addMetricsValue(bbuf, &index, "NumSent", q.numSent)
-	addMetricsValue(bbuf, &index, "NumOverflowed", q.numOverflowed)
-	addMetricsValue(bbuf, &index, "NumFailed", q.numFailed)
-	addMetricsValue(bbuf, &index, "TotalEvents", q.totalEvents)
-	addMetricsValue(bbuf, &index, "QueueLargest", q.queueLargest)
-
-	addHostMetrics(bbuf, &index)
-
-	// runtime stats
-	addMetricsValue(bbuf, &index, "JMX.type=threadcount,name=NumGoroutine", runtime.NumGoroutine())
-	var mem runtime.MemStats
-	host.Mem(&mem)
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.Alloc", int64(mem.Alloc))
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.TotalAlloc", int64(mem.TotalAlloc))
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.Sys", int64(mem.Sys))
-	addMetricsValue(bbuf, &index, "JMX.Memory:type=count,name=MemStats.Lookups", int64(mem.Lookups))
-	addMetricsValue(bbuf, &index, "JMX.Memory:type=count,name=MemStats.Mallocs", int64(mem.Mallocs))
-	addMetricsValue(bbuf, &index, "JMX.Memory:type=count,name=MemStats.Frees", int64(mem.Frees))
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.Heap.Alloc", int64(mem.HeapAlloc))
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.Heap.Sys", int64(mem.HeapSys))
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.Heap.Idle", int64(mem.HeapIdle))
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.Heap.Inuse", int64(mem.HeapInuse))
-	addMetricsValue(bbuf, &index, "JMX.Memory:MemStats.Heap.Released", int64(mem.HeapReleased))
-	addMetricsValue(bbuf, &index, "JMX.Memory:type=count,name=MemStats.Heap.Objects", int64(mem.HeapObjects))
-	var gc debug.GCStats
-	host.GC(&gc)
-	addMetricsValue(bbuf, &index, "JMX.type=count,name=GCStats.NumGC", gc.NumGC)
-
-	metricsHTTPMeasurements.lock.Lock()
-	for _, m := range metricsHTTPMeasurements.measurements {
-		addMeasurementToBSON(bbuf, &index, m)
-	}
-	metricsHTTPMeasurements.measurements = make(map[string]*Measurement) // clear measurements
-	metricsHTTPMeasurements.lock.Unlock()
+	// the built-in collectors followed by the registered ones. The ones
+	// resetting their sources are not subject to the timeout.
+	collectors := []*metricsCollector{
+		newUntimedMetricsCollector("rate counts", func(e *metricsEmitter) { addRateCounts(e, sc) }),
+		newUntimedMetricsCollector("queue stats", func(e *metricsEmitter) { addQueueStats(e, queueStats) }),
+	}
+	if processMetrics {
+		collectors = append(collectors, processMetricsCollectors...)
+	}
+	collectors = append(collectors,
+		newUntimedMetricsCollector("http measurements", func(e *metricsEmitter) { addHTTPMeasurements(e, hm) }),
+		newUntimedMetricsCollector("http histograms", func(e *metricsEmitter) { addHTTPHistograms(e, hm) }))
+	if processMetrics {
+		collectors = append(collectors, registeredMetricsCollectors()...)
+	}
+	results := runMetricsCollectors(collectors)
+
+	var hists []*histogram
+	for _, records := range results {
+		for _, r := range records {
+			if r.histogram != nil {
+				hists = append(hists, r.histogram)
+				continue
+			}
+			addMetricRecordToBSON(bbuf, &index, r)
+		}
+	}
 
 	bsonAppendFinishObject(bbuf, start)
 	// ==========================================
@@ -288,27 +348,73 @@ func generateMetricsMessage(metricsFlushInterval int, queueStats *eventQueueStat
 	start = bsonAppendStartArray(bbuf, "histograms")
 	index = 0
 
-	metricsHTTPHistograms.lock.Lock()
-
-	for _, h := range metricsHTTPHistograms.histograms {
+	for _, h := range hists {
 		addHistogramToBSON(bbuf, &index, h)
 	}
-	metricsHTTPHistograms.histograms = make(map[string]*histogram) // clear histograms
 
-	metricsHTTPHistograms.lock.Unlock()
 	bsonAppendFinishObject(bbuf, start)
 	// ==========================================
 
-	if mTransMap.Overflow() {
+	if hm.transMap.Overflow() {
 		bsonAppendBool(bbuf, "TransactionNameOverflow", true)
 	}
-	// The transaction map is reset in every metrics cycle.
-	mTransMap.Reset()
+	// The transaction and client IP maps are reset in every metrics cycle.
+	hm.transMap.Reset()
+	hm.clientIPs.Reset()
 
 	bsonBufferFinish(bbuf)
 	return bbuf.buf
 }
 
+// addRateCounts reports the request counters of the trace sampler
+func addRateCounts(e *metricsEmitter, sc *oboeSettingsCfg) {
+	rc := sc.flushRateCounts()
+	e.addValue("RequestCount", rc.requested)
+	e.addValue("TraceCount", rc.traced)
+	e.addValue("TokenBucketExhaustionCount", rc.limited)
+	e.addValue("SampleCount", rc.sampled)
+	e.addValue("ThroughTraceCount", rc.through)
+	e.addValue("TriggeredTraceCount", rc.triggered)
+}
+
+// addQueueStats reports the event queue states
+func addQueueStats(e *metricsEmitter, queueStats *eventQueueStats) {
+	q := queueStats.copyAndReset()
+	e.addValue("NumSent", q.numSent)
+	e.addValue("NumOverflowed", q.numOverflowed)
+	e.addValue("NumFailed", q.numFailed)
+	e.addValue("TotalEvents", q.totalEvents)
+	e.addValue("QueueLargest", q.queueLargest)
+	e.addValue("NumDroppedOldest", q.numDroppedOldest)
+	e.addValue("NumBlocked", q.numBlocked)
+	e.addValue("NumBlockTimeout", q.numBlockTimeout)
+	if q.bytesUncompressed != 0 {
+		e.addValue("CompressionBytesIn", q.bytesUncompressed)
+		e.addValue("CompressionBytesOut", q.bytesCompressed)
+		e.addValue("CompressionBytesSaved", q.bytesUncompressed-q.bytesCompressed)
+	}
+}
+
+// addHTTPMeasurements reports the HTTP measurements and clears them
+func addHTTPMeasurements(e *metricsEmitter, hm *httpMetrics) {
+	hm.measurements.lock.Lock()
+	for _, m := range hm.measurements.measurements {
+		e.addMeasurement(m)
+	}
+	hm.measurements.measurements = make(map[string]*Measurement) // clear measurements
+	hm.measurements.lock.Unlock()
+}
+
+// addHTTPHistograms reports the HTTP histograms
+func addHTTPHistograms(e *metricsEmitter, hm *httpMetrics) {
+	hm.histograms.lock.Lock()
+	for _, h := range hm.histograms.histograms {
+		e.addHistogram(h)
+	}
+	hm.histograms.histograms = make(map[string]*histogram) // clear histograms
+	hm.histograms.lock.Unlock()
+}
+
 // append host ID to a BSON buffer
 // bbuf	the BSON buffer to append the KVs to
 func appendHostId(bbuf *bsonBuffer) {
@@ -391,64 +497,94 @@ func addMetricsValue(bbuf *bsonBuffer, index *int, name string, value interface{
 // We can get the path so there is no need to parse the full URL.
 // e.g. Escaped Path path: /appoptics/appoptics-apm-go/blob/metrics becomes /appoptics/appoptics-apm-go
 func GetTransactionFromPath(path string) string {
+	return GetTransactionFromPathWithDepth(path, maxPathLenForTransactionName-1)
+}
+
+// GetTransactionFromPathWithDepth extracts the transaction name from the first
+// depth segments of the escaped path.
+// e.g. /appoptics/appoptics-apm-go/blob/metrics becomes /appoptics/appoptics-apm-go/blob with depth 3
+func GetTransactionFromPathWithDepth(path string, depth int) string {
 	if path == "" || path == "/" {
 		return "/"
 	}
 	p := strings.Split(path, "/")
 	lp := len(p)
-	if lp > maxPathLenForTransactionName {
-		lp = maxPathLenForTransactionName
+	if lp > depth+1 {
+		lp = depth + 1
 	}
 	return strings.Join(p[0:lp], "/")
 }
 
 // processes an HttpSpanMessage
-func (s *HTTPSpanMessage) process() {
+func (s *HTTPSpanMessage) process(hm *httpMetrics) {
 	// always add to overall histogram
-	recordHistogram(metricsHTTPHistograms, "", s.Duration)
+	recordHistogram(hm.histograms, "", s.Duration)
+
+	// the client IP tag has a high cardinality, so the client IPs beyond the
+	// limit are reported as 'other'
+	if s.ClientIP != "" && !hm.clientIPs.IsWithinLimit(s.ClientIP) {
+		s.ClientIP = otherClientIP
+	}
 
 	if s.Transaction != UnknownTransactionName {
 		// only record the transaction-specific histogram and measurements if we are still within the limit
 		// otherwise report it as an 'other' measurement
-		if mTransMap.IsWithinLimit(s.Transaction) {
-			recordHistogram(metricsHTTPHistograms, s.Transaction, s.Duration)
-			s.processMeasurements(s.Transaction)
+		if hm.transMap.IsWithinLimit(s.Transaction) {
+			recordHistogram(hm.histograms, s.Transaction, s.Duration)
+			s.processMeasurements(hm.measurements, s.Transaction)
 		} else {
-			s.processMeasurements(OtherTransactionName)
+			s.processMeasurements(hm.measurements, OtherTransactionName)
 		}
 	} else {
 		// no transaction/url name given, record as 'unknown'
-		s.processMeasurements(UnknownTransactionName)
+		s.processMeasurements(hm.measurements, UnknownTransactionName)
 	}
 }
 
 // processes HTTP measurements, record one for primary key, and one for each secondary key
+// me				collection of measurements that the measurements should be added to
 // transactionName	the transaction name to be used for these measurements
-func (s *HTTPSpanMessage) processMeasurements(transactionName string) {
+func (s *HTTPSpanMessage) processMeasurements(me *measurements, transactionName string) {
 	name := "TransactionResponseTime"
 	duration := float64(s.Duration)
 
-	metricsHTTPMeasurements.lock.Lock()
-	defer metricsHTTPMeasurements.lock.Unlock()
+	me.lock.Lock()
+	defer me.lock.Unlock()
 
 	// primary key: TransactionName
 	primaryTags := make(map[string]string)
 	primaryTags["TransactionName"] = transactionName
-	recordMeasurement(metricsHTTPMeasurements, name, &primaryTags, duration, 1, true)
+	recordMeasurement(me, name, &primaryTags, duration, 1, true)
 
 	// secondary keys: HttpMethod, HttpStatus, Errors
 	withMethodTags := utils.CopyMap(&primaryTags)
 	withMethodTags["HttpMethod"] = s.Method
-	recordMeasurement(metricsHTTPMeasurements, name, &withMethodTags, duration, 1, true)
+	recordMeasurement(me, name, &withMethodTags, duration, 1, true)
 
 	withStatusTags := utils.CopyMap(&primaryTags)
 	withStatusTags["HttpStatus"] = strconv.Itoa(s.Status)
-	recordMeasurement(metricsHTTPMeasurements, name, &withStatusTags, duration, 1, true)
+	recordMeasurement(me, name, &withStatusTags, duration, 1, true)
 
 	if s.HasError {
 		withErrorTags := utils.CopyMap(&primaryTags)
 		withErrorTags["Errors"] = "true"
-		recordMeasurement(metricsHTTPMeasurements, name, &withErrorTags, duration, 1, true)
+		recordMeasurement(me, name, &withErrorTags, duration, 1, true)
+	}
+
+	if s.ClientIP != "" {
+		withClientIPTags := utils.CopyMap(&primaryTags)
+		withClientIPTags["ClientIP"] = s.ClientIP
+		recordMeasurement(me, name, &withClientIPTags, duration, 1, true)
+	}
+
+	if s.Hijacked {
+		withHijackedTags := utils.CopyMap(&primaryTags)
+		withHijackedTags["Hijacked"] = "true"
+		recordMeasurement(me, name, &withHijackedTags, duration, 1, true)
+	} else if s.TimeToFirstByte > 0 {
+		// the response of a hijacked connection is unknown
+		recordMeasurement(me, "TransactionResponseBytes", &primaryTags, float64(s.ResponseBytes), 1, true)
+		recordMeasurement(me, "TransactionTimeToFirstByte", &primaryTags, float64(s.TimeToFirstByte), 1, true)
 	}
 }
 
@@ -552,24 +688,42 @@ func addMeasurementToBSON(bbuf *bsonBuffer, index *int, m *Measurement) {
 		bsonAppendFloat64(bbuf, "sum", m.Sum)
 	}
 
-	if len(m.Tags) > 0 {
-		start := bsonAppendStartObject(bbuf, "tags")
-		for k, v := range m.Tags {
-			if len(k) > metricsTagNameLengthMax {
-				k = k[0:metricsTagNameLengthMax]
-			}
-			if len(v) > metricsTagValueLengthMax {
-				v = v[0:metricsTagValueLengthMax]
-			}
-			bsonAppendString(bbuf, k, v)
-		}
-		bsonAppendFinishObject(bbuf, start)
-	}
+	appendTags(bbuf, m.Tags)
 
 	bsonAppendFinishObject(bbuf, start)
 	*index += 1
 }
 
+// counterDelta returns the difference between two readings of a cumulative
+// counter, or the current value if the counter has been reset.
+func counterDelta(curr, last int64) int64 {
+	if curr < last {
+		return curr
+	}
+	return curr - last
+}
+
+// appends the tags, if any, to a BSON buffer. The tag names and values are
+// truncated if they are too long.
+// bbuf		the BSON buffer to append the tags to
+// tags		the tags to be added
+func appendTags(bbuf *bsonBuffer, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	start := bsonAppendStartObject(bbuf, "tags")
+	for k, v := range tags {
+		if len(k) > metricsTagNameLengthMax {
+			k = k[0:metricsTagNameLengthMax]
+		}
+		if len(v) > metricsTagValueLengthMax {
+			v = v[0:metricsTagValueLengthMax]
+		}
+		bsonAppendString(bbuf, k, v)
+	}
+	bsonAppendFinishObject(bbuf, start)
+}
+
 // adds a histogram to a BSON buffer
 // bbuf		the BSON buffer to append the metric to
 // index	a running integer (0,1,2,...) which is needed for BSON arrays
@@ -582,25 +736,18 @@ func addHistogramToBSON(bbuf *bsonBuffer, index *int, h *histogram) {
 		return
 	}
 
+	name := h.name
+	if name == "" {
+		name = "TransactionResponseTime"
+	}
+
 	start := bsonAppendStartObject(bbuf, strconv.Itoa(*index))
 
-	bsonAppendString(bbuf, "name", "TransactionResponseTime")
+	bsonAppendString(bbuf, "name", name)
 	bsonAppendString(bbuf, "value", string(data))
 
 	// append tags
-	if len(h.tags) > 0 {
-		start := bsonAppendStartObject(bbuf, "tags")
-		for k, v := range h.tags {
-			if len(k) > metricsTagNameLengthMax {
-				k = k[0:metricsTagNameLengthMax]
-			}
-			if len(v) > metricsTagValueLengthMax {
-				v = v[0:metricsTagValueLengthMax]
-			}
-			bsonAppendString(bbuf, k, v)
-		}
-		bsonAppendFinishObject(bbuf, start)
-	}
+	appendTags(bbuf, h.tags)
 
 	bsonAppendFinishObject(bbuf, start)
 	*index += 1
@@ -620,6 +767,12 @@ func (s *eventQueueStats) setQueueLargest(count int64) {
 	}
 }
 
+// addBytesFrom moves the compression stats of another connection to this one.
+func (s *eventQueueStats) addBytesFrom(o *eventQueueStats) {
+	atomic.AddInt64(&s.bytesUncompressed, atomic.SwapInt64(&o.bytesUncompressed, 0))
+	atomic.AddInt64(&s.bytesCompressed, atomic.SwapInt64(&o.bytesCompressed, 0))
+}
+
 // copyAndReset returns a copy of its current values and reset itself.
 func (s *eventQueueStats) copyAndReset() eventQueueStats {
 	c := eventQueueStats{}
@@ -629,6 +782,11 @@ func (s *eventQueueStats) copyAndReset() eventQueueStats {
 	c.totalEvents = atomic.SwapInt64(&s.totalEvents, 0)
 	c.numOverflowed = atomic.SwapInt64(&s.numOverflowed, 0)
 	c.queueLargest = atomic.SwapInt64(&s.queueLargest, 0)
+	c.numDroppedOldest = atomic.SwapInt64(&s.numDroppedOldest, 0)
+	c.numBlocked = atomic.SwapInt64(&s.numBlocked, 0)
+	c.numBlockTimeout = atomic.SwapInt64(&s.numBlockTimeout, 0)
+	c.bytesUncompressed = atomic.SwapInt64(&s.bytesUncompressed, 0)
+	c.bytesCompressed = atomic.SwapInt64(&s.bytesCompressed, 0)
 
 	return c
 }
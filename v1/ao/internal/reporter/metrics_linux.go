@@ -25,12 +25,12 @@ func appendUname(bbuf *bsonBuffer) {
 	}
 }
 
-func addHostMetrics(bbuf *bsonBuffer, index *int) {
+func addHostMetrics(e *metricsEmitter) {
 	// system load of last minute
 	if s := utils.GetStrByKeyword("/proc/loadavg", ""); s != "" {
 		load, err := strconv.ParseFloat(strings.Fields(s)[0], 64)
 		if err == nil {
-			addMetricsValue(bbuf, index, "Load1", load)
+			e.addValue("Load1", load)
 		}
 	}
 
@@ -39,7 +39,7 @@ func addHostMetrics(bbuf *bsonBuffer, index *int) {
 		memTotal := strings.Fields(s) // MemTotal: 7657668 kB
 		if len(memTotal) == 3 {
 			if total, err := strconv.Atoi(memTotal[1]); err == nil {
-				addMetricsValue(bbuf, index, "TotalRAM", int64(total*1024))
+				e.addValue("TotalRAM", int64(total*1024))
 			}
 		}
 	}
@@ -49,7 +49,7 @@ func addHostMetrics(bbuf *bsonBuffer, index *int) {
 		memFree := strings.Fields(s) // MemFree: 161396 kB
 		if len(memFree) == 3 {
 			if free, err := strconv.Atoi(memFree[1]); err == nil {
-				addMetricsValue(bbuf, index, "FreeRAM", int64(free*1024)) // bytes
+				e.addValue("FreeRAM", int64(free*1024)) // bytes
 			}
 		}
 	}
@@ -60,10 +60,13 @@ func addHostMetrics(bbuf *bsonBuffer, index *int) {
 		if len(processRAM) != 0 {
 			for _, ps := range processRAM {
 				if p, err := strconv.Atoi(ps); err == nil {
-					addMetricsValue(bbuf, index, "ProcessRAM", p*os.Getpagesize())
+					e.addValue("ProcessRAM", p*os.Getpagesize())
 					break
 				}
 			}
 		}
 	}
+
+	// container resource limits and usage
+	addCgroupMetrics(e)
 }
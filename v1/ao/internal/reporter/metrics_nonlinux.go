@@ -6,4 +6,6 @@ package reporter
 
 func appendUname(bbuf *bsonBuffer) {}
 
-func addHostMetrics(bbuf *bsonBuffer, index *int) {}
+func addHostMetrics(e *metricsEmitter) {}
+
+func addProcessMetrics(e *metricsEmitter) {}
@@ -16,6 +16,7 @@ import (
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/hdrhist"
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/host"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -178,6 +179,12 @@ func TestGetTransactionFromURL(t *testing.T) {
 	for _, r := range test {
 		assert.Equal(t, r.transaction, GetTransactionFromPath(r.url), "url: "+r.url)
 	}
+
+	assert.Equal(t, "/appoptics/appoptics-apm-go/blob",
+		GetTransactionFromPathWithDepth("/appoptics/appoptics-apm-go/blob/metrics", 3))
+	assert.Equal(t, "/appoptics", GetTransactionFromPathWithDepth("/appoptics/appoptics-apm-go", 1))
+	assert.Equal(t, "/appoptics/appoptics-apm-go",
+		GetTransactionFromPathWithDepth("/appoptics/appoptics-apm-go", 5))
 }
 
 func TestTransMap(t *testing.T) {
@@ -398,6 +405,9 @@ func TestGenerateMetricsMessage(t *testing.T) {
 		{"NumFailed", int64(1)},
 		{"TotalEvents", int64(1)},
 		{"QueueLargest", int64(1)},
+		{"NumDroppedOldest", int64(1)},
+		{"NumBlocked", int64(1)},
+		{"NumBlockTimeout", int64(1)},
 	}
 	if runtime.GOOS == "linux" {
 		testCases = append(testCases, []testCase{
@@ -424,9 +434,16 @@ func TestGenerateMetricsMessage(t *testing.T) {
 		{"JMX.type=count,name=GCStats.NumGC", int64(1)},
 	}...)
 
-	for i, tc := range testCases {
-		assert.Equal(t, tc.name, mts[i].(map[string]interface{})["name"])
-		assert.IsType(t, mts[i].(map[string]interface{})["value"], tc.value, tc.name)
+	// the host may report extra measurements (e.g., cgroup metrics), so look
+	// them up by name rather than position.
+	values := make(map[string]interface{})
+	for _, mt := range mts {
+		values[mt.(map[string]interface{})["name"].(string)] = mt.(map[string]interface{})["value"]
+	}
+	for _, tc := range testCases {
+		v, ok := values[tc.name]
+		assert.True(t, ok, tc.name)
+		assert.IsType(t, v, tc.value, tc.name)
 	}
 
 	assert.Nil(t, m["TransactionNameOverflow"])
@@ -443,3 +460,102 @@ func TestGenerateMetricsMessage(t *testing.T) {
 	assert.True(t, m["TransactionNameOverflow"].(bool))
 	mTransMap.Reset()
 }
+
+func TestCounterDelta(t *testing.T) {
+	assert.Equal(t, int64(5), counterDelta(15, 10))
+	assert.Equal(t, int64(0), counterDelta(10, 10))
+	assert.Equal(t, int64(3), counterDelta(3, 10))
+}
+
+func TestProcessMeasurementsResponseStats(t *testing.T) {
+	me := &measurements{measurements: make(map[string]*Measurement)}
+	s := &HTTPSpanMessage{
+		BaseSpanMessage: BaseSpanMessage{Duration: time.Millisecond},
+		Status:          200,
+		Method:          "GET",
+		ResponseBytes:   1024,
+		TimeToFirstByte: 100 * time.Microsecond,
+	}
+	s.processMeasurements(me, "txn")
+	m := me.measurements["TransactionResponseBytes&true&TransactionName:txn&"]
+	require.NotNil(t, m)
+	assert.Equal(t, float64(1024), m.Sum)
+	m = me.measurements["TransactionTimeToFirstByte&true&TransactionName:txn&"]
+	require.NotNil(t, m)
+	assert.Equal(t, float64(100*time.Microsecond), m.Sum)
+	assert.Nil(t, me.measurements["TransactionResponseTime&true&Hijacked:true&TransactionName:txn&"])
+
+	// the response of a hijacked connection is not measured
+	me = &measurements{measurements: make(map[string]*Measurement)}
+	s.Hijacked = true
+	s.processMeasurements(me, "txn")
+	assert.NotNil(t, me.measurements["TransactionResponseTime&true&Hijacked:true&TransactionName:txn&"])
+	assert.Nil(t, me.measurements["TransactionResponseBytes&true&TransactionName:txn&"])
+	assert.Nil(t, me.measurements["TransactionTimeToFirstByte&true&TransactionName:txn&"])
+}
+
+func TestProcessMeasurementsClientIP(t *testing.T) {
+	me := &measurements{measurements: make(map[string]*Measurement)}
+	s := &HTTPSpanMessage{
+		BaseSpanMessage: BaseSpanMessage{Duration: time.Millisecond},
+		Status:          200,
+		Method:          "GET",
+	}
+	s.processMeasurements(me, "txn")
+	assert.Len(t, me.measurements, 3)
+
+	s.ClientIP = "203.0.113.1"
+	s.processMeasurements(me, "txn")
+	m := me.measurements["TransactionResponseTime&true&ClientIP:203.0.113.1&TransactionName:txn&"]
+	require.NotNil(t, m)
+	assert.Equal(t, 1, m.Count)
+}
+
+func TestProcessClientIPLimit(t *testing.T) {
+	hm := newHTTPMetrics()
+	newSpan := func(ip string) *HTTPSpanMessage {
+		return &HTTPSpanMessage{
+			BaseSpanMessage: BaseSpanMessage{Duration: time.Millisecond},
+			Transaction:     "txn",
+			Status:          200,
+			Method:          "GET",
+			ClientIP:        ip,
+		}
+	}
+	clientIPTags := func() []string {
+		var ips []string
+		for _, m := range hm.measurements.measurements {
+			if ip, ok := m.Tags["ClientIP"]; ok {
+				ips = append(ips, ip)
+			}
+		}
+		return ips
+	}
+
+	for i := 0; i < metricsClientIPsMax; i++ {
+		newSpan("10.0.0." + strconv.Itoa(i)).process(hm)
+	}
+	assert.Len(t, clientIPTags(), metricsClientIPsMax)
+	assert.NotContains(t, clientIPTags(), otherClientIP)
+
+	// the client IPs beyond the limit are reported as 'other'
+	newSpan("10.0.1.1").process(hm)
+	newSpan("10.0.1.2").process(hm)
+	assert.Len(t, clientIPTags(), metricsClientIPsMax+1)
+	assert.Contains(t, clientIPTags(), otherClientIP)
+	assert.NotContains(t, clientIPTags(), "10.0.1.1")
+	m := hm.measurements.measurements["TransactionResponseTime&true&ClientIP:other&TransactionName:txn&"]
+	require.NotNil(t, m)
+	assert.Equal(t, 2, m.Count)
+	// the recorded ones are still tagged
+	newSpan("10.0.0.1").process(hm)
+	m = hm.measurements.measurements["TransactionResponseTime&true&ClientIP:10.0.0.1&TransactionName:txn&"]
+	require.NotNil(t, m)
+	assert.Equal(t, 2, m.Count)
+
+	// the limit is reset in each metrics cycle
+	hm.clientIPs.Reset()
+	hm.measurements.measurements = make(map[string]*Measurement)
+	newSpan("10.0.1.1").process(hm)
+	assert.Equal(t, []string{"10.0.1.1"}, clientIPTags())
+}
@@ -22,7 +22,12 @@ import (
 type oboeSettingsCfg struct {
 	tracingMode tracingMode
 	settings    map[oboeSettingKey]*oboeSettings
-	lock        sync.RWMutex
+	// the token bucket shared by all the settings
+	bucket *tokenBucket
+	// the token buckets of the signed and unsigned trigger traces
+	triggerRelaxed *tokenBucket
+	triggerStrict  *tokenBucket
+	lock           sync.RWMutex
 	rateCounts
 }
 type oboeSettings struct {
@@ -35,9 +40,9 @@ type oboeSettings struct {
 	bucket    *tokenBucket
 }
 
-func newOboeSettings() *oboeSettings {
+func newOboeSettings(bucket *tokenBucket) *oboeSettings {
 	return &oboeSettings{
-		bucket: globalTokenBucket,
+		bucket: bucket,
 	}
 }
 
@@ -85,7 +90,10 @@ type oboeSettingKey struct {
 
 // Global configuration settings
 var globalSettingsCfg = &oboeSettingsCfg{
-	settings: make(map[oboeSettingKey]*oboeSettings),
+	settings:       make(map[oboeSettingKey]*oboeSettings),
+	bucket:         globalTokenBucket,
+	triggerRelaxed: &tokenBucket{},
+	triggerStrict:  &tokenBucket{},
 }
 
 // The global token bucket. Trace decisions of all the requests are controlled
@@ -98,30 +106,78 @@ var globalTokenBucket = &tokenBucket{}
 func init() {
 	readEnvSettings()
 	rand.Seed(time.Now().UnixNano())
+	config.AddListener(configListener(globalSettingsCfg, globalHTTPMetrics))
+}
+
+// configListener applies the configuration updated at runtime to the
+// settings and the HTTP metrics.
+func configListener(sc *oboeSettingsCfg, hm *httpMetrics) config.Listener {
+	return func(changed []string) {
+		for _, name := range changed {
+			switch name {
+			case "TracingMode":
+				sc.lock.Lock()
+				sc.readEnvSettings()
+				sc.lock.Unlock()
+			case "Precision":
+				hm.histograms.setPrecision(configuredPrecision())
+			}
+		}
+	}
+}
+
+// newOboeSettingsCfg creates an empty settings configuration with its own
+// token bucket and rate counters.
+func newOboeSettingsCfg() *oboeSettingsCfg {
+	c := &oboeSettingsCfg{
+		settings:       make(map[oboeSettingKey]*oboeSettings),
+		bucket:         &tokenBucket{},
+		triggerRelaxed: &tokenBucket{},
+		triggerStrict:  &tokenBucket{},
+	}
+	c.readEnvSettings()
+	return c
 }
 
 // This method is not thread-safe (initializes the tracingMode without locking)
 // Call it in the init() method only, or protect it by the caller.
 func readEnvSettings() {
+	globalSettingsCfg.readEnvSettings()
+}
+
+func (sc *oboeSettingsCfg) readEnvSettings() {
 	// Configure tracing mode setting using environment variable
 	mode := config.GetTracingMode()
 	switch mode {
 	case "always":
 		fallthrough
 	default:
-		globalSettingsCfg.tracingMode = TRACE_ALWAYS
+		sc.tracingMode = TRACE_ALWAYS
 	case "never":
-		globalSettingsCfg.tracingMode = TRACE_NEVER
+		sc.tracingMode = TRACE_NEVER
 	}
 }
 
+// getTracingMode returns the tracing mode, which may be updated at runtime.
+func (sc *oboeSettingsCfg) getTracingMode() tracingMode {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+	return sc.tracingMode
+}
+
 func sendInitMessage() {
-	if Closed() {
+	sendAgentInitMessage(nil)
+}
+
+// sendAgentInitMessage sends the init message through the reporter of the agent.
+func sendAgentInitMessage(a *Agent) {
+	if a.getReporter().Closed() {
 		log.Info(errors.Wrap(ErrReporterIsClosed, "send init message"))
 		return
 	}
 	ctx := newContext(true)
 	if c, ok := ctx.(*oboeContext); ok {
+		c.agent = a
 		// create new event from context
 		e, err := c.newEvent("single", "go")
 		if err != nil {
@@ -139,7 +195,12 @@ func sendInitMessage() {
 }
 
 func (b *tokenBucket) count(sampled, hasMetadata, rateLimit bool) bool {
-	c := globalSettingsCfg
+	return globalSettingsCfg.count(b, sampled, hasMetadata, rateLimit)
+}
+
+// count counts the sampling decision and consumes a token from the bucket
+// if rate limiting is required.
+func (c *oboeSettingsCfg) count(b *tokenBucket, sampled, hasMetadata, rateLimit bool) bool {
 	atomic.AddInt64(&c.requested, 1)
 	if hasMetadata {
 		atomic.AddInt64(&c.through, 1)
@@ -159,13 +220,17 @@ func (b *tokenBucket) count(sampled, hasMetadata, rateLimit bool) bool {
 }
 
 func flushRateCounts() *rateCounts {
-	c := globalSettingsCfg
+	return globalSettingsCfg.flushRateCounts()
+}
+
+func (c *oboeSettingsCfg) flushRateCounts() *rateCounts {
 	return &rateCounts{
 		requested: atomic.SwapInt64(&c.requested, 0),
 		sampled:   atomic.SwapInt64(&c.sampled, 0),
 		limited:   atomic.SwapInt64(&c.limited, 0),
 		traced:    atomic.SwapInt64(&c.traced, 0),
 		through:   atomic.SwapInt64(&c.through, 0),
+		triggered: atomic.SwapInt64(&c.triggered, 0),
 	}
 }
 
@@ -192,22 +257,28 @@ func (b *tokenBucket) update(now time.Time) {
 	}
 }
 
-func oboeSampleRequest(layer string, traced bool) (bool, int, sampleSource) {
+func oboeSampleRequest(layer string, traced bool, local *LocalSampleRate) (bool, int, sampleSource) {
 	if usingTestReporter {
-		if r, ok := globalReporter.(*TestReporter); ok {
+		if r, ok := getGlobalReporter().(*TestReporter); ok {
 			if !r.UseSettings {
 				return r.ShouldTrace, 0, SAMPLE_SOURCE_NONE // trace tests
 			}
 		}
 	}
+	return globalSettingsCfg.sampleRequest(layer, traced, local)
+}
 
-	if globalSettingsCfg.tracingMode == TRACE_NEVER {
+// sampleRequest makes the sampling decision with the settings. The stricter one
+// of the remote and the local sample rates wins, unless the local one
+// overrides it and the remote settings don't have the OVERRIDE flag.
+func (sc *oboeSettingsCfg) sampleRequest(layer string, traced bool, local *LocalSampleRate) (bool, int, sampleSource) {
+	if sc.getTracingMode() == TRACE_NEVER {
 		return false, 0, SAMPLE_SOURCE_NONE
 	}
 
 	var setting *oboeSettings
 	var ok bool
-	if setting, ok = getSetting(layer); !ok {
+	if setting, ok = sc.getSetting(layer); !ok {
 		// log.Debugf("Sampling disabled for %v until valid settings are retrieved.", layer)
 		return false, 0, SAMPLE_SOURCE_NONE
 	}
@@ -228,6 +299,14 @@ func oboeSampleRequest(layer string, traced bool) (bool, int, sampleSource) {
 		sampleSource = SAMPLE_SOURCE_NONE
 	}
 
+	if local != nil {
+		localRate := utils.Max(utils.Min(local.Rate, maxSamplingRate), 0)
+		if localRate < sampleRate || (local.Override && setting.flags&FLAG_OVERRIDE == 0) {
+			sampleRate = localRate
+			sampleSource = SAMPLE_SOURCE_LOCAL
+		}
+	}
+
 	if !traced {
 		// A new request
 		if setting.flags&FLAG_SAMPLE_START != 0 {
@@ -245,11 +324,58 @@ func oboeSampleRequest(layer string, traced bool) (bool, int, sampleSource) {
 		}
 	}
 
-	retval = setting.bucket.count(retval, traced, doRateLimiting)
+	retval = sc.count(setting.bucket, retval, traced, doRateLimiting)
 
 	return retval, sampleRate, sampleSource
 }
 
+// forceSample samples the request regardless of the sample rate and the token
+// bucket, unless the tracing mode is never. The request is counted as well.
+func (sc *oboeSettingsCfg) forceSample(traced bool) (bool, int, sampleSource) {
+	if sc.getTracingMode() == TRACE_NEVER {
+		return false, 0, SAMPLE_SOURCE_NONE
+	}
+	sc.count(sc.bucket, true, traced, false)
+	return true, maxSamplingRate, SAMPLE_SOURCE_LOCAL
+}
+
+// The decisions of the trigger trace requests, which are echoed by the
+// X-Trace-Options-Response header.
+const (
+	TriggerTraceOK                   = "ok"
+	TriggerTraceRateExceeded         = "rate-exceeded"
+	TriggerTraceTracingDisabled      = "tracing-disabled"
+	TriggerTraceDisabled             = "trigger-tracing-disabled"
+	TriggerTraceSettingsNotAvailable = "settings-not-available"
+)
+
+// triggerSample samples a trigger trace request regardless of the sample
+// rate, subject to the trigger trace token bucket of the settings. The signed
+// requests have a more relaxed bucket than the unsigned ones.
+func (sc *oboeSettingsCfg) triggerSample(signed bool) (bool, int, sampleSource, string) {
+	if sc.getTracingMode() == TRACE_NEVER {
+		return false, 0, SAMPLE_SOURCE_NONE, TriggerTraceTracingDisabled
+	}
+	setting, ok := sc.getSetting("")
+	if !ok {
+		return false, 0, SAMPLE_SOURCE_NONE, TriggerTraceSettingsNotAvailable
+	}
+	if setting.flags&FLAG_TRIGGER_TRACE == 0 {
+		return false, 0, SAMPLE_SOURCE_NONE, TriggerTraceDisabled
+	}
+	bucket := sc.triggerStrict
+	if signed {
+		bucket = sc.triggerRelaxed
+	}
+	if !sc.count(bucket, true, false, true) {
+		return false, 0, SAMPLE_SOURCE_NONE, TriggerTraceRateExceeded
+	}
+	atomic.AddInt64(&sc.triggered, 1)
+	// the sample rate and source are not applicable to a trigger trace, and
+	// the entry event doesn't report them
+	return true, -1, SAMPLE_SOURCE_UNSET, TriggerTraceOK
+}
+
 func bytesToFloat64(b []byte) (float64, error) {
 	if len(b) != 8 {
 		return -1, fmt.Errorf("invalid length: %d", len(b))
@@ -293,7 +419,12 @@ func parseInt32(args map[string][]byte, key string, fb int32) int32 {
 }
 
 func updateSetting(sType int32, layer string, flags []byte, value int64, ttl int64, args map[string][]byte) {
-	ns := newOboeSettings()
+	globalSettingsCfg.updateSetting(sType, layer, flags, value, ttl, args)
+}
+
+func (sc *oboeSettingsCfg) updateSetting(sType int32, layer string, flags []byte, value int64, ttl int64,
+	args map[string][]byte) {
+	ns := newOboeSettings(sc.bucket)
 
 	ns.timestamp = time.Now()
 	ns.sType = settingType(sType)
@@ -305,15 +436,19 @@ func updateSetting(sType int32, layer string, flags []byte, value int64, ttl int
 	rate := parseFloat64(args, kvBucketRate, 0)
 	capacity := parseFloat64(args, kvBucketCapacity, 0)
 	ns.bucket.setRateCap(rate, capacity)
+	sc.triggerRelaxed.setRateCap(parseFloat64(args, kvTriggerRelaxedBucketRate, 0),
+		parseFloat64(args, kvTriggerRelaxedBucketCapacity, 0))
+	sc.triggerStrict.setRateCap(parseFloat64(args, kvTriggerStrictBucketRate, 0),
+		parseFloat64(args, kvTriggerStrictBucketCapacity, 0))
 
 	key := oboeSettingKey{
 		sType: settingType(sType),
 		layer: layer,
 	}
 
-	globalSettingsCfg.lock.Lock()
-	globalSettingsCfg.settings[key] = ns
-	globalSettingsCfg.lock.Unlock()
+	sc.lock.Lock()
+	sc.settings[key] = ns
+	sc.lock.Unlock()
 }
 
 // Used for tests only
@@ -324,6 +459,8 @@ func resetSettings() {
 	flushRateCounts()
 	globalSettingsCfg.settings = make(map[oboeSettingKey]*oboeSettings)
 	globalTokenBucket.reset()
+	globalSettingsCfg.triggerRelaxed.reset()
+	globalSettingsCfg.triggerStrict.reset()
 	readEnvSettings()
 }
 
@@ -346,15 +483,19 @@ func (sc *oboeSettingsCfg) checkSettingsTimeout() {
 }
 
 func getSetting(layer string) (*oboeSettings, bool) {
-	globalSettingsCfg.lock.RLock()
-	defer globalSettingsCfg.lock.RUnlock()
+	return globalSettingsCfg.getSetting(layer)
+}
+
+func (sc *oboeSettingsCfg) getSetting(layer string) (*oboeSettings, bool) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
 
 	// for now only look up the default settings
 	key := oboeSettingKey{
 		sType: TYPE_DEFAULT,
 		layer: "",
 	}
-	if setting, ok := globalSettingsCfg.settings[key]; ok {
+	if setting, ok := sc.settings[key]; ok {
 		return setting, true
 	}
 
@@ -374,7 +515,11 @@ func removeSetting(layer string) {
 }
 
 func hasDefaultSetting() bool {
-	if _, ok := getSetting(""); ok {
+	return globalSettingsCfg.hasDefaultSetting()
+}
+
+func (sc *oboeSettingsCfg) hasDefaultSetting() bool {
+	if _, ok := sc.getSetting(""); ok {
 		return true
 	}
 	return false
@@ -399,6 +544,8 @@ func flagStringToBin(flagString string) settingFlag {
 				flags |= FLAG_SAMPLE_THROUGH
 			case "SAMPLE_THROUGH_ALWAYS":
 				flags |= FLAG_SAMPLE_THROUGH_ALWAYS
+			case "TRIGGER_TRACE":
+				flags |= FLAG_TRIGGER_TRACE
 			}
 		}
 	}
@@ -3,6 +3,7 @@
 package reporter
 
 import (
+	"context"
 	"os"
 	"sync"
 	"sync/atomic"
@@ -15,6 +16,7 @@ import (
 
 	g "github.com/appoptics/appoptics-apm-go/v1/ao/internal/graphtest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func newTokenBucket(ratePerSec, size float64) *tokenBucket {
@@ -229,6 +231,48 @@ func TestSampleSource(t *testing.T) {
 	r.Close(0)
 }
 
+func TestLocalSampleRate(t *testing.T) {
+	r := SetTestReporter(TestReporterDisableDefaultSetting(true))
+	updateSetting(int32(TYPE_DEFAULT), "", []byte("SAMPLE_START,SAMPLE_THROUGH_ALWAYS"),
+		500000, 120, argsToMap(1000000, 1000000, -1, -1))
+
+	// the stricter one wins
+	_, rate, source := oboeSampleRequest(testLayer, false, nil)
+	assert.Equal(t, 500000, rate)
+	assert.Equal(t, SAMPLE_SOURCE_DEFAULT, source)
+	ok, rate, source := oboeSampleRequest(testLayer, false, &LocalSampleRate{Rate: 0})
+	assert.False(t, ok)
+	assert.Equal(t, 0, rate)
+	assert.Equal(t, SAMPLE_SOURCE_LOCAL, source)
+	_, rate, source = oboeSampleRequest(testLayer, false, &LocalSampleRate{Rate: 1000000})
+	assert.Equal(t, 500000, rate)
+	assert.Equal(t, SAMPLE_SOURCE_DEFAULT, source)
+
+	// overridden by the local rate
+	ok, rate, source = oboeSampleRequest(testLayer, false, &LocalSampleRate{Rate: 1000000, Override: true})
+	assert.True(t, ok)
+	assert.Equal(t, 1000000, rate)
+	assert.Equal(t, SAMPLE_SOURCE_LOCAL, source)
+
+	// unless the remote settings override it
+	updateSetting(int32(TYPE_DEFAULT), "", []byte("OVERRIDE,SAMPLE_START,SAMPLE_THROUGH_ALWAYS"),
+		500000, 120, argsToMap(1000000, 1000000, -1, -1))
+	_, rate, source = oboeSampleRequest(testLayer, false, &LocalSampleRate{Rate: 1000000, Override: true})
+	assert.Equal(t, 500000, rate)
+	assert.Equal(t, SAMPLE_SOURCE_DEFAULT, source)
+	_, rate, source = oboeSampleRequest(testLayer, false, &LocalSampleRate{Rate: 100000, Override: true})
+	assert.Equal(t, 100000, rate)
+	assert.Equal(t, SAMPLE_SOURCE_LOCAL, source)
+
+	// no local rate without the remote settings
+	resetSettings()
+	ok, _, source = oboeSampleRequest(testLayer, false, &LocalSampleRate{Rate: 1000000, Override: true})
+	assert.False(t, ok)
+	assert.Equal(t, SAMPLE_SOURCE_NONE, source)
+
+	r.Close(0)
+}
+
 func TestSampleFlags(t *testing.T) {
 	r := SetTestReporter(TestReporterDisableDefaultSetting(true))
 	c := globalSettingsCfg
@@ -415,7 +459,7 @@ func TestOboeTracingMode(t *testing.T) {
 	config.Refresh()
 	readEnvSettings()
 	assert.EqualValues(t, globalSettingsCfg.tracingMode, 0) // C.OBOE_TRACE_NEVER
-	ok, _, _ := oboeSampleRequest("myLayer", false)
+	ok, _, _ := oboeSampleRequest("myLayer", false, nil)
 	assert.False(t, ok)
 
 	os.Setenv("APPOPTICS_TRACING_MODE", "")
@@ -426,6 +470,41 @@ func TestOboeTracingMode(t *testing.T) {
 	r.Close(0)
 }
 
+func TestUpdateTracingModeAtRuntime(t *testing.T) {
+	r := SetTestReporter()
+	os.Setenv("APPOPTICS_DISABLED", "true")
+	config.Refresh()
+	a, err := NewAgent("ae38315f6116585d64d82ec2455aa3ec61e02fee25d286f74ace9e4fea189217:agent")
+	require.NoError(t, err)
+	os.Unsetenv("APPOPTICS_DISABLED")
+	config.Refresh()
+
+	require.NoError(t, config.Update(config.WithTracingMode("never"), config.WithPrecision(4)))
+	assert.EqualValues(t, TRACE_NEVER, globalSettingsCfg.getTracingMode())
+	ok, _, _ := oboeSampleRequest("myLayer", false, nil)
+	assert.False(t, ok)
+	assert.Equal(t, 4, globalHTTPMetrics.histograms.precision)
+
+	// the agents are updated too
+	assert.EqualValues(t, TRACE_NEVER, a.settings.getTracingMode())
+	assert.Equal(t, 4, a.httpMetrics.histograms.precision)
+	require.NoError(t, config.Update(config.WithTracingMode("always"), config.WithPrecision(2)))
+	assert.EqualValues(t, TRACE_ALWAYS, a.settings.getTracingMode())
+	assert.Equal(t, 2, a.httpMetrics.histograms.precision)
+	assert.EqualValues(t, TRACE_ALWAYS, globalSettingsCfg.getTracingMode())
+	assert.Equal(t, 2, globalHTTPMetrics.histograms.precision)
+	ok, _, _ = oboeSampleRequest("myLayer", false, nil)
+	assert.True(t, ok)
+
+	// the listener is removed once the agent is shutdown
+	a.Shutdown(context.Background())
+	require.NoError(t, config.Update(config.WithTracingMode("never")))
+	assert.EqualValues(t, TRACE_ALWAYS, a.settings.getTracingMode())
+	require.NoError(t, config.Update(config.WithTracingMode("always")))
+
+	r.Close(0)
+}
+
 func TestCheckSettingsTimeout(t *testing.T) {
 	sc := &oboeSettingsCfg{
 		settings: make(map[oboeSettingKey]*oboeSettings),
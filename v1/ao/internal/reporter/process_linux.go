@@ -0,0 +1,195 @@
+// +build linux
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// the proc directory of the current process
+const procSelf = "/proc/self"
+
+// the number of clock ticks per second used by /proc/[pid]/stat. It's the
+// value of sysconf(_SC_CLK_TCK) which is 100 on all the architectures Linux
+// supports from user space.
+const clockTicksPerSec = 100
+
+// the value of an unlimited resource limit, i.e., RLIM_INFINITY
+const rlimInfinity = ^uint64(0)
+
+// processCounters holds the cumulative counters of the process, which are
+// reported as deltas between two metrics cycles.
+type processCounters struct {
+	utime          int64 // user CPU time in clock ticks
+	stime          int64 // system CPU time in clock ticks
+	voluntaryCtx   int64 // voluntary context switches
+	involuntaryCtx int64 // involuntary context switches
+}
+
+// process reads the resource usage of a process from the proc filesystem.
+type process struct {
+	// the proc directory of the process, e.g., /proc/self
+	dir string
+
+	// the counters of the last metrics cycle, protected by the lock.
+	last processCounters
+	lock sync.Mutex
+}
+
+// the current process
+var selfProcess = newProcess(procSelf)
+
+// newProcess returns a reader of the process of the proc directory dir.
+func newProcess(dir string) *process {
+	p := &process{dir: dir}
+	// the first metrics cycle reports the deltas since the process reader is
+	// created, rather than the lifetime counters of the process.
+	p.last, _, _ = p.counters()
+	return p
+}
+
+// stat reads the CPU times from the stat file. The second field (comm) is
+// enclosed in parentheses and may contain spaces, so the fields are counted
+// from the last closing parenthesis.
+func (p *process) stat() (utime, stime int64, ok bool) {
+	b, err := ioutil.ReadFile(filepath.Join(p.dir, "stat"))
+	if err != nil {
+		return 0, 0, false
+	}
+	s := string(b)
+	i := strings.LastIndex(s, ")")
+	if i < 0 {
+		return 0, 0, false
+	}
+	// the fields after comm start with state (3), utime and stime are the
+	// 14th and 15th fields.
+	fields := strings.Fields(s[i+1:])
+	if len(fields) < 13 {
+		return 0, 0, false
+	}
+	utime, err = strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	stime, err = strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return utime, stime, true
+}
+
+// status reads the status file as a map of key to the first numeric value.
+func (p *process) status() map[string]int64 {
+	f, err := os.Open(filepath.Join(p.dir, "status"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	kvs := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g., VmRSS:	   10836 kB
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fields := strings.Fields(kv[1])
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) == 2 && fields[1] == "kB" {
+			v *= 1024
+		}
+		kvs[kv[0]] = v
+	}
+	return kvs
+}
+
+// openFDs returns the number of open file descriptors
+func (p *process) openFDs() (int64, bool) {
+	f, err := os.Open(filepath.Join(p.dir, "fd"))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, false
+	}
+	n := int64(len(names))
+	// the directory opened above is one of the file descriptors of the
+	// current process
+	if p.dir == procSelf && n > 0 {
+		n--
+	}
+	return n, true
+}
+
+// counters reads the cumulative counters of the process. It also returns the
+// status file as a map and whether the stat file is read successfully.
+func (p *process) counters() (processCounters, map[string]int64, bool) {
+	var c processCounters
+	utime, stime, statOK := p.stat()
+	c.utime, c.stime = utime, stime
+	status := p.status()
+	c.voluntaryCtx = status["voluntary_ctxt_switches"]
+	c.involuntaryCtx = status["nonvoluntary_ctxt_switches"]
+	return c, status, statOK
+}
+
+// addMetrics reports the process metrics
+// e		the emitter to report the metrics to
+func (p *process) addMetrics(e *metricsEmitter) {
+	curr, status, statOK := p.counters()
+
+	p.lock.Lock()
+	last := p.last
+	p.last = curr
+	p.lock.Unlock()
+
+	if statOK {
+		e.addValue("ProcessCPUUserTime",
+			float64(counterDelta(curr.utime, last.utime))/clockTicksPerSec)
+		e.addValue("ProcessCPUSystemTime",
+			float64(counterDelta(curr.stime, last.stime))/clockTicksPerSec)
+	}
+
+	if status != nil {
+		e.addValue("ProcessRSS", status["VmRSS"])
+		e.addValue("ProcessThreads", status["Threads"])
+		e.addValue("ProcessVoluntaryCtxSwitches",
+			counterDelta(curr.voluntaryCtx, last.voluntaryCtx))
+		e.addValue("ProcessInvoluntaryCtxSwitches",
+			counterDelta(curr.involuntaryCtx, last.involuntaryCtx))
+	}
+
+	if fds, ok := p.openFDs(); ok {
+		e.addValue("ProcessOpenFDs", fds)
+	}
+	var rlim syscall.Rlimit
+	// the limit is not reported if it's unlimited (RLIM_INFINITY)
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err == nil &&
+		rlim.Cur != rlimInfinity {
+		e.addValue("ProcessMaxFDs", int64(rlim.Cur))
+	}
+}
+
+// addProcessMetrics reports the metrics of the current process.
+func addProcessMetrics(e *metricsEmitter) {
+	selfProcess.addMetrics(e)
+}
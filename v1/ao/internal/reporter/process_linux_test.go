@@ -0,0 +1,78 @@
+// +build linux
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMetrics(t *testing.T) {
+	p := newProcess("testdata/proc")
+	assert.Equal(t, processCounters{250, 75, 150, 12}, p.last)
+
+	utime, stime, ok := p.stat()
+	assert.True(t, ok)
+	assert.Equal(t, int64(250), utime)
+	assert.Equal(t, int64(75), stime)
+
+	// the first cycle doesn't report the lifetime counters
+	m := emittedValues(p.addMetrics)
+	assert.Equal(t, float64(0), m["ProcessCPUUserTime"])
+	assert.Equal(t, float64(0), m["ProcessCPUSystemTime"])
+	assert.Equal(t, int64(0), m["ProcessVoluntaryCtxSwitches"])
+	assert.Equal(t, int64(0), m["ProcessInvoluntaryCtxSwitches"])
+	assert.Equal(t, int64(10800*1024), m["ProcessRSS"])
+	assert.Equal(t, int64(8), m["ProcessThreads"])
+	assert.Equal(t, int64(4), m["ProcessOpenFDs"])
+
+	// the counters are reported as deltas
+	p.last = processCounters{50, 25, 100, 10}
+	m = emittedValues(p.addMetrics)
+	assert.Equal(t, 2.0, m["ProcessCPUUserTime"])
+	assert.Equal(t, 0.5, m["ProcessCPUSystemTime"])
+	assert.Equal(t, int64(50), m["ProcessVoluntaryCtxSwitches"])
+	assert.Equal(t, int64(2), m["ProcessInvoluntaryCtxSwitches"])
+	assert.Equal(t, int64(10800*1024), m["ProcessRSS"])
+}
+
+func TestProcessMetricsSelf(t *testing.T) {
+	m := emittedValues(newProcess(procSelf).addMetrics)
+	assert.Contains(t, m, "ProcessCPUUserTime")
+	assert.True(t, m["ProcessRSS"].(int64) > 0)
+	assert.True(t, m["ProcessThreads"].(int64) > 0)
+	assert.True(t, m["ProcessOpenFDs"].(int64) > 0)
+
+	var rlim syscall.Rlimit
+	assert.Nil(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim))
+	if rlim.Cur == rlimInfinity {
+		assert.NotContains(t, m, "ProcessMaxFDs")
+	} else {
+		assert.Equal(t, int64(rlim.Cur), m["ProcessMaxFDs"])
+	}
+}
+
+func TestProcessOpenFDsSelf(t *testing.T) {
+	// count the valid file descriptors of the current process
+	var expected int64
+	var st syscall.Stat_t
+	for fd := 0; fd < 1024; fd++ {
+		if syscall.Fstat(fd, &st) == nil {
+			expected++
+		}
+	}
+	fds, ok := newProcess(procSelf).openFDs()
+	assert.True(t, ok)
+	assert.Equal(t, expected, fds)
+}
+
+func TestProcessMetricsNotAvailable(t *testing.T) {
+	m := emittedValues((&process{dir: "testdata/nonexistent"}).addMetrics)
+	assert.NotContains(t, m, "ProcessCPUUserTime")
+	assert.NotContains(t, m, "ProcessRSS")
+	assert.NotContains(t, m, "ProcessOpenFDs")
+}
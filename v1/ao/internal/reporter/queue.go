@@ -0,0 +1,112 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// the policies to handle a full message queue
+const (
+	// the new message is discarded
+	overflowDropNewest = "drop-newest"
+	// the oldest message in the queue is discarded to make room for the new one
+	overflowDropOldest = "drop-oldest"
+	// wait for the queue to have room until timeout, then drop the new message
+	overflowBlockWithTimeout = "block-with-timeout"
+)
+
+const (
+	// the default capacity of the event queue
+	eventQueueSizeDefault = 10000
+	// the default time to wait for room in a full queue
+	queueBlockTimeoutDefault = 100 * time.Millisecond
+)
+
+var (
+	errEventQueueFull  = errors.New("event message queue is full")
+	errStatusQueueFull = errors.New("status message queue is full")
+)
+
+// messageQueue is a channel of messages with a policy to handle overflow.
+type messageQueue struct {
+	c       chan []byte
+	policy  string
+	timeout time.Duration
+	stats   *eventQueueStats
+}
+
+// newMessageQueue creates a queue with the capacity and overflow policy. The
+// decisions made on overflow are counted in the queue stats, or not counted
+// at all if it's nil.
+func newMessageQueue(size int, policy string, timeout time.Duration,
+	stats *eventQueueStats) *messageQueue {
+	switch policy {
+	case overflowDropOldest, overflowBlockWithTimeout:
+	default:
+		policy = overflowDropNewest
+	}
+	return &messageQueue{
+		c:       make(chan []byte, size),
+		policy:  policy,
+		timeout: timeout,
+		stats:   stats,
+	}
+}
+
+// push puts the message into the queue and returns whether it's accepted. It
+// also returns the messages dropped due to overflow, which may be the message
+// itself or the oldest ones in the queue depending on the policy, or nil if
+// nothing is dropped. More than one message may be dropped if the room made
+// for the message is taken by the concurrent pushes. The done channel
+// interrupts a blocking push.
+func (q *messageQueue) push(msg []byte, done <-chan struct{}) (ok bool, dropped [][]byte) {
+	select {
+	case q.c <- msg:
+		return true, nil
+	default:
+	}
+
+	switch q.policy {
+	case overflowDropOldest:
+		for {
+			select {
+			case oldest := <-q.c:
+				dropped = append(dropped, oldest)
+				if q.stats != nil {
+					atomic.AddInt64(&q.stats.numDroppedOldest, 1)
+					atomic.AddInt64(&q.stats.numOverflowed, 1)
+				}
+			default:
+			}
+			select {
+			case q.c <- msg:
+				return true, dropped
+			default:
+				// someone else filled the room, try again
+			}
+		}
+	case overflowBlockWithTimeout:
+		if q.stats != nil {
+			atomic.AddInt64(&q.stats.numBlocked, 1)
+		}
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		select {
+		case q.c <- msg:
+			return true, nil
+		case <-timer.C:
+			if q.stats != nil {
+				atomic.AddInt64(&q.stats.numBlockTimeout, 1)
+			}
+		case <-done:
+		}
+	}
+	if q.stats != nil {
+		atomic.AddInt64(&q.stats.numOverflowed, 1)
+	}
+	return false, [][]byte{msg}
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageQueueDropNewest(t *testing.T) {
+	stats := &eventQueueStats{}
+	q := newMessageQueue(2, "invalid", 0, stats)
+	assert.Equal(t, overflowDropNewest, q.policy)
+
+	for _, m := range []string{"a", "b"} {
+		ok, dropped := q.push([]byte(m), nil)
+		assert.True(t, ok)
+		assert.Nil(t, dropped)
+	}
+	ok, dropped := q.push([]byte("c"), nil)
+	assert.False(t, ok)
+	assert.Equal(t, batchOf("c"), dropped)
+	assert.Equal(t, []byte("a"), <-q.c)
+	assert.Equal(t, []byte("b"), <-q.c)
+	assert.Equal(t, eventQueueStats{numOverflowed: 1}, stats.copyAndReset())
+}
+
+func TestMessageQueueDropOldest(t *testing.T) {
+	stats := &eventQueueStats{}
+	q := newMessageQueue(2, overflowDropOldest, 0, stats)
+
+	q.push([]byte("a"), nil)
+	q.push([]byte("b"), nil)
+	ok, dropped := q.push([]byte("c"), nil)
+	assert.True(t, ok)
+	assert.Equal(t, batchOf("a"), dropped)
+	assert.Equal(t, []byte("b"), <-q.c)
+	assert.Equal(t, []byte("c"), <-q.c)
+	assert.Equal(t, eventQueueStats{numOverflowed: 1, numDroppedOldest: 1}, stats.copyAndReset())
+}
+
+func TestMessageQueueDropOldestConcurrently(t *testing.T) {
+	stats := &eventQueueStats{}
+	q := newMessageQueue(1, overflowDropOldest, 0, stats)
+	// the producers are preempted in the middle of a push more likely
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	// a consumer races the producers for the room of the full queue
+	var consumed [][]byte
+	stop := make(chan struct{})
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		for {
+			select {
+			case msg := <-q.c:
+				consumed = append(consumed, msg)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	const producers, pushes = 16, 2000
+	var lock sync.Mutex
+	var dropped [][]byte
+	var wg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < pushes; j++ {
+				ok, d := q.push([]byte(fmt.Sprintf("%d-%d", i, j)), nil)
+				assert.True(t, ok)
+				lock.Lock()
+				dropped = append(dropped, d...)
+				lock.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-consumerDone
+	close(q.c)
+	for msg := range q.c {
+		consumed = append(consumed, msg)
+	}
+
+	// every message is either consumed or dropped exactly once, and every
+	// dropped one is counted.
+	seen := make(map[string]int)
+	for _, msg := range append(consumed, dropped...) {
+		seen[string(msg)]++
+	}
+	assert.Len(t, seen, producers*pushes)
+	for msg, n := range seen {
+		assert.Equal(t, 1, n, msg)
+	}
+	assert.Equal(t, eventQueueStats{numOverflowed: int64(len(dropped)), numDroppedOldest: int64(len(dropped))},
+		stats.copyAndReset())
+}
+
+func TestMessageQueueBlockWithTimeout(t *testing.T) {
+	stats := &eventQueueStats{}
+	q := newMessageQueue(1, overflowBlockWithTimeout, 20*time.Millisecond, stats)
+
+	q.push([]byte("a"), nil)
+	// timed out
+	start := time.Now()
+	ok, dropped := q.push([]byte("b"), nil)
+	assert.False(t, ok)
+	assert.Equal(t, batchOf("b"), dropped)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	assert.Equal(t, eventQueueStats{numOverflowed: 1, numBlocked: 1, numBlockTimeout: 1},
+		stats.copyAndReset())
+
+	// the queue has room before timeout
+	q.timeout = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-q.c
+	}()
+	ok, dropped = q.push([]byte("c"), nil)
+	assert.True(t, ok)
+	assert.Nil(t, dropped)
+	assert.Equal(t, []byte("c"), <-q.c)
+	assert.Equal(t, eventQueueStats{numBlocked: 1}, stats.copyAndReset())
+
+	// interrupted by the reporter shutdown
+	q.push([]byte("d"), nil)
+	done := make(chan struct{})
+	close(done)
+	ok, _ = q.push([]byte("e"), done)
+	assert.False(t, ok)
+	assert.Equal(t, eventQueueStats{numOverflowed: 1, numBlocked: 1}, stats.copyAndReset())
+}
+
+func TestMessageQueueNotCounted(t *testing.T) {
+	q := newMessageQueue(1, overflowBlockWithTimeout, time.Millisecond, nil)
+	ok, _ := q.push([]byte("a"), nil)
+	assert.True(t, ok)
+	ok, dropped := q.push([]byte("b"), nil)
+	assert.False(t, ok)
+	assert.Equal(t, batchOf("b"), dropped)
+
+	q = newMessageQueue(1, overflowDropOldest, 0, nil)
+	q.push([]byte("a"), nil)
+	ok, dropped = q.push([]byte("b"), nil)
+	assert.True(t, ok)
+	assert.Equal(t, batchOf("a"), dropped)
+}
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
@@ -41,10 +43,45 @@ const (
 	kvMetricsFlushInterval = "MetricsFlushInterval"
 	kvEventsFlushInterval  = "EventsFlushInterval"
 	kvMaxTransactions      = "MaxTransactions"
+
+	kvTriggerRelaxedBucketCapacity = "TriggerRelaxedBucketCapacity"
+	kvTriggerRelaxedBucketRate     = "TriggerRelaxedBucketRate"
+	kvTriggerStrictBucketCapacity  = "TriggerStrictBucketCapacity"
+	kvTriggerStrictBucketRate      = "TriggerStrictBucketRate"
 )
 
-// currently used reporter
-var globalReporter reporter = &nullReporter{}
+// currently used reporter, which is replaced by Start. It holds a
+// reporterHolder as atomic.Value requires the same concrete type for all the
+// stored values. It's loaded on the hot path of every event, so it's lock-free
+// to read. Use getGlobalReporter and storeGlobalReporter to access it.
+var globalReporter = func() *atomic.Value {
+	v := &atomic.Value{}
+	v.Store(reporterHolder{&nullReporter{}})
+	return v
+}()
+
+// reporterHolder wraps a reporter to be stored in globalReporter.
+type reporterHolder struct {
+	reporter
+}
+
+// serializes the replacements of the global reporter
+var globalReporterLock sync.Mutex
+
+// getGlobalReporter returns the currently used reporter.
+func getGlobalReporter() reporter {
+	return globalReporter.Load().(reporterHolder).reporter
+}
+
+// storeGlobalReporter replaces the currently used reporter and returns the
+// previous one.
+func storeGlobalReporter(r reporter) reporter {
+	globalReporterLock.Lock()
+	defer globalReporterLock.Unlock()
+	old := getGlobalReporter()
+	globalReporter.Store(reporterHolder{r})
+	return old
+}
 
 var (
 	periodicTasksDisabled = false // disable periodic tasks, for testing
@@ -64,10 +101,35 @@ func (r *nullReporter) WaitForReady(ctx context.Context) bool         { return t
 
 // init() is called only once on program startup. Here we create the reporter
 // that will be used throughout the runtime of the app. Default is 'ssl' but
-// can be overridden via APPOPTICS_REPORTER
+// can be overridden via APPOPTICS_REPORTER. The reporter is not created if
+// APPOPTICS_NO_AUTO_INIT is set, it's up to the caller to Start it.
 func init() {
+	if config.GetNoAutoInit() {
+		log.Info("The automatic initialization of the reporter is disabled.")
+		return
+	}
+	Start()
+}
+
+// guards the (re)start of the global reporter
+var startLock sync.Mutex
+
+// Start creates the global reporter from the current configuration and sends
+// the init message. The previous reporter, if any, is shut down first, so it
+// can be called to restart the reporter after Shutdown or to apply a new
+// configuration.
+func Start() error {
+	startLock.Lock()
+	defer startLock.Unlock()
+
+	// apply the configuration which may have been changed since the last start
+	configListener(globalSettingsCfg, globalHTTPMetrics)([]string{"TracingMode", "Precision"})
 	initReporter()
 	sendInitMessage()
+	if _, ok := getGlobalReporter().(*nullReporter); ok && !config.GetDisabled() {
+		return ErrReporterInitFailed
+	}
+	return nil
 }
 
 func initReporter() {
@@ -81,38 +143,38 @@ func initReporter() {
 
 func setGlobalReporter(reporterType string) {
 	// Close the previous reporter
-	if globalReporter != nil {
-		globalReporter.ShutdownNow()
+	if r := getGlobalReporter(); r != nil {
+		r.ShutdownNow()
 	}
 
+	var r reporter
 	switch strings.ToLower(reporterType) {
 	case "ssl":
 		fallthrough // using fallthrough since the SSL reporter (gRPC) is our default reporter
 	default:
-		globalReporter = newGRPCReporter()
+		r = newGRPCReporter()
 	case "udp":
-		globalReporter = udpNewReporter()
+		r = udpNewReporter()
 	case "none":
-		globalReporter = newNullReporter()
+		r = newNullReporter()
 	}
+	storeGlobalReporter(r)
 }
 
 // WaitForReady waits until the reporter becomes ready or the context is canceled.
 func WaitForReady(ctx context.Context) bool {
-	// globalReporter is not protected by a mutex as currently it's only modified
-	// from the init() function.
-	return globalReporter.WaitForReady(ctx)
+	return getGlobalReporter().WaitForReady(ctx)
 }
 
 // Shutdown flushes the metrics and stops the reporter. It blocked until the reporter
 // is shutdown or the context is canceled.
 func Shutdown(ctx context.Context) error {
-	return globalReporter.Shutdown(ctx)
+	return getGlobalReporter().Shutdown(ctx)
 }
 
 // Closed indicates if the reporter has been shutdown
 func Closed() bool {
-	return globalReporter.Closed()
+	return getGlobalReporter().Closed()
 }
 
 // ReportSpan is called from the app when a span message is available
@@ -120,7 +182,7 @@ func Closed() bool {
 //
 // returns	error if channel is full
 func ReportSpan(span SpanMessage) error {
-	return globalReporter.reportSpan(span)
+	return getGlobalReporter().reportSpan(span)
 }
 
 // check if context and event are valid, add general keys like Timestamp, or hostname
@@ -158,7 +220,7 @@ func prepareEvent(ctx *oboeContext, e *event) error {
 
 // Determines if request should be traced, based on sample rate settings.
 func shouldTraceRequest(layer string, traced bool) (bool, int, sampleSource) {
-	return oboeSampleRequest(layer, traced)
+	return oboeSampleRequest(layer, traced, nil)
 }
 
 func argsToMap(capacity, ratePerSec float64, metricsFlushInterval, maxTransactions int) map[string][]byte {
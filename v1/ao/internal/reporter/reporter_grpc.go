@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"io/ioutil"
 	"math"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -93,6 +94,7 @@ type grpcConnection struct {
 	pingTickerLock sync.Mutex                     // lock to ensure sequential access of pingTicker
 	lock           sync.RWMutex                   // lock to ensure sequential access (in case of connection loss)
 	queueStats     *eventQueueStats               // queue stats (reset on each metrics report cycle)
+	compressor     string                         // the name of the gRPC compressor, empty for no compression
 	// for testing only: if true, skip verifying TLS cert hostname
 	insecureSkipVerify bool
 	// atomicActive indicates if the underlying connection is active. It should
@@ -107,6 +109,12 @@ type grpcConnection struct {
 	// This channel is closed after flushing the metrics.
 	flushed     chan struct{}
 	flushedOnce sync.Once
+
+	// the last error and success of the RPC calls, for diagnostics only
+	rpcStatusLock sync.Mutex
+	lastErr       error
+	lastErrTime   time.Time
+	lastSuccess   time.Time
 }
 
 // GrpcConnOpt defines the function type that sets an option of the grpcConnection
@@ -133,6 +141,13 @@ func WithDialer(d Dialer) GrpcConnOpt {
 	}
 }
 
+// WithCompressor returns a function that sets the compressor of the messages
+func WithCompressor(name string) GrpcConnOpt {
+	return func(c *grpcConnection) {
+		c.compressor = name
+	}
+}
+
 // WithBackoff return a function that sets the backoff option
 func WithBackoff(b Backoff) GrpcConnOpt {
 	return func(c *grpcConnection) {
@@ -186,9 +201,13 @@ type grpcReporter struct {
 
 	serviceKey string // service key
 
-	eventMessages  chan []byte      // channel for event messages (sent from agent)
+	// the sampling settings and HTTP metrics of the agent which owns this reporter
+	settings    *oboeSettingsCfg
+	httpMetrics *httpMetrics
+
+	eventMessages  *messageQueue    // queue for event messages (sent from agent)
 	spanMessages   chan SpanMessage // channel for span messages (sent from agent)
-	statusMessages chan []byte      // channel for status messages (sent from agent)
+	statusMessages *messageQueue    // queue for status messages (sent from agent)
 
 	// The reporter is considered ready if there is a valid default setting for sampling.
 	// It should be accessed atomically.
@@ -205,6 +224,14 @@ type grpcReporter struct {
 	// The flag to indicate gracefully stopping the reporter. It should be accessed atomically.
 	// A (default) zero value means shutdown abruptly.
 	gracefully int32
+
+	// the on-disk spool of the overflowed and failed event batches, nil if
+	// spooling is disabled.
+	spool *spool
+	// the overflowed events to be written into the spool by spoolWriter()
+	spoolEvents chan []byte
+	// the interval to replay the spooled batches if there are no new ones
+	spoolReplayInterval time.Duration
 }
 
 // gRPC reporter errors
@@ -232,8 +259,14 @@ const (
 //
 // returns	GRPC reporter object
 func newGRPCReporter() reporter {
+	return newAgentGRPCReporter(config.GetServiceKey(), "", globalSettingsCfg, globalHTTPMetrics)
+}
+
+// newAgentGRPCReporter initializes a GRPC reporter with the service key, the
+// sampling settings and HTTP metrics of an agent. The events are spooled into
+// the subdirectory of the spool directory if it's not empty.
+func newAgentGRPCReporter(serviceKey, spoolSubdir string, settings *oboeSettingsCfg, hm *httpMetrics) reporter {
 	// service key is required, so bail out if not found
-	serviceKey := config.GetServiceKey()
 	log.Warningf("Using converted service key: \"%s\"", config.MaskServiceKey(serviceKey))
 
 	if !config.IsValidServiceKey(serviceKey) {
@@ -257,6 +290,9 @@ func newGRPCReporter() reporter {
 	}
 
 	opts = append(opts, WithSkipVerify(config.GetSkipVerify()))
+	if c := config.GetCompression(); c != compressionNone {
+		opts = append(opts, WithCompressor(c))
+	}
 
 	// create connection object for events client and metrics client
 	eventConn, err1 := newGrpcConnection("events channel", addr, opts...)
@@ -271,6 +307,16 @@ func newGRPCReporter() reporter {
 		return &nullReporter{}
 	}
 
+	queueSize := config.GetEventQueueSize()
+	if queueSize <= 0 {
+		queueSize = eventQueueSizeDefault
+	}
+	policy := config.GetOverflowPolicy()
+	timeout := time.Duration(config.GetQueueBlockTimeout()) * time.Millisecond
+	if timeout <= 0 {
+		timeout = queueBlockTimeoutDefault
+	}
+
 	// construct the reporter object which handles two connections
 	r := &grpcReporter{
 		eventConnection:  eventConn,
@@ -280,16 +326,30 @@ func newGRPCReporter() reporter {
 		getSettingsInterval:          grpcGetSettingsIntervalDefault,
 		settingsTimeoutCheckInterval: grpcSettingsTimeoutCheckIntervalDefault,
 
-		serviceKey: serviceKey,
+		serviceKey:  serviceKey,
+		settings:    settings,
+		httpMetrics: hm,
 
-		eventMessages:  make(chan []byte, 10000),
+		eventMessages:  newMessageQueue(queueSize, policy, timeout, eventConn.queueStats),
 		spanMessages:   make(chan SpanMessage, 10000),
-		statusMessages: make(chan []byte, 100),
+		// the status messages are not counted in the event queue stats
+		statusMessages: newMessageQueue(100, policy, timeout, nil),
 
 		cond: sync.NewCond(&sync.Mutex{}),
 		done: make(chan struct{}),
 	}
 
+	if dir := config.GetSpoolDir(); dir != "" {
+		sp, err := newSpool(filepath.Join(dir, spoolSubdir), config.GetSpoolMaxSize()*1024*1024)
+		if err != nil {
+			log.Errorf("Event spooling is disabled: %v", err)
+		} else {
+			r.spool = sp
+			r.spoolEvents = make(chan []byte, spoolEventsQueueSize)
+			r.spoolReplayInterval = spoolReplayInterval
+		}
+	}
+
 	r.start()
 
 	log.Warningf("AppOptics reporter v%s is initialized. id: %v Go version: %s.",
@@ -316,6 +376,12 @@ func (r *grpcReporter) start() {
 	// and reports incoming events to the collector using GRPC
 	go r.eventSender()
 
+	// start up long-running goroutine spoolWriter() which writes the overflowed
+	// events into the spool
+	if r.spool != nil {
+		go r.spoolWriter()
+	}
+
 	// start up long-running goroutine statusSender() which listens on the status message channel
 	// and reports incoming events to the collector using GRPC
 	go r.statusSender()
@@ -634,16 +700,89 @@ func (r *grpcReporter) reportEvent(ctx *oboeContext, e *event) error {
 		return err
 	}
 
-	select {
-	case r.eventMessages <- (*e).bbuf.GetBuf():
-		atomic.AddInt64(&r.eventConnection.queueStats.totalEvents, int64(1))
-		return nil
-	default:
-		atomic.AddInt64(&r.eventConnection.queueStats.numOverflowed, int64(1))
-		return errors.New("event message queue is full")
+	ok, dropped := r.eventMessages.push((*e).bbuf.GetBuf(), r.done)
+	for _, msg := range dropped {
+		// the disk I/O is done by spoolWriter(), the event is discarded
+		// if it falls behind.
+		select {
+		case r.spoolEvents <- msg:
+		default:
+		}
+	}
+	if !ok {
+		return errEventQueueFull
+	}
+	atomic.AddInt64(&r.eventConnection.queueStats.totalEvents, int64(1))
+	return nil
+}
+
+// spoolWriter is a long-running goroutine which writes the events dropped from
+// the full event queue into the spool, so reportEvent is not blocked by the
+// disk I/O.
+func (r *grpcReporter) spoolWriter() {
+	for {
+		select {
+		case msg := <-r.spoolEvents:
+			r.spool.add(msg)
+		case <-r.done:
+			// the remaining ones are written by eventBatchSender() before
+			// the spool is closed.
+			return
+		}
 	}
 }
 
+// drainSpoolEvents writes the overflowed events which are still in the
+// channel into the spool.
+func (r *grpcReporter) drainSpoolEvents() {
+	for {
+		select {
+		case msg := <-r.spoolEvents:
+			r.spool.add(msg)
+		default:
+			return
+		}
+	}
+}
+
+// noRetryMethod is a method which is invoked only once, the failure is
+// returned as errNoRetryOnErr instead of being retried.
+type noRetryMethod struct {
+	Method
+}
+
+func (m noRetryMethod) RetryOnErr() bool { return false }
+
+// replaySpool sends the spooled batches in order. Each of them is sent only
+// once without retries, so it doesn't hold the caller for the whole retry
+// window while the collector is unreachable: the first batch serves as a probe
+// of the collector, and at most spoolReplayBatches attempts are made in a call.
+// It stops at the first failure and the batch is left in the spool to be
+// retried next time. It returns true only if the spool is empty, so a new
+// batch can be sent without overtaking the spooled ones, and false if the
+// collector is not reachable or there are batches left to be replayed.
+func (r *grpcReporter) replaySpool() bool {
+	for i := 0; i < spoolReplayBatches; i++ {
+		messages := r.spool.peek()
+		if len(messages) == 0 {
+			return true
+		}
+		method := noRetryMethod{newPostEventsMethod(r.serviceKey, messages)}
+		switch err := r.eventConnection.InvokeRPC(r.done, method); err {
+		case nil:
+			log.Infof("Replayed %d spooled events.", len(messages))
+			r.spool.advance()
+		case errInvalidServiceKey:
+			r.ShutdownNow()
+			return false
+		default:
+			log.Debugf("replaySpool: %s", err)
+			return false
+		}
+	}
+	return len(r.spool.peek()) == 0
+}
+
 // eventSender is a long-running goroutine that listens on the events message
 // channel, collects all messages on that channel and attempts to send them to
 // the collector using the gRPC method PostEvents()
@@ -659,7 +798,7 @@ func (r *grpcReporter) eventSender() {
 
 	// This event bucket is drainable either after it reaches HWM, or the flush
 	// interval has passed.
-	evtBucket := NewBytesBucket(r.eventMessages,
+	evtBucket := NewBytesBucket(r.eventMessages.c,
 		WithHWM(int(opts.GetEventBatchSize()*1024)),
 		WithIntervalGetter(opts.GetEventFlushInterval))
 
@@ -707,14 +846,26 @@ func (r *grpcReporter) eventSender() {
 
 func (r *grpcReporter) eventBatchSender(batches <-chan [][]byte) {
 	defer func() {
+		r.drainSpoolEvents()
+		r.spool.close()
 		r.eventConnection.setFlushed()
 		log.Info("eventBatchSender goroutine exiting.")
 	}()
 
+	// the spooled batches are replayed periodically if there are no new
+	// batches to trigger it.
+	var replay <-chan time.Time
+	if r.spool != nil && r.spoolReplayInterval > 0 {
+		ticker := time.NewTicker(r.spoolReplayInterval)
+		defer ticker.Stop()
+		replay = ticker.C
+	}
+
 	var closing bool
 	var messages [][]byte
 
 	for {
+		messages = nil
 		// this will block until a message arrives or the reporter is closed
 		select {
 		case b := <-batches:
@@ -723,17 +874,36 @@ func (r *grpcReporter) eventBatchSender(batches <-chan [][]byte) {
 			if len(messages) == 0 {
 				batches = nil
 			}
+		case <-replay:
+			r.replaySpool()
+			continue
 		case <-r.done:
 			select {
 			case messages = <-batches:
 			default:
 			}
 			if !r.isGracefully() {
+				// the batch is not sent but kept for the next run
+				if len(messages) != 0 && r.spool != nil {
+					if err := r.spool.put(messages); err != nil {
+						log.Warningf("Failed to spool %d events: %v", len(messages), err)
+					}
+				}
 				return
 			}
 			closing = true
 		}
 
+		// the spooled batches are older, so they are sent before the new
+		// one, which is spooled behind them if the collector is still
+		// unreachable or they are not all replayed yet.
+		if len(messages) != 0 && !r.replaySpool() {
+			if err := r.spool.put(messages); err != nil {
+				log.Warningf("Failed to spool %d events: %v", len(messages), err)
+			}
+			messages = nil
+		}
+
 		if len(messages) != 0 {
 			method := newPostEventsMethod(r.serviceKey, messages)
 			err := r.eventConnection.InvokeRPC(r.done, method)
@@ -745,6 +915,11 @@ func (r *grpcReporter) eventBatchSender(batches <-chan [][]byte) {
 				log.Info(method.CallSummary())
 			default:
 				log.Warningf("eventBatchSender: %s", err)
+				if err != errNoRetryOnErr {
+					if err := r.spool.put(messages); err != nil {
+						log.Warningf("Failed to spool %d events: %v", len(messages), err)
+					}
+				}
 			}
 		}
 
@@ -772,8 +947,13 @@ func (r *grpcReporter) collectMetrics(collectReady chan bool) {
 	defer func() { collectReady <- true }()
 
 	i := int(atomic.LoadInt32(&r.collectMetricInterval))
+	// the metrics and status messages are sent through the metrics connection
+	r.eventConnection.queueStats.addBytesFrom(r.metricConnection.queueStats)
 	// generate a new metrics message
-	message := generateMetricsMessage(i, r.eventConnection.queueStats)
+	// the process-wide metrics are reported by the default agent only, which
+	// uses the global settings.
+	message := generateAgentMetricsMessage(i, r.eventConnection.queueStats, r.settings, r.httpMetrics,
+		r.settings == globalSettingsCfg)
 	r.sendMetrics(message)
 }
 
@@ -825,7 +1005,7 @@ func (r *grpcReporter) getSettings(ready chan bool) {
 func (r *grpcReporter) updateSettings(settings *collector.SettingsResult) {
 	for _, s := range settings.GetSettings() {
 		log.Debugf("Got sampling setting: %#v\n", s)
-		updateSetting(int32(s.Type), string(s.Layer), s.Flags, s.Value, s.Ttl, s.Arguments)
+		r.settings.updateSetting(int32(s.Type), string(s.Layer), s.Flags, s.Value, s.Ttl, s.Arguments)
 
 		// update MetricsFlushInterval
 		mi := parseInt32(s.Arguments, kvMetricsFlushInterval, r.collectMetricInterval)
@@ -837,11 +1017,11 @@ func (r *grpcReporter) updateSettings(settings *collector.SettingsResult) {
 		o.SetEventFlushInterval(int64(ei))
 
 		// update MaxTransactions
-		mt := parseInt32(s.Arguments, kvMaxTransactions, mTransMap.Cap())
-		mTransMap.SetCap(mt)
+		mt := parseInt32(s.Arguments, kvMaxTransactions, r.httpMetrics.transMap.Cap())
+		r.httpMetrics.transMap.SetCap(mt)
 	}
 
-	if !r.isReady() && hasDefaultSetting() {
+	if !r.isReady() && r.settings.hasDefaultSetting() {
 		r.cond.L.Lock()
 		r.setReady(true)
 		log.Warningf("AppOptics agent (%v) is ready.", r.done)
@@ -856,8 +1036,8 @@ func (r *grpcReporter) checkSettingsTimeout(ready chan bool) {
 	// notify caller that this routine has terminated (defered to end of routine)
 	defer func() { ready <- true }()
 
-	OboeCheckSettingsTimeout()
-	if r.isReady() && !hasDefaultSetting() {
+	r.settings.checkSettingsTimeout()
+	if r.isReady() && !r.settings.hasDefaultSetting() {
 		log.Warningf("Sampling setting expired. AppOptics agent (%v) is not working.", r.done)
 		r.setReady(false)
 	}
@@ -880,12 +1060,10 @@ func (r *grpcReporter) reportStatus(ctx *oboeContext, e *event) error {
 		return err
 	}
 
-	select {
-	case r.statusMessages <- (*e).bbuf.GetBuf():
-		return nil
-	default:
-		return errors.New("status message queue is full")
+	if ok, _ := r.statusMessages.push((*e).bbuf.GetBuf(), r.done); !ok {
+		return errStatusQueueFull
 	}
+	return nil
 }
 
 // long-running goroutine that listens on the status message channel, collects all messages
@@ -898,7 +1076,7 @@ func (r *grpcReporter) statusSender() {
 
 		select {
 		// this will block until a message arrives
-		case e := <-r.statusMessages:
+		case e := <-r.statusMessages.c:
 			messages = append(messages, e)
 		case <-r.done: // Exit if the reporter's done channel is closed.
 			return
@@ -907,7 +1085,7 @@ func (r *grpcReporter) statusSender() {
 		done := false
 		for !done {
 			select {
-			case e := <-r.statusMessages:
+			case e := <-r.statusMessages.c:
 				messages = append(messages, e)
 			default:
 				done = true
@@ -953,7 +1131,7 @@ func (r *grpcReporter) spanMessageAggregator() {
 	for {
 		select {
 		case span := <-r.spanMessages:
-			span.process()
+			span.process(r.httpMetrics)
 		case <-r.done:
 			return
 		}
@@ -1071,6 +1249,7 @@ func (c *grpcConnection) InvokeRPC(exit chan struct{}, m Method) error {
 		if err != nil {
 			// gRPC handles the reconnection automatically.
 			failsNum++
+			c.setLastError(errors.Wrap(err, m.String()))
 			if failsNum == grpcRetryLogThreshold {
 				log.Warningf("[%s] invocation error: %v.", m, err)
 			} else {
@@ -1083,9 +1262,14 @@ func (c *grpcConnection) InvokeRPC(exit chan struct{}, m Method) error {
 			failsNum = 0
 
 			// server responded, check the result code and perform actions accordingly
-			switch result, _ := m.ResultCode(); result {
+			result, _ := m.ResultCode()
+			if result != collector.ResultCode_OK {
+				c.setLastError(errors.Errorf("%s: %s", m, result))
+			}
+			switch result {
 			case collector.ResultCode_OK:
 				atomic.AddInt64(&c.queueStats.numSent, m.MessageLen())
+				c.setLastSuccess()
 				return nil
 
 			case collector.ResultCode_TRY_LATER:
@@ -1134,6 +1318,21 @@ func (c *grpcConnection) InvokeRPC(exit chan struct{}, m Method) error {
 	return errShouldNotHappen
 }
 
+// setLastError records the error of an RPC call.
+func (c *grpcConnection) setLastError(err error) {
+	c.rpcStatusLock.Lock()
+	defer c.rpcStatusLock.Unlock()
+	c.lastErr = err
+	c.lastErrTime = time.Now()
+}
+
+// setLastSuccess records the time of a successful RPC call.
+func (c *grpcConnection) setLastSuccess() {
+	c.rpcStatusLock.Lock()
+	defer c.rpcStatusLock.Unlock()
+	c.lastSuccess = time.Now()
+}
+
 func (c *grpcConnection) setFlushed() {
 	c.flushedOnce.Do(func() { close(c.flushed) })
 }
@@ -1219,7 +1418,13 @@ func (d *DefaultDialer) Dial(c grpcConnection) (*grpc.ClientConn, error) {
 	}
 	creds := credentials.NewTLS(tlsConfig)
 
-	return grpc.Dial(c.address, grpc.WithTransportCredentials(creds))
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if c.compressor != "" {
+		opts = append(opts,
+			grpc.WithDefaultCallOptions(grpc.UseCompressor(c.compressor)),
+			grpc.WithStatsHandler(&compressionStats{queueStats: c.queueStats}))
+	}
+	return grpc.Dial(c.address, opts...)
 }
 
 func printRPCMsg(m Method) {
@@ -3,14 +3,17 @@
 package reporter
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"path"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	pb "github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter/collector"
 	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/utils"
@@ -19,6 +22,7 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/stats"
 )
 
 var (
@@ -39,6 +43,8 @@ type TestGRPCServer struct {
 	metrics []*pb.MessageRequest
 	status  []*pb.MessageRequest
 	pings   int
+	// the compression algorithm of each RPC call received
+	compressions []string
 }
 
 func StartTestGRPCServer(t *testing.T, addr string) *TestGRPCServer {
@@ -51,9 +57,10 @@ func StartTestGRPCServer(t *testing.T, addr string) *TestGRPCServer {
 	assert.NotNil(t, creds)
 
 	// Create the gRPC server with the credentials
-	grpcServer := grpc.NewServer(grpc.Creds(creds))
+	testServer := &TestGRPCServer{t: t, addr: addr}
+	grpcServer := grpc.NewServer(grpc.Creds(creds), grpc.StatsHandler(testServer))
 	assert.NotNil(t, grpcServer)
-	testServer := &TestGRPCServer{t: t, grpcServer: grpcServer, addr: addr}
+	testServer.grpcServer = grpcServer
 	pb.RegisterTraceCollectorServer(grpcServer, testServer)
 	require.NoError(t, err)
 
@@ -78,6 +85,28 @@ func printSettingsRequest(req *pb.SettingsRequest) {
 
 func (s *TestGRPCServer) Stop() { s.grpcServer.Stop() }
 
+// TagRPC implements the gRPC stats handler
+func (s *TestGRPCServer) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC records the compression algorithm of the incoming RPC calls
+func (s *TestGRPCServer) HandleRPC(_ context.Context, rs stats.RPCStats) {
+	if h, ok := rs.(*stats.InHeader); ok {
+		s.mutex.Lock()
+		s.compressions = append(s.compressions, h.Compression)
+		s.mutex.Unlock()
+	}
+}
+
+// TagConn implements the gRPC stats handler
+func (s *TestGRPCServer) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn implements the gRPC stats handler
+func (s *TestGRPCServer) HandleConn(context.Context, stats.ConnStats) {}
+
 func (s *TestGRPCServer) PostEvents(ctx context.Context, req *pb.MessageRequest) (*pb.MessageResult, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -133,3 +162,62 @@ func (s *TestGRPCServer) Ping(ctx context.Context, req *pb.PingRequest) (*pb.Mes
 	s.pings++
 	return &pb.MessageResult{Result: pb.ResultCode_OK}, nil
 }
+
+func TestCompression(t *testing.T) {
+	addr := "localhost:4568"
+	server := StartTestGRPCServer(t, addr)
+	defer server.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	cert, err := ioutil.ReadFile(testCertFile)
+	require.NoError(t, err)
+	msgs := [][]byte{
+		bytes.Repeat([]byte("compressible event "), 500),
+		bytes.Repeat([]byte("another event "), 500),
+	}
+
+	for _, compressor := range []string{"", "gzip", "snappy"} {
+		c, err := newGrpcConnection("events channel", addr,
+			WithCert(cert), WithSkipVerify(true), WithCompressor(compressor),
+			WithBackoff(func(retries int, wait func(d time.Duration)) error {
+				if retries > 10 {
+					return errGiveUpAfterRetries
+				}
+				wait(100 * time.Millisecond)
+				return nil
+			}))
+		require.NoError(t, err)
+
+		server.mutex.Lock()
+		server.events = nil
+		server.compressions = nil
+		server.mutex.Unlock()
+
+		assert.NoError(t, c.InvokeRPC(make(chan struct{}), newPostEventsMethod("key", msgs)))
+
+		server.mutex.Lock()
+		require.Len(t, server.events, 1, compressor)
+		assert.Equal(t, msgs, server.events[0].Messages, compressor)
+		assert.Equal(t, []string{compressor}, server.compressions, compressor)
+		server.mutex.Unlock()
+
+		m := emittedValues(func(e *metricsEmitter) { addQueueStats(e, c.queueStats) })
+		if compressor == "" {
+			assert.NotContains(t, m, "CompressionBytesIn")
+		} else {
+			in, out := m["CompressionBytesIn"].(int64), m["CompressionBytesOut"].(int64)
+			assert.True(t, in > int64(len(msgs[0])+len(msgs[1])), compressor)
+			assert.True(t, out < in/10, compressor)
+			assert.Equal(t, in-out, m["CompressionBytesSaved"], compressor)
+		}
+		c.Close()
+	}
+}
+
+func TestAddBytesFrom(t *testing.T) {
+	q1 := &eventQueueStats{bytesUncompressed: 100, bytesCompressed: 10}
+	q2 := &eventQueueStats{bytesUncompressed: 50, bytesCompressed: 5, numSent: 1}
+	q1.addBytesFrom(q2)
+	assert.Equal(t, eventQueueStats{bytesUncompressed: 150, bytesCompressed: 15}, q1.copyAndReset())
+	assert.Equal(t, eventQueueStats{numSent: 1}, q2.copyAndReset())
+}
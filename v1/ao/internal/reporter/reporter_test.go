@@ -141,7 +141,7 @@ func TestNullReporter(t *testing.T) {
 // ========================= UDP Reporter =============================
 func startTestUDPListener(t *testing.T, bufs *[][]byte, numbufs int) chan struct{} {
 	done := make(chan struct{})
-	assert.IsType(t, &udpReporter{}, globalReporter)
+	assert.IsType(t, &udpReporter{}, getGlobalReporter())
 
 	addr, err := net.ResolveUDPAddr("udp4", os.Getenv("APPOPTICS_COLLECTOR_UDP"))
 	assert.NoError(t, err)
@@ -176,9 +176,9 @@ func assertUDPMode(t *testing.T) {
 
 func TestUDPReporter(t *testing.T) {
 	assertUDPMode(t)
-	assert.IsType(t, &udpReporter{}, globalReporter)
+	assert.IsType(t, &udpReporter{}, getGlobalReporter())
 
-	r := globalReporter.(*udpReporter)
+	r := getGlobalReporter().(*udpReporter)
 	ctx := newTestContext(t)
 	ev1, _ := ctx.newEvent(LabelInfo, testLayer)
 	ev2, _ := ctx.newEvent(LabelInfo, testLayer)
@@ -215,12 +215,12 @@ func TestGRPCReporter(t *testing.T) {
 	os.Setenv("APPOPTICS_COLLECTOR", addr)
 	os.Setenv("APPOPTICS_TRUSTEDPATH", testCertFile)
 	config.Refresh()
-	oldReporter := globalReporter
+	oldReporter := getGlobalReporter()
 	setGlobalReporter("ssl")
 
-	require.IsType(t, &grpcReporter{}, globalReporter)
+	require.IsType(t, &grpcReporter{}, getGlobalReporter())
 
-	r := globalReporter.(*grpcReporter)
+	r := getGlobalReporter().(*grpcReporter)
 
 	// Test WaitForReady
 	// The reporter is not ready when there is no default setting.
@@ -273,7 +273,7 @@ func TestGRPCReporter(t *testing.T) {
 
 	// stop test reporter
 	server.Stop()
-	globalReporter = oldReporter
+	storeGlobalReporter(oldReporter)
 
 	// assert data received
 	require.Len(t, server.events, 1)
@@ -309,13 +309,13 @@ func TestShutdownGRPCReporter(t *testing.T) {
 	os.Setenv("APPOPTICS_COLLECTOR", addr)
 	os.Setenv("APPOPTICS_TRUSTEDPATH", testCertFile)
 	config.Refresh()
-	oldReporter := globalReporter
+	oldReporter := getGlobalReporter()
 	// numGo := runtime.NumGoroutine()
 	setGlobalReporter("ssl")
 
-	require.IsType(t, &grpcReporter{}, globalReporter)
+	require.IsType(t, &grpcReporter{}, getGlobalReporter())
 
-	r := globalReporter.(*grpcReporter)
+	r := getGlobalReporter().(*grpcReporter)
 	r.ShutdownNow()
 
 	assert.Equal(t, true, r.Closed())
@@ -330,7 +330,7 @@ func TestShutdownGRPCReporter(t *testing.T) {
 
 	// stop test reporter
 	server.Stop()
-	globalReporter = oldReporter
+	storeGlobalReporter(oldReporter)
 	// fmt.Println(buf)
 }
 
@@ -361,13 +361,13 @@ func TestInvalidKey(t *testing.T) {
 
 	// set gRPC reporter
 	config.Refresh()
-	oldReporter := globalReporter
+	oldReporter := getGlobalReporter()
 
 	aolog.SetLevel(aolog.INFO)
 	setGlobalReporter("ssl")
-	require.IsType(t, &grpcReporter{}, globalReporter)
+	require.IsType(t, &grpcReporter{}, getGlobalReporter())
 
-	r := globalReporter.(*grpcReporter)
+	r := getGlobalReporter().(*grpcReporter)
 	ctx := newTestContext(t)
 	ev1, _ := ctx.newEvent(LabelInfo, "hello-from-invalid-key")
 	assert.NoError(t, r.reportEvent(ctx, ev1))
@@ -383,7 +383,7 @@ func TestInvalidKey(t *testing.T) {
 
 	// Tear down everything.
 	server.Stop()
-	globalReporter = oldReporter
+	storeGlobalReporter(oldReporter)
 	os.Setenv("APPOPTICS_SERVICE_KEY", oldKey)
 
 	patterns := []string{
@@ -560,7 +560,7 @@ func TestInitReporter(t *testing.T) {
 	os.Setenv("APPOPTICS_DISABLED", "true")
 	config.Refresh()
 	initReporter()
-	require.IsType(t, &nullReporter{}, globalReporter)
+	require.IsType(t, &nullReporter{}, getGlobalReporter())
 
 	// Test enable agent
 	os.Unsetenv("APPOPTICS_DISABLED")
@@ -569,5 +569,5 @@ func TestInitReporter(t *testing.T) {
 	assert.False(t, config.GetDisabled())
 
 	initReporter()
-	require.IsType(t, &grpcReporter{}, globalReporter)
+	require.IsType(t, &grpcReporter{}, getGlobalReporter())
 }
@@ -0,0 +1,276 @@
+// +build go1.16
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"math"
+	"runtime/metrics"
+	"sync"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/hdrhist"
+)
+
+// the runtime/metrics names used by the runtime collector. Not all of them are
+// supported by every Go version, the unsupported ones are simply skipped.
+const (
+	rmGoroutines      = "/sched/goroutines:goroutines"
+	rmGOMAXPROCS      = "/sched/gomaxprocs:threads"
+	rmMemTotal        = "/memory/classes/total:bytes"
+	rmHeapObjectBytes = "/memory/classes/heap/objects:bytes"
+	rmHeapUnused      = "/memory/classes/heap/unused:bytes"
+	rmHeapFree        = "/memory/classes/heap/free:bytes"
+	rmHeapReleased    = "/memory/classes/heap/released:bytes"
+	rmHeapObjects     = "/gc/heap/objects:objects"
+	rmHeapGoal        = "/gc/heap/goal:bytes"
+	rmAllocBytes      = "/gc/heap/allocs:bytes"
+	rmAllocObjects    = "/gc/heap/allocs:objects"
+	rmFreeObjects     = "/gc/heap/frees:objects"
+	rmTinyAllocs      = "/gc/heap/tiny/allocs:objects"
+	rmGCCycles        = "/gc/cycles/total:gc-cycles"
+	rmMutexWait       = "/sync/mutex/wait/total:seconds"
+
+	rmSchedLatencies = "/sched/latencies:seconds"
+	rmGCPauses       = "/sched/pauses/total/gc:seconds"
+	rmGCPausesLegacy = "/gc/pauses:seconds" // deprecated since Go 1.22
+)
+
+// runtimeHistogram maps a runtime/metrics histogram to the histogram reported
+// to the collector. The first supported metric in the list is used.
+type runtimeHistogram struct {
+	name    string
+	metrics []string
+}
+
+var runtimeHistograms = []runtimeHistogram{
+	{"Runtime.GC.PauseTime", []string{rmGCPauses, rmGCPausesLegacy}},
+	{"Runtime.Sched.Latency", []string{rmSchedLatencies}},
+}
+
+// runtimeCollector reads the Go runtime metrics through runtime/metrics, which
+// doesn't stop the world as runtime.ReadMemStats does. The cumulative counters
+// and histograms are reported as deltas between two metrics cycles.
+type runtimeCollector struct {
+	samples []metrics.Sample
+	// the index of each metric in samples
+	index map[string]int
+	// the histograms to be reported, with the runtime metric name resolved
+	hists map[string]string
+
+	// the values of the last metrics cycle, protected by the lock
+	lastCounters map[string]int64
+	lastHists    map[string][]uint64
+	lock         sync.Mutex
+}
+
+// the runtime collector of the current process
+var runtimeMetrics = newRuntimeCollector()
+
+func newRuntimeCollector() *runtimeCollector {
+	supported := make(map[string]bool)
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+
+	rc := &runtimeCollector{
+		index:        make(map[string]int),
+		hists:        make(map[string]string),
+		lastCounters: make(map[string]int64),
+		lastHists:    make(map[string][]uint64),
+	}
+	add := func(name string) {
+		if _, ok := rc.index[name]; ok || !supported[name] {
+			return
+		}
+		rc.index[name] = len(rc.samples)
+		rc.samples = append(rc.samples, metrics.Sample{Name: name})
+	}
+
+	for _, name := range []string{rmGoroutines, rmGOMAXPROCS, rmMemTotal,
+		rmHeapObjectBytes, rmHeapUnused, rmHeapFree, rmHeapReleased,
+		rmHeapObjects, rmHeapGoal, rmAllocBytes, rmAllocObjects, rmFreeObjects,
+		rmTinyAllocs, rmGCCycles, rmMutexWait} {
+		add(name)
+	}
+	for _, h := range runtimeHistograms {
+		for _, name := range h.metrics {
+			if supported[name] {
+				rc.hists[h.name] = name
+				add(name)
+				break
+			}
+		}
+	}
+	return rc
+}
+
+// uint64 returns the value of an uint64 metric, 0 if it's not supported.
+func (rc *runtimeCollector) uint64(name string) int64 {
+	if i, ok := rc.index[name]; ok {
+		if v := rc.samples[i].Value; v.Kind() == metrics.KindUint64 {
+			return int64(v.Uint64())
+		}
+	}
+	return 0
+}
+
+// float64 returns the value of a float64 metric and whether it's supported.
+func (rc *runtimeCollector) float64(name string) (float64, bool) {
+	if i, ok := rc.index[name]; ok {
+		if v := rc.samples[i].Value; v.Kind() == metrics.KindFloat64 {
+			return v.Float64(), true
+		}
+	}
+	return 0, false
+}
+
+// supported checks if the metric is supported by the current Go version
+func (rc *runtimeCollector) supported(name string) bool {
+	_, ok := rc.index[name]
+	return ok
+}
+
+// delta returns the increase of a cumulative counter since the last call and
+// records the current value. It must be called with the lock held.
+func (rc *runtimeCollector) delta(name string, curr int64) int64 {
+	last := rc.lastCounters[name]
+	rc.lastCounters[name] = curr
+	return counterDelta(curr, last)
+}
+
+// collect reads the runtime metrics once and reports both the metrics and
+// the histograms, so they are from the same instant.
+// e		the emitter to report the metrics to
+func (rc *runtimeCollector) collect(e *metricsEmitter) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	metrics.Read(rc.samples)
+	rc.addMetrics(e)
+	rc.addHistograms(e)
+}
+
+// addMetrics reports the runtime metrics of the samples read. It must be
+// called with the lock held.
+// e		the emitter to report the metrics to
+func (rc *runtimeCollector) addMetrics(e *metricsEmitter) {
+	// the metrics names inherited from runtime.MemStats
+	e.addValue("JMX.type=threadcount,name=NumGoroutine", int(rc.uint64(rmGoroutines)))
+	heapObjectBytes := rc.uint64(rmHeapObjectBytes)
+	heapUnused := rc.uint64(rmHeapUnused)
+	heapFree := rc.uint64(rmHeapFree)
+	heapReleased := rc.uint64(rmHeapReleased)
+	tinyAllocs := rc.uint64(rmTinyAllocs)
+	e.addValue("JMX.Memory:MemStats.Alloc", heapObjectBytes)
+	e.addValue("JMX.Memory:MemStats.TotalAlloc", rc.uint64(rmAllocBytes))
+	e.addValue("JMX.Memory:MemStats.Sys", rc.uint64(rmMemTotal))
+	// runtime/metrics doesn't track the pointer lookups, which are reported as
+	// 0 to keep the metric of the older versions
+	e.addValue("JMX.Memory:type=count,name=MemStats.Lookups", int64(0))
+	e.addValue("JMX.Memory:type=count,name=MemStats.Mallocs", rc.uint64(rmAllocObjects)+tinyAllocs)
+	e.addValue("JMX.Memory:type=count,name=MemStats.Frees", rc.uint64(rmFreeObjects)+tinyAllocs)
+	e.addValue("JMX.Memory:MemStats.Heap.Alloc", heapObjectBytes)
+	e.addValue("JMX.Memory:MemStats.Heap.Sys", heapObjectBytes+heapUnused+heapFree+heapReleased)
+	e.addValue("JMX.Memory:MemStats.Heap.Idle", heapFree+heapReleased)
+	e.addValue("JMX.Memory:MemStats.Heap.Inuse", heapObjectBytes+heapUnused)
+	e.addValue("JMX.Memory:MemStats.Heap.Released", heapReleased)
+	e.addValue("JMX.Memory:type=count,name=MemStats.Heap.Objects", rc.uint64(rmHeapObjects))
+	e.addValue("JMX.type=count,name=GCStats.NumGC", rc.uint64(rmGCCycles))
+
+	// the cumulative counters are reported as per-interval deltas
+	e.addValue("Runtime.GC.Cycles", rc.delta(rmGCCycles, rc.uint64(rmGCCycles)))
+	e.addValue("Runtime.Heap.AllocBytes", rc.delta(rmAllocBytes, rc.uint64(rmAllocBytes)))
+	e.addValue("Runtime.Heap.AllocObjects", rc.delta(rmAllocObjects, rc.uint64(rmAllocObjects)+tinyAllocs))
+	if rc.supported(rmHeapGoal) {
+		e.addValue("Runtime.Heap.Goal", rc.uint64(rmHeapGoal))
+	}
+	if rc.supported(rmGOMAXPROCS) {
+		e.addValue("Runtime.Sched.GOMAXPROCS", rc.uint64(rmGOMAXPROCS))
+	}
+	if wait, ok := rc.float64(rmMutexWait); ok {
+		// in microseconds, the same unit as the histograms
+		e.addValue("Runtime.Sync.MutexWaitTime", rc.delta(rmMutexWait, int64(wait*1e6)))
+	}
+}
+
+// addHistograms reports the runtime histograms of the samples read which have
+// new values since the last metrics cycle. It must be called with the lock held.
+// e		the emitter to report the histograms to
+func (rc *runtimeCollector) addHistograms(e *metricsEmitter) {
+	for _, rh := range runtimeHistograms {
+		name, ok := rc.hists[rh.name]
+		if !ok {
+			continue
+		}
+		v := rc.samples[rc.index[name]].Value
+		if v.Kind() != metrics.KindFloat64Histogram {
+			continue
+		}
+		h := rc.histDelta(name, v.Float64Histogram())
+		if h.TotalCount() == 0 {
+			continue
+		}
+		e.addHistogram(&histogram{name: rh.name, hist: h})
+	}
+}
+
+// the range of values (in microseconds) a runtime histogram can record
+const (
+	runtimeHistLowest  = 1
+	runtimeHistHighest = 3600000000
+)
+
+// histDelta converts the increase of a runtime histogram since the last call
+// to an hdrhist histogram in microseconds. It must be called with the lock held.
+func (rc *runtimeCollector) histDelta(name string, fh *metrics.Float64Histogram) *hdrhist.Hist {
+	h := hdrhist.WithConfig(hdrhist.Config{
+		LowestDiscernible: runtimeHistLowest,
+		HighestTrackable:  runtimeHistHighest,
+		SigFigs:           int32(metricsHTTPHistograms.getPrecision()),
+	})
+
+	last := rc.lastHists[name]
+	if len(last) != len(fh.Counts) {
+		last = nil
+	}
+	for i, c := range fh.Counts {
+		if last != nil {
+			c = uint64(counterDelta(int64(c), int64(last[i])))
+		}
+		if c == 0 {
+			continue
+		}
+		h.RecordN(bucketValue(fh.Buckets[i], fh.Buckets[i+1]), int64(c))
+	}
+	rc.lastHists[name] = append(last[:0], fh.Counts...)
+	return h
+}
+
+// bucketValue returns the value in microseconds representing the bucket with
+// the boundaries in seconds. The unbounded side of the first and last buckets
+// is ignored.
+func bucketValue(lo, hi float64) int64 {
+	var v float64
+	switch {
+	case math.IsInf(lo, -1):
+		v = hi
+	case math.IsInf(hi, 1):
+		v = lo
+	default:
+		v = (lo + hi) / 2
+	}
+	us := int64(v * 1e6)
+	if us < runtimeHistLowest {
+		return runtimeHistLowest
+	}
+	if us > runtimeHistHighest {
+		return runtimeHistHighest
+	}
+	return us
+}
+
+// addRuntimeMetrics reports the Go runtime metrics and histograms.
+func addRuntimeMetrics(e *metricsEmitter) {
+	runtimeMetrics.collect(e)
+}
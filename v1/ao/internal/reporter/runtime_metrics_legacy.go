@@ -0,0 +1,38 @@
+// +build !go1.16
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/host"
+)
+
+// addRuntimeMetrics reports the Go runtime metrics. The
+// runtime/metrics package is not available before Go 1.16 so it falls back to
+// runtime.MemStats, which stops the world while gathering the information.
+// The runtime histograms are only available through runtime/metrics.
+// e		the emitter to report the metrics to
+func addRuntimeMetrics(e *metricsEmitter) {
+	e.addValue("JMX.type=threadcount,name=NumGoroutine", runtime.NumGoroutine())
+	var mem runtime.MemStats
+	host.Mem(&mem)
+	e.addValue("JMX.Memory:MemStats.Alloc", int64(mem.Alloc))
+	e.addValue("JMX.Memory:MemStats.TotalAlloc", int64(mem.TotalAlloc))
+	e.addValue("JMX.Memory:MemStats.Sys", int64(mem.Sys))
+	e.addValue("JMX.Memory:type=count,name=MemStats.Lookups", int64(mem.Lookups))
+	e.addValue("JMX.Memory:type=count,name=MemStats.Mallocs", int64(mem.Mallocs))
+	e.addValue("JMX.Memory:type=count,name=MemStats.Frees", int64(mem.Frees))
+	e.addValue("JMX.Memory:MemStats.Heap.Alloc", int64(mem.HeapAlloc))
+	e.addValue("JMX.Memory:MemStats.Heap.Sys", int64(mem.HeapSys))
+	e.addValue("JMX.Memory:MemStats.Heap.Idle", int64(mem.HeapIdle))
+	e.addValue("JMX.Memory:MemStats.Heap.Inuse", int64(mem.HeapInuse))
+	e.addValue("JMX.Memory:MemStats.Heap.Released", int64(mem.HeapReleased))
+	e.addValue("JMX.Memory:type=count,name=MemStats.Heap.Objects", int64(mem.HeapObjects))
+	var gc debug.GCStats
+	host.GC(&gc)
+	e.addValue("JMX.type=count,name=GCStats.NumGC", gc.NumGC)
+}
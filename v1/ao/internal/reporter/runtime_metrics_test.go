@@ -0,0 +1,83 @@
+// +build go1.16
+
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	rc := newRuntimeCollector()
+
+	m := emittedValues(rc.collect)
+	assert.IsType(t, int(0), m["JMX.type=threadcount,name=NumGoroutine"])
+	assert.True(t, m["JMX.type=threadcount,name=NumGoroutine"].(int) > 0)
+	assert.True(t, m["JMX.Memory:MemStats.Heap.Alloc"].(int64) > 0)
+	assert.True(t, m["JMX.Memory:MemStats.Sys"].(int64) > 0)
+	assert.True(t, m["Runtime.Heap.AllocBytes"].(int64) > 0)
+	assert.Equal(t, int64(0), m["JMX.Memory:type=count,name=MemStats.Lookups"])
+
+	runtime.GC()
+	numGC := m["JMX.type=count,name=GCStats.NumGC"].(int64)
+	m = emittedValues(rc.collect)
+
+	// the cumulative value and the per-interval delta
+	currGC := m["JMX.type=count,name=GCStats.NumGC"].(int64)
+	assert.True(t, currGC > numGC)
+	assert.Equal(t, currGC-numGC, m["Runtime.GC.Cycles"])
+}
+
+func TestRuntimeHistograms(t *testing.T) {
+	rc := newRuntimeCollector()
+	require.NotEmpty(t, rc.hists)
+
+	runtime.GC()
+	m := emittedHistograms(rc.collect)
+
+	require.Contains(t, m, "Runtime.GC.PauseTime")
+	h := m["Runtime.GC.PauseTime"].hist
+	assert.True(t, h.TotalCount() > 0)
+
+	// only the pauses since the last cycle are reported
+	total := h.TotalCount()
+	runtime.GC()
+	m = emittedHistograms(rc.collect)
+
+	require.Contains(t, m, "Runtime.GC.PauseTime")
+	h = m["Runtime.GC.PauseTime"].hist
+	assert.True(t, h.TotalCount() > 0)
+	assert.True(t, h.TotalCount() <= total, "%d pauses", h.TotalCount())
+}
+
+func TestRuntimeMetricsReadOnce(t *testing.T) {
+	rc := newRuntimeCollector()
+	rc.collect(&metricsEmitter{})
+	runtime.GC()
+
+	// a single collection reports both the metrics and the histograms
+	var values, hists int
+	for _, r := range collectMetrics(rc.collect) {
+		if r.histogram != nil {
+			hists++
+		} else {
+			values++
+		}
+	}
+	assert.NotZero(t, values)
+	assert.NotZero(t, hists)
+}
+
+func TestBucketValue(t *testing.T) {
+	assert.Equal(t, int64(15), bucketValue(0.00001, 0.00002))
+	assert.Equal(t, int64(10), bucketValue(math.Inf(-1), 0.00001))
+	assert.Equal(t, int64(2000000), bucketValue(2, math.Inf(1)))
+	assert.Equal(t, int64(runtimeHistLowest), bucketValue(0, 0.0000001))
+	assert.Equal(t, int64(runtimeHistHighest), bucketValue(7200, math.Inf(1)))
+}
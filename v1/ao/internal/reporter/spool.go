@@ -0,0 +1,423 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// the suffix of the spool segment files
+	spoolSegmentSuffix = ".seg"
+	// the file which records the read position of the spool
+	spoolCursorFile = "cursor"
+	// the maximum size of a segment file
+	spoolSegmentSize = 4 * 1024 * 1024
+	// the overflowed events are accumulated up to this size before being
+	// written to the spool as a batch
+	spoolPendingSize = 1024 * 1024
+	// the maximum number of spooled batches replayed before each new batch,
+	// so the new events won't be delayed too much.
+	spoolReplayBatches = 10
+	// the interval to replay the spooled batches if there are no new ones
+	spoolReplayInterval = 10 * time.Second
+	// the number of overflowed events waiting to be written into the spool,
+	// the ones exceeding it are dropped.
+	spoolEventsQueueSize = 1000
+)
+
+var (
+	errSpoolCorrupted = errors.New("corrupted spool segment")
+	errBatchTooLarge  = errors.New("batch is larger than the spool")
+	errSpoolSize      = errors.New("spool size must be positive")
+)
+
+// spool is an on-disk FIFO queue of event batches. The batches are appended to
+// segment files which are named after an increasing sequence number, and are
+// read from the oldest segment. A segment is removed once all the batches in
+// it are read. The oldest segments are dropped if the total size exceeds the
+// limit. The read position is saved in the cursor file so the spool survives
+// process restarts. The batches are always appended to a new segment after
+// restarts, as the newest segment may be left with a truncated record by a
+// crashed process.
+//
+// All the methods are safe to be called on a nil spool.
+type spool struct {
+	dir         string
+	maxSize     int64
+	segmentSize int64
+
+	lock sync.Mutex
+	// the sequence numbers of the segments, from the oldest to the newest
+	segments []int64
+	// the size of each segment
+	sizes []int64
+	// the total size of all the segments
+	total int64
+	// the file of the newest segment which is open for writing, a new segment
+	// is created if it's nil.
+	w *os.File
+	// the read position of the oldest segment
+	offset int64
+	// the size of the batch returned by the last peek
+	peeked int64
+
+	// the overflowed events which haven't been written into the spool yet
+	pending     [][]byte
+	pendingSize int
+	// the events added after the spool is closed are dropped
+	closed bool
+}
+
+// newSpool opens the spool in the directory, which is created if it doesn't
+// exist. The segments left by the previous process are picked up.
+func newSpool(dir string, maxSize int64) (*spool, error) {
+	if maxSize <= 0 {
+		return nil, errSpoolSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create the spool directory")
+	}
+	s := &spool{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: spoolSegmentSize,
+	}
+	if s.segmentSize > maxSize {
+		s.segmentSize = maxSize
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the spool directory")
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, seq)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+	for _, seq := range s.segments {
+		fi, err := os.Stat(s.path(seq))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to stat the spool segment")
+		}
+		s.sizes = append(s.sizes, fi.Size())
+		s.total += fi.Size()
+	}
+	s.loadCursor()
+	return s, nil
+}
+
+// path returns the file path of the segment
+func (s *spool) path(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentSuffix))
+}
+
+// loadCursor restores the read position saved by the previous process. It
+// starts from the beginning of the oldest segment if the cursor is invalid.
+func (s *spool) loadCursor() {
+	if len(s.segments) == 0 {
+		return
+	}
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, spoolCursorFile))
+	if err != nil {
+		return
+	}
+	var seq, offset int64
+	if _, err := fmt.Sscanf(string(b), "%d %d", &seq, &offset); err != nil {
+		return
+	}
+	if seq == s.segments[0] && offset >= 0 && offset <= s.sizes[0] {
+		s.offset = offset
+	}
+}
+
+// saveCursor persists the read position. It must be called with the lock held.
+func (s *spool) saveCursor() {
+	if len(s.segments) == 0 {
+		os.Remove(filepath.Join(s.dir, spoolCursorFile))
+		return
+	}
+	cursor := fmt.Sprintf("%d %d", s.segments[0], s.offset)
+	if err := ioutil.WriteFile(filepath.Join(s.dir, spoolCursorFile), []byte(cursor), 0600); err != nil {
+		log.Warningf("Failed to save the spool cursor: %v", err)
+	}
+}
+
+// add buffers an overflowed event, which is written to the spool along with
+// the other events when there are enough of them.
+func (s *spool) add(msg []byte) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.pending = append(s.pending, msg)
+	s.pendingSize += len(msg)
+	if s.pendingSize >= spoolPendingSize {
+		s.flushPending()
+	}
+}
+
+// flushPending writes the buffered events to the spool. It must be called
+// with the lock held.
+func (s *spool) flushPending() {
+	if len(s.pending) == 0 {
+		return
+	}
+	if err := s.write(s.pending); err != nil {
+		log.Warningf("Failed to spool %d events: %v", len(s.pending), err)
+	}
+	s.pending = nil
+	s.pendingSize = 0
+}
+
+// put appends the batch to the spool.
+func (s *spool) put(batch [][]byte) error {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.flushPending()
+	return s.write(batch)
+}
+
+// write appends the batch to the newest segment, a new segment is created if
+// the current one is full or not open yet. It must be called with the lock
+// held.
+func (s *spool) write(batch [][]byte) error {
+	rec := encodeBatch(batch)
+	size := int64(len(rec))
+	if size > s.segmentSize {
+		return errBatchTooLarge
+	}
+
+	last := len(s.segments) - 1
+	if s.w == nil || s.sizes[last]+size > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		last = len(s.segments) - 1
+	}
+	if _, err := s.w.Write(rec); err != nil {
+		return errors.Wrap(err, "failed to write the spool segment")
+	}
+	s.sizes[last] += size
+	s.total += size
+
+	// drop the oldest segments to make room, but keep the one being written.
+	for s.total > s.maxSize && len(s.segments) > 1 {
+		log.Warningf("Spool is full, dropping segment %d.", s.segments[0])
+		s.removeOldest()
+	}
+	return nil
+}
+
+// rotate closes the current segment and creates a new one. It must be called
+// with the lock held.
+func (s *spool) rotate() error {
+	var seq int64
+	if n := len(s.segments); n > 0 {
+		seq = s.segments[n-1] + 1
+	}
+	if s.w != nil {
+		s.w.Close()
+		s.w = nil
+	}
+	w, err := os.OpenFile(s.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the spool segment")
+	}
+	s.w = w
+	s.segments = append(s.segments, seq)
+	s.sizes = append(s.sizes, 0)
+	return nil
+}
+
+// removeOldest deletes the oldest segment. It must be called with the lock
+// held.
+func (s *spool) removeOldest() {
+	if len(s.segments) == 1 && s.w != nil {
+		s.w.Close()
+		s.w = nil
+	}
+	if err := os.Remove(s.path(s.segments[0])); err != nil && !os.IsNotExist(err) {
+		log.Warningf("Failed to remove the spool segment: %v", err)
+	}
+	s.total -= s.sizes[0]
+	s.segments = s.segments[1:]
+	s.sizes = s.sizes[1:]
+	s.offset = 0
+	s.peeked = 0
+	s.saveCursor()
+}
+
+// peek returns the oldest batch in the spool without removing it, or nil if
+// the spool is empty. Call advance to remove it after it's been sent.
+func (s *spool) peek() [][]byte {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.flushPending()
+	for len(s.segments) != 0 {
+		if s.offset >= s.sizes[0] {
+			s.removeOldest()
+			continue
+		}
+		batch, size, err := s.read(s.segments[0], s.offset, s.sizes[0])
+		if err != nil {
+			log.Warningf("Dropping spool segment %d: %v", s.segments[0], err)
+			s.removeOldest()
+			continue
+		}
+		s.peeked = size
+		return batch
+	}
+	return nil
+}
+
+// advance removes the batch returned by the last peek.
+func (s *spool) advance() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.peeked == 0 || len(s.segments) == 0 {
+		return
+	}
+	s.offset += s.peeked
+	s.peeked = 0
+	if s.offset >= s.sizes[0] {
+		s.removeOldest()
+		return
+	}
+	s.saveCursor()
+}
+
+// read decodes the batch at the offset of the segment of the size and returns
+// it along with its size on disk. The length of the record is checked against
+// the rest of the segment before reading it, as it may be corrupted.
+func (s *spool) read(seq, offset, segmentSize int64) ([][]byte, int64, error) {
+	f, err := os.Open(s.path(seq))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var hdr [4]byte
+	if _, err := f.ReadAt(hdr[:], offset); err != nil {
+		return nil, 0, errSpoolCorrupted
+	}
+	n := int64(binary.BigEndian.Uint32(hdr[:]))
+	if n > segmentSize-offset-4 {
+		return nil, 0, errSpoolCorrupted
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, offset+4); err != nil && !(err == io.EOF && len(buf) == 0) {
+		return nil, 0, errSpoolCorrupted
+	}
+	batch, err := decodeBatch(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	return batch, int64(len(buf) + 4), nil
+}
+
+// size returns the total size of the spooled batches.
+func (s *spool) size() int64 {
+	if s == nil {
+		return 0
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.total - s.offset
+}
+
+// close writes the buffered events to disk and closes the spool.
+func (s *spool) close() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.flushPending()
+	if s.w != nil {
+		s.w.Close()
+		s.w = nil
+	}
+	s.closed = true
+}
+
+// encodeBatch encodes the batch as a record: the length of the record, the
+// number of messages, and each message prefixed by its length.
+func encodeBatch(batch [][]byte) []byte {
+	size := 8
+	for _, m := range batch {
+		size += 4 + len(m)
+	}
+	rec := make([]byte, size)
+	binary.BigEndian.PutUint32(rec, uint32(size-4))
+	binary.BigEndian.PutUint32(rec[4:], uint32(len(batch)))
+	pos := 8
+	for _, m := range batch {
+		binary.BigEndian.PutUint32(rec[pos:], uint32(len(m)))
+		pos += 4
+		pos += copy(rec[pos:], m)
+	}
+	return rec
+}
+
+// decodeBatch decodes the record body encoded by encodeBatch.
+func decodeBatch(buf []byte) ([][]byte, error) {
+	if len(buf) < 4 {
+		return nil, errSpoolCorrupted
+	}
+	n := binary.BigEndian.Uint32(buf)
+	buf = buf[4:]
+	var batch [][]byte
+	for i := uint32(0); i < n; i++ {
+		if len(buf) < 4 {
+			return nil, errSpoolCorrupted
+		}
+		l := binary.BigEndian.Uint32(buf)
+		buf = buf[4:]
+		if uint32(len(buf)) < l {
+			return nil, errSpoolCorrupted
+		}
+		batch = append(batch, buf[:l])
+		buf = buf[l:]
+	}
+	return batch, nil
+}
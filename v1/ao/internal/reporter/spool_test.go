@@ -0,0 +1,483 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package reporter
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter/collector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// fakeCollector is a trace collector client which records the events posted
+// and returns the result set by the test.
+type fakeCollector struct {
+	sync.Mutex
+	result collector.ResultCode
+	events [][]byte
+}
+
+func (f *fakeCollector) setResult(r collector.ResultCode) {
+	f.Lock()
+	defer f.Unlock()
+	f.result = r
+}
+
+func (f *fakeCollector) received() [][]byte {
+	f.Lock()
+	defer f.Unlock()
+	return append([][]byte(nil), f.events...)
+}
+
+func (f *fakeCollector) PostEvents(ctx context.Context, in *collector.MessageRequest, opts ...grpc.CallOption) (*collector.MessageResult, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.result == collector.ResultCode_OK {
+		f.events = append(f.events, in.Messages...)
+	}
+	return &collector.MessageResult{Result: f.result}, nil
+}
+
+func (f *fakeCollector) PostMetrics(ctx context.Context, in *collector.MessageRequest, opts ...grpc.CallOption) (*collector.MessageResult, error) {
+	return &collector.MessageResult{}, nil
+}
+
+func (f *fakeCollector) PostStatus(ctx context.Context, in *collector.MessageRequest, opts ...grpc.CallOption) (*collector.MessageResult, error) {
+	return &collector.MessageResult{}, nil
+}
+
+func (f *fakeCollector) GetSettings(ctx context.Context, in *collector.SettingsRequest, opts ...grpc.CallOption) (*collector.SettingsResult, error) {
+	return &collector.SettingsResult{}, nil
+}
+
+func (f *fakeCollector) Ping(ctx context.Context, in *collector.PingRequest, opts ...grpc.CallOption) (*collector.MessageResult, error) {
+	return &collector.MessageResult{}, nil
+}
+
+func tempSpool(t *testing.T, maxSize int64) (*spool, string) {
+	dir, err := ioutil.TempDir("", "aospool")
+	require.NoError(t, err)
+	s, err := newSpool(dir, maxSize)
+	require.NoError(t, err)
+	return s, dir
+}
+
+func batchOf(msgs ...string) [][]byte {
+	var b [][]byte
+	for _, m := range msgs {
+		b = append(b, []byte(m))
+	}
+	return b
+}
+
+func TestSpoolOrder(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+	s.segmentSize = 64
+
+	assert.Nil(t, s.peek())
+	for _, b := range [][][]byte{batchOf("a", "b"), batchOf("c"), batchOf("d", "e", "f"), batchOf("g")} {
+		require.NoError(t, s.put(b))
+	}
+	s.add([]byte("h"))
+	s.add([]byte("i"))
+
+	var got []string
+	for b := s.peek(); b != nil; b = s.peek() {
+		var msgs []string
+		for _, m := range b {
+			msgs = append(msgs, string(m))
+		}
+		got = append(got, msgs...)
+		s.advance()
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"}, got)
+	assert.Equal(t, int64(0), s.size())
+	assert.Empty(t, s.segments)
+
+	// nil spool is a no-op
+	var ns *spool
+	assert.NoError(t, ns.put(batchOf("a")))
+	assert.Nil(t, ns.peek())
+	ns.advance()
+	ns.close()
+}
+
+func TestSpoolSizeCap(t *testing.T) {
+	s, dir := tempSpool(t, 100)
+	defer os.RemoveAll(dir)
+	s.segmentSize = 40
+
+	// each record takes 8+4+20 bytes so there is one record per segment
+	msg := "01234567890123456789"
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.put(batchOf(msg)))
+	}
+	assert.True(t, s.size() <= 100)
+	assert.Len(t, s.segments, 3)
+	assert.Equal(t, int64(7), s.segments[0])
+	assert.Equal(t, errBatchTooLarge, s.put(batchOf(msg, msg)))
+}
+
+func TestSpoolRestart(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, s.put(batchOf("a")))
+	require.NoError(t, s.put(batchOf("b")))
+	s.add([]byte("c"))
+	assert.Equal(t, batchOf("a"), s.peek())
+	s.advance()
+	s.close()
+
+	// the batches left are picked up from where it stopped
+	s, err := newSpool(dir, 1024*1024)
+	require.NoError(t, err)
+	assert.Equal(t, batchOf("b"), s.peek())
+	s.advance()
+	require.NoError(t, s.put(batchOf("d")))
+	assert.Equal(t, batchOf("c"), s.peek())
+	s.advance()
+	assert.Equal(t, batchOf("d"), s.peek())
+	s.advance()
+	assert.Nil(t, s.peek())
+	s.close()
+}
+
+func TestSpoolCorrupted(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, s.put(batchOf("a")))
+	s.close()
+	// a truncated record is written by a crashed process
+	f, err := os.OpenFile(s.path(0), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	f.Write([]byte{0, 0, 0, 100, 0})
+	f.Close()
+
+	// the new batches are written to a new segment rather than after the
+	// truncated record
+	s, err = newSpool(dir, 1024*1024)
+	require.NoError(t, err)
+	require.NoError(t, s.put(batchOf("b")))
+	assert.Equal(t, []int64{0, 1}, s.segments)
+	assert.Equal(t, batchOf("a"), s.peek())
+	s.advance()
+	assert.Equal(t, batchOf("b"), s.peek())
+	s.advance()
+	assert.Nil(t, s.peek())
+	s.close()
+
+	// the events added after it's closed are dropped
+	s.add([]byte("c"))
+	assert.Nil(t, s.peek())
+}
+
+func TestSpoolBogusLength(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+	s.close()
+
+	// the length of the record is far beyond the size of the segment
+	require.NoError(t, ioutil.WriteFile(s.path(0), []byte{0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 1}, 0600))
+	s, err := newSpool(dir, 1024*1024)
+	require.NoError(t, err)
+	require.NoError(t, s.put(batchOf("a")))
+	assert.Equal(t, []int64{0, 1}, s.segments)
+
+	// the segment is dropped without reading the record
+	_, _, err = s.read(0, 0, s.sizes[0])
+	assert.Equal(t, errSpoolCorrupted, err)
+	assert.Equal(t, batchOf("a"), s.peek())
+	assert.Equal(t, []int64{1}, s.segments)
+	s.advance()
+	assert.Nil(t, s.peek())
+	s.close()
+}
+
+func TestSpoolInvalidSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aospool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, size := range []int64{0, -1} {
+		s, err := newSpool(dir, size)
+		assert.Nil(t, s)
+		assert.Equal(t, errSpoolSize, err)
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+
+	fc := &fakeCollector{result: collector.ResultCode_TRY_LATER}
+	c := &grpcConnection{
+		name:        "events channel",
+		address:     "test-addr",
+		certificate: []byte(grpcCertDefault),
+		queueStats:  &eventQueueStats{},
+		backoff: func(retries int, wait func(d time.Duration)) error {
+			if retries > 1 {
+				return errGiveUpAfterRetries
+			}
+			return nil
+		},
+		Dialer:  &NoopDialer{},
+		flushed: make(chan struct{}),
+	}
+	require.NoError(t, c.connect())
+	c.client = fc
+
+	r := &grpcReporter{
+		eventConnection:     c,
+		serviceKey:          "key",
+		done:                make(chan struct{}),
+		spool:               s,
+		spoolReplayInterval: 20 * time.Millisecond,
+	}
+	batches := make(chan [][]byte)
+	go r.eventBatchSender(batches)
+
+	// the batches are spooled as the collector is not available
+	batches <- batchOf("a", "b")
+	batches <- batchOf("c")
+	batches <- batchOf("d")
+	spooled := int64(len(encodeBatch(batchOf("a", "b"))) + 2*len(encodeBatch(batchOf("c"))))
+	for i := 0; i < 100 && s.size() < spooled; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Empty(t, fc.received())
+
+	// the spooled ones are replayed in order after the collector recovers,
+	// even if there are no new batches.
+	fc.setResult(collector.ResultCode_OK)
+	for i := 0; i < 100 && (len(fc.received()) < 4 || s.size() != 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, batchOf("a", "b", "c", "d"), fc.received())
+	assert.Equal(t, int64(0), s.size())
+
+	batches <- batchOf("e")
+	close(batches)
+	for i := 0; i < 100 && len(fc.received()) < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, batchOf("a", "b", "c", "d", "e"), fc.received())
+
+	close(r.done)
+	<-c.flushed
+}
+
+func TestSpoolReplayBeforeNewBatches(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.put(batchOf("a")))
+	require.NoError(t, s.put(batchOf("b")))
+
+	fc := &fakeCollector{result: collector.ResultCode_OK}
+	c := &grpcConnection{
+		name:        "events channel",
+		address:     "test-addr",
+		certificate: []byte(grpcCertDefault),
+		queueStats:  &eventQueueStats{},
+		backoff:     DefaultBackoff,
+		Dialer:      &NoopDialer{},
+		flushed:     make(chan struct{}),
+	}
+	require.NoError(t, c.connect())
+	c.client = fc
+
+	r := &grpcReporter{
+		eventConnection: c,
+		serviceKey:      "key",
+		done:            make(chan struct{}),
+		spool:           s,
+		spoolEvents:     make(chan []byte, 10),
+	}
+	go r.spoolWriter()
+
+	// the overflowed events are written into the spool asynchronously
+	r.spoolEvents <- []byte("c")
+	for i := 0; i < 100; i++ {
+		s.lock.Lock()
+		n := len(s.pending)
+		s.lock.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the spooled events are older so they are sent first
+	batches := make(chan [][]byte)
+	go r.eventBatchSender(batches)
+	batches <- batchOf("d")
+	close(batches)
+	for i := 0; i < 100 && len(fc.received()) < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, batchOf("a", "b", "c", "d"), fc.received())
+
+	close(r.done)
+	<-c.flushed
+}
+
+func TestSpoolReplayNoRetry(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+	require.NoError(t, s.put(batchOf("a")))
+
+	var retried int32
+	fc := &fakeCollector{result: collector.ResultCode_TRY_LATER}
+	c := &grpcConnection{
+		name:        "events channel",
+		address:     "test-addr",
+		certificate: []byte(grpcCertDefault),
+		queueStats:  &eventQueueStats{},
+		backoff: func(retries int, wait func(d time.Duration)) error {
+			atomic.AddInt32(&retried, 1)
+			if retries > 1 {
+				return errGiveUpAfterRetries
+			}
+			wait(time.Second)
+			return nil
+		},
+		Dialer:  &NoopDialer{},
+		flushed: make(chan struct{}),
+	}
+	require.NoError(t, c.connect())
+	c.client = fc
+
+	r := &grpcReporter{
+		eventConnection:     c,
+		serviceKey:          "key",
+		done:                make(chan struct{}),
+		spool:               s,
+		spoolReplayInterval: 20 * time.Millisecond,
+	}
+	batches := make(chan [][]byte)
+	go r.eventBatchSender(batches)
+
+	// the replay fails at once while the collector is unreachable, so the
+	// new batches are spooled without waiting for the retries.
+	start := time.Now()
+	batches <- batchOf("b")
+	batches <- batchOf("c")
+	batches <- batchOf("d")
+	spooled := int64(4 * len(encodeBatch(batchOf("a"))))
+	for i := 0; i < 100 && s.size() < spooled; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, spooled, s.size())
+	assert.True(t, time.Since(start) < time.Second)
+
+	// neither is the periodic replay retried
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&retried))
+	assert.Empty(t, fc.received())
+
+	close(r.done)
+	<-c.flushed
+}
+
+func TestSpoolReplayBacklog(t *testing.T) {
+	s, dir := tempSpool(t, 1024*1024)
+	defer os.RemoveAll(dir)
+	var want [][]byte
+	for i := 0; i < spoolReplayBatches+2; i++ {
+		b := batchOf(strconv.Itoa(i))
+		require.NoError(t, s.put(b))
+		want = append(want, b...)
+	}
+
+	fc := &fakeCollector{result: collector.ResultCode_OK}
+	c := &grpcConnection{
+		name:        "events channel",
+		address:     "test-addr",
+		certificate: []byte(grpcCertDefault),
+		queueStats:  &eventQueueStats{},
+		backoff:     DefaultBackoff,
+		Dialer:      &NoopDialer{},
+		flushed:     make(chan struct{}),
+	}
+	require.NoError(t, c.connect())
+	c.client = fc
+
+	r := &grpcReporter{
+		eventConnection:     c,
+		serviceKey:          "key",
+		done:                make(chan struct{}),
+		spool:               s,
+		spoolReplayInterval: 20 * time.Millisecond,
+	}
+	batches := make(chan [][]byte)
+	go r.eventBatchSender(batches)
+
+	// the new batch doesn't overtake the spooled ones which are left after
+	// a round of replay, but is spooled behind them.
+	batches <- batchOf("new")
+	want = append(want, []byte("new"))
+	for i := 0; i < 100 && len(fc.received()) < len(want); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, want, fc.received())
+	assert.Equal(t, int64(0), s.size())
+
+	close(r.done)
+	<-c.flushed
+}
+
+func TestSpoolOnShutdownNow(t *testing.T) {
+	// the sender may either send the batch pending or read it on the
+	// shutdown, so it's repeated to cover both cases.
+	for i := 0; i < 20; i++ {
+		s, dir := tempSpool(t, 1024*1024)
+
+		fc := &fakeCollector{result: collector.ResultCode_OK}
+		c := &grpcConnection{
+			name:        "events channel",
+			address:     "test-addr",
+			certificate: []byte(grpcCertDefault),
+			queueStats:  &eventQueueStats{},
+			backoff:     DefaultBackoff,
+			Dialer:      &NoopDialer{},
+			flushed:     make(chan struct{}),
+		}
+		require.NoError(t, c.connect())
+		c.client = fc
+
+		r := &grpcReporter{
+			eventConnection: c,
+			serviceKey:      "key",
+			done:            make(chan struct{}),
+			spool:           s,
+		}
+		batches := make(chan [][]byte, 1)
+		batches <- batchOf("a")
+		close(r.done)
+		r.eventBatchSender(batches)
+
+		// the batch is kept for the next run if it's not sent on a
+		// non-graceful shutdown
+		s, err := newSpool(dir, 1024*1024)
+		require.NoError(t, err)
+		if len(fc.received()) == 0 {
+			assert.Equal(t, batchOf("a"), s.peek())
+		} else {
+			assert.Nil(t, s.peek())
+		}
+		s.close()
+		os.RemoveAll(dir)
+	}
+}
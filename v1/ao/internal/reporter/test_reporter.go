@@ -85,10 +85,10 @@ func SetTestReporter(options ...TestReporterOption) *TestReporter {
 	r.wg.Add(1)
 	go r.resultWriter()
 
+	prev := storeGlobalReporter(r)
 	if _, ok := oldReporter.(*nullReporter); ok {
-		oldReporter = globalReporter
+		oldReporter = prev
 	}
-	globalReporter = r
 	usingTestReporter = true
 
 	// start with clean slate
@@ -144,7 +144,7 @@ func (r *TestReporter) Close(numBufs int) {
 	}
 	usingTestReporter = false
 	if _, ok := oldReporter.(*nullReporter); !ok {
-		globalReporter = oldReporter
+		storeGlobalReporter(oldReporter)
 		oldReporter = &nullReporter{}
 	}
 }
@@ -198,8 +198,13 @@ func (r *TestReporter) reportSpan(span SpanMessage) error {
 }
 
 func (r *TestReporter) addDefaultSetting() {
-	// add default setting with 100% sampling
+	// add default setting with 100% sampling and trigger traces enabled
+	args := argsToMap(1000000, 1000000, -1, -1)
+	for _, k := range []string{kvTriggerRelaxedBucketCapacity, kvTriggerRelaxedBucketRate,
+		kvTriggerStrictBucketCapacity, kvTriggerStrictBucketRate} {
+		args[k] = args[kvBucketCapacity]
+	}
 	updateSetting(int32(TYPE_DEFAULT), "",
-		[]byte("SAMPLE_START,SAMPLE_THROUGH_ALWAYS"),
-		1000000, 120, argsToMap(1000000, 1000000, -1, -1))
+		[]byte("SAMPLE_START,SAMPLE_THROUGH_ALWAYS,TRIGGER_TRACE"),
+		1000000, 120, args)
 }
@@ -48,6 +48,10 @@ const (
 	keyQueryString     = "Query-String"
 	keyRemoteStatus    = "RemoteStatus"
 	keyContentLength   = "ContentLength"
+	keyResponseBytes   = "ResponseBytes"
+	keyTTFB            = "TimeToFirstByte"
+	keyHijacked        = "Hijacked"
+	keyClientIP        = "Client-IP"
 )
 
 // Span is used to measure a span of time associated with an activity
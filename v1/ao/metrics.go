@@ -0,0 +1,33 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+)
+
+// MetricEmitter is used by a metrics collector to report measurements. It's
+// only valid during the call of the collector.
+type MetricEmitter = reporter.MetricEmitter
+
+// RegisterMetricsCollector registers a collector which is called in each
+// metrics flush to report custom measurements, e.g., connection pool stats or
+// cache sizes:
+//
+//	ao.RegisterMetricsCollector("cache", func(emit ao.MetricEmitter) {
+//		emit.Emit("CacheSize", cache.Len(), map[string]string{"name": "users"})
+//	})
+//
+// Each collector runs with a timeout (1 second), the measurements are discarded
+// if it doesn't return in time. A panic in the collector is recovered and
+// won't affect the other collectors. It returns an error if the name is empty
+// or a collector with the same name has been registered.
+func RegisterMetricsCollector(name string, collector func(emit MetricEmitter)) error {
+	return reporter.RegisterMetricsCollector(name, collector)
+}
+
+// UnregisterMetricsCollector removes a registered metrics collector. It
+// returns false if there is no collector registered with the name.
+func UnregisterMetricsCollector(name string) bool {
+	return reporter.UnregisterMetricsCollector(name)
+}
@@ -57,6 +57,9 @@ func (p *textMapPropagator) Inject(spanCtx ot.SpanContext, opaqueCarrier interfa
 	}
 	if md := sc.span.MetadataString(); md != "" {
 		carrier.Set(ao.HTTPHeaderName, md)
+		if sig := ao.SignTraceID(md, ""); sig != "" {
+			carrier.Set(ao.HTTPSignatureHeaderName, sig)
+		}
 	}
 	carrier.Set(fieldNameSampled, strconv.FormatBool(sc.span.IsReporting()))
 
@@ -68,6 +71,7 @@ func (p *textMapPropagator) Inject(spanCtx ot.SpanContext, opaqueCarrier interfa
 
 type tracerState struct {
 	XTraceID     string            `json:"xtrace_id,omitempty"`
+	Signature    string            `json:"signature,omitempty"`
 	Sampled      bool              `json:"sampled,omitempty"`
 	BaggageItems map[string]string `json:"baggage_items,omitempty"`
 }
@@ -96,6 +100,9 @@ func (p *binaryPropagator) Inject(spanCtx ot.SpanContext, opaqueCarrier interfac
 		Sampled:      sc.span.IsReporting(),
 		BaggageItems: sc.baggage,
 	}
+	if state.XTraceID != "" {
+		state.Signature = ao.SignTraceID(state.XTraceID, "")
+	}
 
 	b, err := p.marshaler.Marshal(&state)
 	if err != nil {
@@ -137,9 +144,10 @@ func (p *binaryPropagator) Extract(opaqueCarrier interface{}) (ot.SpanContext, e
 	}
 
 	return spanContext{
-		remoteMD: ctx.XTraceID,
-		sampled:  ctx.Sampled,
-		baggage:  ctx.BaggageItems,
+		remoteMD:  ctx.XTraceID,
+		remoteSig: ctx.Signature,
+		sampled:   ctx.Sampled,
+		baggage:   ctx.BaggageItems,
 	}, nil
 }
 
@@ -148,7 +156,7 @@ func (p *textMapPropagator) Extract(opaqueCarrier interface{}) (ot.SpanContext,
 	if !ok {
 		return nil, ot.ErrInvalidCarrier
 	}
-	var xTraceID string
+	var xTraceID, signature string
 	var sampled bool
 	var sawSampled bool
 	var err error
@@ -161,6 +169,8 @@ func (p *textMapPropagator) Extract(opaqueCarrier interface{}) (ot.SpanContext,
 			} else {
 				return ot.ErrSpanContextCorrupted
 			}
+		case strings.ToLower(ao.HTTPSignatureHeaderName):
+			signature = v
 		case fieldNameSampled:
 			sawSampled = true
 			sampled, err = strconv.ParseBool(v)
@@ -186,8 +196,9 @@ func (p *textMapPropagator) Extract(opaqueCarrier interface{}) (ot.SpanContext,
 	}
 
 	return spanContext{
-		remoteMD: xTraceID,
-		sampled:  sampled,
-		baggage:  decodedBaggage,
+		remoteMD:  xTraceID,
+		remoteSig: signature,
+		sampled:   sampled,
+		baggage:   decodedBaggage,
 	}, nil
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/appoptics/appoptics-apm-go/v1/ao"
@@ -194,3 +195,46 @@ func TestTextMapExtract(t *testing.T) {
 	assert.Equal(t, opentracing.ErrSpanContextCorrupted, err)
 
 }
+
+func TestExtractTrust(t *testing.T) {
+	const md = "2B0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456701"
+	require.NoError(t, ao.UpdateConfig(ao.WithTrustedTraceSources("10.0.0.0/8")))
+	defer ao.UpdateConfig(ao.WithTrustedTraceSources(), ao.WithTraceContextSecret(""))
+
+	continues := func(carrier opentracing.TextMapCarrier) bool {
+		r := reporter.SetTestReporter()
+		tr := NewTracer()
+		ctx, err := tr.Extract(opentracing.TextMap, carrier)
+		require.NoError(t, err)
+		span := tr.StartSpan("op", opentracing.ChildOf(ctx))
+		mdStr := span.Context().(spanContext).span.MetadataString()
+		span.Finish()
+		r.Close(2)
+		return strings.HasPrefix(mdStr, md[:42])
+	}
+
+	// the source of an extracted context is unknown, so it's untrusted
+	assert.False(t, continues(opentracing.TextMapCarrier{ao.HTTPHeaderName: md, fieldNameSampled: "true"}))
+
+	// signed by the shared secret
+	require.NoError(t, ao.UpdateConfig(ao.WithTraceContextSecret("secret")))
+	assert.True(t, continues(opentracing.TextMapCarrier{ao.HTTPHeaderName: md,
+		ao.HTTPSignatureHeaderName: ao.SignTraceID(md, "")}))
+	assert.False(t, continues(opentracing.TextMapCarrier{ao.HTTPHeaderName: md,
+		ao.HTTPSignatureHeaderName: "ts=1;sig=bad"}))
+
+	// the injected context is signed
+	r := reporter.SetTestReporter()
+	tr := NewTracer()
+	span := tr.StartSpan("op")
+	carrier := opentracing.TextMapCarrier{}
+	require.NoError(t, tr.Inject(span.Context(), opentracing.TextMap, carrier))
+	buf := new(bytes.Buffer)
+	require.NoError(t, tr.Inject(span.Context(), opentracing.Binary, buf))
+	span.Finish()
+	r.Close(2)
+	assert.NotEmpty(t, carrier[ao.HTTPSignatureHeaderName])
+	ctx, err := tr.Extract(opentracing.Binary, buf)
+	require.NoError(t, err)
+	assert.NotEmpty(t, ctx.(spanContext).remoteSig)
+}
@@ -2,7 +2,10 @@
 
 package opentracing
 
-import "github.com/opentracing/opentracing-go/ext"
+import (
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/opentracing/opentracing-go/ext"
+)
 
 // Map selected OpenTracing tag constants to AppOptics analogs
 var otAOMap = map[string]string{
@@ -28,10 +31,19 @@ func translateTagName(key string) string {
 	return key
 }
 
+// translateTagValue redacts the URLs of the translated tags, see ao.RedactURL.
+func translateTagValue(key string, value interface{}) interface{} {
+	if s, ok := value.(string); ok && (key == "URL" || key == "RemoteURL") {
+		return ao.RedactURL(s)
+	}
+	return value
+}
+
 func translateTags(tags map[string]interface{}) map[string]interface{} {
 	ret := make(map[string]interface{})
 	for k, v := range tags {
-		ret[translateTagName(k)] = v
+		k = translateTagName(k)
+		ret[k] = translateTagValue(k, v)
 	}
 	return ret
 }
@@ -46,7 +46,8 @@ func (t *Tracer) startSpanWithOptions(operationName string, opts ot.StartSpanOpt
 			if refCtx.span == nil { // referenced spanContext created by Extract()
 				var span ao.Span
 				if refCtx.sampled {
-					span = ao.NewTraceFromID(operationName, refCtx.remoteMD, func() ao.KVMap {
+					src := ao.TraceSource{Signature: refCtx.remoteSig}
+					span = ao.NewTraceFromSource(operationName, refCtx.remoteMD, src, func() ao.KVMap {
 						return translateTags(opts.Tags)
 					})
 				} else {
@@ -73,8 +74,9 @@ type spanContext struct {
 	// 1. spanContext created by StartSpanWithOptions
 	span ao.Span
 	// 2. spanContext created by Extract()
-	remoteMD string
-	sampled  bool
+	remoteMD  string
+	remoteSig string // the signature of remoteMD, if any
+	sampled   bool
 
 	// The span's associated baggage.
 	baggage map[string]string // initialized on first use
@@ -123,7 +125,7 @@ func (c spanContext) WithBaggageItem(key, val string) spanContext {
 		newBaggage[key] = val
 	}
 	// Use positional parameters so the compiler will help catch new fields.
-	return spanContext{c.span, c.remoteMD, c.sampled, newBaggage}
+	return spanContext{c.span, c.remoteMD, c.remoteSig, c.sampled, newBaggage}
 }
 
 // BaggageItem returns the baggage item with the provided key.
@@ -190,7 +192,8 @@ func (s *spanImpl) SetOperationName(operationName string) ot.Span {
 func (s *spanImpl) SetTag(key string, value interface{}) ot.Span {
 	s.Lock()
 	defer s.Unlock()
-	s.context.span.AddEndArgs(translateTagName(key), value)
+	key = translateTagName(key)
+	s.context.span.AddEndArgs(key, translateTagValue(key, value))
 	return s
 }
 
@@ -0,0 +1,80 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+)
+
+// samplingRule is a compiled config.SamplingRule
+type samplingRule struct {
+	spanName string
+	url      *regexp.Regexp
+	method   string
+	rate     reporter.LocalSampleRate
+}
+
+// the compiled sampling rules of the configuration, it's a []samplingRule.
+var samplingRules atomic.Value
+
+func init() {
+	registerCompiledConfig(loadSamplingRules, "SamplingRules")
+}
+
+// loadSamplingRules compiles the sampling rules of the configuration.
+func loadSamplingRules() {
+	var rules []samplingRule
+	for _, r := range config.GetSamplingRules() {
+		if err := r.Validate(); err != nil {
+			aolog.Warningf("Ignored the sampling rule: %v", err)
+			continue
+		}
+		sr := samplingRule{
+			spanName: r.SpanName,
+			method:   strings.ToUpper(r.Method),
+			rate:     reporter.LocalSampleRate{Rate: r.SampleRate, Override: r.Override},
+		}
+		if r.URL != "" {
+			sr.url = regexp.MustCompile(r.URL)
+		}
+		rules = append(rules, sr)
+	}
+	samplingRules.Store(rules)
+}
+
+// matches returns whether the rule matches the span name and the inbound HTTP
+// request. The rules with a URL or method never match a nil request.
+func (sr *samplingRule) matches(spanName string, r *http.Request) bool {
+	if sr.spanName != "" && sr.spanName != spanName {
+		return false
+	}
+	if sr.url == nil && sr.method == "" {
+		return true
+	}
+	if r == nil {
+		return false
+	}
+	return (sr.url == nil || sr.url.MatchString(r.URL.Path)) &&
+		(sr.method == "" || sr.method == strings.ToUpper(r.Method))
+}
+
+// localSampleRateOf returns the sample rate of the first sampling rule matching
+// the span name and the inbound HTTP request, which may be nil, or nil if there
+// is no such rule.
+func localSampleRateOf(spanName string, r *http.Request) *reporter.LocalSampleRate {
+	rules, _ := samplingRules.Load().([]samplingRule)
+	for i := range rules {
+		if rules[i].matches(spanName, r) {
+			rate := rules[i].rate
+			return &rate
+		}
+	}
+	return nil
+}
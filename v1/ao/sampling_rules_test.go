@@ -0,0 +1,38 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSampleRateOf(t *testing.T) {
+	defer UpdateConfig(WithSamplingRules())
+
+	assert.Nil(t, localSampleRateOf("cron", nil))
+
+	require.NoError(t, UpdateConfig(WithSamplingRules(
+		SamplingRule{URL: "^/checkout", Method: "post", SampleRate: 1000000, Override: true},
+		SamplingRule{Method: "GET", SampleRate: 100000},
+		SamplingRule{SpanName: "cron", SampleRate: 0},
+		SamplingRule{SpanName: "api", URL: "^/api/", SampleRate: 500000},
+	)))
+
+	assert.Equal(t, &reporter.LocalSampleRate{Rate: 1000000, Override: true},
+		localSampleRateOf("http", httptest.NewRequest("POST", "/checkout/1", nil)))
+	assert.Equal(t, &reporter.LocalSampleRate{Rate: 100000},
+		localSampleRateOf("http", httptest.NewRequest("GET", "/checkout/1", nil)))
+	assert.Nil(t, localSampleRateOf("http", httptest.NewRequest("PUT", "/checkout/1", nil)))
+
+	// the rules with a URL or method only match the HTTP requests
+	assert.Equal(t, &reporter.LocalSampleRate{Rate: 0}, localSampleRateOf("cron", nil))
+	assert.Nil(t, localSampleRateOf("api", nil))
+	assert.Equal(t, &reporter.LocalSampleRate{Rate: 500000},
+		localSampleRateOf("api", httptest.NewRequest("DELETE", "/api/users", nil)))
+	assert.Nil(t, localSampleRateOf("api", httptest.NewRequest("DELETE", "/users", nil)))
+}
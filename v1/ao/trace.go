@@ -71,12 +71,19 @@ type traceHTTPSpan struct {
 	start      time.Time
 	controller string
 	action     string
+	// the transaction name given by the web framework, e.g., the route template
+	txnName string
+	// the URL path before it's masked, which is matched by the transaction
+	// name rules
+	rawPath string
 }
 
 type aoTrace struct {
 	layerSpan
 	exitEvent reporter.Event
 	httpSpan  traceHTTPSpan
+	// the agent which reports this trace
+	agent *Agent
 }
 
 func (t *aoTrace) aoContext() reporter.Context { return t.aoCtx }
@@ -98,26 +105,21 @@ func NewTraceWithOptions(spanName string, opts SpanOptions) Trace {
 
 // NewTraceFromID creates a new Trace for reporting to AppOptics, provided an
 // incoming trace ID (e.g. from a incoming RPC or service call's "X-Trace" header).
-// If callback is provided & trace is sampled, cb will be called for entry event KVs
+// If callback is provided & trace is sampled, cb will be called for entry event KVs.
+// The trace ID comes from an unknown source, so it's ignored and a new trace is
+// started if the trusted trace sources or the shared secret are configured, see
+// NewTraceFromSource.
 func NewTraceFromID(spanName, mdStr string, cb func() KVMap) Trace {
-	if Disabled() || Closed() {
-		return NewNullTrace()
-	}
+	return defaultAgent.NewTraceFromID(spanName, mdStr, cb)
+}
 
-	ctx, ok := reporter.NewContext(spanName, mdStr, true, func() map[string]interface{} {
-		if cb != nil {
-			return cb()
-		}
-		return nil
-	})
-	if !ok {
-		return NewNullTrace()
-	}
-	t := &aoTrace{
-		layerSpan: layerSpan{span: span{aoCtx: ctx, labeler: spanLabeler{spanName}}},
-	}
-	t.SetStartTime(time.Now())
-	return t
+// NewTraceFromSource creates a new Trace for reporting to AppOptics, provided an
+// incoming trace ID and the source it comes from. The trace ID is continued only
+// if it's trusted: it's signed with the shared secret of the configuration, or the
+// peer and all the X-Forwarded-For addresses of the source are trusted sources.
+// Otherwise a new trace is started instead. See NewTraceFromID for the callback.
+func NewTraceFromSource(spanName, mdStr string, src TraceSource, cb func() KVMap) Trace {
+	return defaultAgent.NewTraceFromSource(spanName, mdStr, src, cb)
 }
 
 // SetTransactionName can be called inside a http handler to set the custom transaction name.
@@ -125,6 +127,31 @@ func SetTransactionName(ctx context.Context, name string) error {
 	return TraceFromContext(ctx).SetTransactionName(name)
 }
 
+// SetFrameworkTransactionName can be called by the instrumentation of a web framework to name
+// the transaction, e.g., by the matched route template "GET /users/{id}". Unlike
+// SetTransactionName, it takes precedence over neither the custom transaction name nor the
+// transaction name rules.
+func SetFrameworkTransactionName(ctx context.Context, name string) {
+	if t, ok := TraceFromContext(ctx).(*aoTrace); ok {
+		t.httpSpan.txnName = name
+	}
+}
+
+// setClientIP sets the client IP of the trace, which is a tag of the metrics.
+func setClientIP(t Trace, ip string) {
+	if at, ok := t.(*aoTrace); ok {
+		at.httpSpan.span.ClientIP = ip
+	}
+}
+
+// setRawPath sets the URL path of the trace before it's masked, see
+// WithURLPathMasks.
+func setRawPath(t Trace, path string) {
+	if at, ok := t.(*aoTrace); ok {
+		at.httpSpan.rawPath = path
+	}
+}
+
 // GetTransactionName fetches the current transaction name from the context
 func GetTransactionName(ctx context.Context) string {
 	return TraceFromContext(ctx).GetTransactionName()
@@ -227,11 +254,11 @@ func (t *aoTrace) ExitMetadata() (mdHex string) {
 	return
 }
 
-// recordHTTPSpan extract http status, controller and action from the deferred endArgs
-// and fill them into trace's httpSpan struct. The data is then sent to the span message channel.
+// recordHTTPSpan extract http status, controller, action and the response stats from the deferred
+// endArgs and fill them into trace's httpSpan struct. The data is then sent to the span message channel.
 func (t *aoTrace) recordHTTPSpan() {
 	var controller, action string
-	num := len([]string{keyStatus, keyController, keyAction})
+	num := len([]string{keyStatus, keyController, keyAction, keyResponseBytes, keyTTFB, keyHijacked})
 	for i := 0; (i+1 < len(t.endArgs)) && (num > 0); i += 2 {
 		k, isStr := t.endArgs[i].(string)
 		if !isStr {
@@ -251,6 +278,19 @@ func (t *aoTrace) recordHTTPSpan() {
 		} else if k == keyAction {
 			action += t.endArgs[i+1].(string)
 			num--
+		} else if k == keyResponseBytes {
+			if v, ok := t.endArgs[i+1].(*int64); ok {
+				t.httpSpan.span.ResponseBytes = *v
+			}
+			num--
+		} else if k == keyTTFB {
+			if v, ok := t.endArgs[i+1].(int64); ok {
+				t.httpSpan.span.TimeToFirstByte = time.Duration(v) * time.Microsecond
+			}
+			num--
+		} else if k == keyHijacked {
+			t.httpSpan.span.Hijacked, _ = t.endArgs[i+1].(bool)
+			num--
 		}
 	}
 
@@ -260,26 +300,37 @@ func (t *aoTrace) recordHTTPSpan() {
 		t.httpSpan.span.HasError = true
 	}
 
-	reporter.ReportSpan(&t.httpSpan.span)
+	t.agent.reportSpan(&t.httpSpan.span)
 
 	// This will add the TransactionName KV into the exit event.
 	t.endArgs = append(t.endArgs, keyTransactionName, t.httpSpan.span.Transaction)
 }
 
 // finalizeTxnName finalizes the transaction name based on the following factors:
-// custom transaction name, action/controller, Path and the value of APPOPTICS_PREPEND_DOMAIN
+// custom transaction name, the transaction name rules, action/controller, Path and
+// the value of APPOPTICS_PREPEND_DOMAIN
 func (t *aoTrace) finalizeTxnName(controller string, action string) {
 	// The precedence:
-	// custom transaction name > framework specific transaction naming > controller.action > 1st and 2nd segment of Path
+	// custom transaction name > transaction name rules > framework specific transaction naming >
+	// controller.action > the first segments of Path
+	// the rules match the path before it's masked
+	rulesPath := t.httpSpan.rawPath
+	if rulesPath == "" {
+		rulesPath = t.httpSpan.span.Path
+	}
 	customTxnName := t.aoCtx.GetTransactionName()
 	if customTxnName != "" {
 		t.httpSpan.span.Transaction = customTxnName
+	} else if name, ok := txnNameFromRules(rulesPath); ok {
+		t.httpSpan.span.Transaction = name
+	} else if t.httpSpan.txnName != "" {
+		t.httpSpan.span.Transaction = t.httpSpan.txnName
 	} else if t.httpSpan.controller != "" && t.httpSpan.action != "" {
 		t.httpSpan.span.Transaction = t.httpSpan.controller + "." + t.httpSpan.action
 	} else if controller != "" && action != "" {
 		t.httpSpan.span.Transaction = controller + "." + action
 	} else if t.httpSpan.span.Path != "" {
-		t.httpSpan.span.Transaction = reporter.GetTransactionFromPath(t.httpSpan.span.Path)
+		t.httpSpan.span.Transaction = txnNameFromPath(t.httpSpan.span.Path)
 	}
 
 	if t.httpSpan.span.Transaction == "" {
@@ -0,0 +1,213 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+)
+
+// HTTPSignatureHeaderName is the HTTP header of the signature of the X-Trace header, e.g.,
+// "ts=1546300800;sig=...". The sig is the hex encoded HMAC-SHA256 of the X-Trace header and the
+// ts, the Unix time when it's signed, joined by a semicolon, with the shared secret of the
+// configuration. The signature expires after a few minutes.
+const HTTPSignatureHeaderName = "X-Trace-Signature"
+
+// TraceSource describes where an incoming trace ID comes from, which decides
+// whether it's trusted, see NewTraceFromSource.
+type TraceSource struct {
+	// Signature is the signature of the trace ID, e.g., the value of the
+	// X-Trace-Signature header, see HTTPSignatureHeaderName.
+	Signature string
+	// Peer is the IP address of the peer which sends the trace ID.
+	Peer string
+	// ForwardedFor is the values of the X-Forwarded-For header, if any.
+	ForwardedFor []string
+}
+
+// SignTraceID returns the signature of the trace ID sent to the host, which is
+// sent along with it as the X-Trace-Signature header, see HTTPSignatureHeaderName.
+// It returns an empty string if the configuration has no shared secret or the host
+// is not a destination to be signed.
+func SignTraceID(mdStr, host string) string {
+	return currentTraceTrust().sign(mdStr, host)
+}
+
+// The max difference between the timestamp of a signed X-Trace header and the
+// local time, the same as the one of X-Trace-Options.
+const traceSignatureTimestampWindow = traceOptionsTimestampWindow
+
+// traceTrust is the compiled trust boundary of the inbound trace context.
+type traceTrust struct {
+	sources []*net.IPNet
+	secret  []byte
+	// the host patterns of the outbound requests which are signed, all of them
+	// are signed if it's empty.
+	destinations []string
+}
+
+// the compiled trust boundary of the configuration, it's a *traceTrust.
+var traceTrustConf atomic.Value
+
+func init() {
+	registerCompiledConfig(loadTraceTrust, "TrustedTraceSources", "TraceContextSecret",
+		"TraceContextSignDestinations")
+}
+
+// loadTraceTrust compiles the trust boundary of the configuration.
+func loadTraceTrust() {
+	tt := &traceTrust{}
+	for _, s := range config.GetTrustedTraceSources() {
+		n, err := config.ParseIPNet(s)
+		if err != nil {
+			aolog.Warningf("Ignored the trusted trace source: %v", err)
+			continue
+		}
+		tt.sources = append(tt.sources, n)
+	}
+	if secret := config.GetTraceContextSecret(); secret != "" {
+		tt.secret = []byte(secret)
+	}
+	for _, d := range config.GetTraceContextSignDestinations() {
+		tt.destinations = append(tt.destinations, strings.ToLower(strings.TrimSpace(d)))
+	}
+	traceTrustConf.Store(tt)
+}
+
+// currentTraceTrust returns the compiled trust boundary.
+func currentTraceTrust() *traceTrust {
+	tt, _ := traceTrustConf.Load().(*traceTrust)
+	if tt == nil {
+		return &traceTrust{}
+	}
+	return tt
+}
+
+// sign returns the signature of the trace context of the outbound request to
+// the host, or an empty string if there is no shared secret or the host is
+// not a destination to be signed.
+func (tt *traceTrust) sign(md, host string) string {
+	if len(tt.secret) == 0 || !tt.signs(host) {
+		return ""
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	return "ts=" + ts + ";sig=" + tt.mac(md, ts)
+}
+
+// mac returns the hex encoded HMAC of the trace context and the timestamp.
+func (tt *traceTrust) mac(md, ts string) string {
+	mac := hmac.New(sha256.New, tt.secret)
+	mac.Write([]byte(md + ";" + ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signs returns whether the trace context of the outbound request to the host
+// is signed. A pattern "*.example.com" matches the subdomains of example.com.
+func (tt *traceTrust) signs(host string) bool {
+	if len(tt.destinations) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, d := range tt.destinations {
+		if strings.HasPrefix(d, "*.") {
+			if strings.HasSuffix(host, d[1:]) {
+				return true
+			}
+		} else if host == d {
+			return true
+		}
+	}
+	return false
+}
+
+// verify returns whether the signature of the trace context is valid and not
+// expired.
+func (tt *traceTrust) verify(md, signature string) bool {
+	var ts, sig string
+	for _, kv := range strings.Split(signature, ";") {
+		kv := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(kv) != 2 {
+			return false
+		}
+		switch kv[0] {
+		case "ts":
+			ts = kv[1]
+		case "sig":
+			sig = strings.ToLower(kv[1])
+		}
+	}
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return false
+	}
+	d := time.Since(time.Unix(t, 0))
+	if t <= 0 || d > traceSignatureTimestampWindow || d < -traceSignatureTimestampWindow {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(tt.mac(md, ts)))
+}
+
+// trustsRequest returns whether the trace context of the inbound request is
+// continued, see trusts.
+func (tt *traceTrust) trustsRequest(r *http.Request, md string) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return tt.trusts(md, r.Header.Get(HTTPSignatureHeaderName), host,
+		r.Header[http.CanonicalHeaderKey("X-Forwarded-For")]...)
+}
+
+// trusts returns whether the trace context is continued, given its signature,
+// the address of the peer and the X-Forwarded-For values it comes through.
+// Everything is trusted unless the trusted sources or the shared secret are
+// configured. Otherwise the trace context must be signed, or the peer address
+// and all the X-Forwarded-For addresses must be trusted.
+func (tt *traceTrust) trusts(md, signature, peer string, forwardedFor ...string) bool {
+	if len(tt.sources) == 0 && len(tt.secret) == 0 {
+		return true
+	}
+	if signature != "" && len(tt.secret) > 0 {
+		if tt.verify(md, signature) {
+			return true
+		}
+	}
+	if len(tt.sources) == 0 {
+		return false
+	}
+	if !tt.trustsAddr(peer) {
+		return false
+	}
+	for _, xff := range forwardedFor {
+		for _, addr := range strings.Split(xff, ",") {
+			if !tt.trustsAddr(strings.TrimSpace(addr)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// trustsAddr returns whether the IP address is in a trusted source.
+func (tt *traceTrust) trustsAddr(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range tt.sources {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
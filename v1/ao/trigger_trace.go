@@ -0,0 +1,172 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+)
+
+// The HTTP headers of the trigger traces. The X-Trace-Options header requests a
+// trigger trace and carries the custom KVs of the entry event, e.g.,
+// "trigger-trace;custom-ticket=1234;ts=1546300800". It may be signed by the
+// X-Trace-Options-Signature header, which is the hex encoded HMAC-SHA1 of the
+// X-Trace-Options header with the token of the service key. The decision is
+// echoed by the X-Trace-Options-Response header of the response, e.g.,
+// "auth=ok;trigger-trace=ok".
+const (
+	HTTPTraceOptionsHeaderName          = "X-Trace-Options"
+	HTTPTraceOptionsSignatureHeaderName = "X-Trace-Options-Signature"
+	HTTPTraceOptionsResponseHeaderName  = "X-Trace-Options-Response"
+)
+
+// The max difference between the timestamp of a signed X-Trace-Options header
+// and the local time
+const traceOptionsTimestampWindow = 5 * time.Minute
+
+// The KV of the pd-keys option
+const keyPDKeys = "PDKeys"
+
+// The results of the authentication of a signed X-Trace-Options header
+const (
+	traceOptionsAuthOK             = "ok"
+	traceOptionsAuthBadTimestamp   = "bad-timestamp"
+	traceOptionsAuthBadSignature   = "bad-signature"
+	traceOptionsAuthNoSignatureKey = "no-signature-key"
+)
+
+// The decisions of the trigger traces which are not made by the settings, see
+// reporter.TriggerTraceOK for the others.
+const (
+	triggerTraceNotRequested = "not-requested"
+	triggerTraceIgnored      = "ignored"
+)
+
+// traceOptions is the parsed X-Trace-Options header of a request.
+type traceOptions struct {
+	trigger   bool
+	timestamp int64
+	kvs       KVMap
+	ignored   []string
+	// the result of the authentication, it's empty if the header is not signed
+	auth string
+	// the decision of the trigger trace
+	decision string
+}
+
+// parseTraceOptions parses the X-Trace-Options header and authenticates it
+// by the signature, if any. It returns nil if there is no such header. The
+// unknown or invalid options are ignored, and the first one of the duplicate
+// options is kept.
+func parseTraceOptions(header, signature, serviceKey string) *traceOptions {
+	if header == "" {
+		return nil
+	}
+	o := &traceOptions{kvs: KVMap{}}
+	seen := make(map[string]bool)
+	for _, opt := range strings.Split(header, ";") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		switch {
+		case key == "trigger-trace" && len(kv) == 1:
+			o.trigger = true
+		case key == "ts" && len(kv) == 2:
+			ts, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+			if err != nil {
+				o.ignored = append(o.ignored, key)
+				continue
+			}
+			o.timestamp = ts
+		case key == "pd-keys" && len(kv) == 2:
+			o.kvs[keyPDKeys] = strings.TrimSpace(kv[1])
+		case strings.HasPrefix(key, "custom-") && len(key) > len("custom-") &&
+			!strings.ContainsAny(key, " \t") && len(kv) == 2:
+			o.kvs[key] = strings.TrimSpace(kv[1])
+		default:
+			o.ignored = append(o.ignored, key)
+		}
+	}
+	if signature != "" {
+		o.auth = o.authenticate(header, signature, serviceKey)
+	}
+	return o
+}
+
+// authenticate verifies the signature of the header with the token of the
+// service key, the timestamp of the header must be recent.
+func (o *traceOptions) authenticate(header, signature, serviceKey string) string {
+	token := strings.SplitN(serviceKey, ":", 2)[0]
+	if token == "" {
+		return traceOptionsAuthNoSignatureKey
+	}
+	d := time.Since(time.Unix(o.timestamp, 0))
+	if o.timestamp <= 0 || d > traceOptionsTimestampWindow || d < -traceOptionsTimestampWindow {
+		return traceOptionsAuthBadTimestamp
+	}
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(header))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		return traceOptionsAuthBadSignature
+	}
+	return traceOptionsAuthOK
+}
+
+// authorized returns whether the options are honored, i.e., the header is not
+// signed or it's authenticated. Otherwise the request is traced as if there
+// were no such header.
+func (o *traceOptions) authorized() bool {
+	return o.auth == "" || o.auth == traceOptionsAuthOK
+}
+
+// startsTrigger returns whether a trigger trace is started for the request
+// with the X-Trace header md and the sampling override of the URL filters.
+// Otherwise the decision is made here.
+func (o *traceOptions) startsTrigger(md string, override reporter.SamplingOverride) bool {
+	switch {
+	case !o.authorized():
+	case !o.trigger:
+		o.decision = triggerTraceNotRequested
+	case md != "":
+		// the trace is continued regardless of the trigger
+		o.decision = triggerTraceIgnored
+	case override == reporter.SampleNever:
+		o.decision = reporter.TriggerTraceTracingDisabled
+	case !config.GetTriggerTrace():
+		o.decision = reporter.TriggerTraceDisabled
+	default:
+		return true
+	}
+	return false
+}
+
+// response returns the X-Trace-Options-Response header, e.g.,
+// "auth=ok;trigger-trace=ok;ignored=foo,bar".
+func (o *traceOptions) response() string {
+	var resp []string
+	if o.auth != "" {
+		resp = append(resp, "auth="+o.auth)
+	}
+	if o.authorized() {
+		resp = append(resp, "trigger-trace="+o.decision)
+		if len(o.ignored) > 0 {
+			resp = append(resp, "ignored="+strings.Join(o.ignored, ","))
+		}
+	}
+	return strings.Join(resp, ";")
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceOptions(t *testing.T) {
+	assert.Nil(t, parseTraceOptions("", "", ""))
+
+	o := parseTraceOptions("trigger-trace; custom-ticket = 1234;pd-keys=lo:se,check-id:123;foo;custom-ticket=5;"+
+		"custom-=x;ts=now;trigger-trace=1", "", "")
+	require.NotNil(t, o)
+	assert.True(t, o.trigger)
+	assert.Equal(t, KVMap{"custom-ticket": "1234", keyPDKeys: "lo:se,check-id:123"}, o.kvs)
+	assert.Equal(t, []string{"foo", "custom-", "ts"}, o.ignored)
+	assert.Equal(t, "", o.auth)
+	assert.True(t, o.authorized())
+
+	assert.True(t, o.startsTrigger("", reporter.SampleBySettings))
+	assert.False(t, o.startsTrigger("2B0123", reporter.SampleBySettings))
+	assert.Equal(t, "trigger-trace=ignored;ignored=foo,custom-,ts", o.response())
+	assert.False(t, o.startsTrigger("", reporter.SampleNever))
+	assert.Equal(t, reporter.TriggerTraceTracingDisabled, o.decision)
+
+	o = parseTraceOptions("custom-ticket=1234", "", "")
+	assert.False(t, o.trigger)
+	assert.False(t, o.startsTrigger("", reporter.SampleBySettings))
+	assert.Equal(t, "trigger-trace=not-requested", o.response())
+
+	require.NoError(t, UpdateConfig(WithTriggerTrace(false)))
+	defer UpdateConfig(WithTriggerTrace(true))
+	o = parseTraceOptions("trigger-trace", "", "")
+	assert.False(t, o.startsTrigger("", reporter.SampleBySettings))
+	assert.Equal(t, "trigger-trace=trigger-tracing-disabled", o.response())
+}
+
+func TestAuthenticateTraceOptions(t *testing.T) {
+	sign := func(header, token string) string {
+		mac := hmac.New(sha1.New, []byte(token))
+		mac.Write([]byte(header))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	const serviceKey = "token:service"
+	header := fmt.Sprintf("trigger-trace;custom-ticket=1234;ts=%d", time.Now().Unix())
+
+	o := parseTraceOptions(header, sign(header, "token"), serviceKey)
+	assert.Equal(t, traceOptionsAuthOK, o.auth)
+	assert.True(t, o.startsTrigger("", reporter.SampleBySettings))
+	o.decision = reporter.TriggerTraceOK
+	assert.Equal(t, "auth=ok;trigger-trace=ok", o.response())
+
+	o = parseTraceOptions(header, sign(header, "another"), serviceKey)
+	assert.Equal(t, traceOptionsAuthBadSignature, o.auth)
+	assert.False(t, o.authorized())
+	assert.False(t, o.startsTrigger("", reporter.SampleBySettings))
+	assert.Equal(t, "auth=bad-signature", o.response())
+
+	o = parseTraceOptions(header, sign(header, "token"), "")
+	assert.Equal(t, "auth=no-signature-key", o.response())
+
+	for _, ts := range []string{"", ";ts=0", fmt.Sprintf(";ts=%d", time.Now().Add(-time.Hour).Unix())} {
+		header = "trigger-trace" + ts
+		o = parseTraceOptions(header, sign(header, "token"), serviceKey)
+		assert.Equal(t, traceOptionsAuthBadTimestamp, o.auth)
+	}
+}
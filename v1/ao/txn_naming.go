@@ -0,0 +1,95 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+)
+
+// The placeholders of the IDs in the URL path
+const (
+	txnNameIDPlaceholder   = "{id}"
+	txnNameUUIDPlaceholder = "{uuid}"
+	txnNameHexPlaceholder  = "{hex}"
+)
+
+var (
+	numericIDRegex = regexp.MustCompile(`^[0-9]+$`)
+	uuidRegex      = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexIDRegex     = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// txnNameRule is a compiled config.TransactionNameRule
+type txnNameRule struct {
+	regex *regexp.Regexp
+	name  string
+}
+
+// the compiled transaction name rules of the configuration, it's a
+// []txnNameRule.
+var txnNameRules atomic.Value
+
+func init() {
+	registerCompiledConfig(loadTxnNameRules, "TransactionNameRules")
+}
+
+// loadTxnNameRules compiles the transaction name rules of the configuration.
+func loadTxnNameRules() {
+	var rules []txnNameRule
+	for _, r := range config.GetTransactionNameRules() {
+		if err := r.Validate(); err != nil {
+			aolog.Warningf("Ignored the transaction name rule: %v", err)
+			continue
+		}
+		rules = append(rules, txnNameRule{regexp.MustCompile(r.Regex), r.Name})
+	}
+	txnNameRules.Store(rules)
+}
+
+// txnNameFromRules returns the transaction name of the URL path defined by the
+// first matching rule, or false if no rule matches.
+func txnNameFromRules(path string) (string, bool) {
+	rules, _ := txnNameRules.Load().([]txnNameRule)
+	for _, r := range rules {
+		if m := r.regex.FindStringSubmatchIndex(path); m != nil {
+			return string(r.regex.ExpandString(nil, r.name, path, m)), true
+		}
+	}
+	return "", false
+}
+
+// txnNameFromPath returns the transaction name made of the first segments of
+// the URL path, whose IDs are replaced by placeholders if required.
+func txnNameFromPath(path string) string {
+	if config.GetNormalizeTransactionIDs() {
+		path = normalizePathIDs(path)
+	}
+	depth := config.GetTransactionNameDepth()
+	if depth < 1 {
+		return reporter.GetTransactionFromPath(path)
+	}
+	return reporter.GetTransactionFromPathWithDepth(path, depth)
+}
+
+// normalizePathIDs replaces the numeric, UUID and hex IDs in the path by
+// placeholders, e.g., /users/123/orders becomes /users/{id}/orders
+func normalizePathIDs(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch {
+		case numericIDRegex.MatchString(s):
+			segments[i] = txnNameIDPlaceholder
+		case uuidRegex.MatchString(s):
+			segments[i] = txnNameUUIDPlaceholder
+		case hexIDRegex.MatchString(s):
+			segments[i] = txnNameHexPlaceholder
+		}
+	}
+	return strings.Join(segments, "/")
+}
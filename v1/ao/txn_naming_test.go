@@ -0,0 +1,46 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnNameFromPath(t *testing.T) {
+	defer UpdateConfig(WithTransactionNameRules(), WithNormalizeTransactionIDs(false),
+		WithTransactionNameDepth(2))
+
+	// the default: the first two segments
+	assert.Equal(t, "/users/123", txnNameFromPath("/users/123/orders"))
+	assert.Equal(t, "/", txnNameFromPath("/"))
+
+	require.NoError(t, UpdateConfig(WithNormalizeTransactionIDs(true), WithTransactionNameDepth(3)))
+	for path, txn := range map[string]string{
+		"/users/123/orders/456":                             "/users/{id}/orders",
+		"/users/456/orders":                                 "/users/{id}/orders",
+		"/carts/0b7e2a2c-6c4e-4c1b-9b39-12d9c4b6b1aa/items": "/carts/{uuid}/items",
+		"/blobs/507F1F77BCF86CD799439011":                   "/blobs/{hex}",
+		"/blobs/cafe/v2":                                    "/blobs/cafe/v2",
+	} {
+		assert.Equal(t, txn, txnNameFromPath(path), path)
+	}
+
+	// invalid depth
+	assert.Error(t, UpdateConfig(WithTransactionNameDepth(0)))
+	assert.Equal(t, "/users/{id}/orders", txnNameFromPath("/users/123/orders/456"))
+
+	require.NoError(t, UpdateConfig(WithTransactionNameRules(
+		TransactionNameRule{Regex: "^/api/v[0-9]+/(\\w+)", Name: "/api/$1"},
+		TransactionNameRule{Regex: "^/api/", Name: "api"})))
+	name, ok := txnNameFromRules("/api/v1/users/123")
+	assert.True(t, ok)
+	assert.Equal(t, "/api/users", name)
+	name, ok = txnNameFromRules("/api/status")
+	assert.True(t, ok)
+	assert.Equal(t, "api", name)
+	_, ok = txnNameFromRules("/users/123")
+	assert.False(t, ok)
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/reporter"
+)
+
+// urlFilter is a compiled config.URLFilter
+type urlFilter struct {
+	regex      *regexp.Regexp
+	extensions map[string]bool
+	action     string
+}
+
+// the compiled URL filters of the configuration, it's a []urlFilter.
+var urlFilters atomic.Value
+
+func init() {
+	registerCompiledConfig(loadURLFilters, "URLFilters")
+}
+
+// loadURLFilters compiles the URL filters of the configuration.
+func loadURLFilters() {
+	var filters []urlFilter
+	for _, f := range config.GetURLFilters() {
+		if err := f.Validate(); err != nil {
+			aolog.Warningf("Ignored the URL filter: %v", err)
+			continue
+		}
+		uf := urlFilter{action: f.Action}
+		if f.Regex != "" {
+			uf.regex = regexp.MustCompile(f.Regex)
+		}
+		if len(f.Extensions) > 0 {
+			uf.extensions = make(map[string]bool)
+			for _, ext := range f.Extensions {
+				uf.extensions[strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+			}
+		}
+		filters = append(filters, uf)
+	}
+	urlFilters.Store(filters)
+}
+
+// samplingOverrideOfURL returns the sampling override of the first URL filter
+// matching the path, and whether the request should be ignored entirely,
+// i.e., neither traced nor recorded in the metrics.
+func samplingOverrideOfURL(urlPath string) (override reporter.SamplingOverride, ignored bool) {
+	filters, _ := urlFilters.Load().([]urlFilter)
+	if len(filters) == 0 {
+		return reporter.SampleBySettings, false
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(urlPath), "."))
+	for _, f := range filters {
+		if (f.regex == nil || !f.regex.MatchString(urlPath)) && (ext == "" || !f.extensions[ext]) {
+			continue
+		}
+		switch f.action {
+		case config.URLFilterNoMetrics:
+			return reporter.SampleNever, true
+		case config.URLFilterNoTracing:
+			return reporter.SampleNever, false
+		case config.URLFilterForceSample:
+			return reporter.SampleAlways, false
+		}
+	}
+	return reporter.SampleBySettings, false
+}
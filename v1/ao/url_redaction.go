@@ -0,0 +1,145 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package ao
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao/internal/config"
+	aolog "github.com/appoptics/appoptics-apm-go/v1/ao/internal/log"
+)
+
+// The replacements of the redacted query values and the masked path segments
+const (
+	queryValueRedacted = "?"
+	pathSegmentMasked  = "*"
+)
+
+// urlRedaction is the compiled redaction policy of the reported URLs.
+type urlRedaction struct {
+	params    map[string]bool
+	dropQuery bool
+	pathMasks []*regexp.Regexp
+}
+
+// the compiled redaction policy of the configuration, it's a *urlRedaction.
+var urlRedactionConf atomic.Value
+
+func init() {
+	registerCompiledConfig(loadURLRedaction, "RedactedQueryParams", "DropQueryString", "URLPathMasks")
+}
+
+// loadURLRedaction compiles the redaction policy of the configuration.
+func loadURLRedaction() {
+	r := &urlRedaction{
+		params:    make(map[string]bool),
+		dropQuery: config.GetDropQueryString(),
+	}
+	for _, p := range config.GetRedactedQueryParams() {
+		r.params[strings.ToLower(p)] = true
+	}
+	for _, m := range config.GetURLPathMasks() {
+		re, err := regexp.Compile(m)
+		if err != nil || m == "" {
+			aolog.Warningf("Ignored the URL path mask: %q", m)
+			continue
+		}
+		r.pathMasks = append(r.pathMasks, re)
+	}
+	urlRedactionConf.Store(r)
+}
+
+// currentURLRedaction returns the compiled redaction policy.
+func currentURLRedaction() *urlRedaction {
+	r, _ := urlRedactionConf.Load().(*urlRedaction)
+	if r == nil {
+		return &urlRedaction{}
+	}
+	return r
+}
+
+// query returns the query string whose redacted parameters have the value
+// "?", or an empty string if the query strings are dropped.
+func (r *urlRedaction) query(rawQuery string) string {
+	if r.dropQuery {
+		return ""
+	}
+	if len(r.params) == 0 || rawQuery == "" {
+		return rawQuery
+	}
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		key := pair
+		if j := strings.IndexByte(pair, '='); j >= 0 {
+			key = pair[:j]
+		}
+		name := key
+		if k, err := url.QueryUnescape(key); err == nil {
+			name = k
+		}
+		if r.params[strings.ToLower(name)] {
+			pairs[i] = key + "=" + queryValueRedacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// path returns the escaped URL path whose segments matching a mask are
+// replaced by "*".
+func (r *urlRedaction) path(escapedPath string) string {
+	if len(r.pathMasks) == 0 {
+		return escapedPath
+	}
+	segments := strings.Split(escapedPath, "/")
+	for i, seg := range segments {
+		if seg == "" {
+			continue
+		}
+		if s, err := url.PathUnescape(seg); err == nil {
+			seg = s
+		}
+		for _, m := range r.pathMasks {
+			if m.MatchString(seg) {
+				segments[i] = pathSegmentMasked
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// RedactURL returns the URL redacted by the configuration, i.e., the values of
+// the redacted query parameters are replaced by "?", the path segments matching
+// the masks are replaced by "*", and the query string is dropped if required.
+// The password of the user info is always removed. It's applied to the URLs
+// reported by the inbound HTTP requests, BeginRemoteURLSpan,
+// BeginHTTPClientSpan and the OpenTracing tags.
+func RedactURL(rawURL string) string {
+	r := currentURLRedaction()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// only the query string is redacted if it's not a valid URL
+		if i := strings.IndexByte(rawURL, '?'); i >= 0 {
+			if q := r.query(rawURL[i+1:]); q != "" {
+				return rawURL[:i+1] + q
+			}
+			return rawURL[:i]
+		}
+		return rawURL
+	}
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+	if u.Opaque == "" {
+		if p := r.path(u.EscapedPath()); p != u.EscapedPath() {
+			u.RawPath = p
+			u.Path, _ = url.PathUnescape(p)
+		}
+	}
+	u.RawQuery = r.query(u.RawQuery)
+	u.ForceQuery = false
+	return u.String()
+}
@@ -0,0 +1,55 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package aochi provides the AppOptics instrumentation for the go-chi router.
+package aochi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/go-chi/chi"
+)
+
+const spanName = "chi"
+
+// Middleware traces the requests routed by a chi router. The transactions
+// are named by the method and the pattern of the matched route, e.g.,
+// "GET /users/{id}". The Controller is the route pattern and the Action is
+// the method. The trace is propagated to the handlers through the request's
+// context.
+//   r := chi.NewRouter()
+//   r.Use(aochi.Middleware)
+func Middleware(next http.Handler) http.Handler {
+	if ao.Disabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ao.AgentFromContext(r.Context()).Closed() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, w, r := ao.TraceFromHTTPRequestResponse(spanName, w, r)
+		// the route is matched after the middlewares of the router are
+		// called, so the pattern is known once the request is served.
+		defer func() {
+			var endArgs []interface{}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if pattern := rctx.RoutePattern(); pattern != "" {
+					ao.SetFrameworkTransactionName(r.Context(), r.Method+" "+pattern)
+					endArgs = append(endArgs, "Controller", pattern, "Action", r.Method)
+				}
+			}
+			t.End(endArgs...)
+		}()
+
+		defer func() { // catch and report panic, if one occurs
+			if err := recover(); err != nil {
+				t.Error("panic", fmt.Sprintf("%v", err))
+				panic(err) // re-raise the panic
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
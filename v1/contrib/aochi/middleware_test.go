@@ -0,0 +1,54 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aochi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
+	"github.com/appoptics/appoptics-apm-go/v1/contrib/aochi"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouter(t *testing.T) chi.Router {
+	r := chi.NewRouter()
+	r.Use(aochi.Middleware)
+	r.Route("/users", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			assert.True(t, ao.TraceFromContext(r.Context()).IsSampled())
+			assert.Equal(t, "123", chi.URLParam(r, "id"))
+			w.WriteHeader(http.StatusAccepted)
+		})
+	})
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) { panic("oops") })
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	r := aotest.NewReporter()
+	w := httptest.NewRecorder()
+	newRouter(t).ServeHTTP(w, httptest.NewRequest("GET", "/users/123", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.NotEmpty(t, w.Header().Get(ao.HTTPHeaderName))
+	r.Close(2)
+	r.Trace(t).AssertTree().NoError().Span("chi").
+		HasKV("TransactionName", "GET /users/{id}").
+		HasKV("Controller", "/users/{id}").
+		HasKV("Action", "GET").
+		HasKV("Status", http.StatusAccepted)
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	r := aotest.NewReporter()
+	assert.Panics(t, func() {
+		newRouter(t).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("chi").
+		HasKV("TransactionName", "GET /panic").
+		HasError("oops")
+}
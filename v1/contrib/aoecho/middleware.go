@@ -0,0 +1,95 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package aoecho provides the AppOptics instrumentation for the echo web
+// framework.
+package aoecho
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/labstack/echo"
+)
+
+const spanName = "echo"
+
+// Middleware returns a middleware which traces the requests handled by an
+// echo server. The transactions are named by the method and the path of the
+// matched route, e.g., "GET /users/:id". The Controller is the route path and
+// the Action is the method. The panics and the errors returned by the
+// handlers are reported, and the trace is propagated to the handlers through
+// c.Request().Context().
+//   e := echo.New()
+//   e.Use(aoecho.Middleware())
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if ao.Disabled() || ao.AgentFromContext(c.Request().Context()).Closed() {
+				return next(c)
+			}
+
+			res := c.Response()
+			t, w, r := ao.TraceFromHTTPRequestResponse(spanName, res.Writer, c.Request())
+			aoWriter := ao.HTTPResponseWriterOf(w)
+			c.SetRequest(r)
+			res.Writer = &responseWriter{ResponseWriter: w, orig: res.Writer}
+
+			defer func() {
+				var endArgs []interface{}
+				if path := c.Path(); path != "" {
+					ao.SetFrameworkTransactionName(r.Context(), r.Method+" "+path)
+					endArgs = append(endArgs, "Controller", path, "Action", r.Method)
+				}
+				aoWriter.StatusCode = res.Status
+				t.End(endArgs...)
+			}()
+
+			defer func() { // catch and report panic, if one occurs
+				if err := recover(); err != nil {
+					t.Error("panic", fmt.Sprintf("%v", err))
+					panic(err) // re-raise the panic
+				}
+			}()
+			if err = next(c); err != nil {
+				t.Error("error", err.Error())
+				// let the error handler write the response to observe the status
+				c.Error(err)
+			}
+			return err
+		}
+	}
+}
+
+// responseWriter is the writer of ao, which implements the optional
+// interfaces of the original writer except http.CloseNotifier. It implements
+// all the ones used by echo.Response, which are expected to be supported.
+type responseWriter struct {
+	http.ResponseWriter
+	orig http.ResponseWriter
+}
+
+// Flush implements the http.Flusher interface.
+func (w *responseWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// CloseNotify implements the http.CloseNotifier interface.
+func (w *responseWriter) CloseNotify() <-chan bool {
+	return w.orig.(http.CloseNotifier).CloseNotify()
+}
+
+// Push implements the http.Pusher interface.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aoecho_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
+	"github.com/appoptics/appoptics-apm-go/v1/contrib/aoecho"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newServer(t *testing.T) *echo.Echo {
+	e := echo.New()
+	e.Use(aoecho.Middleware())
+	e.GET("/users/:id", func(c echo.Context) error {
+		assert.True(t, ao.TraceFromContext(c.Request().Context()).IsSampled())
+		return c.String(http.StatusAccepted, "user "+c.Param("id"))
+	})
+	e.GET("/error", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad request")
+	})
+	e.GET("/internal", func(c echo.Context) error {
+		return errors.New("oops")
+	})
+	e.GET("/flush", func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusCreated)
+		c.Response().Flush()
+		return nil
+	})
+	e.GET("/panic", func(c echo.Context) error { panic("oops") })
+	return e
+}
+
+func TestMiddleware(t *testing.T) {
+	r := aotest.NewReporter()
+	w := httptest.NewRecorder()
+	newServer(t).ServeHTTP(w, httptest.NewRequest("GET", "/users/123", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "user 123", w.Body.String())
+	xt := w.Header().Get(ao.HTTPHeaderName)
+	assert.NotEmpty(t, xt)
+	r.Close(2)
+	tr := r.Trace(t).AssertTree().NoError()
+	tr.Span("echo").
+		HasKV("TransactionName", "GET /users/:id").
+		HasKV("Controller", "/users/:id").
+		HasKV("Action", "GET").
+		HasKV("Status", http.StatusAccepted)
+	assert.Equal(t, xt, tr.Span("echo").Exit.XTrace)
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	for path, status := range map[string]int{
+		"/error":    http.StatusBadRequest,
+		"/internal": http.StatusInternalServerError,
+	} {
+		r := aotest.NewReporter()
+		w := httptest.NewRecorder()
+		newServer(t).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, status, w.Code)
+		r.Close(3)
+		r.Trace(t).AssertTree().Span("echo").
+			HasKV("Status", status).
+			HasError("")
+	}
+
+	// the optional interfaces are served by the original writer
+	r := aotest.NewReporter()
+	w := httptest.NewRecorder()
+	newServer(t).ServeHTTP(w, httptest.NewRequest("GET", "/flush", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.True(t, w.Flushed)
+	r.Close(2)
+	r.Trace(t).AssertTree().Span("echo").HasKV("Status", http.StatusCreated)
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	r := aotest.NewReporter()
+	assert.Panics(t, func() {
+		newServer(t).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("echo").
+		HasKV("TransactionName", "GET /panic").
+		HasError("oops")
+}
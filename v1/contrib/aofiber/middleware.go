@@ -0,0 +1,143 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package aofiber provides the AppOptics instrumentation for the fiber web
+// framework.
+package aofiber
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/gofiber/fiber"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	spanName = "fiber"
+	// the key of the locals of a fiber context to the context of the trace
+	contextKey = "aofiber.context"
+)
+
+// Middleware returns a middleware which traces the requests handled by a fiber
+// app. The transactions are named by the method and the path of the matched
+// route, e.g., "GET /users/:id". The Controller is the route path and the
+// Action is the method, and the requests without a matching route are named
+// by the URL path. The panics and the errors passed to c.Next are reported.
+// Fiber is built on fasthttp rather than net/http, so the trace is propagated
+// to the handlers through Context(c) instead of c.Context().
+//   app := fiber.New()
+//   app.Use(aofiber.Middleware())
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) {
+		req, err := newRequest(c)
+		if err != nil || ao.Disabled() || ao.AgentFromContext(req.Context()).Closed() {
+			c.Next()
+			return
+		}
+
+		res := &c.Fasthttp.Response
+		rw := &responseWriter{res: res, header: http.Header{}}
+		t, w, r := ao.TraceFromHTTPRequestResponse(spanName, rw, req)
+		aoWriter := ao.HTTPResponseWriterOf(w)
+		rw.writeHeaders() // e.g., X-Trace-Options-Response
+		c.Locals(contextKey, r.Context())
+		// the route of the middleware, which is still the route of the context
+		// after the handlers return if no other route matches
+		own := c.Route()
+
+		defer func() {
+			var endArgs []interface{}
+			if route := c.Route(); route != own {
+				ao.SetFrameworkTransactionName(r.Context(), route.Method+" "+route.Path)
+				endArgs = append(endArgs, "Controller", route.Path, "Action", route.Method)
+			}
+			// fiber writes the response by fasthttp, which is observed once
+			// the handlers return
+			rw.readHeaders()
+			aoWriter.WriteHeader(res.StatusCode())
+			aoWriter.BytesWritten = int64(len(res.Body()))
+			t.End(endArgs...)
+		}()
+
+		defer func() { // catch and report panic, if one occurs
+			if err := recover(); err != nil {
+				t.Error("panic", fmt.Sprintf("%v", err))
+				panic(err) // re-raise the panic
+			}
+		}()
+		c.Next()
+
+		if err := c.Error(); err != nil {
+			t.Error("error", err.Error())
+		}
+	}
+}
+
+// Context returns the context of the trace of a request traced by the
+// middleware, which can be passed to the ao APIs, e.g., ao.TraceFromContext.
+// It returns c.Context() if the request is not traced.
+func Context(c *fiber.Ctx) context.Context {
+	if ctx, ok := c.Locals(contextKey).(context.Context); ok {
+		return ctx
+	}
+	return c.Context()
+}
+
+// newRequest returns an http.Request of the fasthttp request of a fiber
+// context, which has the method, the URL, the host, the remote address and
+// the headers. The body is not read.
+func newRequest(c *fiber.Ctx) (*http.Request, error) {
+	r, err := http.NewRequest(c.Method(), c.OriginalURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Host = string(c.Fasthttp.Host())
+	r.RemoteAddr = c.Fasthttp.RemoteAddr().String()
+	c.Fasthttp.Request.Header.VisitAll(func(k, v []byte) {
+		r.Header.Add(string(k), string(v))
+	})
+	return r, nil
+}
+
+// responseWriter is an http.ResponseWriter of a fasthttp response, which lets
+// the writer of ao observe the response written by fiber and set the X-Trace
+// header. The status and the body are written by fiber.
+type responseWriter struct {
+	res    *fasthttp.Response
+	header http.Header
+}
+
+// Header implements the http.ResponseWriter interface.
+func (w *responseWriter) Header() http.Header { return w.header }
+
+// writeHeaders sets the headers of the fasthttp response to the ones set by
+// ao before the request is handled.
+func (w *responseWriter) writeHeaders() {
+	for k := range w.header {
+		w.res.Header.Set(k, w.header.Get(k))
+	}
+}
+
+// readHeaders replaces the headers by the ones of the fasthttp response, which
+// are written by fiber.
+func (w *responseWriter) readHeaders() {
+	w.header = http.Header{}
+	w.res.Header.VisitAll(func(k, v []byte) {
+		w.header.Add(string(k), string(v))
+	})
+}
+
+// WriteHeader implements the http.ResponseWriter interface, it sets the
+// X-Trace header of the fasthttp response.
+func (w *responseWriter) WriteHeader(status int) {
+	if xt := w.header.Get(ao.HTTPHeaderName); xt != "" {
+		w.res.Header.Set(ao.HTTPHeaderName, xt)
+	}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	return w.res.BodyWriter().Write(p)
+}
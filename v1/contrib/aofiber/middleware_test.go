@@ -0,0 +1,127 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aofiber_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
+	"github.com/appoptics/appoptics-apm-go/v1/contrib/aofiber"
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/fiber/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newApp(t *testing.T) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.Recover())
+	app.Use(aofiber.Middleware())
+	app.Get("/users/:id", func(c *fiber.Ctx) {
+		assert.True(t, ao.TraceFromContext(aofiber.Context(c)).IsSampled())
+		c.Status(http.StatusAccepted).SendString("user " + c.Params("id"))
+	})
+	app.Get("/error", func(c *fiber.Ctx) {
+		c.Next(fiber.NewError(http.StatusBadRequest, "oops"))
+	})
+	app.Get("/header", func(c *fiber.Ctx) {
+		c.Set("Set-Cookie", "a=1")
+		c.SendStatus(http.StatusCreated)
+	})
+	app.Get("/panic", func(c *fiber.Ctx) { panic(errors.New("oops")) })
+	return app
+}
+
+// serve serves a request by the fiber test helper, which returns the response
+// and its body.
+func serve(t *testing.T, app *fiber.App, req *http.Request) (*http.Response, string) {
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	r := aotest.NewReporter()
+	resp, body := serve(t, newApp(t), httptest.NewRequest("GET", "/users/123", nil))
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "user 123", body)
+	xt := resp.Header.Get(ao.HTTPHeaderName)
+	assert.NotEmpty(t, xt)
+	r.Close(2)
+	tr := r.Trace(t).AssertTree().NoError()
+	tr.Span("fiber").
+		HasKV("TransactionName", "GET /users/:id").
+		HasKV("Controller", "/users/:id").
+		HasKV("Action", "GET").
+		HasKV("Status", http.StatusAccepted).
+		HasKV("URL", "/users/123")
+	assert.Equal(t, xt, tr.Span("fiber").Exit.XTrace)
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	r := aotest.NewReporter()
+	resp, body := serve(t, newApp(t), httptest.NewRequest("GET", "/error", nil))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "oops", body)
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("fiber").
+		HasKV("Status", http.StatusBadRequest).
+		HasError("oops")
+
+	// the headers written by fiber are kept
+	r = aotest.NewReporter()
+	resp, _ = serve(t, newApp(t), httptest.NewRequest("GET", "/header", nil))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "a=1", resp.Header.Get("Set-Cookie"))
+	assert.NotEmpty(t, resp.Header.Get(ao.HTTPHeaderName))
+	r.Close(2)
+	r.Trace(t).AssertTree().Span("fiber").HasKV("Status", http.StatusCreated)
+
+	// no route, named by the URL path
+	r = aotest.NewReporter()
+	resp, _ = serve(t, newApp(t), httptest.NewRequest("GET", "/none", nil))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	r.Close(2)
+	r.Trace(t).AssertTree().Span("fiber").
+		HasKV("Status", http.StatusNotFound).
+		HasKV("TransactionName", "/none")
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	r := aotest.NewReporter()
+	resp, _ := serve(t, newApp(t), httptest.NewRequest("GET", "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("fiber").
+		HasKV("TransactionName", "GET /panic").
+		HasError("oops")
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	r := aotest.NewReporter()
+	tr := ao.NewTrace("client")
+	req := httptest.NewRequest("GET", "/users/123", nil)
+	req.Header.Set(ao.HTTPHeaderName, tr.ExitMetadata())
+	resp, _ := serve(t, newApp(t), req)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	tr.End()
+	r.Close(4)
+	r.Trace(t).AssertTree().Span("client").HasChild("fiber")
+}
+
+func TestContextNotTraced(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) {
+		assert.False(t, ao.TraceFromContext(aofiber.Context(c)).IsSampled())
+		c.SendStatus(http.StatusOK)
+	})
+	resp, _ := serve(t, app, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
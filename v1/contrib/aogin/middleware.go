@@ -0,0 +1,116 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package aogin provides the AppOptics instrumentation for the gin web
+// framework.
+package aogin
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/gin-gonic/gin"
+)
+
+const spanName = "gin"
+
+// Middleware returns a middleware which traces the requests handled by a gin
+// engine. The transactions are named by the method and the path of the
+// matched route, e.g., "GET /users/:id". The Controller is the route path and
+// the Action is the name of the handler. The panics and the errors attached
+// to the gin context are reported, and the trace is propagated to the
+// handlers through c.Request.Context().
+//   r := gin.New()
+//   r.Use(aogin.Middleware())
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ao.Disabled() || ao.AgentFromContext(c.Request.Context()).Closed() {
+			c.Next()
+			return
+		}
+
+		t, w, r := ao.TraceFromHTTPRequestResponse(spanName, c.Writer, c.Request)
+		aoWriter := ao.HTTPResponseWriterOf(w)
+		c.Request = r
+		c.Writer = &responseWriter{ResponseWriter: c.Writer, w: w, ao: aoWriter}
+
+		defer func() {
+			var endArgs []interface{}
+			if path := c.FullPath(); path != "" {
+				ao.SetFrameworkTransactionName(r.Context(), r.Method+" "+path)
+				endArgs = append(endArgs, "Controller", path, "Action", c.HandlerName())
+			}
+			// gin may write the status without calling the writer, e.g., 404
+			aoWriter.StatusCode = c.Writer.Status()
+			t.End(endArgs...)
+		}()
+
+		defer func() { // catch and report panic, if one occurs
+			if err := recover(); err != nil {
+				t.Error("panic", fmt.Sprintf("%v", err))
+				panic(err) // re-raise the panic
+			}
+		}()
+		c.Next()
+
+		for _, err := range c.Errors {
+			t.Error("error", err.Error())
+		}
+	}
+}
+
+// responseWriter is a gin.ResponseWriter which observes the response by the
+// writer of ao, e.g., the status code and the bytes written, and sets the
+// X-Trace header. The other methods are served by the writer of gin.
+type responseWriter struct {
+	gin.ResponseWriter
+	// the writer of ao wrapping the one of gin
+	w  http.ResponseWriter
+	ao *ao.HTTPResponseWriter
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *responseWriter) WriteHeader(status int) {
+	w.ao.WriteHeader(status)
+}
+
+// writeHeader lets the writer of ao observe the status of gin, which is
+// written with the body.
+func (w *responseWriter) writeHeader() {
+	if !w.ao.WroteHeader {
+		w.ao.WriteHeader(w.ResponseWriter.Status())
+	}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.writeHeader()
+	return w.ao.Write(p)
+}
+
+// WriteString implements the gin.ResponseWriter interface.
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.writeHeader()
+	n, err := w.ResponseWriter.WriteString(s)
+	w.ao.BytesWritten += int64(n)
+	return n, err
+}
+
+// WriteHeaderNow implements the gin.ResponseWriter interface.
+func (w *responseWriter) WriteHeaderNow() {
+	w.writeHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush implements the http.Flusher interface.
+func (w *responseWriter) Flush() {
+	w.writeHeader()
+	w.w.(http.Flusher).Flush()
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.w.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aogin_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
+	"github.com/appoptics/appoptics-apm-go/v1/contrib/aogin"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func getUser(c *gin.Context) {
+	c.String(http.StatusAccepted, "user %s", c.Param("id"))
+}
+
+func newEngine(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(aogin.Middleware())
+	r.GET("/users/:id", func(c *gin.Context) {
+		assert.True(t, ao.TraceFromContext(c.Request.Context()).IsSampled())
+		getUser(c)
+	})
+	r.GET("/error", func(c *gin.Context) {
+		c.Error(errors.New("oops"))
+		c.AbortWithStatus(http.StatusBadRequest)
+	})
+	r.GET("/flush", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+		c.Writer.Flush()
+	})
+	r.GET("/panic", func(c *gin.Context) { panic("oops") })
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	r := aotest.NewReporter()
+	w := httptest.NewRecorder()
+	newEngine(t).ServeHTTP(w, httptest.NewRequest("GET", "/users/123", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "user 123", w.Body.String())
+	xt := w.Header().Get(ao.HTTPHeaderName)
+	assert.NotEmpty(t, xt)
+	r.Close(2)
+	tr := r.Trace(t).AssertTree().NoError()
+	tr.Span("gin").
+		HasKV("TransactionName", "GET /users/:id").
+		HasKV("Controller", "/users/:id").
+		HasKV("Status", http.StatusAccepted).
+		HasKey("Action")
+	assert.Equal(t, xt, tr.Span("gin").Exit.XTrace)
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	r := aotest.NewReporter()
+	w := httptest.NewRecorder()
+	newEngine(t).ServeHTTP(w, httptest.NewRequest("GET", "/error", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("gin").
+		HasKV("Status", http.StatusBadRequest).
+		HasError("oops")
+
+	// the status written by the writer of gin is observed
+	r = aotest.NewReporter()
+	w = httptest.NewRecorder()
+	newEngine(t).ServeHTTP(w, httptest.NewRequest("GET", "/flush", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.True(t, w.Flushed)
+	assert.NotEmpty(t, w.Header().Get(ao.HTTPHeaderName))
+	r.Close(2)
+	r.Trace(t).AssertTree().Span("gin").HasKV("Status", http.StatusCreated)
+
+	// no route, named by the URL path
+	r = aotest.NewReporter()
+	w = httptest.NewRecorder()
+	newEngine(t).ServeHTTP(w, httptest.NewRequest("GET", "/none", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	r.Close(2)
+	r.Trace(t).AssertTree().Span("gin").
+		HasKV("Status", http.StatusNotFound).
+		HasKV("TransactionName", "/none")
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	r := aotest.NewReporter()
+	assert.Panics(t, func() {
+		newEngine(t).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("gin").
+		HasKV("TransactionName", "GET /panic").
+		HasError("oops")
+}
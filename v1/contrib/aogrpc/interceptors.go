@@ -3,6 +3,7 @@ package aogrpc
 import (
 	"fmt"
 	"io"
+	"net"
 	fp "path/filepath"
 	"strings"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 func actionFromMethod(method string) string {
@@ -65,21 +67,60 @@ func getTopFramePkg(st StackTracer) (string, error) {
 	return fp.Base(fp.Dir(frames[1])), nil
 }
 
+// metadataValue returns the first value of the key in the metadata.
+func metadataValue(md metadata.MD, key string) string {
+	if v, ok := md[key]; ok && len(v) > 0 {
+		return v[0]
+	} else if v, ok = md[strings.ToLower(key)]; ok && len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// appendTraceContext appends the trace ID, and its signature if it's signed, to
+// the outgoing metadata of the RPC to the target.
+func appendTraceContext(ctx context.Context, target, xtID string) context.Context {
+	ctx = metadata.AppendToOutgoingContext(ctx, ao.HTTPHeaderName, xtID)
+	if sig := ao.SignTraceID(xtID, targetHost(target)); sig != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, ao.HTTPSignatureHeaderName, sig)
+	}
+	return ctx
+}
+
+// targetHost returns the host of the dial target, e.g., "dns:///example.com:443".
+func targetHost(target string) string {
+	if i := strings.Index(target, "://"); i >= 0 {
+		target = target[i+len("://"):]
+		if i = strings.LastIndex(target, "/"); i >= 0 {
+			target = target[i+1:]
+		}
+	}
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		return host
+	}
+	return target
+}
+
 func tracingContext(ctx context.Context, serverName string, methodName string, statusCode *int) (context.Context, ao.Trace) {
 
 	action := actionFromMethod(methodName)
 
 	xtID := ""
+	var src ao.TraceSource
 	md, ok := metadata.FromIncomingContext(ctx)
 	if ok {
-		if xt, ok := md[ao.HTTPHeaderName]; ok {
-			xtID = xt[0]
-		} else if xt, ok = md[strings.ToLower(ao.HTTPHeaderName)]; ok {
-			xtID = xt[0]
+		xtID = metadataValue(md, ao.HTTPHeaderName)
+		src.Signature = metadataValue(md, ao.HTTPSignatureHeaderName)
+		src.ForwardedFor = md["x-forwarded-for"]
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		src.Peer = p.Addr.String()
+		if host, _, err := net.SplitHostPort(src.Peer); err == nil {
+			src.Peer = host
 		}
 	}
 
-	t := ao.NewTraceFromID(serverName, xtID, func() ao.KVMap {
+	t := ao.AgentFromContext(ctx).NewTraceFromSource(serverName, xtID, src, func() ao.KVMap {
 		return ao.KVMap{
 			"Method":     "POST",
 			"Controller": serverName,
@@ -183,7 +224,7 @@ func UnaryClientInterceptor(target string, serviceName string) grpc.UnaryClientI
 		defer span.End()
 		xtID := span.MetadataString()
 		if len(xtID) > 0 {
-			ctx = metadata.AppendToOutgoingContext(ctx, ao.HTTPHeaderName, xtID)
+			ctx = appendTraceContext(ctx, target, xtID)
 		}
 		err := invoker(ctx, method, req, resp, cc, opts...)
 		if err != nil {
@@ -204,7 +245,7 @@ func StreamClientInterceptor(target string, serviceName string) grpc.StreamClien
 		xtID := span.MetadataString()
 		// lg.Debug("stream client interceptor", "x-trace", xtID)
 		if len(xtID) > 0 {
-			ctx = metadata.AppendToOutgoingContext(ctx, ao.HTTPHeaderName, xtID)
+			ctx = appendTraceContext(ctx, target, xtID)
 		}
 		clientStream, err := streamer(ctx, desc, cc, method, opts...)
 		if err != nil {
@@ -1,12 +1,20 @@
 package aogrpc
 
 import (
+	"net"
+	"strings"
 	"testing"
 
+	"golang.org/x/net/context"
+
 	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
 	"github.com/appoptics/appoptics-apm-go/v1/contrib/aogrpc/mocks"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 func TestGetTopFramePkg(t *testing.T) {
@@ -54,3 +62,40 @@ func TestGetTopFramePkg(t *testing.T) {
 	}
 
 }
+
+func TestTracingContextTrust(t *testing.T) {
+	const md = "2B0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456701"
+	require.NoError(t, ao.UpdateConfig(ao.WithTrustedTraceSources("10.0.0.0/8")))
+	defer ao.UpdateConfig(ao.WithTrustedTraceSources(), ao.WithTraceContextSecret(""))
+
+	continues := func(peerAddr string, kvs ...string) bool {
+		r := aotest.NewReporter()
+		ctx := metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(append([]string{ao.HTTPHeaderName, md}, kvs...)...))
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(peerAddr), Port: 1234}})
+		status := 200
+		_, tr := tracingContext(ctx, "test", "/pkg.Svc/Method", &status)
+		mdStr := tr.MetadataString()
+		tr.End()
+		r.Close(2)
+		return strings.HasPrefix(mdStr, md[:42])
+	}
+
+	// trusted peer
+	assert.True(t, continues("10.1.2.3"))
+	// untrusted peer or proxy, a new trace is started
+	assert.False(t, continues("203.0.113.1"))
+	assert.False(t, continues("10.1.2.3", "x-forwarded-for", "203.0.113.1"))
+
+	// signed by the shared secret
+	require.NoError(t, ao.UpdateConfig(ao.WithTraceContextSecret("secret")))
+	assert.True(t, continues("203.0.113.1", ao.HTTPSignatureHeaderName, ao.SignTraceID(md, "")))
+	assert.False(t, continues("203.0.113.1", ao.HTTPSignatureHeaderName, "ts=1;sig=bad"))
+}
+
+func TestTargetHost(t *testing.T) {
+	assert.Equal(t, "example.com", targetHost("example.com:443"))
+	assert.Equal(t, "example.com", targetHost("dns:///example.com:443"))
+	assert.Equal(t, "example.com", targetHost("example.com"))
+	assert.Equal(t, "::1", targetHost("[::1]:50051"))
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package aohttprouter provides the AppOptics instrumentation for the
+// julienschmidt/httprouter router.
+package aohttprouter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/julienschmidt/httprouter"
+)
+
+const spanName = "httprouter"
+
+// Router is an httprouter.Router which traces the requests of the handles
+// registered by its methods.
+//   r := aohttprouter.New()
+//   r.GET("/users/:id", getUser)
+type Router struct {
+	*httprouter.Router
+}
+
+// New returns a new initialized Router.
+func New() *Router {
+	return &Router{httprouter.New()}
+}
+
+// GET is a shortcut for router.Handle("GET", path, handle)
+func (r *Router) GET(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodGet, path, handle)
+}
+
+// HEAD is a shortcut for router.Handle("HEAD", path, handle)
+func (r *Router) HEAD(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodHead, path, handle)
+}
+
+// OPTIONS is a shortcut for router.Handle("OPTIONS", path, handle)
+func (r *Router) OPTIONS(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodOptions, path, handle)
+}
+
+// POST is a shortcut for router.Handle("POST", path, handle)
+func (r *Router) POST(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPost, path, handle)
+}
+
+// PUT is a shortcut for router.Handle("PUT", path, handle)
+func (r *Router) PUT(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPut, path, handle)
+}
+
+// PATCH is a shortcut for router.Handle("PATCH", path, handle)
+func (r *Router) PATCH(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodPatch, path, handle)
+}
+
+// DELETE is a shortcut for router.Handle("DELETE", path, handle)
+func (r *Router) DELETE(path string, handle httprouter.Handle) {
+	r.Handle(http.MethodDelete, path, handle)
+}
+
+// Handle registers a new traced request handle with the given path and
+// method, see Wrap.
+func (r *Router) Handle(method, path string, handle httprouter.Handle) {
+	r.Router.Handle(method, path, Wrap(method, path, handle))
+}
+
+// Handler registers an http.Handler as a traced request handle. The params
+// are available in the request's context by httprouter.ParamsFromContext.
+func (r *Router) Handler(method, path string, handler http.Handler) {
+	r.Handle(method, path, func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		if len(ps) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), httprouter.ParamsKey, ps))
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// HandlerFunc registers an http.HandlerFunc as a traced request handle.
+func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	r.Handler(method, path, handler)
+}
+
+// Wrap returns a handle which traces the requests of the handle registered
+// with the method and path. The transactions are named by the method and the
+// path, e.g., "GET /users/:id". The Controller is the path and the Action is
+// the method. The trace is propagated to the handle through the request's
+// context.
+//   router.GET("/users/:id", aohttprouter.Wrap("GET", "/users/:id", getUser))
+func Wrap(method, path string, handle httprouter.Handle) httprouter.Handle {
+	if ao.Disabled() {
+		return handle
+	}
+	txnName := method + " " + path
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if ao.AgentFromContext(r.Context()).Closed() {
+			handle(w, r, ps)
+			return
+		}
+
+		t, w, r := ao.TraceFromHTTPRequestResponse(spanName, w, r)
+		ao.SetFrameworkTransactionName(r.Context(), txnName)
+		defer t.End("Controller", path, "Action", method)
+
+		defer func() { // catch and report panic, if one occurs
+			if err := recover(); err != nil {
+				t.Error("panic", fmt.Sprintf("%v", err))
+				panic(err) // re-raise the panic
+			}
+		}()
+		handle(w, r, ps)
+	}
+}
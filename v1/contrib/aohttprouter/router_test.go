@@ -0,0 +1,59 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aohttprouter_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
+	"github.com/appoptics/appoptics-apm-go/v1/contrib/aohttprouter"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouter(t *testing.T) *aohttprouter.Router {
+	r := aohttprouter.New()
+	r.GET("/users/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		assert.True(t, ao.TraceFromContext(r.Context()).IsSampled())
+		assert.Equal(t, "123", ps.ByName("id"))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	r.HandlerFunc("DELETE", "/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "123", httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	})
+	r.GET("/panic", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) { panic("oops") })
+	return r
+}
+
+func TestRouter(t *testing.T) {
+	r := aotest.NewReporter()
+	w := httptest.NewRecorder()
+	newRouter(t).ServeHTTP(w, httptest.NewRequest("GET", "/users/123", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.NotEmpty(t, w.Header().Get(ao.HTTPHeaderName))
+	r.Close(2)
+	r.Trace(t).AssertTree().NoError().Span("httprouter").
+		HasKV("TransactionName", "GET /users/:id").
+		HasKV("Controller", "/users/:id").
+		HasKV("Action", "GET").
+		HasKV("Status", http.StatusAccepted)
+
+	r = aotest.NewReporter()
+	newRouter(t).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/users/123", nil))
+	r.Close(2)
+	r.Trace(t).AssertTree().Span("httprouter").HasKV("TransactionName", "DELETE /users/:id")
+}
+
+func TestRouterPanic(t *testing.T) {
+	r := aotest.NewReporter()
+	assert.Panics(t, func() {
+		newRouter(t).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("httprouter").
+		HasKV("TransactionName", "GET /panic").
+		HasError("oops")
+}
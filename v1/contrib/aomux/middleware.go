@@ -0,0 +1,56 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+// Package aomux provides the AppOptics instrumentation for the gorilla/mux
+// router.
+package aomux
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/gorilla/mux"
+)
+
+const spanName = "gorilla/mux"
+
+// Middleware traces the requests routed by a gorilla/mux router. The
+// transactions are named by the method and the path template of the matched
+// route, e.g., "GET /users/{id}". The Controller is the path template and the
+// Action is the name of the route, or the method if the route has no name.
+// The trace is propagated to the handlers through the request's context.
+//   r := mux.NewRouter()
+//   r.Use(aomux.Middleware)
+func Middleware(next http.Handler) http.Handler {
+	if ao.Disabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ao.AgentFromContext(r.Context()).Closed() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, w, r := ao.TraceFromHTTPRequestResponse(spanName, w, r)
+		var endArgs []interface{}
+		if route := mux.CurrentRoute(r); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				action := route.GetName()
+				if action == "" {
+					action = r.Method
+				}
+				ao.SetFrameworkTransactionName(r.Context(), r.Method+" "+tmpl)
+				endArgs = append(endArgs, "Controller", tmpl, "Action", action)
+			}
+		}
+		defer t.End(endArgs...)
+
+		defer func() { // catch and report panic, if one occurs
+			if err := recover(); err != nil {
+				t.Error("panic", fmt.Sprintf("%v", err))
+				panic(err) // re-raise the panic
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
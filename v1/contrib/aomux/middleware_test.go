@@ -0,0 +1,60 @@
+// Copyright (C) 2018 Librato, Inc. All rights reserved.
+
+package aomux_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/appoptics/appoptics-apm-go/v1/ao"
+	"github.com/appoptics/appoptics-apm-go/v1/ao/aotest"
+	"github.com/appoptics/appoptics-apm-go/v1/contrib/aomux"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouter(t *testing.T) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(aomux.Middleware)
+	r.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, ao.TraceFromContext(r.Context()).IsSampled())
+		w.WriteHeader(http.StatusCreated)
+	}).Methods("POST").Name("createUser")
+	r.HandleFunc("/users/{id}/orders", func(w http.ResponseWriter, r *http.Request) {})
+	r.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("oops") })
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	r := aotest.NewReporter()
+	w := httptest.NewRecorder()
+	newRouter(t).ServeHTTP(w, httptest.NewRequest("POST", "/users/123", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, w.Header().Get(ao.HTTPHeaderName))
+	r.Close(2)
+	r.Trace(t).AssertTree().NoError().Span("gorilla/mux").
+		HasKV("TransactionName", "POST /users/{id}").
+		HasKV("Controller", "/users/{id}").
+		HasKV("Action", "createUser").
+		HasKV("Status", http.StatusCreated)
+
+	// the action is the method if the route has no name
+	r = aotest.NewReporter()
+	newRouter(t).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/123/orders", nil))
+	r.Close(2)
+	r.Trace(t).AssertTree().Span("gorilla/mux").
+		HasKV("TransactionName", "GET /users/{id}/orders").
+		HasKV("Action", "GET")
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	r := aotest.NewReporter()
+	assert.Panics(t, func() {
+		newRouter(t).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+	r.Close(3)
+	r.Trace(t).AssertTree().Span("gorilla/mux").
+		HasKV("TransactionName", "GET /panic").
+		HasError("oops")
+}